@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"bubble-talk/server/internal/config"
+	"bubble-talk/server/internal/export"
+	"bubble-talk/server/internal/model"
+)
+
+// runExport 实现 `bubbletalk export`：把会话导出为 jsonl/md/vtt/srt/csv。
+//
+// 两种来源：
+//   - -server + -session：向运行中的服务请求 /api/sessions/:id/export（服务端渲染）；
+//   - -in：本地的原始事件 JSONL（即 -format jsonl 的导出结果），可选 -state 提供 SessionState 快照。
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := fs.String("format", "md", "output format: jsonl | md | vtt | srt | csv")
+	in := fs.String("in", "", "timeline events JSONL file (- for stdin)")
+	statePath := fs.String("state", "", "optional SessionState JSON file")
+	configPath := fs.String("config", "", "optional config file for role display names")
+	server := fs.String("server", "", "bubbletalk server base URL, e.g. http://localhost:8080")
+	sessionID := fs.String("session", "", "session id (required with -server)")
+	out := fs.String("o", "-", "output file (- for stdout)")
+	_ = fs.Parse(args)
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	// 输入都确认无误后再创建输出文件，避免出错时留下空文件
+	if *server != "" {
+		if *sessionID == "" {
+			return fmt.Errorf("-session is required with -server")
+		}
+		var buf bytes.Buffer
+		if err := fetchExport(&buf, *server, *sessionID, format); err != nil {
+			return err
+		}
+		return writeOutput(*out, func(w io.Writer) error {
+			_, err := buf.WriteTo(w)
+			return err
+		})
+	}
+	if *in == "" {
+		return fmt.Errorf("either -in or -server is required")
+	}
+
+	sess, err := loadExportSession(*in, *statePath, *configPath)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, func(w io.Writer) error {
+		return export.Write(w, format, sess)
+	})
+}
+
+// writeOutput 打开输出并写入
+func writeOutput(path string, write func(w io.Writer) error) error {
+	w, closeOut, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+	return write(w)
+}
+
+// loadExportSession 从本地文件组装导出输入
+func loadExportSession(in, statePath, configPath string) (*export.Session, error) {
+	r, closeIn, err := openInput(in)
+	if err != nil {
+		return nil, err
+	}
+	defer closeIn()
+	events, err := export.ReadJSONL(r)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", in, err)
+	}
+
+	sess := &export.Session{Events: events}
+	if statePath != "" {
+		data, err := os.ReadFile(statePath)
+		if err != nil {
+			return nil, err
+		}
+		var state model.SessionState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", statePath, err)
+		}
+		sess.State = &state
+		sess.SessionID = state.SessionID
+	}
+	if sess.SessionID == "" && len(events) > 0 {
+		sess.SessionID = events[0].SessionID
+	}
+	if configPath != "" {
+		roles, err := config.LoadRoles(configPath)
+		if err != nil {
+			return nil, err
+		}
+		sess.RoleNames = make(map[string]string, len(roles))
+		for role, profile := range roles {
+			if profile.Name != "" {
+				sess.RoleNames[role] = profile.Name
+			}
+		}
+	}
+	return sess, nil
+}
+
+func fetchExport(w io.Writer, server, sessionID string, format export.Format) error {
+	endpoint := fmt.Sprintf("%s/api/sessions/%s/export?format=%s",
+		strings.TrimRight(server, "/"), url.PathEscape(sessionID), url.QueryEscape(string(format)))
+	resp, err := http.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("export failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func openInput(path string) (io.Reader, func(), error) {
+	if path == "-" {
+		return os.Stdin, func() {}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { _ = f.Close() }, nil
+}
+
+func openOutput(path string) (io.Writer, func(), error) {
+	if path == "" || path == "-" {
+		return os.Stdout, func() {}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { _ = f.Close() }, nil
+}
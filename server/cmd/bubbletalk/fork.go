@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"bubble-talk/server/internal/export"
+	"bubble-talk/server/internal/model"
+)
+
+// overrideFlags fork/import 共用的引擎覆盖参数
+type overrideFlags struct {
+	directorType  *string
+	promptVersion *string
+	llmProvider   *string
+	llmModel      *string
+}
+
+func addOverrideFlags(fs *flag.FlagSet) overrideFlags {
+	return overrideFlags{
+		directorType:  fs.String("director", "", "director type for the new session: beats | segment"),
+		promptVersion: fs.String("prompt-version", "", "actor prompt version (<paths.prompts>/versions/<version>)"),
+		llmProvider:   fs.String("llm-provider", "", "director llm provider"),
+		llmModel:      fs.String("llm-model", "", "director llm model"),
+	}
+}
+
+// overrides 没有任何覆盖时返回 nil（fork 时沿用源会话的覆盖）
+func (f overrideFlags) overrides() *model.SessionOverrides {
+	o := model.SessionOverrides{
+		DirectorType:  *f.directorType,
+		PromptVersion: *f.promptVersion,
+		LLMProvider:   *f.llmProvider,
+		LLMModel:      *f.llmModel,
+	}
+	if o == (model.SessionOverrides{}) {
+		return nil
+	}
+	return &o
+}
+
+// runFork 实现 `bubbletalk fork`：在服务上把已有会话从某个 seq 分叉出新会话。
+func runFork(args []string) error {
+	fs := flag.NewFlagSet("fork", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8080", "bubbletalk server base URL")
+	sessionID := fs.String("session", "", "session id to fork")
+	seq := fs.Int64("seq", 0, "replay up to this timeline seq (0 = all)")
+	ov := addOverrideFlags(fs)
+	_ = fs.Parse(args)
+
+	if *sessionID == "" {
+		return fmt.Errorf("-session is required")
+	}
+	body := map[string]interface{}{"seq": *seq}
+	if o := ov.overrides(); o != nil {
+		body["overrides"] = o
+	}
+	return postSession(serverURL(*server, "/api/sessions/%s/fork", *sessionID), body)
+}
+
+// runImport 实现 `bubbletalk import`：把其他环境的会话导入到服务（可同时在某个 seq 分叉）。
+//
+// 两种来源：
+//   - -from + -session：直接从源服务拉取快照与原始事件；
+//   - -in：本地原始事件 JSONL，配合 -state 或 -entry。
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8080", "target bubbletalk server base URL")
+	from := fs.String("from", "", "source bubbletalk server base URL")
+	sessionID := fs.String("session", "", "source session id (with -from)")
+	in := fs.String("in", "", "timeline events JSONL file (- for stdin)")
+	statePath := fs.String("state", "", "SessionState JSON file (with -in)")
+	entryID := fs.String("entry", "", "bubble entry id on the target server (overrides the source state's)")
+	seq := fs.Int64("seq", 0, "replay up to this timeline seq (0 = all)")
+	ov := addOverrideFlags(fs)
+	_ = fs.Parse(args)
+
+	body := map[string]interface{}{"seq": *seq}
+	if *entryID != "" {
+		body["entry_id"] = *entryID
+	}
+	if o := ov.overrides(); o != nil {
+		body["overrides"] = o
+	}
+
+	switch {
+	case *from != "":
+		if *sessionID == "" {
+			return fmt.Errorf("-session is required with -from")
+		}
+		var state model.SessionState
+		if err := getJSON(serverURL(*from, "/api/sessions/%s", *sessionID), &state); err != nil {
+			return fmt.Errorf("fetch session: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := fetchExport(&buf, *from, *sessionID, export.FormatJSONL); err != nil {
+			return fmt.Errorf("fetch timeline: %w", err)
+		}
+		events, err := export.ReadJSONL(&buf)
+		if err != nil {
+			return err
+		}
+		body["state"] = state
+		body["events"] = events
+	case *in != "":
+		sess, err := loadExportSession(*in, *statePath, "")
+		if err != nil {
+			return err
+		}
+		if sess.State == nil && *entryID == "" {
+			return fmt.Errorf("-state or -entry is required with -in")
+		}
+		if sess.State != nil {
+			body["state"] = sess.State
+		}
+		body["events"] = sess.Events
+	default:
+		return fmt.Errorf("either -from or -in is required")
+	}
+	return postSession(strings.TrimRight(*server, "/")+"/api/sessions/import", body)
+}
+
+// postSession 发请求并把新会话的 ID 与谱系打印出来
+func postSession(endpoint string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var created model.CreateSessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return err
+	}
+	out, _ := json.MarshalIndent(map[string]interface{}{
+		"session_id": created.SessionID,
+		"lineage":    created.State.Lineage,
+		"overrides":  created.State.Overrides,
+		"turns":      len(created.State.Turns),
+	}, "", "  ")
+	_, err = fmt.Fprintln(os.Stdout, string(out))
+	return err
+}
+
+func getJSON(endpoint string, v interface{}) error {
+	resp, err := http.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func serverURL(base, pathFormat, sessionID string) string {
+	return strings.TrimRight(base, "/") + fmt.Sprintf(pathFormat, url.PathEscape(sessionID))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"bubble-talk/server/internal/api"
 	"bubble-talk/server/internal/config"
@@ -12,7 +13,25 @@ import (
 	"bubble-talk/server/internal/timeline"
 )
 
+// subcommands 离线/运维子命令
+var subcommands = map[string]func(args []string) error{
+	"export": runExport,
+	"fork":   runFork,
+	"import": runImport,
+	"replay": runReplay,
+}
+
 func main() {
+	// 子命令：离线工具；不带子命令时启动服务
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
 	// 第一阶段以"本地可跑、可调试"为优先：参数用 flag，敏感信息（OpenAI API Key）用环境变量。
 	// - OPENAI_API_KEY：用于签发 Realtime ephemeral key（不要放到前端）
 	// - OPENAI_REALTIME_MODEL / OPENAI_REALTIME_VOICE：可选，便于你在本地快速切换模型/音色
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"bubble-talk/server/internal/config"
+	"bubble-talk/server/internal/domain"
+	"bubble-talk/server/internal/export"
+	"bubble-talk/server/internal/model"
+	"bubble-talk/server/internal/orchestrator"
+	"bubble-talk/server/internal/replay"
+)
+
+// runReplay 实现 `bubbletalk replay`：把录制会话的用户轮次重新喂给选定的导演，
+// 逐轮对比新计划与录制的 director_plan，输出可读差异（-o）与 JSON 摘要（-json）。
+//
+// 两种来源（与 import 相同）：
+//   - -from + -session：从服务拉取快照与原始事件；
+//   - -in：本地原始事件 JSONL，配合 -state 或 -entry（导演需要泡泡与角色信息）。
+//
+// 导演默认按快照里记录的覆盖（分叉会话的导演/LLM）构建，命令行参数再覆盖其中的对应项。
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := fs.String("config", "server/configs/config.yaml", "config file path (director, llm, scripts)")
+	from := fs.String("from", "", "source bubbletalk server base URL")
+	sessionID := fs.String("session", "", "source session id (with -from)")
+	in := fs.String("in", "", "timeline events JSONL file (- for stdin)")
+	statePath := fs.String("state", "", "SessionState JSON file (with -in)")
+	entryID := fs.String("entry", "", "bubble entry id from the config's bubbles (with -in, overrides the state's)")
+	directorType := fs.String("director", "", "director to replay with: beats | segment (default: recorded override, then config)")
+	llmProvider := fs.String("llm-provider", "", "director llm provider")
+	llmModel := fs.String("llm-model", "", "director llm model")
+	rulesOnly := fs.Bool("rules", false, "disable the director llm (rule-based decisions only)")
+	all := fs.Bool("all", false, "list unchanged turns in the diff too")
+	out := fs.String("o", "-", "diff output file (- for stdout)")
+	jsonOut := fs.String("json", "", "write the JSON summary to this file (- for stdout)")
+	_ = fs.Parse(args)
+
+	if *directorType != "" && *directorType != "beats" && *directorType != "segment" {
+		return fmt.Errorf("-director must be beats or segment")
+	}
+
+	if *from == "" && *in != "" && *statePath == "" && *entryID == "" {
+		return fmt.Errorf("-state or -entry is required with -in")
+	}
+
+	cfg, err := config.LoadOffline(*configPath)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	if *rulesOnly {
+		cfg.Director.EnableLLM = false
+	}
+
+	snapshot, events, err := loadReplaySession(*from, *sessionID, *in, *statePath)
+	if err != nil {
+		return err
+	}
+	if *entryID != "" {
+		if err := applyEntry(snapshot, cfg, *entryID); err != nil {
+			return err
+		}
+	}
+
+	// 录制时的覆盖（分叉会话）是基线，命令行参数只替换显式给出的项
+	var overrides model.SessionOverrides
+	if snapshot.Overrides != nil {
+		overrides = *snapshot.Overrides
+	}
+	// 回放只比较导演决策，用不到 Actor 的 Prompt 版本
+	overrides.PromptVersion = ""
+	if *directorType != "" {
+		overrides.DirectorType = *directorType
+	}
+	if *llmProvider != "" {
+		overrides.LLMProvider = *llmProvider
+	}
+	if *llmModel != "" {
+		overrides.LLMModel = *llmModel
+	}
+	dir, _, err := orchestrator.ConfigEngineFactory(cfg)(overrides)
+	if err != nil {
+		return err
+	}
+
+	report := replay.Run(context.Background(), dir, replay.InitialState(snapshot), events)
+	report.Director = directorName(cfg, overrides.DirectorType)
+
+	w, closeOut, err := openOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+	if err := replay.WriteDiff(w, report, *all); err != nil {
+		return err
+	}
+
+	if *jsonOut != "" {
+		jw, closeJSON, err := openOutput(*jsonOut)
+		if err != nil {
+			return err
+		}
+		defer closeJSON()
+		enc := json.NewEncoder(jw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadReplaySession 取回放输入：会话快照（没有时只带 SessionID）与原始事件
+func loadReplaySession(from, sessionID, in, statePath string) (*model.SessionState, []model.Event, error) {
+	switch {
+	case from != "":
+		if sessionID == "" {
+			return nil, nil, fmt.Errorf("-session is required with -from")
+		}
+		var state model.SessionState
+		if err := getJSON(serverURL(from, "/api/sessions/%s", sessionID), &state); err != nil {
+			return nil, nil, fmt.Errorf("fetch session: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := fetchExport(&buf, from, sessionID, export.FormatJSONL); err != nil {
+			return nil, nil, fmt.Errorf("fetch timeline: %w", err)
+		}
+		events, err := export.ReadJSONL(&buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &state, events, nil
+	case in != "":
+		sess, err := loadExportSession(in, statePath, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		if sess.State != nil {
+			return sess.State, sess.Events, nil
+		}
+		return &model.SessionState{SessionID: sess.SessionID}, sess.Events, nil
+	default:
+		return nil, nil, fmt.Errorf("either -from or -in is required")
+	}
+}
+
+// applyEntry 用配置里的泡泡补齐快照的泡泡与角色信息（与 import 的 -entry 一致）
+func applyEntry(snapshot *model.SessionState, cfg *config.Config, entryID string) error {
+	bubbles, err := domain.LoadBubbles(cfg.Paths.Bubbles)
+	if err != nil {
+		return err
+	}
+	for _, b := range bubbles {
+		if b.EntryID == entryID {
+			snapshot.EntryID = b.EntryID
+			snapshot.Domain = b.Domain
+			snapshot.MainObjective = b.Title
+			snapshot.AvailableRoles = b.Roles
+			return nil
+		}
+	}
+	return fmt.Errorf("entry %q not found in %s", entryID, cfg.Paths.Bubbles)
+}
+
+// directorName 与 director.NewDirector 的选择一致：beats 以外都是片段导演
+func directorName(cfg *config.Config, override string) string {
+	if override != "" {
+		return override
+	}
+	if strings.ToLower(strings.TrimSpace(cfg.Director.Type)) == "beats" {
+		return "beats"
+	}
+	return "segment"
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bubble-talk/server/internal/gateway"
+	"bubble-talk/server/internal/model"
+	"bubble-talk/server/internal/session"
+	"bubble-talk/server/internal/timeline"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SSE 输出通道（GET /api/sessions/:id/events/stream）：给屏蔽 WebSocket 的环境（企业代理、部分小程序 webview）用，
+// 输入仍走 POST /api/sessions/:id/events。打开 SSE 的会话里，用户消息交给会话的网关（没有时创建无头文本网关），
+// 与 WebSocket 文本模式走同一条 HandleUserUtterance 路径；最后一个 SSE 订阅者断开时关闭无头网关。
+//
+// 下发两类事件：
+//   - event: timeline —— Timeline 事件（model.Event），id 为 timeline seq；断线重连时浏览器带回 Last-Event-ID，
+//     从该 seq 之后补发；
+//   - event: <type> —— 不落 Timeline 的实时消息（字幕增量、文本增量、quiz_show），没有 id，断线期间的不补发。
+
+const (
+	// sseHeartbeatInterval 心跳注释间隔，防止代理因空闲断开
+	sseHeartbeatInterval = 15 * time.Second
+	// sseLiveBuffer 每个订阅者的实时消息缓冲，写满后丢弃（慢消费者不拖慢网关）
+	sseLiveBuffer = 256
+)
+
+// sseLiveEvent 是否把网关下发的消息旁路给 SSE：只要不落 Timeline 的实时消息，落 Timeline 的走 timeline 事件
+func sseLiveEvent(msg gateway.ServerMessage) bool {
+	switch msg.Type {
+	case gateway.EventTypeAssistantTextDelta, gateway.EventTypeQuizShow:
+		return true
+	case gateway.EventTypeCaption:
+		// final 字幕会作为 caption 事件落 Timeline
+		return msg.Caption != nil && msg.Caption.Kind != "final"
+	default:
+		return false
+	}
+}
+
+// outputHub 按 session 把网关的实时消息分发给 SSE 订阅者
+type outputHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan gateway.ServerMessage]struct{}
+}
+
+func newOutputHub() *outputHub {
+	return &outputHub{subs: make(map[string]map[chan gateway.ServerMessage]struct{})}
+}
+
+// subscribe 订阅某个 session 的实时消息，返回的函数用于退订
+func (h *outputHub) subscribe(sessionID string) (<-chan gateway.ServerMessage, func()) {
+	ch := make(chan gateway.ServerMessage, sseLiveBuffer)
+	h.mu.Lock()
+	if h.subs[sessionID] == nil {
+		h.subs[sessionID] = make(map[chan gateway.ServerMessage]struct{})
+	}
+	h.subs[sessionID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs[sessionID], ch)
+		if len(h.subs[sessionID]) == 0 {
+			delete(h.subs, sessionID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// subscribers 某个 session 当前的 SSE 订阅者数量
+func (h *outputHub) subscribers(sessionID string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[sessionID])
+}
+
+// observer 返回挂到网关上的 OutputObserver：非阻塞投递，订阅者缓冲满时丢弃
+func (h *outputHub) observer(sessionID string) gateway.OutputObserver {
+	return func(msg gateway.ServerMessage) {
+		if !sseLiveEvent(msg) {
+			return
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for ch := range h.subs[sessionID] {
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	}
+}
+
+// parseLastEventID 解析 Last-Event-ID（EventSource 重连时自动带上）；不能设置请求头的客户端可用 last_event_id 查询参数
+func parseLastEventID(header, query string) (int64, error) {
+	raw := strings.TrimSpace(header)
+	if raw == "" {
+		raw = strings.TrimSpace(query)
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("invalid Last-Event-ID: %q", raw)
+	}
+	return seq, nil
+}
+
+// handleSessionEventStream 处理 GET /api/sessions/:id/events/stream
+func (s *Server) handleSessionEventStream(c *gin.Context) {
+	sessionID := c.Param("id")
+	ctx := c.Request.Context()
+
+	if _, err := s.store.Get(ctx, sessionID); err != nil {
+		if err == session.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load session failed"})
+		return
+	}
+	lastSeq, err := parseLastEventID(c.GetHeader("Last-Event-ID"), c.Query("last_event_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 先订阅实时消息再订阅 Timeline（补发历史），避免两者之间的消息丢失
+	live, unsubscribe := s.outputs.subscribe(sessionID)
+	defer func() {
+		unsubscribe()
+		s.releaseHeadlessGateway(sessionID)
+	}()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭 nginx 等反向代理的响应缓冲
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	log.Printf("[API] 📡 SSE stream opened for session %s (last_event_id=%d)", sessionID, lastSeq)
+	defer log.Printf("[API] SSE stream closed for session %s", sessionID)
+
+	sub, err := s.timelineWatch.Subscribe(ctx, sessionID, lastSeq)
+	if err != nil {
+		log.Printf("[API] ⚠️  SSE subscribe timeline failed for session %s: %v", sessionID, err)
+		return
+	}
+	defer func() { sub.Close() }()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-sub.Events():
+			if !ok {
+				// 写出太慢被 Hub 断开：从最后下发的 seq 重新订阅补齐
+				if !errors.Is(sub.Err(), timeline.ErrSlowConsumer) {
+					return
+				}
+				log.Printf("[API] ⚠️  SSE consumer too slow for session %s, resubscribing from seq %d", sessionID, lastSeq)
+				if sub, err = s.timelineWatch.Subscribe(ctx, sessionID, lastSeq); err != nil {
+					return
+				}
+				continue
+			}
+			if err := writeSSE(c, strconv.FormatInt(evt.Seq, 10), "timeline", evt); err != nil {
+				return
+			}
+			lastSeq = evt.Seq
+		case msg := <-live:
+			if err := writeSSE(c, "", string(msg.Type), msg); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// errTextOutputUnavailable 没有配置 LLM，无法为 SSE 客户端生成角色发言
+var errTextOutputUnavailable = errors.New("text output requires an llm provider")
+
+// sseUserInput POST /events 中需要角色回应的用户输入
+func sseUserInput(eventType string) bool {
+	return eventType == string(gateway.EventTypeUserMessage) || eventType == string(gateway.EventTypeASRFinal)
+}
+
+// handleSSEUserInput 打开了 SSE 的会话收到用户输入：交给会话的网关，角色发言经 outputHub 与 Timeline 下发到 SSE。
+// 立即返回 202，不等角色说完。
+func (s *Server) handleSSEUserInput(c *gin.Context, sessionID string, evt model.Event) {
+	text := strings.TrimSpace(evt.Text)
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		return
+	}
+
+	gw, err := s.sseGateway(c.Request.Context(), sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, session.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		case errors.Is(err, errTextOutputUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "start gateway failed"})
+		}
+		return
+	}
+
+	if textGW, ok := gw.(*gateway.TextGateway); ok {
+		// 经文本网关的输入路径：打断正在生成的发言、记入对话历史，再排队交给 Orchestrator
+		err = textGW.HandleClientMessage(&gateway.ClientMessage{
+			Type:     gateway.EventTypeUserMessage,
+			EventID:  evt.EventID,
+			Text:     text,
+			ClientTS: evt.ClientTS,
+		})
+	} else {
+		err = s.orchestrator.HandleUserUtterance(c.Request.Context(), sessionID, text, gw)
+	}
+	if err != nil {
+		log.Printf("[API] ❌ SSE user input failed for session %s: %v", sessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "handle event failed"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "accepted"})
+}
+
+// sseGateway 返回会话当前的网关；没有时创建并登记一个无头文本网关
+func (s *Server) sseGateway(ctx context.Context, sessionID string) (interface{}, error) {
+	if gw := s.activeGateway(sessionID); gw != nil {
+		return gw, nil
+	}
+	state, err := s.store.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if s.textLLM == nil {
+		return nil, errTextOutputUnavailable
+	}
+
+	gw := s.newTextGateway(ctx, sessionID, state, nil)
+	if err := gw.Start(context.Background()); err != nil {
+		return nil, err
+	}
+
+	s.gatewaysMu.Lock()
+	if existing := s.gateways[sessionID]; existing != nil {
+		// 并发的另一个请求先建好了
+		s.gatewaysMu.Unlock()
+		_ = gw.Close()
+		return existing, nil
+	}
+	s.gateways[sessionID] = gw
+	s.gatewaysMu.Unlock()
+
+	go func() {
+		<-gw.Done()
+		s.unregisterGateway(sessionID, gw)
+	}()
+	log.Printf("[API] ✅ Headless text gateway started for SSE session %s", sessionID)
+	return gw, nil
+}
+
+// releaseHeadlessGateway 会话没有 SSE 订阅者后关闭它的无头文本网关
+func (s *Server) releaseHeadlessGateway(sessionID string) {
+	if s.outputs.subscribers(sessionID) > 0 {
+		return
+	}
+	if gw, ok := s.activeGateway(sessionID).(*gateway.TextGateway); ok && gw.Headless() {
+		log.Printf("[API] 🔌 Closing headless text gateway for session %s", sessionID)
+		_ = gw.Close()
+	}
+}
+
+// handleTimelineFirehose 处理 GET /api/debug/timeline/stream：所有 session 新写入的 Timeline 事件（看板/调试用，不补发历史）
+// 没有访问控制，只在 server.debug_timeline_stream 打开时注册（见 Routes）
+func (s *Server) handleTimelineFirehose(c *gin.Context) {
+	ctx := c.Request.Context()
+	sub, err := s.timelineWatch.SubscribeAll(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "subscribe timeline failed"})
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case evt, ok := <-sub.Events():
+			if !ok {
+				// 消费过慢被断开时直接结束，由客户端重连
+				if err := sub.Err(); errors.Is(err, timeline.ErrSlowConsumer) {
+					log.Printf("[API] ⚠️  Timeline firehose consumer too slow, closing")
+				}
+				return
+			}
+			if err := writeSSE(c, "", "timeline", evt); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeSSE 写出一个 SSE 事件（id 为空时不带 id，不影响客户端的 Last-Event-ID）
+func writeSSE(c *gin.Context, id string, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", event, data)
+	if _, err := c.Writer.WriteString(b.String()); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
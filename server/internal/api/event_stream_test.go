@@ -0,0 +1,295 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/actor"
+	"bubble-talk/server/internal/config"
+	"bubble-talk/server/internal/gateway"
+	"bubble-talk/server/internal/llm"
+	"bubble-talk/server/internal/model"
+	"bubble-talk/server/internal/orchestrator"
+	"bubble-talk/server/internal/session"
+	"bubble-talk/server/internal/timeline"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseLastEventID(t *testing.T) {
+	cases := []struct {
+		header, query string
+		want          int64
+		wantErr       bool
+	}{
+		{"", "", 0, false},
+		{"12", "", 12, false},
+		{" 7 ", "", 7, false},
+		{"", "5", 5, false},
+		{"3", "9", 3, false}, // 请求头优先
+		{"abc", "", 0, true},
+		{"-1", "", 0, true},
+	}
+	for _, tc := range cases {
+		got, err := parseLastEventID(tc.header, tc.query)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("parseLastEventID(%q, %q) = %d, %v", tc.header, tc.query, got, err)
+		}
+	}
+}
+
+func TestSSELiveEvent(t *testing.T) {
+	cases := []struct {
+		msg  gateway.ServerMessage
+		want bool
+	}{
+		{gateway.ServerMessage{Type: gateway.EventTypeAssistantTextDelta}, true},
+		{gateway.ServerMessage{Type: gateway.EventTypeQuizShow}, true},
+		{gateway.ServerMessage{Type: gateway.EventTypeCaption, Caption: &gateway.Caption{Kind: "partial"}}, true},
+		// 落 Timeline 的消息走 timeline 事件，不重复下发
+		{gateway.ServerMessage{Type: gateway.EventTypeCaption, Caption: &gateway.Caption{Kind: "final"}}, false},
+		{gateway.ServerMessage{Type: gateway.EventTypeCaption}, false},
+		{gateway.ServerMessage{Type: gateway.EventTypeAssistantText}, false},
+		{gateway.ServerMessage{Type: gateway.EventTypeSpeechDropped}, false},
+	}
+	for _, tc := range cases {
+		if got := sseLiveEvent(tc.msg); got != tc.want {
+			t.Errorf("sseLiveEvent(%s %+v) = %v", tc.msg.Type, tc.msg.Caption, got)
+		}
+	}
+}
+
+// newSSETestServer 只带 SSE 所需依赖的 Server：内存会话与 Timeline，director/textLLM 可选
+func newSSETestServer(t *testing.T, dir orchestratorDirector, textLLM llm.Client) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := session.NewInMemoryStore()
+	tl, watcher := watchableTimeline(timeline.NewInMemoryStore())
+	actorEngine, err := actor.NewActorEngine("../../configs/prompts")
+	if err != nil {
+		t.Fatalf("new actor engine: %v", err)
+	}
+	cfg := &config.Config{Roles: map[string]config.RoleProfile{"host": {Voice: "cedar"}}}
+	s := &Server{
+		config:        cfg,
+		store:         store,
+		timeline:      tl,
+		now:           time.Now,
+		orchestrator:  orchestrator.NewWithEngines(store, tl, dir, actorEngine, log.Default()),
+		gateways:      make(map[string]interface{}),
+		textLLM:       textLLM,
+		timelineWatch: watcher,
+		outputs:       newOutputHub(),
+	}
+	if err := store.Save(context.Background(), &model.SessionState{SessionID: "s1", EntryID: "entry", AvailableRoles: []string{"host"}}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	return s
+}
+
+// orchestratorDirector 测试用导演：总是让 host 接话
+type orchestratorDirector struct{}
+
+func (orchestratorDirector) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
+	return model.DirectorPlan{NextRole: "host", Instruction: "Scene Direction: 接住用户的问题"}
+}
+
+// sseFrame 一个 SSE 事件
+type sseFrame struct {
+	id, event, data string
+}
+
+// readSSE 逐个读出 SSE 事件（忽略心跳注释）
+func readSSE(r *bufio.Reader, frames chan<- sseFrame) {
+	var f sseFrame
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			close(frames)
+			return
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if f.event != "" {
+				frames <- f
+			}
+			f = sseFrame{}
+		case strings.HasPrefix(line, "id: "):
+			f.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			f.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			f.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func waitFrame(t *testing.T, frames <-chan sseFrame, match func(sseFrame) bool) sseFrame {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case f, ok := <-frames:
+			if !ok {
+				t.Fatalf("stream closed")
+			}
+			if match(f) {
+				return f
+			}
+		case <-deadline:
+			t.Fatalf("timeout waiting for sse frame")
+		}
+	}
+}
+
+// openSSE 打开 /events/stream，返回逐个事件的 channel
+func openSSE(t *testing.T, url string, lastEventID string) <-chan sseFrame {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/sessions/s1/events/stream", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open sse: %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("sse status = %d", resp.StatusCode)
+	}
+	frames := make(chan sseFrame, 64)
+	go readSSE(bufio.NewReader(resp.Body), frames)
+	return frames
+}
+
+// TestSessionEventStreamResumesFromLastEventID 验证重连带 Last-Event-ID 时只补发之后的 Timeline 事件，
+// 之后写入的事件继续推送，且每条都带 seq 作为 id。
+func TestSessionEventStreamResumesFromLastEventID(t *testing.T) {
+	s := newSSETestServer(t, orchestratorDirector{}, nil)
+	ctx := context.Background()
+	for _, text := range []string{"一", "二", "三"} {
+		if _, err := s.timeline.Append(ctx, "s1", &model.Event{Type: "user_message", Text: text}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	engine := gin.New()
+	engine.GET("/api/sessions/:id/events/stream", s.handleSessionEventStream)
+	srv := httptest.NewServer(engine)
+	t.Cleanup(srv.Close) // 先于 openSSE 注册：Cleanup 倒序执行，SSE 请求取消后再关服务
+
+	frames := openSSE(t, srv.URL, "1")
+	for _, want := range []string{"2", "3"} {
+		f := waitFrame(t, frames, func(f sseFrame) bool { return f.event == "timeline" })
+		if f.id != want {
+			t.Fatalf("resumed frame id = %s, want %s", f.id, want)
+		}
+	}
+
+	if _, err := s.timeline.Append(ctx, "s1", &model.Event{Type: "user_message", Text: "四"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	f := waitFrame(t, frames, func(f sseFrame) bool { return f.event == "timeline" })
+	var evt model.Event
+	if err := json.Unmarshal([]byte(f.data), &evt); err != nil || f.id != "4" || evt.Text != "四" {
+		t.Fatalf("live frame = %+v (%v)", f, err)
+	}
+}
+
+// fixedLLM 文本网关用的假模型：固定回复
+type fixedLLM struct{ reply string }
+
+func (m fixedLLM) Complete(ctx context.Context, messages []llm.Message, schema *llm.JSONSchema) (string, error) {
+	return m.reply, nil
+}
+
+// TestSSEUserInputRoutesThroughHeadlessGateway 验证只连 SSE 的客户端发来的用户消息走 HandleUserUtterance：
+// 由无头文本网关生成角色发言，增量与 Timeline 事件都从 SSE 下发；SSE 断开后无头网关关闭。
+func TestSSEUserInputRoutesThroughHeadlessGateway(t *testing.T) {
+	s := newSSETestServer(t, orchestratorDirector{}, fixedLLM{reply: "好问题，我们先看菜价。"})
+
+	engine := gin.New()
+	engine.POST("/api/sessions/:id/events", s.handleSessionEvents)
+	engine.GET("/api/sessions/:id/events/stream", s.handleSessionEventStream)
+	srv := httptest.NewServer(engine)
+	t.Cleanup(srv.Close)
+
+	frames := openSSE(t, srv.URL, "")
+	deadline := time.Now().Add(5 * time.Second)
+	for s.outputs.subscribers("s1") == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err := http.Post(srv.URL+"/api/sessions/s1/events", "application/json", strings.NewReader(`{"type":"user_message","text":"为什么涨价？"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("post status = %d", resp.StatusCode)
+	}
+
+	delta := waitFrame(t, frames, func(f sseFrame) bool { return f.event == string(gateway.EventTypeAssistantTextDelta) })
+	if !strings.Contains(delta.data, `"role":"host"`) {
+		t.Errorf("delta = %s", delta.data)
+	}
+	waitFrame(t, frames, func(f sseFrame) bool {
+		return f.event == "timeline" && strings.Contains(f.data, `"type":"assistant_text"`) && strings.Contains(f.data, "菜价")
+	})
+	// 不再是固定台词的 stub 路径
+	events, _ := s.timeline.List(context.Background(), "s1")
+	for _, evt := range events {
+		if evt.DirectorPlan != nil && evt.DirectorPlan.NextRole == "Coach" {
+			t.Fatalf("stub plan written: %+v", evt)
+		}
+	}
+
+	gw, ok := s.activeGateway("s1").(*gateway.TextGateway)
+	if !ok || !gw.Headless() {
+		t.Fatalf("active gateway = %T", s.activeGateway("s1"))
+	}
+	unsubscribeAll := func() {
+		s.outputs.mu.Lock()
+		defer s.outputs.mu.Unlock()
+		delete(s.outputs.subs, "s1")
+	}
+	unsubscribeAll()
+	s.releaseHeadlessGateway("s1")
+	select {
+	case <-gw.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("headless gateway not closed")
+	}
+}
+
+// TestTimelineFirehoseRequiresDebugFlag 验证跨会话的 Timeline firehose 只在调试配置打开时注册
+func TestTimelineFirehoseRequiresDebugFlag(t *testing.T) {
+	s := newSSETestServer(t, orchestratorDirector{}, nil)
+	registered := func() bool {
+		for _, r := range s.Routes().(*gin.Engine).Routes() {
+			if r.Path == "/api/debug/timeline/stream" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if registered() {
+		t.Fatal("firehose registered without debug flag")
+	}
+	s.config.Server.DebugTimelineStream = true
+	if !registered() {
+		t.Fatal("firehose not registered with debug flag")
+	}
+}
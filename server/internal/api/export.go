@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"bubble-talk/server/internal/export"
+	"bubble-talk/server/internal/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleSessionExport 处理 GET /api/sessions/:id/export?format=jsonl|md|vtt|srt|csv（默认 jsonl），以附件下载。
+func (s *Server) handleSessionExport(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	format, err := export.ParseFormat(c.DefaultQuery("format", string(export.FormatJSONL)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sess, err := export.Load(c.Request.Context(), s.store, s.timeline, sessionID)
+	if err != nil {
+		if err == session.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load session failed"})
+		return
+	}
+	sess.RoleNames = s.roleNames()
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, sessionID, format))
+	c.Status(http.StatusOK)
+	if err := export.Write(c.Writer, format, sess); err != nil {
+		log.Printf("[API] ❌ Export %s for session %s failed: %v", format, sessionID, err)
+	}
+}
+
+// roleNames 配置里的角色展示名
+func (s *Server) roleNames() map[string]string {
+	names := make(map[string]string, len(s.config.Roles))
+	for role, profile := range s.config.Roles {
+		if profile.Name != "" {
+			names[role] = profile.Name
+		}
+	}
+	return names
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+
+	"bubble-talk/server/internal/model"
+	"bubble-talk/server/internal/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forkRequest POST /api/sessions/:id/fork 的请求体
+type forkRequest struct {
+	// Seq 回放到源 Timeline 的该 seq 为止（含），0 表示全部
+	Seq int64 `json:"seq"`
+	// Overrides 新会话的引擎覆盖，为空时沿用源会话的覆盖
+	Overrides *model.SessionOverrides `json:"overrides,omitempty"`
+}
+
+// importRequest POST /api/sessions/import 的请求体：导出的原始事件（export?format=jsonl 逐行解析）与可选快照
+type importRequest struct {
+	// State 源会话快照，提供泡泡与角色信息；为空时需要 EntryID
+	State *model.SessionState `json:"state,omitempty"`
+	// EntryID 本服务上的泡泡，优先于 State.EntryID
+	EntryID string        `json:"entry_id,omitempty"`
+	Events  []model.Event `json:"events"`
+	forkRequest
+}
+
+// handleSessionState 处理 GET /api/sessions/:id：返回会话快照（导入到其他环境时与 export?format=jsonl 配合使用）
+func (s *Server) handleSessionState(c *gin.Context) {
+	state, err := s.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == session.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load session failed"})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// handleSessionFork 处理 POST /api/sessions/:id/fork：从本服务的会话在某个 seq 分叉出新会话。
+func (s *Server) handleSessionFork(c *gin.Context) {
+	var req forkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+	ctx := c.Request.Context()
+	parentID := c.Param("id")
+
+	parent, err := s.store.Get(ctx, parentID)
+	if err != nil {
+		if err == session.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load session failed"})
+		return
+	}
+	events, err := s.timeline.List(ctx, parentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load timeline failed"})
+		return
+	}
+
+	overrides := req.Overrides
+	if overrides == nil {
+		overrides = parent.Overrides
+	}
+	s.forkSession(c, "fork", parentID, s.sessionBubble(parent), events, req.Seq, overrides)
+}
+
+// handleSessionImport 处理 POST /api/sessions/import：导入其他环境导出的 Timeline，可同时在某个 seq 分叉。
+func (s *Server) handleSessionImport(c *gin.Context) {
+	var req importRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		return
+	}
+
+	var bubble model.Bubble
+	switch {
+	case req.EntryID != "":
+		b, ok := findBubble(s.bubbles, req.EntryID)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "entry_id not found"})
+			return
+		}
+		bubble = b
+	case req.State != nil:
+		bubble = s.sessionBubble(req.State)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state or entry_id required"})
+		return
+	}
+
+	parentID := ""
+	if req.State != nil {
+		parentID = req.State.SessionID
+	} else if len(req.Events) > 0 {
+		parentID = req.Events[0].SessionID
+	}
+	s.forkSession(c, "import", parentID, bubble, req.Events, req.Seq, req.Overrides)
+}
+
+// forkSession 创建新会话并交给 Orchestrator 回放源事件，响应新会话快照
+func (s *Server) forkSession(c *gin.Context, source, parentID string, bubble model.Bubble, events []model.Event, seq int64, overrides *model.SessionOverrides) {
+	if seq < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "seq must be >= 0"})
+		return
+	}
+	if overrides != nil && overrides.DirectorType != "" && overrides.DirectorType != "beats" && overrides.DirectorType != "segment" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "director_type must be beats or segment"})
+		return
+	}
+	// 覆盖在这里就构建一次：无效的 Prompt 版本/LLM 配置直接拒绝，而不是建好会话后每轮悄悄退回默认引擎
+	if err := s.orchestrator.PrepareEngines(overrides); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid overrides: " + err.Error()})
+		return
+	}
+
+	now := s.now()
+	state := newSessionState(bubble, newSessionID(), now)
+	state.Overrides = overrides
+	state.Lineage = &model.SessionLineage{
+		Source:          source,
+		ParentSessionID: parentID,
+		ForkSeq:         seq,
+	}
+
+	if err := s.orchestrator.ForkSession(c.Request.Context(), &state, events, seq); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "fork session failed"})
+		return
+	}
+	c.JSON(http.StatusOK, model.CreateSessionResponse{
+		SessionID: state.SessionID,
+		State:     state,
+		Diagnose:  defaultDiagnose(),
+	})
+}
+
+// sessionBubble 取会话所属泡泡；本服务没有该泡泡时（导入自其他环境）用快照里的字段拼一个
+func (s *Server) sessionBubble(state *model.SessionState) model.Bubble {
+	if b, ok := findBubble(s.bubbles, state.EntryID); ok {
+		return b
+	}
+	return model.Bubble{
+		EntryID: state.EntryID,
+		Domain:  state.Domain,
+		Title:   state.MainObjective,
+		Roles:   state.AvailableRoles,
+	}
+}
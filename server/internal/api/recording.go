@@ -0,0 +1,55 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"bubble-talk/server/internal/recording"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleSessionRecording 导出会话录音。
+// format=mix（默认）返回混音后的单条 WAV；format=multitrack 返回各 take 分轨 WAV + manifest 的 zip。
+func (s *Server) handleSessionRecording(c *gin.Context) {
+	if s.recordings == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "recording disabled"})
+		return
+	}
+
+	sessionID := c.Param("id")
+	format := c.DefaultQuery("format", "mix")
+	if format != "mix" && format != "multitrack" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid format: %q", format)})
+		return
+	}
+
+	// 先确认有录音再写响应头，避免 404 混进附件下载
+	if _, err := s.recordings.Takes(sessionID); err != nil {
+		if errors.Is(err, recording.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load recording failed"})
+		return
+	}
+
+	var err error
+	if format == "multitrack" {
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-recording.zip"`, sessionID))
+		c.Status(http.StatusOK)
+		err = s.recordings.ExportArchive(c.Writer, sessionID)
+	} else {
+		c.Header("Content-Type", "audio/wav")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.wav"`, sessionID))
+		c.Status(http.StatusOK)
+		err = s.recordings.ExportMix(c.Writer, sessionID)
+	}
+	if err != nil {
+		// 响应头已发出，只能记录日志
+		log.Printf("[API] ❌ Export recording failed: session=%s format=%s: %v", sessionID, format, err)
+	}
+}
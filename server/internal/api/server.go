@@ -2,22 +2,28 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
+	"bubble-talk/server/internal/audio"
 	"bubble-talk/server/internal/config"
 	"bubble-talk/server/internal/domain"
 	"bubble-talk/server/internal/gateway"
+	"bubble-talk/server/internal/llm"
 	"bubble-talk/server/internal/model"
 	"bubble-talk/server/internal/orchestrator"
 	"bubble-talk/server/internal/realtime"
+	"bubble-talk/server/internal/recording"
 	"bubble-talk/server/internal/session"
 	"bubble-talk/server/internal/timeline"
 	"bubble-talk/server/internal/tool"
+	"bubble-talk/server/internal/usage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -39,16 +45,61 @@ type Server struct {
 	// 让浏览器用 WebRTC 直连 OpenAI（语音原生），同时不暴露服务端 API Key。
 	realtimeClient *realtime.Client
 
+	// recordings 会话录音（config.recording.enabled 时非 nil）
+	recordings *recording.Manager
+
+	// warmPool 角色连接预热池（config.gateway.warm_pool.enabled 时非 nil），所有会话共享
+	warmPool *gateway.WarmPool
+
+	// historySummarizer 角色连接对话历史的滚动摘要（config.gateway.history_summary 时非 nil）
+	historySummarizer gateway.HistorySummarizer
+
+	// textLLM 文本网关（/stream?mode=text）生成角色发言用的 LLM，未配置 LLM 时为 nil
+	textLLM llm.Client
+
+	// timelineWatch Timeline 订阅（与 timeline 为同一存储，不经过录音装饰）
+	timelineWatch timeline.Watcher
+
+	// outputs 网关实时消息（字幕增量、文本增量、quiz_show）到 SSE 订阅者的分发
+	outputs *outputHub
+
 	// WebSocket upgrader
 	upgrader websocket.Upgrader
 }
 
+// watchableTimeline 返回支持订阅的 Timeline：存储自身实现 Watcher 时原样返回，否则用 WatchStore 包装
+func watchableTimeline(store timeline.Store) (timeline.Store, timeline.Watcher) {
+	if watcher, ok := store.(timeline.Watcher); ok {
+		return store, watcher
+	}
+	watchStore := timeline.NewWatchStore(store)
+	return watchStore, watchStore
+}
+
 func NewServer(cfg *config.Config, store session.Store, timeline timeline.Store) (*Server, error) {
 	bubbles, err := domain.LoadBubbles(cfg.Paths.Bubbles)
 	if err != nil {
 		return nil, err
 	}
 
+	// 订阅能力（SSE 等）：存储本身不支持时用 WatchStore 包一层；须在录音装饰之前取得
+	timeline, watcher := watchableTimeline(timeline)
+
+	// 开启录音时装饰 Timeline，让事件 seq 对齐到录音时间轴上
+	var recordings *recording.Manager
+	if cfg.Recording.Enabled {
+		recordings, err = recording.NewManager(recording.Config{
+			Dir:             cfg.Recording.Dir,
+			MaxAge:          cfg.Recording.MaxAge,
+			MaxSessions:     cfg.Recording.MaxSessions,
+			MaxTakeDuration: cfg.Recording.MaxTakeDuration,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("init recordings: %w", err)
+		}
+		timeline = recording.NewTimelineStore(timeline, recordings)
+	}
+
 	// 使用完整配置创建Orchestrator（支持LLM）
 	orch, err := orchestrator.NewWithConfig(store, timeline, cfg, time.Now)
 	if err != nil {
@@ -57,18 +108,58 @@ func NewServer(cfg *config.Config, store session.Store, timeline timeline.Store)
 		orch = orchestrator.New(store, timeline, time.Now)
 	}
 
+	var warmPool *gateway.WarmPool
+	if poolCfg := cfg.Gateway.WarmPool; poolCfg.Enabled {
+		warmPool = gateway.NewWarmPool(gateway.WarmPoolConfig{
+			OpenAIAPIKey:                 cfg.OpenAI.APIKey,
+			RealtimeURL:                  cfg.OpenAI.RealtimeURL,
+			RealtimeHeaders:              cfg.OpenAI.RealtimeHeaders,
+			Model:                        cfg.OpenAI.Model,
+			DefaultInstructions:          cfg.Gateway.DefaultInstructions,
+			InputAudioFormat:             cfg.Gateway.InputAudioFormat,
+			OutputAudioFormat:            cfg.Gateway.OutputAudioFormat,
+			InputAudioTranscriptionModel: cfg.Gateway.InputAudioTranscriptionModel,
+			Voices:                       roleVoices(cfg.Roles),
+			MinIdle:                      poolCfg.MinIdle,
+			MaxIdle:                      poolCfg.MaxIdle,
+			MaxAge:                       poolCfg.MaxAge,
+			HealthInterval:               poolCfg.HealthInterval,
+		})
+		warmPool.Start()
+	}
+
+	// 文本网关的角色发言与历史摘要不走响应缓存：开场等相同提示词不能在各会话间复用同一句台词
+	textLLM, err := llm.NewUncachedClient(cfg)
+	if err != nil {
+		log.Printf("⚠️ Text gateway and history summary disabled: %v", err)
+		textLLM = nil
+	}
+
+	var historySummarizer gateway.HistorySummarizer
+	if cfg.Gateway.HistorySummary && cfg.Gateway.HistoryWindow > 0 && textLLM != nil {
+		historySummarizer = gateway.NewLLMHistorySummarizer(textLLM)
+	}
+
 	return &Server{
-		config:       cfg,
-		store:        store,
-		timeline:     timeline,
-		bubbles:      bubbles,
-		now:          time.Now,
-		orchestrator: orch,
-		gateways:     make(map[string]interface{}),
+		config:            cfg,
+		store:             store,
+		timeline:          timeline,
+		bubbles:           bubbles,
+		now:               time.Now,
+		orchestrator:      orch,
+		gateways:          make(map[string]interface{}),
+		recordings:        recordings,
+		warmPool:          warmPool,
+		historySummarizer: historySummarizer,
+		textLLM:           textLLM,
+		timelineWatch:     watcher,
+		outputs:           newOutputHub(),
 		realtimeClient: &realtime.Client{
 			APIKey: cfg.OpenAI.APIKey,
 		},
 		upgrader: websocket.Upgrader{
+			// 协议版本靠子协议协商；不声明子协议的旧客户端按 v1 处理
+			Subprotocols: gateway.Subprotocols,
 			CheckOrigin: func(r *http.Request) bool {
 				// 开发期允许本地跨域，生产环境应改为白名单
 				origin := r.Header.Get("Origin")
@@ -78,6 +169,20 @@ func NewServer(cfg *config.Config, store session.Store, timeline timeline.Store)
 	}, nil
 }
 
+// roleVoices 返回角色配置中用到的音色（去重、有序）
+func roleVoices(roles map[string]config.RoleProfile) []string {
+	seen := make(map[string]bool)
+	var voices []string
+	for _, profile := range roles {
+		if profile.Voice != "" && !seen[profile.Voice] {
+			seen[profile.Voice] = true
+			voices = append(voices, profile.Voice)
+		}
+	}
+	sort.Strings(voices)
+	return voices
+}
+
 func (s *Server) Routes() http.Handler {
 	// Gin 统一承载中间件与路由，便于扩展日志/鉴权/限流等能力。
 	engine := gin.New()
@@ -85,9 +190,23 @@ func (s *Server) Routes() http.Handler {
 	engine.GET("/healthz", s.handleHealthz)
 	engine.GET("/api/bubbles", s.handleBubbles)
 	engine.POST("/api/sessions", s.handleSessions)
+	engine.POST("/api/sessions/import", s.handleSessionImport)
+	engine.GET("/api/sessions/:id", s.handleSessionState)
+	engine.POST("/api/sessions/:id/fork", s.handleSessionFork)
 	engine.POST("/api/sessions/:id/events", s.handleSessionEvents)
 	engine.GET("/api/sessions/:id/stream", s.handleSessionStream)
+	engine.GET("/api/sessions/:id/events/stream", s.handleSessionEventStream)
+	engine.GET("/api/sessions/:id/timeline", s.handleSessionTimeline)
+	engine.GET("/api/sessions/:id/export", s.handleSessionExport)
 	engine.POST("/api/sessions/:id/realtime/token", s.handleRealtimeToken)
+	engine.GET("/api/sessions/:id/usage", s.handleSessionUsage)
+	engine.GET("/api/sessions/:id/recording", s.handleSessionRecording)
+	engine.GET("/api/debug/llm/schemas", s.handleLLMSchemaStats)
+	engine.GET("/api/debug/llm/cache", s.handleLLMCacheStats)
+	if s.config.Server.DebugTimelineStream {
+		// 跨会话推送所有 Timeline 事件且不做访问控制，只在调试配置下注册
+		engine.GET("/api/debug/timeline/stream", s.handleTimelineFirehose)
+	}
 	return engine
 }
 
@@ -101,6 +220,62 @@ func (s *Server) handleBubbles(c *gin.Context) {
 	c.JSON(http.StatusOK, s.bubbles)
 }
 
+type sessionUsageResponse struct {
+	SessionID      string                   `json:"session_id"`
+	EntryID        string                   `json:"entry_id"`
+	Budget         config.UsageBudgetConfig `json:"budget"`
+	BudgetExceeded bool                     `json:"budget_exceeded"`
+	Session        usage.Summary            `json:"session"`
+	Bubble         usage.Summary            `json:"bubble"`
+}
+
+// handleSessionUsage 返回会话与其所属泡泡的用量/费用汇总。
+func (s *Server) handleSessionUsage(c *gin.Context) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+	state, err := s.store.Get(ctx, id)
+	if err != nil {
+		if err == session.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load session failed"})
+		return
+	}
+
+	tracker := s.orchestrator.UsageTracker()
+	summary, ok := tracker.Session(id)
+	if !ok {
+		// 进程重启后内存聚合为空：以 Timeline 的 usage 事件为准重建
+		events, err := s.timeline.List(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "load timeline failed"})
+			return
+		}
+		tracker.Restore(id, state.EntryID, events)
+		summary, _ = tracker.Session(id)
+	}
+
+	c.JSON(http.StatusOK, sessionUsageResponse{
+		SessionID:      id,
+		EntryID:        state.EntryID,
+		Budget:         tracker.Budget(),
+		BudgetExceeded: state.BudgetExceeded || tracker.Exceeded(id),
+		Session:        summary,
+		Bubble:         tracker.Bubble(state.EntryID),
+	})
+}
+
+// handleLLMSchemaStats 返回各 provider/schema 的结构化输出校验计数（首次通过/修复通过/失败）。
+func (s *Server) handleLLMSchemaStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"schemas": llm.DefaultSchemaMetrics.Snapshot()})
+}
+
+// handleLLMCacheStats 返回各 schema 的 LLM 响应缓存命中计数。
+func (s *Server) handleLLMCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"cache": llm.DefaultCacheMetrics.Snapshot()})
+}
+
 type createSessionRequest struct {
 	EntryID string `json:"entry_id"`
 }
@@ -124,26 +299,7 @@ func (s *Server) handleSessions(c *gin.Context) {
 		return
 	}
 
-	now := s.now()
-	state := model.SessionState{
-		SessionID:         newSessionID(),
-		EntryID:           bubble.EntryID,
-		Domain:            bubble.Domain,
-		AvailableRoles:    bubble.Roles, // 从泡泡配置中获取角色列表
-		MainObjective:     bubble.Title,
-		Act:               1,
-		Beat:              "ColdOpen",
-		PacingMode:        "NORMAL",
-		MasteryEstimate:   0.2,
-		OutputClockSec:    0,
-		LastOutputAt:      now,
-		TensionLevel:      2,
-		CognitiveLoad:     2,
-		QuestionStack:     nil,
-		Signals:           model.SignalsSnapshot{},
-		Turns:             nil,
-		MisconceptionTags: nil,
-	}
+	state := newSessionState(bubble, newSessionID(), s.now())
 
 	// 副作用：创建快照以便后续 reducer 增量归约。
 	if err := s.store.Save(c.Request.Context(), &state); err != nil {
@@ -168,6 +324,11 @@ func (s *Server) handleSessionEvents(c *gin.Context) {
 	}
 
 	sessionID := c.Param("id")
+	// 打开了 SSE 的客户端：用户输入走网关与 HandleUserUtterance，角色发言从 SSE 下发
+	if sseUserInput(evt.Type) && s.outputs.subscribers(sessionID) > 0 {
+		s.handleSSEUserInput(c, sessionID, evt)
+		return
+	}
 	// 这里将事件交给编排器，确保走 append-first 与快照归约。
 	resp, err := s.orchestrator.OnEvent(c.Request.Context(), sessionID, evt)
 	if err != nil {
@@ -203,6 +364,34 @@ func (s *Server) handleSessionStream(c *gin.Context) {
 	}
 	log.Printf("[API] ✅ Session validated: entry_id=%s domain=%s", state.EntryID, state.Domain)
 
+	// 纯文本客户端（聊天嵌入、自动化测试）：同一个 /stream 协议，不涉及音频与 Realtime
+	if c.Query("mode") == "text" {
+		s.handleTextStream(c, sessionID, state)
+		return
+	}
+
+	// 断线续传参数：带 resume_token 的连接优先接回仍在宽限期内的网关
+	resume, err := parseStreamResumeParams(c.Query("resume_token"), c.Query("last_seq"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audioFormats, err := parseClientAudioFormats(
+		c.DefaultQuery("input_format", s.config.Gateway.ClientInputAudioFormat),
+		c.DefaultQuery("output_format", s.config.Gateway.ClientOutputAudioFormat),
+	)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	active := s.activeGateway(sessionID)
+	existing, _ := active.(*gateway.MultiVoiceGateway)
+	if resume.Token != "" && existing != nil && !existing.CheckResumeToken(resume.Token) {
+		log.Printf("[API] ❌ Resume token mismatch for session %s", sessionID)
+		c.JSON(http.StatusConflict, gin.H{"error": "resume token mismatch"})
+		return
+	}
+
 	// 升级到 WebSocket
 	log.Printf("[API] Upgrading to WebSocket...")
 	clientConn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -212,45 +401,64 @@ func (s *Server) handleSessionStream(c *gin.Context) {
 	}
 	log.Printf("[API] ✅ WebSocket upgraded successfully")
 
-	// 创建 Gateway 配置：只为当前泡泡配置的角色创建 RoleProfiles
-	roleProfiles := make(map[string]gateway.RoleProfile)
-	for _, role := range state.AvailableRoles {
-		if profile, ok := s.config.Roles[role]; ok {
-			roleProfiles[role] = gateway.RoleProfile{
-				Voice:  profile.Voice,
-				Avatar: profile.Avatar,
-			}
-		} else {
-			log.Printf("[API] ⚠️  Role %s not found in global config, skipping", role)
+	if resume.Token != "" && existing != nil {
+		err := existing.AttachClient(clientConn, resume.LastSeq)
+		if err == nil {
+			log.Printf("[API] ✅ Stream resumed for session %s (last_seq=%d)", sessionID, resume.LastSeq)
+			// 网关的生命周期仍由最初的 handler 管理，这里只陪跑到网关关闭
+			<-existing.Done()
+			return
 		}
-	}
-
-	if len(roleProfiles) == 0 {
-		log.Printf("[API] ⚠️  No valid roles found, using default roles")
-		// 兜底：如果没有有效角色，使用全部配置的角色
-		for role, profile := range s.config.Roles {
-			roleProfiles[role] = gateway.RoleProfile{
-				Voice:  profile.Voice,
-				Avatar: profile.Avatar,
-			}
+		if !errors.Is(err, gateway.ErrGatewayClosed) {
+			log.Printf("[API] ⚠️  Resume failed for session %s: %v", sessionID, err)
+			return
 		}
+		// 网关恰好在宽限期末尾关闭：走下面的新建流程，并用 Timeline 重建
+		existing = nil
+	}
+	if closer, ok := active.(interface{ Close() error }); ok {
+		// 未带续传凭证的新连接视为重新开始：关闭旧网关（语音网关释放角色连接，文本网关停止生成）
+		log.Printf("[API] Replacing active gateway for session %s", sessionID)
+		_ = closer.Close()
 	}
 
+	// 创建 Gateway 配置：只为当前泡泡配置的角色创建 RoleProfiles
+	roleProfiles := s.sessionRoleProfiles(state)
+
 	log.Printf("[API] Creating RoleProfiles for roles: %v", state.AvailableRoles)
 
 	gwConfig := gateway.GatewayConfig{
 		OpenAIAPIKey:                 s.config.OpenAI.APIKey,
 		OpenAIRealtimeURL:            s.config.OpenAI.RealtimeURL,
+		RealtimeHeaders:              s.config.OpenAI.RealtimeHeaders,
 		Model:                        s.config.OpenAI.Model,
 		Voice:                        s.config.OpenAI.Voice,
 		RoleProfiles:                 roleProfiles,
 		DefaultInstructions:          s.config.Gateway.DefaultInstructions,
+		SessionStart:                 state.CreatedAt,
 		ReadTimeout:                  30 * time.Second,
 		WriteTimeout:                 30 * time.Second,
 		PingInterval:                 s.config.Gateway.PingInterval,
 		InputAudioFormat:             s.config.Gateway.InputAudioFormat,
 		OutputAudioFormat:            s.config.Gateway.OutputAudioFormat,
 		InputAudioTranscriptionModel: s.config.Gateway.InputAudioTranscriptionModel,
+		ClientInputAudioFormat:       audioFormats.Input,
+		ClientOutputAudioFormat:      audioFormats.Output,
+		ResumeGracePeriod:            s.config.Gateway.ResumeGracePeriod,
+		ReplayBufferSize:             s.config.Gateway.ReplayBufferSize,
+		SpeechTTL:                    s.config.Gateway.SpeechTTL,
+		RealtimePingInterval:         s.config.Gateway.RealtimePingInterval,
+		RoleReconnectAttempts:        s.config.Gateway.RoleReconnectAttempts,
+		RoleRecoveryInterval:         s.config.Gateway.RoleRecoveryInterval,
+		HistoryWindow:                s.config.Gateway.HistoryWindow,
+	}
+	if vadCfg := s.config.Gateway.LocalVAD; vadCfg.Enabled {
+		gwConfig.LocalVAD = &audio.VADConfig{
+			ThresholdDB:   vadCfg.ThresholdDB,
+			NoiseMarginDB: vadCfg.NoiseMarginDB,
+			MinSpeech:     vadCfg.MinSpeech,
+			Hangover:      vadCfg.Hangover,
+		}
 	}
 	log.Printf("[API] Gateway config: model=%s voice=%s", gwConfig.Model, gwConfig.Voice)
 
@@ -262,6 +470,16 @@ func (s *Server) handleSessionStream(c *gin.Context) {
 	gw.SetEventHandler(func(ctx context.Context, msg *gateway.ClientMessage) error {
 		return s.handleGatewayEvent(ctx, sessionID, gw, msg)
 	})
+	gw.SetReplayFallback(func(ctx context.Context) ([]gateway.ServerMessage, error) {
+		return s.timelineReplay(ctx, sessionID)
+	})
+	gw.SetOutputObserver(s.outputs.observer(sessionID))
+	if s.warmPool != nil {
+		gw.SetWarmPool(s.warmPool)
+	}
+	if s.historySummarizer != nil {
+		gw.SetHistorySummarizer(s.historySummarizer)
+	}
 
 	// 初始化工具注册表并注册选择题工具
 	log.Printf("[API] Initializing tool registry...")
@@ -282,6 +500,17 @@ func (s *Server) handleSessionStream(c *gin.Context) {
 	gw.SetToolRegistry(toolRegistry)
 	log.Printf("[API] ✅ Tool registry initialized with %d tools", 1)
 
+	// 会话录音（可选）：每个新网关一个 take，续传接回的连接沿用同一个
+	if s.recordings != nil {
+		rec, err := s.recordings.Start(sessionID)
+		if err != nil {
+			log.Printf("[API] ⚠️  Failed to start recording for session %s: %v", sessionID, err)
+		} else {
+			gw.SetAudioRecorder(rec)
+			defer s.recordings.Finish(sessionID, rec)
+		}
+	}
+
 	// 注册到活跃网关表
 	s.gatewaysMu.Lock()
 	s.gateways[sessionID] = gw
@@ -291,10 +520,7 @@ func (s *Server) handleSessionStream(c *gin.Context) {
 
 	// 清理函数
 	defer func() {
-		s.gatewaysMu.Lock()
-		delete(s.gateways, sessionID)
-		remaining := len(s.gateways)
-		s.gatewaysMu.Unlock()
+		remaining := s.unregisterGateway(sessionID, gw)
 		_ = gw.Close()
 		log.Printf("[API] 🔌 Gateway closed for session %s (remaining: %d)", sessionID, remaining)
 	}()
@@ -322,6 +548,13 @@ func (s *Server) handleSessionStream(c *gin.Context) {
 	}
 
 	log.Printf("[API] ✅ Gateway started successfully for session %s", sessionID)
+
+	// 客户端以为自己在续传，但原网关已过期：用 Timeline 快照帮它重建对话
+	if resume.Token != "" || resume.LastSeq > 0 {
+		if err := gw.Resync(); err != nil {
+			log.Printf("[API] ⚠️  Resync failed for session %s: %v", sessionID, err)
+		}
+	}
 	log.Printf("[API] 🎙️  Ready for audio streaming...")
 
 	// 阻塞直到连接关闭
@@ -329,13 +562,40 @@ func (s *Server) handleSessionStream(c *gin.Context) {
 	log.Printf("[API] Gateway connection closed for session %s", sessionID)
 }
 
+// sessionRoleProfiles 只为当前泡泡配置的角色创建 RoleProfiles；都无效时退回全部配置的角色
+func (s *Server) sessionRoleProfiles(state *model.SessionState) map[string]gateway.RoleProfile {
+	roleProfiles := make(map[string]gateway.RoleProfile)
+	for _, role := range state.AvailableRoles {
+		if profile, ok := s.config.Roles[role]; ok {
+			roleProfiles[role] = gateway.RoleProfile{
+				Voice:  profile.Voice,
+				Avatar: profile.Avatar,
+			}
+		} else {
+			log.Printf("[API] ⚠️  Role %s not found in global config, skipping", role)
+		}
+	}
+
+	if len(roleProfiles) == 0 {
+		log.Printf("[API] ⚠️  No valid roles found, using default roles")
+		// 兜底：如果没有有效角色，使用全部配置的角色
+		for role, profile := range s.config.Roles {
+			roleProfiles[role] = gateway.RoleProfile{
+				Voice:  profile.Voice,
+				Avatar: profile.Avatar,
+			}
+		}
+	}
+	return roleProfiles
+}
+
 // handleGatewayEvent 处理来自 Gateway 的事件
 func (s *Server) handleGatewayEvent(ctx context.Context, sessionID string, gw interface{}, msg *gateway.ClientMessage) error {
 	log.Printf("[API] gateway event: session=%s type=%s", sessionID, msg.Type)
 
 	switch msg.Type {
-	case gateway.EventTypeASRFinal:
-		// 用户语音转写完成，交给 Orchestrator 处理
+	case gateway.EventTypeASRFinal, gateway.EventTypeUserMessage:
+		// 用户语音转写完成（或文本网关的用户消息），交给 Orchestrator 处理
 		return s.orchestrator.HandleUserUtterance(ctx, sessionID, msg.Text, gw)
 
 	case gateway.EventTypeAssistantText:
@@ -377,10 +637,78 @@ func (s *Server) handleGatewayEvent(ctx context.Context, sessionID string, gw in
 		}
 		// TODO: 触发 EXIT_TICKET 流程
 		return nil
+	case gateway.EventTypeSpeechDropped:
+		// 排队的角色发言未开播即被丢弃（过期/被新计划替换/插话），落 Timeline 便于回放对账
+		meta := func(key string) string {
+			v, _ := msg.Metadata[key].(string)
+			return v
+		}
+		event := &model.Event{
+			EventID:   msg.EventID,
+			SessionID: sessionID,
+			TurnID:    msg.TurnID,
+			Type:      "speech_dropped",
+			ClientTS:  msg.ClientTS,
+			ServerTS:  time.Now(),
+			SpeechDrop: &model.SpeechDrop{
+				Role:     meta("role"),
+				PlanID:   meta("plan_id"),
+				Priority: meta("priority"),
+				Reason:   meta("reason"),
+			},
+		}
+		_, err := s.timeline.Append(ctx, sessionID, event)
+		return err
+
+	case gateway.EventTypeCaption:
+		// 最终字幕（用户/角色，带时间轴）落 Timeline，供带字幕回放
+		if msg.Caption == nil {
+			return nil
+		}
+		event := &model.Event{
+			EventID:   msg.EventID,
+			SessionID: sessionID,
+			Type:      "caption",
+			Text:      msg.Caption.Text,
+			ClientTS:  msg.ClientTS,
+			ServerTS:  time.Now(),
+			Caption: &model.Caption{
+				CaptionID: msg.Caption.CaptionID,
+				Speaker:   msg.Caption.Speaker,
+				Role:      msg.Caption.Role,
+				Avatar:    msg.Caption.Avatar,
+				StreamID:  msg.Caption.StreamID,
+				StartMS:   msg.Caption.StartMS,
+				EndMS:     msg.Caption.EndMS,
+				Cancelled: msg.Caption.Cancelled,
+				Take:      msg.Caption.Take,
+				OffsetMS:  msg.Caption.OffsetMS,
+			},
+		}
+		_, err := s.timeline.Append(ctx, sessionID, event)
+		return err
+
 	case gateway.EventTypeWorldEntered:
 		// World 进入，导演主动开场
 		return s.orchestrator.HandleWorldEntered(ctx, sessionID, gw)
 
+	case gateway.EventTypeUsage:
+		// Realtime 用量（按角色），落 Timeline 并参与预算判断
+		if msg.Usage == nil {
+			return nil
+		}
+		return s.orchestrator.HandleRealtimeUsage(ctx, sessionID, &model.UsageRecord{
+			Source:                usage.SourceRealtime,
+			Provider:              "openai_realtime",
+			Model:                 msg.Usage.Model,
+			Role:                  msg.Usage.Role,
+			PromptTokens:          msg.Usage.InputTokens,
+			CompletionTokens:      msg.Usage.OutputTokens,
+			CachedTokens:          msg.Usage.CachedTokens,
+			AudioPromptTokens:     msg.Usage.AudioInputTokens,
+			AudioCompletionTokens: msg.Usage.AudioOutputTokens,
+		})
+
 	default:
 		log.Printf("[API] unhandled gateway event type: %s", msg.Type)
 		return nil
@@ -465,6 +793,30 @@ func findBubble(bubbles []model.Bubble, entryID string) (model.Bubble, bool) {
 	return model.Bubble{}, false
 }
 
+// newSessionState 创建泡泡会话的初始快照（新建会话与导入/分叉共用）
+func newSessionState(bubble model.Bubble, sessionID string, now time.Time) model.SessionState {
+	return model.SessionState{
+		SessionID:         sessionID,
+		EntryID:           bubble.EntryID,
+		Domain:            bubble.Domain,
+		AvailableRoles:    bubble.Roles, // 从泡泡配置中获取角色列表
+		MainObjective:     bubble.Title,
+		Act:               1,
+		Beat:              "ColdOpen",
+		PacingMode:        "NORMAL",
+		MasteryEstimate:   0.2,
+		OutputClockSec:    0,
+		LastOutputAt:      now,
+		CreatedAt:         now,
+		TensionLevel:      2,
+		CognitiveLoad:     2,
+		QuestionStack:     nil,
+		Signals:           model.SignalsSnapshot{},
+		Turns:             nil,
+		MisconceptionTags: nil,
+	}
+}
+
 func defaultDiagnose() model.DiagnoseSet {
 	return model.DiagnoseSet{
 		Questions: []model.QuizQuestion{
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"bubble-talk/server/internal/audio"
+	"bubble-talk/server/internal/gateway"
+)
+
+// streamResumeParams 客户端重连时携带的续传参数（/stream?resume_token=...&last_seq=...）
+type streamResumeParams struct {
+	Token   string
+	LastSeq int64
+}
+
+func parseStreamResumeParams(token, lastSeq string) (streamResumeParams, error) {
+	params := streamResumeParams{Token: token}
+	if lastSeq == "" {
+		return params, nil
+	}
+	seq, err := strconv.ParseInt(lastSeq, 10, 64)
+	if err != nil || seq < 0 {
+		return params, fmt.Errorf("invalid last_seq: %q", lastSeq)
+	}
+	params.LastSeq = seq
+	return params, nil
+}
+
+// clientAudioFormats 客户端侧音频格式（/stream?input_format=...&output_format=...，缺省取配置）。
+// 只对新建的网关生效；续传接回的连接沿用原网关的格式。
+type clientAudioFormats struct {
+	Input  string
+	Output string
+}
+
+func parseClientAudioFormats(input, output string) (clientAudioFormats, error) {
+	for _, name := range []string{input, output} {
+		if name == "" {
+			continue
+		}
+		format, err := audio.ParseFormat(name)
+		if err == nil {
+			_, err = audio.NewCodec(format.Codec)
+		}
+		if err != nil {
+			return clientAudioFormats{}, fmt.Errorf("invalid audio format: %w", err)
+		}
+	}
+	return clientAudioFormats{Input: input, Output: output}, nil
+}
+
+// activeGateway 返回 session 当前登记的网关（可能为 nil）
+func (s *Server) activeGateway(sessionID string) interface{} {
+	s.gatewaysMu.RLock()
+	defer s.gatewaysMu.RUnlock()
+	return s.gateways[sessionID]
+}
+
+// unregisterGateway 只在登记的仍是 gw 时删除，避免误删接管后新建的网关
+func (s *Server) unregisterGateway(sessionID string, gw interface{}) int {
+	s.gatewaysMu.Lock()
+	defer s.gatewaysMu.Unlock()
+	if s.gateways[sessionID] == gw {
+		delete(s.gateways, sessionID)
+	}
+	return len(s.gateways)
+}
+
+// timelineReplay 从 Timeline 重建对话快照，供 resync 使用。
+// 只包含客户端需要重建字幕/气泡的事实事件：用户转写与助手文本。
+func (s *Server) timelineReplay(ctx context.Context, sessionID string) ([]gateway.ServerMessage, error) {
+	events, err := s.timeline.List(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []gateway.ServerMessage
+	for _, evt := range events {
+		var msgType gateway.EventType
+		switch evt.Type {
+		case "user_utterance":
+			msgType = gateway.EventTypeASRFinal
+		case "assistant_text":
+			msgType = gateway.EventTypeAssistantText
+		default:
+			continue
+		}
+		out = append(out, gateway.ServerMessage{
+			Type:     msgType,
+			TurnID:   evt.TurnID,
+			Text:     evt.Text,
+			Metadata: map[string]interface{}{"timeline_seq": evt.Seq},
+			ServerTS: evt.ServerTS,
+		})
+	}
+	return out, nil
+}
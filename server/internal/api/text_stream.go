@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"bubble-talk/server/internal/gateway"
+	"bubble-talk/server/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// handleTextStream 处理 /stream?mode=text：创建 TextGateway，角色发言由 LLM 以文本流式生成。
+// 与语音网关共用 Orchestrator 与 handleGatewayEvent；不支持续传，断开即结束。
+func (s *Server) handleTextStream(c *gin.Context, sessionID string, state *model.SessionState) {
+	if s.textLLM == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "text mode requires an llm provider"})
+		return
+	}
+
+	clientConn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[API] ❌ Failed to upgrade websocket: %v", err)
+		return
+	}
+
+	if existing, ok := s.activeGateway(sessionID).(interface{ Close() error }); ok {
+		log.Printf("[API] Replacing active gateway for session %s", sessionID)
+		_ = existing.Close()
+	}
+
+	gw := s.newTextGateway(c.Request.Context(), sessionID, state, clientConn)
+
+	s.gatewaysMu.Lock()
+	s.gateways[sessionID] = gw
+	s.gatewaysMu.Unlock()
+	defer func() {
+		remaining := s.unregisterGateway(sessionID, gw)
+		_ = gw.Close()
+		log.Printf("[API] 🔌 Text gateway closed for session %s (remaining: %d)", sessionID, remaining)
+	}()
+
+	if err := gw.Start(context.Background()); err != nil {
+		log.Printf("[API] ❌ Failed to start text gateway: %v", err)
+		return
+	}
+	log.Printf("[API] ✅ Text gateway started for session %s", sessionID)
+
+	<-gw.Done()
+}
+
+// newTextGateway 按会话配置创建文本网关并接上 Orchestrator 与 SSE 旁路；clientConn 为 nil 时创建无头网关（SSE 客户端）
+func (s *Server) newTextGateway(ctx context.Context, sessionID string, state *model.SessionState, clientConn *websocket.Conn) *gateway.TextGateway {
+	instructions, err := s.orchestrator.GetInitialInstructions(ctx, state)
+	if err != nil {
+		log.Printf("[API] ⚠️  Failed to get initial instructions: %v, using fallback", err)
+		instructions = s.config.Gateway.DefaultInstructions
+	}
+
+	config := gateway.GatewayConfig{
+		RoleProfiles:        s.sessionRoleProfiles(state),
+		DefaultInstructions: instructions,
+		WriteTimeout:        30 * time.Second,
+		HistoryWindow:       s.config.Gateway.HistoryWindow,
+	}
+	var gw *gateway.TextGateway
+	if clientConn == nil {
+		gw = gateway.NewHeadlessTextGateway(sessionID, config, s.textLLM)
+	} else {
+		gw = gateway.NewTextGateway(sessionID, clientConn, config, s.textLLM)
+	}
+	gw.SetEventHandler(func(ctx context.Context, msg *gateway.ClientMessage) error {
+		return s.handleGatewayEvent(ctx, sessionID, gw, msg)
+	})
+	gw.SetOutputObserver(s.outputs.observer(sessionID))
+	return gw
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bubble-talk/server/internal/session"
+	"bubble-talk/server/internal/timeline"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// timelineDefaultLimit 未传 limit 时的每页条数
+	timelineDefaultLimit = 100
+	// timelineMaxLimit limit 上限
+	timelineMaxLimit = 1000
+)
+
+// handleSessionTimeline 处理 GET /api/sessions/:id/timeline：分页/过滤查询 Timeline。
+//
+// 查询参数：from_seq/to_seq（seq 闭区间）、since/until（RFC3339，按 server_ts）、
+// type（可重复或逗号分隔）、turn_id、limit（默认 100，上限 1000）、cursor（上一页的 next_cursor）、order=asc|desc。
+func (s *Server) handleSessionTimeline(c *gin.Context) {
+	sessionID := c.Param("id")
+	ctx := c.Request.Context()
+
+	if _, err := s.store.Get(ctx, sessionID); err != nil {
+		if err == session.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load session failed"})
+		return
+	}
+
+	q, err := parseTimelineQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := timeline.QueryEvents(ctx, s.timeline, sessionID, q)
+	if err != nil {
+		if errors.Is(err, timeline.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query timeline failed"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func parseTimelineQuery(c *gin.Context) (timeline.Query, error) {
+	q := timeline.Query{
+		TurnID: strings.TrimSpace(c.Query("turn_id")),
+		Cursor: strings.TrimSpace(c.Query("cursor")),
+		Limit:  timelineDefaultLimit,
+	}
+
+	var err error
+	if q.FromSeq, err = parseSeqParam(c, "from_seq"); err != nil {
+		return q, err
+	}
+	if q.ToSeq, err = parseSeqParam(c, "to_seq"); err != nil {
+		return q, err
+	}
+	if q.Since, err = parseTimeParam(c, "since"); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseTimeParam(c, "until"); err != nil {
+		return q, err
+	}
+
+	for _, raw := range c.QueryArray("type") {
+		for _, t := range strings.Split(raw, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				q.Types = append(q.Types, t)
+			}
+		}
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return q, fmt.Errorf("invalid limit: %q", raw)
+		}
+		if limit > timelineMaxLimit {
+			limit = timelineMaxLimit
+		}
+		q.Limit = limit
+	}
+
+	switch order := c.DefaultQuery("order", "asc"); order {
+	case "asc":
+	case "desc":
+		q.Reverse = true
+	default:
+		return q, fmt.Errorf("invalid order: %q", order)
+	}
+	return q, nil
+}
+
+func parseSeqParam(c *gin.Context, name string) (int64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return seq, nil
+}
+
+func parseTimeParam(c *gin.Context, name string) (time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %q (want RFC3339)", name, raw)
+	}
+	return ts, nil
+}
@@ -0,0 +1,190 @@
+package audio
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Format
+	}{
+		{"", Format{CodecPCM16, 24000}},
+		{"pcm16", Format{CodecPCM16, 24000}},
+		{"PCM16@16000", Format{CodecPCM16, 16000}},
+		{"g711_ulaw", Format{CodecG711ULaw, 8000}},
+		{"g711_alaw@8000", Format{CodecG711ALaw, 8000}},
+		{"opus", Format{CodecOpus, 48000}},
+	}
+	for _, c := range cases {
+		got, err := ParseFormat(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("ParseFormat(%q) = %+v, %v; want %+v", c.in, got, err, c.want)
+		}
+	}
+
+	for _, bad := range []string{"mp3", "pcm16@abc", "pcm16@96000", "g711_ulaw@16000"} {
+		if _, err := ParseFormat(bad); err == nil {
+			t.Errorf("ParseFormat(%q) should fail", bad)
+		}
+	}
+	if f := (Format{CodecPCM16, 16000}); f.String() != "pcm16@16000" {
+		t.Errorf("String() = %q", f.String())
+	}
+	if f := (Format{CodecG711ULaw, 8000}); f.String() != "g711_ulaw" {
+		t.Errorf("String() = %q", f.String())
+	}
+}
+
+func TestG711_KnownValuesAndRoundTrip(t *testing.T) {
+	if got := linearToULaw(0); got != 0xFF {
+		t.Errorf("ulaw(0) = %#x, want 0xff", got)
+	}
+	if got := linearToALaw(0); got != 0xD5 {
+		t.Errorf("alaw(0) = %#x, want 0xd5", got)
+	}
+
+	// G.711 是对数量化：误差随幅度增长，约为幅度的 1/16
+	for _, s := range []int16{0, 1, -1, 100, -100, 1000, -1000, 12345, -12345, 32767, -32768} {
+		for _, alaw := range []bool{false, true} {
+			var back int16
+			if alaw {
+				back = alawToLinear(linearToALaw(s))
+			} else {
+				back = ulawToLinear(linearToULaw(s))
+			}
+			tolerance := math.Max(16, math.Abs(float64(s))/16)
+			if diff := math.Abs(float64(back) - float64(s)); diff > tolerance {
+				t.Errorf("alaw=%v: %d -> %d (diff %.0f > %.0f)", alaw, s, back, diff, tolerance)
+			}
+		}
+	}
+}
+
+func TestPCM16Codec_CarriesOddByte(t *testing.T) {
+	c := &pcm16Codec{}
+	got, _ := c.Decode(nil, []byte{0x01, 0x02, 0x03})
+	got, _ = c.Decode(got, []byte{0x04})
+	if len(got) != 2 || got[0] != 0x0201 || got[1] != 0x0403 {
+		t.Errorf("decoded = %#v", got)
+	}
+}
+
+func sine(n, rate int, freq float64) []int16 {
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = int16(10000 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+	}
+	return out
+}
+
+func TestResampler_ChunkedMatchesWhole(t *testing.T) {
+	in := sine(2400, 24000, 440)
+	for _, rates := range [][2]int{{24000, 8000}, {8000, 24000}, {24000, 16000}, {16000, 24000}, {44100, 24000}} {
+		whole := NewResampler(rates[0], rates[1]).Process(nil, in)
+
+		chunked := NewResampler(rates[0], rates[1])
+		var out []int16
+		for i := 0; i < len(in); i += 137 {
+			end := i + 137
+			if end > len(in) {
+				end = len(in)
+			}
+			out = chunked.Process(out, in[i:end])
+		}
+
+		if len(out) != len(whole) {
+			t.Fatalf("%v: chunked len %d != whole len %d", rates, len(out), len(whole))
+		}
+		for i := range out {
+			if out[i] != whole[i] {
+				t.Fatalf("%v: sample %d differs: %d vs %d", rates, i, out[i], whole[i])
+			}
+		}
+		// 最后一个输入样本之后的插值点要等下一块才输出
+		want := len(in) * rates[1] / rates[0]
+		if len(whole) < want-rates[1]/rates[0]-1 || len(whole) > want {
+			t.Errorf("%v: output samples = %d, want ~%d", rates, len(whole), want)
+		}
+	}
+}
+
+func TestResampler_PreservesTone(t *testing.T) {
+	// 24k 的 440Hz 正弦降到 8k，再和 8k 直接生成的正弦比较
+	out := NewResampler(24000, 8000).Process(nil, sine(2400, 24000, 440))
+	ref := sine(len(out), 8000, 440)
+	for i := range out {
+		if diff := math.Abs(float64(out[i]) - float64(ref[i])); diff > 20 {
+			t.Fatalf("sample %d: %d vs %d", i, out[i], ref[i])
+		}
+	}
+}
+
+func TestTranscoder_PhoneLineToRealtime(t *testing.T) {
+	phone := Format{CodecG711ULaw, 8000}
+	realtime := Format{CodecPCM16, 24000}
+
+	up, err := NewTranscoder(phone, realtime)
+	if err != nil {
+		t.Fatalf("new transcoder: %v", err)
+	}
+	down, err := NewTranscoder(realtime, phone)
+	if err != nil {
+		t.Fatalf("new transcoder: %v", err)
+	}
+
+	// 20ms 的 8k μ-law 帧 = 160 字节 → 24k pcm16 约 480 样本（960 字节）
+	frame := make([]byte, 160)
+	enc := g711Codec{}
+	frame, _ = enc.Encode(frame[:0], sine(160, 8000, 300))
+	pcm, err := up.Convert(frame)
+	if err != nil {
+		t.Fatalf("convert up: %v", err)
+	}
+	if len(pcm) < 954 || len(pcm) > 960 {
+		t.Errorf("upsampled bytes = %d, want ~960", len(pcm))
+	}
+
+	back, err := down.Convert(pcm)
+	if err != nil {
+		t.Fatalf("convert down: %v", err)
+	}
+	if len(back) < 158 || len(back) > 160 {
+		t.Errorf("downsampled bytes = %d, want ~160", len(back))
+	}
+}
+
+func TestTranscoder_PassthroughAndUnsupported(t *testing.T) {
+	same, err := NewTranscoder(Format{CodecPCM16, 24000}, Format{CodecPCM16, 24000})
+	if err != nil || !same.Passthrough() {
+		t.Fatalf("expected passthrough, err=%v", err)
+	}
+	in := []byte{1, 2, 3}
+	if out, _ := same.Convert(in); &out[0] != &in[0] {
+		t.Error("passthrough should not copy")
+	}
+
+	if _, err := NewTranscoder(Format{CodecOpus, 48000}, Format{CodecPCM16, 24000}); !errors.Is(err, ErrUnsupportedCodec) {
+		t.Errorf("opus err = %v, want ErrUnsupportedCodec", err)
+	}
+}
+
+// fakeOpus 用于验证 RegisterCodec 插件路径（按 pcm16 透传）
+type fakeOpus struct{ pcm16Codec }
+
+func TestRegisterCodec(t *testing.T) {
+	RegisterCodec("test_codec", 16000, func() (Codec, error) { return &fakeOpus{}, nil })
+	f, err := ParseFormat("test_codec")
+	if err != nil || f.SampleRate != 16000 {
+		t.Fatalf("ParseFormat = %+v, %v", f, err)
+	}
+	tc, err := NewTranscoder(f, Format{CodecPCM16, 16000})
+	if err != nil {
+		t.Fatalf("new transcoder: %v", err)
+	}
+	if out, _ := tc.Convert([]byte{1, 0, 2, 0}); len(out) != 4 {
+		t.Errorf("out = %v", out)
+	}
+}
@@ -0,0 +1,141 @@
+package audio
+
+import "encoding/binary"
+
+// pcm16Codec 16-bit little-endian 线性 PCM；跨块的奇数字节会被暂存到下一块
+type pcm16Codec struct {
+	carry    byte
+	hasCarry bool
+}
+
+func (c *pcm16Codec) Decode(dst []int16, src []byte) ([]int16, error) {
+	if c.hasCarry && len(src) > 0 {
+		dst = append(dst, int16(uint16(c.carry)|uint16(src[0])<<8))
+		src = src[1:]
+		c.hasCarry = false
+	}
+	for len(src) >= 2 {
+		dst = append(dst, int16(binary.LittleEndian.Uint16(src)))
+		src = src[2:]
+	}
+	if len(src) == 1 {
+		c.carry, c.hasCarry = src[0], true
+	}
+	return dst, nil
+}
+
+func (c *pcm16Codec) Encode(dst []byte, pcm []int16) ([]byte, error) {
+	for _, s := range pcm {
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(s))
+	}
+	return dst, nil
+}
+
+// g711Codec ITU-T G.711（8kHz，每样本 1 字节），无状态
+type g711Codec struct {
+	alaw bool
+}
+
+func (c g711Codec) Decode(dst []int16, src []byte) ([]int16, error) {
+	for _, b := range src {
+		if c.alaw {
+			dst = append(dst, alawToLinear(b))
+		} else {
+			dst = append(dst, ulawToLinear(b))
+		}
+	}
+	return dst, nil
+}
+
+func (c g711Codec) Encode(dst []byte, pcm []int16) ([]byte, error) {
+	for _, s := range pcm {
+		if c.alaw {
+			dst = append(dst, linearToALaw(s))
+		} else {
+			dst = append(dst, linearToULaw(s))
+		}
+	}
+	return dst, nil
+}
+
+const (
+	ulawBias = 0x84
+	ulawClip = 32635
+)
+
+func linearToULaw(sample int16) byte {
+	v := int(sample)
+	sign := 0
+	if v < 0 {
+		v = -v
+		sign = 0x80
+	}
+	if v > ulawClip {
+		v = ulawClip
+	}
+	v += ulawBias
+
+	exponent := 7
+	for mask := 0x4000; v&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (v >> (exponent + 3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+func ulawToLinear(u byte) int16 {
+	u = ^u
+	exponent := int(u>>4) & 0x07
+	v := ((int(u&0x0F) << 3) + ulawBias) << exponent
+	v -= ulawBias
+	if u&0x80 != 0 {
+		v = -v
+	}
+	return int16(v)
+}
+
+// alawSegEnd A-law 各段的上界（13-bit 幅度）
+var alawSegEnd = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+
+func linearToALaw(sample int16) byte {
+	v := int(sample) >> 3
+	mask := byte(0xD5)
+	if v < 0 {
+		mask = 0x55
+		v = -v - 1
+	}
+
+	seg := 0
+	for seg < len(alawSegEnd) && v > alawSegEnd[seg] {
+		seg++
+	}
+	if seg >= len(alawSegEnd) {
+		return 0x7F ^ mask
+	}
+	aval := byte(seg << 4)
+	if seg < 2 {
+		aval |= byte(v>>1) & 0x0F
+	} else {
+		aval |= byte(v>>seg) & 0x0F
+	}
+	return aval ^ mask
+}
+
+func alawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0F) << 4
+	seg := int(a&0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
@@ -0,0 +1,113 @@
+// Package audio 网关的音频转码层：PCM16（任意采样率）、G.711 μ-law/A-law 之间的互转与重采样，纯 Go 实现。
+// Opus 等需要外部库的编码通过 RegisterCodec 以插件方式接入，默认未注册。
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 编码名与 Realtime 的 input/output_audio_format 保持一致
+const (
+	CodecPCM16    = "pcm16"
+	CodecG711ULaw = "g711_ulaw"
+	CodecG711ALaw = "g711_alaw"
+	CodecOpus     = "opus"
+)
+
+// ErrUnsupportedCodec 编码未实现或未注册
+var ErrUnsupportedCodec = errors.New("audio: unsupported codec")
+
+// Format 单声道音频格式
+type Format struct {
+	Codec      string
+	SampleRate int
+}
+
+// String 返回可被 ParseFormat 解析回来的格式名；编码默认采样率时省略 @rate
+func (f Format) String() string {
+	if rate, ok := defaultRate(f.Codec); ok && rate == f.SampleRate {
+		return f.Codec
+	}
+	return fmt.Sprintf("%s@%d", f.Codec, f.SampleRate)
+}
+
+// defaultRates 各编码的默认采样率（由 codecsMu 保护）：pcm16 是 Realtime 的 24kHz，G.711 固定 8kHz，Opus 48kHz
+var defaultRates = map[string]int{
+	CodecPCM16:    24000,
+	CodecG711ULaw: 8000,
+	CodecG711ALaw: 8000,
+	CodecOpus:     48000,
+}
+
+// ParseFormat 解析格式名："pcm16"、"pcm16@16000"、"g711_ulaw" 等；空串视为 pcm16（24kHz）
+func ParseFormat(s string) (Format, error) {
+	if s == "" {
+		return Format{Codec: CodecPCM16, SampleRate: 24000}, nil
+	}
+	name, rateStr, hasRate := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "@")
+	rate, known := defaultRate(name)
+	if !known {
+		return Format{}, fmt.Errorf("%w: %q", ErrUnsupportedCodec, s)
+	}
+	if hasRate {
+		r, err := strconv.Atoi(rateStr)
+		if err != nil || r < 8000 || r > 48000 {
+			return Format{}, fmt.Errorf("audio: invalid sample rate in %q", s)
+		}
+		if (name == CodecG711ULaw || name == CodecG711ALaw) && r != 8000 {
+			return Format{}, fmt.Errorf("audio: %s only supports 8000Hz", name)
+		}
+		rate = r
+	}
+	return Format{Codec: name, SampleRate: rate}, nil
+}
+
+// Codec 把某种编码与线性 PCM16 样本互转。实例可以有状态（如 Opus），每个音频流一个实例。
+type Codec interface {
+	Decode(dst []int16, src []byte) ([]int16, error)
+	Encode(dst []byte, pcm []int16) ([]byte, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]func() (Codec, error){
+		CodecPCM16:    func() (Codec, error) { return &pcm16Codec{}, nil },
+		CodecG711ULaw: func() (Codec, error) { return g711Codec{alaw: false}, nil },
+		CodecG711ALaw: func() (Codec, error) { return g711Codec{alaw: true}, nil },
+	}
+)
+
+// RegisterCodec 注册额外的编码（如基于 cgo 的 Opus）；sampleRate 为该编码的默认采样率
+func RegisterCodec(name string, sampleRate int, factory func() (Codec, error)) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[name] = factory
+	defaultRates[name] = sampleRate
+}
+
+func defaultRate(name string) (int, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	rate, ok := defaultRates[name]
+	return rate, ok
+}
+
+func lookupCodec(name string) (func() (Codec, error), bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	factory, ok := codecs[name]
+	return factory, ok
+}
+
+// NewCodec 创建编码实例；未注册返回 ErrUnsupportedCodec
+func NewCodec(name string) (Codec, error) {
+	factory, ok := lookupCodec(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, name)
+	}
+	return factory()
+}
@@ -0,0 +1,58 @@
+package audio
+
+import "fmt"
+
+// Transcoder 把一条音频流从 From 格式转换为 To 格式（解码 → 重采样 → 编码）。
+// 有状态（重采样相位、奇数字节、编码器内部状态），每条流一个实例，不可并发使用。
+type Transcoder struct {
+	From, To Format
+
+	passthrough bool
+	dec         Codec
+	enc         Codec
+	rs          *Resampler
+	pcm         []int16
+	resampled   []int16
+}
+
+// NewTranscoder 创建转码器；格式相同时为直通，不做任何处理
+func NewTranscoder(from, to Format) (*Transcoder, error) {
+	t := &Transcoder{From: from, To: to}
+	if from == to {
+		t.passthrough = true
+		return t, nil
+	}
+
+	var err error
+	if t.dec, err = NewCodec(from.Codec); err != nil {
+		return nil, fmt.Errorf("decoder: %w", err)
+	}
+	if t.enc, err = NewCodec(to.Codec); err != nil {
+		return nil, fmt.Errorf("encoder: %w", err)
+	}
+	t.rs = NewResampler(from.SampleRate, to.SampleRate)
+	return t, nil
+}
+
+// Passthrough 是否直通（两端格式相同）
+func (t *Transcoder) Passthrough() bool {
+	return t.passthrough
+}
+
+// Convert 转换一块音频；返回的切片归调用方所有
+func (t *Transcoder) Convert(in []byte) ([]byte, error) {
+	if t.passthrough {
+		return in, nil
+	}
+
+	var err error
+	if t.pcm, err = t.dec.Decode(t.pcm[:0], in); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", t.From, err)
+	}
+	t.resampled = t.rs.Process(t.resampled[:0], t.pcm)
+	out, err := t.enc.Encode(nil, t.resampled)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", t.To, err)
+	}
+	return out, nil
+}
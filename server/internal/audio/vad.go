@@ -0,0 +1,207 @@
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+// VADConfig 本地语音活动检测参数；零值字段使用默认值
+type VADConfig struct {
+	// SampleRate 输入 PCM 的采样率
+	SampleRate int
+	// FrameDuration 分析帧长，默认 20ms
+	FrameDuration time.Duration
+	// ThresholdDB 绝对能量门限（dBFS），低于它的帧一律视为静音，默认 -45
+	ThresholdDB float64
+	// NoiseMarginDB 帧能量需要高出自适应底噪多少 dB 才算语音，默认 12
+	NoiseMarginDB float64
+	// MinSpeech 连续语音达到该时长才判定开口（抗咳嗽/敲桌子），默认 120ms
+	MinSpeech time.Duration
+	// Hangover 连续静音达到该时长才判定说完（容忍句中停顿），默认 500ms
+	Hangover time.Duration
+}
+
+func (c VADConfig) withDefaults() VADConfig {
+	if c.SampleRate <= 0 {
+		c.SampleRate = 24000
+	}
+	if c.FrameDuration <= 0 {
+		c.FrameDuration = 20 * time.Millisecond
+	}
+	if c.ThresholdDB == 0 {
+		c.ThresholdDB = -45
+	}
+	if c.NoiseMarginDB == 0 {
+		c.NoiseMarginDB = 12
+	}
+	if c.MinSpeech <= 0 {
+		c.MinSpeech = 120 * time.Millisecond
+	}
+	if c.Hangover <= 0 {
+		c.Hangover = 500 * time.Millisecond
+	}
+	return c
+}
+
+// VADEventType 语音活动事件类型
+type VADEventType int
+
+const (
+	VADSpeechStarted VADEventType = iota + 1
+	VADSpeechStopped
+)
+
+func (t VADEventType) String() string {
+	switch t {
+	case VADSpeechStarted:
+		return "speech_started"
+	case VADSpeechStopped:
+		return "speech_stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// VADEvent 一次状态切换。At 是语音（或静音）真正开始的位置（相对流起点），
+// 事件本身要在 MinSpeech / Hangover 之后才能确认，二者之差就是检测延迟。
+type VADEvent struct {
+	Type VADEventType
+	At   time.Duration
+}
+
+// 底噪跟踪系数：下降快、上升慢。语音的音节间隙会迅速把底噪拉回真实水平，
+// 持续的背景噪声（风扇、空调）则会在几秒内被吸收进底噪，不会一直被当成语音。
+const (
+	noiseFloorDownAlpha = 0.3
+	noiseFloorUpAlpha   = 0.005
+)
+
+// VAD 基于短时能量 + 自适应底噪的语音活动检测器，流式处理，不可并发使用。
+type VAD struct {
+	cfg        VADConfig
+	frameSize  int
+	minFrames  int
+	hangFrames int
+	pending    []int16
+	frames     int64 // 已处理的帧数
+	noiseFloor float64
+
+	speaking  bool
+	run       int   // 当前状态下相反判定的连续帧数
+	runStart  int64 // 连续段起始帧
+	lastLevel float64
+}
+
+// NewVAD 创建检测器
+func NewVAD(cfg VADConfig) *VAD {
+	cfg = cfg.withDefaults()
+	frameSize := int(int64(cfg.SampleRate) * int64(cfg.FrameDuration) / int64(time.Second))
+	if frameSize < 1 {
+		frameSize = 1
+	}
+	return &VAD{
+		cfg:        cfg,
+		frameSize:  frameSize,
+		minFrames:  framesFor(cfg.MinSpeech, cfg.FrameDuration),
+		hangFrames: framesFor(cfg.Hangover, cfg.FrameDuration),
+	}
+}
+
+func framesFor(d, frame time.Duration) int {
+	n := int((d + frame - 1) / frame)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Speaking 当前是否处于说话状态
+func (v *VAD) Speaking() bool {
+	return v.speaking
+}
+
+// Level 最近一帧的能量（dBFS）
+func (v *VAD) Level() float64 {
+	return v.lastLevel
+}
+
+// Process 处理一块 PCM，返回本块内确认的状态切换；不足一帧的尾巴留到下一块
+func (v *VAD) Process(pcm []int16) []VADEvent {
+	var events []VADEvent
+	v.pending = append(v.pending, pcm...)
+	for len(v.pending) >= v.frameSize {
+		if evt, ok := v.processFrame(v.pending[:v.frameSize]); ok {
+			events = append(events, evt)
+		}
+		v.pending = v.pending[v.frameSize:]
+	}
+	// 避免 pending 底层数组无限增长
+	if cap(v.pending) > 8*v.frameSize {
+		v.pending = append([]int16(nil), v.pending...)
+	}
+	return events
+}
+
+func (v *VAD) processFrame(frame []int16) (VADEvent, bool) {
+	level := frameLevelDB(frame)
+	v.lastLevel = level
+	index := v.frames
+	v.frames++
+
+	// 第一帧只用来校准底噪：麦克风通常在开口前就已打开，流的开头是环境声
+	if index == 0 {
+		v.noiseFloor = level
+		return VADEvent{}, false
+	}
+
+	voiced := level > v.cfg.ThresholdDB && level > v.noiseFloor+v.cfg.NoiseMarginDB
+	if level < v.noiseFloor {
+		v.noiseFloor += noiseFloorDownAlpha * (level - v.noiseFloor)
+	} else {
+		v.noiseFloor += noiseFloorUpAlpha * (level - v.noiseFloor)
+	}
+
+	// 与当前状态一致的帧打断“反向连续段”
+	if voiced == v.speaking {
+		v.run = 0
+		return VADEvent{}, false
+	}
+	if v.run == 0 {
+		v.runStart = index
+	}
+	v.run++
+
+	need := v.minFrames
+	if v.speaking {
+		need = v.hangFrames
+	}
+	if v.run < need {
+		return VADEvent{}, false
+	}
+
+	v.speaking = !v.speaking
+	v.run = 0
+	evt := VADEvent{Type: VADSpeechStopped, At: v.frameOffset(v.runStart)}
+	if v.speaking {
+		evt.Type = VADSpeechStarted
+	}
+	return evt, true
+}
+
+func (v *VAD) frameOffset(index int64) time.Duration {
+	return time.Duration(index) * v.cfg.FrameDuration
+}
+
+// frameLevelDB 帧的 RMS 能量（dBFS），全零帧返回 -100
+func frameLevelDB(frame []int16) float64 {
+	var sum float64
+	for _, s := range frame {
+		f := float64(s)
+		sum += f * f
+	}
+	mean := sum / float64(len(frame))
+	if mean <= 0 {
+		return -100
+	}
+	return 10 * math.Log10(mean/(32768.0*32768.0))
+}
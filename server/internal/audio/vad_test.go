@@ -0,0 +1,112 @@
+package audio
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+)
+
+// loadFixture 读取 testdata 下的 16-bit 单声道 WAV（标准 44 字节头）
+func loadFixture(t *testing.T, name string) ([]int16, int) {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	if len(data) < 44 || string(data[0:4]) != "RIFF" || string(data[36:40]) != "data" {
+		t.Fatalf("%s: unexpected wav layout", name)
+	}
+	rate := int(binary.LittleEndian.Uint32(data[24:28]))
+	pcm, _ := (&pcm16Codec{}).Decode(nil, data[44:])
+	return pcm, rate
+}
+
+// runVAD 以 20ms 一块喂入，模拟网关收到的上行分块
+func runVAD(cfg VADConfig, pcm []int16) []VADEvent {
+	vad := NewVAD(cfg)
+	chunk := cfg.SampleRate / 50
+	var events []VADEvent
+	for i := 0; i < len(pcm); i += chunk {
+		end := i + chunk
+		if end > len(pcm) {
+			end = len(pcm)
+		}
+		events = append(events, vad.Process(pcm[i:end])...)
+	}
+	return events
+}
+
+func TestVAD_SpeechWithPausesFixture(t *testing.T) {
+	// speech_pauses_16k.wav：-55dBFS 底噪上三段合成浊音
+	// 0.6–1.8s、2.2–3.0s（中间 400ms 停顿，短于 hangover，应视为同一轮）、4.2–4.8s
+	pcm, rate := loadFixture(t, "speech_pauses_16k.wav")
+	events := runVAD(VADConfig{SampleRate: rate}, pcm)
+
+	want := []VADEvent{
+		{VADSpeechStarted, 600 * time.Millisecond},
+		{VADSpeechStopped, 3000 * time.Millisecond},
+		{VADSpeechStarted, 4200 * time.Millisecond},
+		{VADSpeechStopped, 4800 * time.Millisecond},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %+v, want %d events", events, len(want))
+	}
+	const tolerance = 60 * time.Millisecond
+	for i, evt := range events {
+		diff := evt.At - want[i].At
+		if diff < 0 {
+			diff = -diff
+		}
+		if evt.Type != want[i].Type || diff > tolerance {
+			t.Errorf("event %d = %s@%v, want %s@%v (±%v)", i, evt.Type, evt.At, want[i].Type, want[i].At, tolerance)
+		}
+	}
+}
+
+func TestVAD_IgnoresBackgroundNoiseAndClicks(t *testing.T) {
+	// background_noise_16k.wav：-38dBFS 的风扇噪声，2.0s 处一次 60ms 的敲击
+	pcm, rate := loadFixture(t, "background_noise_16k.wav")
+	if events := runVAD(VADConfig{SampleRate: rate}, pcm); len(events) != 0 {
+		t.Fatalf("expected no events, got %+v", events)
+	}
+}
+
+func TestVAD_ChunkingDoesNotChangeResult(t *testing.T) {
+	pcm, rate := loadFixture(t, "speech_pauses_16k.wav")
+	whole := NewVAD(VADConfig{SampleRate: rate}).Process(pcm)
+
+	vad := NewVAD(VADConfig{SampleRate: rate})
+	var chunked []VADEvent
+	for i := 0; i < len(pcm); i += 333 {
+		end := i + 333
+		if end > len(pcm) {
+			end = len(pcm)
+		}
+		chunked = append(chunked, vad.Process(pcm[i:end])...)
+	}
+
+	if len(whole) != len(chunked) {
+		t.Fatalf("whole=%+v chunked=%+v", whole, chunked)
+	}
+	for i := range whole {
+		if whole[i] != chunked[i] {
+			t.Errorf("event %d: whole=%+v chunked=%+v", i, whole[i], chunked[i])
+		}
+	}
+}
+
+func TestVAD_ThresholdsAreConfigurable(t *testing.T) {
+	pcm, rate := loadFixture(t, "speech_pauses_16k.wav")
+
+	// hangover 短于 400ms 的句中停顿时，第一轮被切成两段
+	events := runVAD(VADConfig{SampleRate: rate, Hangover: 200 * time.Millisecond}, pcm)
+	if len(events) != 6 {
+		t.Errorf("short hangover events = %+v, want 6", events)
+	}
+
+	// 绝对门限高于合成语音电平时什么都检测不到
+	if events := runVAD(VADConfig{SampleRate: rate, ThresholdDB: -3}, pcm); len(events) != 0 {
+		t.Errorf("high threshold events = %+v, want none", events)
+	}
+}
@@ -10,17 +10,19 @@ import (
 
 // Config 全局配置
 type Config struct {
-	Server   ServerConfig           `yaml:"server"`
-	OpenAI   OpenAIConfig           `yaml:"openai"`
-	LLM      LLMConfig              `yaml:"llm"`
-	Gateway  GatewayConfig          `yaml:"gateway"`
-	Director DirectorConfig         `yaml:"director"`
-	Actor    ActorConfig            `yaml:"actor"`
-	Session  SessionConfig          `yaml:"session"`
-	Learning LearningConfig         `yaml:"learning"`
-	Logging  LoggingConfig          `yaml:"logging"`
-	Paths    PathsConfig            `yaml:"paths"`
-	Roles    map[string]RoleProfile `yaml:"roles"`
+	Server    ServerConfig           `yaml:"server"`
+	OpenAI    OpenAIConfig           `yaml:"openai"`
+	LLM       LLMConfig              `yaml:"llm"`
+	Gateway   GatewayConfig          `yaml:"gateway"`
+	Director  DirectorConfig         `yaml:"director"`
+	Actor     ActorConfig            `yaml:"actor"`
+	Session   SessionConfig          `yaml:"session"`
+	Learning  LearningConfig         `yaml:"learning"`
+	Logging   LoggingConfig          `yaml:"logging"`
+	Paths     PathsConfig            `yaml:"paths"`
+	Roles     map[string]RoleProfile `yaml:"roles"`
+	Usage     UsageConfig            `yaml:"usage"`
+	Recording RecordingConfig        `yaml:"recording"`
 }
 
 type ServerConfig struct {
@@ -28,23 +30,55 @@ type ServerConfig struct {
 	Port         int           `yaml:"port"`
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// DebugTimelineStream 注册 /api/debug/timeline/stream（所有会话的 Timeline firehose，无鉴权），只在调试环境打开
+	DebugTimelineStream bool `yaml:"debug_timeline_stream"`
 }
 
 type OpenAIConfig struct {
-	APIKey                  string  `yaml:"api_key"`
-	RealtimeURL             string  `yaml:"realtime_url"`
-	Model                   string  `yaml:"model"`
-	Voice                   string  `yaml:"voice"`
-	Temperature             float64 `yaml:"temperature"`
-	MaxResponseOutputTokens int     `yaml:"max_response_output_tokens"`
+	APIKey                  string            `yaml:"api_key"`
+	RealtimeURL             string            `yaml:"realtime_url"`
+	RealtimeHeaders         map[string]string `yaml:"realtime_headers"` // 额外握手头（代理认证等）
+	Model                   string            `yaml:"model"`
+	Voice                   string            `yaml:"voice"`
+	Temperature             float64           `yaml:"temperature"`
+	MaxResponseOutputTokens int               `yaml:"max_response_output_tokens"`
 }
 
 // LLMConfig LLM 决策配置（用于导演引擎）
 type LLMConfig struct {
-	Provider  string            `yaml:"provider"` // "openai", "anthropic" or "talopenai"
-	OpenAI    LLMProviderConfig `yaml:"openai"`
-	Anthropic LLMProviderConfig `yaml:"anthropic"`
-	TalOpenAI LLMProviderConfig `yaml:"talopenai"`
+	Provider         string            `yaml:"provider"` // "openai", "anthropic", "talopenai" or "openai_compatible"
+	OpenAI           LLMProviderConfig `yaml:"openai"`
+	Anthropic        LLMProviderConfig `yaml:"anthropic"`
+	TalOpenAI        LLMProviderConfig `yaml:"talopenai"`
+	OpenAICompatible LLMProviderConfig `yaml:"openai_compatible"`
+	Cache            LLMCacheConfig    `yaml:"cache"`
+}
+
+// ActiveProvider 返回当前 provider 的配置（可修改）；未知 provider 返回 nil
+func (c *LLMConfig) ActiveProvider() *LLMProviderConfig {
+	switch c.Provider {
+	case "openai":
+		return &c.OpenAI
+	case "anthropic":
+		return &c.Anthropic
+	case "talopenai":
+		return &c.TalOpenAI
+	case "openai_compatible":
+		return &c.OpenAICompatible
+	default:
+		return nil
+	}
+}
+
+// LLMCacheConfig 导演子调用（对齐度/剧本修订/进度摘要）的响应缓存配置
+type LLMCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxEntries 内存 LRU 容量，0 使用默认值
+	MaxEntries int `yaml:"max_entries"`
+	// Dir 可选磁盘层目录，为空只用内存
+	Dir string `yaml:"dir"`
+	// TTLs 缓存名 -> TTL：schema 名，或无 schema 调用通过 llm.WithCacheTag 打的标签；未列出的不缓存
+	TTLs map[string]time.Duration `yaml:"ttls"`
 }
 
 // LLMProviderConfig LLM 提供商配置
@@ -54,11 +88,46 @@ type LLMProviderConfig struct {
 	Model       string  `yaml:"model"`
 	Temperature float64 `yaml:"temperature"`
 	MaxTokens   int     `yaml:"max_tokens"`
+
+	// 以下字段目前只对 openai_compatible（自部署模型）生效
+	// Headers 额外请求头（如网关鉴权、租户标识），会覆盖默认请求头
+	Headers map[string]string `yaml:"headers"`
+	// SupportsJSONSchema 服务端是否支持 response_format=json_schema；
+	// 为 false 时改为提示词约束 + 从返回内容中提取 JSON
+	SupportsJSONSchema bool `yaml:"supports_json_schema"`
+	// Timeout 单次请求超时，0 表示使用客户端默认值
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// UsageConfig 用量与成本核算配置
+type UsageConfig struct {
+	Budget UsageBudgetConfig `yaml:"budget"`
+	// Pricing 按模型名配置价目（美元 / 百万 token），未配置的模型只统计 token 不折算费用
+	Pricing map[string]ModelPricing `yaml:"pricing"`
+}
+
+// UsageBudgetConfig 单会话预算上限，0 表示不限制。
+// 超出后导演进入收束模式（Wrap/ExitTicket），不会强行断开会话。
+type UsageBudgetConfig struct {
+	MaxSessionTokens  int     `yaml:"max_session_tokens"`
+	MaxSessionCostUSD float64 `yaml:"max_session_cost_usd"`
+}
+
+// ModelPricing 模型价目（美元 / 百万 token）
+type ModelPricing struct {
+	InputPerMTok       float64 `yaml:"input_per_mtok"`
+	CachedInputPerMTok float64 `yaml:"cached_input_per_mtok"`
+	OutputPerMTok      float64 `yaml:"output_per_mtok"`
+	// Realtime 音频 token 单独计价；为 0 时按文本价计
+	AudioInputPerMTok  float64 `yaml:"audio_input_per_mtok"`
+	AudioOutputPerMTok float64 `yaml:"audio_output_per_mtok"`
 }
 
 type RoleProfile struct {
 	Voice  string `yaml:"voice"`
 	Avatar string `yaml:"avatar"`
+	// Name 展示名（导出文字稿等），为空时用角色 ID
+	Name string `yaml:"name"`
 }
 
 type GatewayConfig struct {
@@ -67,6 +136,67 @@ type GatewayConfig struct {
 	OutputAudioFormat            string        `yaml:"output_audio_format"`
 	InputAudioTranscriptionModel string        `yaml:"input_audio_transcription_model"`
 	PingInterval                 time.Duration `yaml:"ping_interval"`
+	// 客户端侧默认音频格式（如 pcm16@16000、g711_ulaw），为空与上面的 Realtime 侧相同；
+	// 客户端也可以在 /stream 上用 input_format / output_format 查询参数按连接指定
+	ClientInputAudioFormat  string `yaml:"client_input_audio_format"`
+	ClientOutputAudioFormat string `yaml:"client_output_audio_format"`
+	// 断线续传：客户端断开后保留网关的时长（0 表示断开即关闭）与补发缓冲条数
+	ResumeGracePeriod time.Duration `yaml:"resume_grace_period"`
+	ReplayBufferSize  int           `yaml:"replay_buffer_size"`
+	// SpeechTTL 角色发言在队列里等待开播的时限，超时丢弃并记录 speech_dropped
+	SpeechTTL time.Duration `yaml:"speech_ttl"`
+	// LocalVAD 网关侧本地语音活动检测，比服务端 VAD 更早发现用户插话
+	LocalVAD LocalVADConfig `yaml:"local_vad"`
+	// RealtimePingInterval 角色 Realtime 连接的保活 ping 周期，连续 3 个周期无任何帧判定断线并重连
+	RealtimePingInterval time.Duration `yaml:"realtime_ping_interval"`
+	// RoleReconnectAttempts 角色连接断线后的重连次数，全部失败则该角色暂不可用，转入后台重试
+	RoleReconnectAttempts int `yaml:"role_reconnect_attempts"`
+	// RoleRecoveryInterval 不可用角色（含 ASR 连接）后台重试的初始间隔，之后逐次翻倍，封顶 1 分钟
+	RoleRecoveryInterval time.Duration `yaml:"role_recovery_interval"`
+	// HistoryWindow 镜像到各角色连接的对话只保留最近这么多轮，更早的删除；0 表示不限制
+	HistoryWindow int `yaml:"history_window"`
+	// HistorySummary 滑出窗口的轮次用 LLM 合并成滚动摘要，作为 system item 注入角色连接
+	HistorySummary bool `yaml:"history_summary"`
+	// WarmPool 跨会话共享的 Realtime 角色连接预热池，消除新会话首句的建连等待
+	WarmPool WarmPoolConfig `yaml:"warm_pool"`
+}
+
+// LocalVADConfig 本地 VAD 参数（默认关闭）；零值字段使用内置默认值
+type LocalVADConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ThresholdDB 绝对能量门限（dBFS）
+	ThresholdDB float64 `yaml:"threshold_db"`
+	// NoiseMarginDB 高出自适应底噪多少 dB 才算语音
+	NoiseMarginDB float64 `yaml:"noise_margin_db"`
+	// MinSpeech 连续语音达到该时长才判定开口
+	MinSpeech time.Duration `yaml:"min_speech"`
+	// Hangover 连续静音达到该时长才判定说完
+	Hangover time.Duration `yaml:"hangover"`
+}
+
+// WarmPoolConfig 角色连接预热池（默认关闭）；按 roles 中配置的音色预热
+type WarmPoolConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MinIdle 每个音色至少保持的空闲连接数
+	MinIdle int `yaml:"min_idle"`
+	// MaxIdle 每个音色最多保留的空闲连接数，会话归还时超出的连接直接关闭
+	MaxIdle int `yaml:"max_idle"`
+	// MaxAge 连接最长寿命，超过后淘汰（Realtime 会话有时长上限）
+	MaxAge time.Duration `yaml:"max_age"`
+	// HealthInterval 空闲连接 ping 与淘汰检查的周期
+	HealthInterval time.Duration `yaml:"health_interval"`
+}
+
+// RecordingConfig 服务端会话录音（默认关闭）
+type RecordingConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+	// MaxAge 超过该时长的会话录音会被清理，0 表示不按时间清理
+	MaxAge time.Duration `yaml:"max_age"`
+	// MaxSessions 最多保留多少个会话的录音，0 表示不限制
+	MaxSessions int `yaml:"max_sessions"`
+	// MaxTakeDuration 单次连接每条轨道的最长录制时长，0 表示不限制
+	MaxTakeDuration time.Duration `yaml:"max_take_duration"`
 }
 
 type DirectorConfig struct {
@@ -78,6 +208,10 @@ type DirectorConfig struct {
 	DefaultTalkBurstLimit  int      `yaml:"default_talk_burst_limit"`
 	HighLoadTalkBurstLimit int      `yaml:"high_load_talk_burst_limit"`
 	OutputClockThreshold   int      `yaml:"output_clock_threshold"`
+	// StreamEarlyStart 流式决策：role_id 与 scene_direction 开头到达后就让第一个角色开口
+	StreamEarlyStart bool `yaml:"stream_early_start"`
+	// EarlyStartMinChars 提前开口前 scene_direction 至少要到达的字数（<=0 使用默认值）
+	EarlyStartMinChars int `yaml:"early_start_min_chars"`
 }
 
 type ActorConfig struct {
@@ -136,20 +270,7 @@ func Load(path string) (*Config, error) {
 	}
 
 	// LLM API keys
-	if llmKey := os.Getenv("LLM_API_KEY"); llmKey != "" {
-		fmt.Printf("🔑 Using LLM_API_KEY from environment variable\n")
-		if cfg.LLM.Provider == "openai" {
-			cfg.LLM.OpenAI.APIKey = llmKey
-		} else if cfg.LLM.Provider == "anthropic" {
-			cfg.LLM.Anthropic.APIKey = llmKey
-		} else if cfg.LLM.Provider == "talopenai" {
-			cfg.LLM.TalOpenAI.APIKey = llmKey
-		}
-	}
-	if anthropicKey := os.Getenv("ANTHROPIC_API_KEY"); anthropicKey != "" {
-		fmt.Printf("🔑 Using ANTHROPIC_API_KEY from environment variable\n")
-		cfg.LLM.Anthropic.APIKey = anthropicKey
-	}
+	cfg.applyLLMKeyEnv(func(format string, args ...interface{}) { fmt.Printf(format, args...) })
 
 	if model := os.Getenv("OPENAI_REALTIME_MODEL"); model != "" {
 		fmt.Printf("🤖 Using OPENAI_REALTIME_MODEL from environment: %s\n", model)
@@ -191,3 +312,52 @@ func (c *Config) Validate() error {
 	}
 	return nil
 }
+
+// LoadOffline 读取配置并应用 LLM API Key 环境变量（离线工具用：不打印、不校验 Realtime 相关配置）
+func LoadOffline(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	cfg.applyLLMKeyEnv(func(string, ...interface{}) {})
+	return &cfg, nil
+}
+
+// applyLLMKeyEnv 用环境变量覆盖 LLM API Key
+func (c *Config) applyLLMKeyEnv(logf func(format string, args ...interface{})) {
+	if llmKey := os.Getenv("LLM_API_KEY"); llmKey != "" {
+		logf("🔑 Using LLM_API_KEY from environment variable\n")
+		if c.LLM.Provider == "openai" {
+			c.LLM.OpenAI.APIKey = llmKey
+		} else if c.LLM.Provider == "anthropic" {
+			c.LLM.Anthropic.APIKey = llmKey
+		} else if c.LLM.Provider == "talopenai" {
+			c.LLM.TalOpenAI.APIKey = llmKey
+		} else if c.LLM.Provider == "openai_compatible" {
+			c.LLM.OpenAICompatible.APIKey = llmKey
+		}
+	}
+	if anthropicKey := os.Getenv("ANTHROPIC_API_KEY"); anthropicKey != "" {
+		logf("🔑 Using ANTHROPIC_API_KEY from environment variable\n")
+		c.LLM.Anthropic.APIKey = anthropicKey
+	}
+}
+
+// LoadRoles 只读取配置文件里的角色配置（离线工具用：不打印、不校验 API Key）
+func LoadRoles(path string) (map[string]RoleProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var cfg struct {
+		Roles map[string]RoleProfile `yaml:"roles"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	return cfg.Roles, nil
+}
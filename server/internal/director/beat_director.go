@@ -76,12 +76,16 @@ func NewDirectorEngine(cfg *config.Config, llmClient llm.Client) *DirectorEngine
 // Decide 生成导演计划
 // 这是导演引擎的核心方法，负责决定下一个拍点和角色
 func (d *DirectorEngine) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
-	ctx := context.Background()
+	return d.DecideContext(context.Background(), state, userInput)
+}
 
+// DecideContext 实现 ContextDirector 接口。
+func (d *DirectorEngine) DecideContext(ctx context.Context, state *model.SessionState, userInput string) model.DirectorPlan {
 	var decision decisionPlan
 
 	// 如果启用 LLM，让 LLM 完全负责推断（包括 FlowMode）
-	if d.config.EnableLLM && d.llmClient != nil {
+	// 预算已超时不再调用 LLM，直接由规则 + 护栏收束到 exit_ticket。
+	if d.config.EnableLLM && d.llmClient != nil && !state.BudgetExceeded {
 		llmDecision, err := d.decideLLM(ctx, state, userInput)
 		if err != nil {
 			log.Printf("⚠️ LLM decision failed, falling back to rules: %v", err)
@@ -107,10 +111,20 @@ func (d *DirectorEngine) Decide(state *model.SessionState, userInput string) mod
 	return model.DirectorPlan{
 		NextRole:    decision.NextRole,
 		Instruction: d.buildInstruction(state, userInput, decision),
+		Beat:        decision.NextBeat,
+		Priority:    beatPriority(decision.NextBeat),
 		Debug:       decision.Debug,
 	}
 }
 
+// beatPriority 拍点对应的发言优先级：twist 是当场挑战用户的假设，要趁热插话，抢占正在播的发言
+func beatPriority(beat string) string {
+	if beat == "twist" {
+		return "urgent"
+	}
+	return ""
+}
+
 // buildInstruction 将内部决策渲染为可执行的导演指令文本。
 // TODO 是不是考虑更加完善的提示词，以方便actor更好地执行呢？比如TensionGoal说提升和降低是不是对于角色过于抽象呢？
 func (d *DirectorEngine) buildInstruction(
@@ -520,6 +534,11 @@ func (d *DirectorEngine) decideWithRules(
 
 // applyGuardrails 应用硬约束
 func (d *DirectorEngine) applyGuardrails(plan decisionPlan, state *model.SessionState) decisionPlan {
+	// 预算已超：强制进入收束拍点
+	if state.BudgetExceeded && contains(d.availableBeats, "exit_ticket") {
+		plan.NextBeat = "exit_ticket"
+	}
+
 	// 验证 next_beat 在可用列表中
 	if !contains(d.availableBeats, plan.NextBeat) {
 		log.Printf("⚠️ Invalid beat '%s', falling back to 'check'", plan.NextBeat)
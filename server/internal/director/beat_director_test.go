@@ -465,6 +465,18 @@ func TestRoleRotation(t *testing.T) {
 	}
 }
 
+// TestBeatPriority 测试拍点对应的发言优先级：只有 twist 是紧急插话
+func TestBeatPriority(t *testing.T) {
+	if p := beatPriority("twist"); p != "urgent" {
+		t.Errorf("twist priority = %q", p)
+	}
+	for _, beat := range []string{"reveal", "check", "continue", ""} {
+		if p := beatPriority(beat); p != "" {
+			t.Errorf("%s priority = %q, want default", beat, p)
+		}
+	}
+}
+
 // TestDetermineTalkBurstLimit 测试说话时长限制
 func TestDetermineTalkBurstLimit(t *testing.T) {
 	cfg := &config.Config{
@@ -0,0 +1,136 @@
+package director
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/config"
+	"bubble-talk/server/internal/llm"
+	"bubble-talk/server/internal/model"
+)
+
+// 重新录制磁带：
+//
+//	BUBBLE_RECORD_CASSETTES=1 LLM_API_KEY=sk-... go test ./server/internal/director -run Cassette
+//
+// 默认离线回放 testdata/cassettes 下的磁带；提示词有实质改动时回放会未命中并直接失败，需重新录制。
+const recordCassettesEnv = "BUBBLE_RECORD_CASSETTES"
+
+// cassetteClient 按环境变量选择录制（真实 LLM）或回放客户端。
+func cassetteClient(t *testing.T, name string) (llm.Client, func()) {
+	t.Helper()
+	path := filepath.Join("testdata", "cassettes", name)
+
+	if os.Getenv(recordCassettesEnv) == "" {
+		replay, err := llm.NewReplayClient(path)
+		if err != nil {
+			t.Fatalf("load cassette: %v", err)
+		}
+		if replay.Synthetic() {
+			t.Logf("cassette %s is a synthetic fixture, not a recorded provider session", name)
+		}
+		return replay, func() {
+			if unused := replay.Unused(); len(unused) > 0 {
+				t.Errorf("cassette %s has %d unused interactions: %v (director made fewer calls than recorded)", name, len(unused), unused)
+			}
+		}
+	}
+
+	apiKey := os.Getenv("LLM_API_KEY")
+	if apiKey == "" {
+		t.Skipf("%s set but LLM_API_KEY is empty", recordCassettesEnv)
+	}
+	real, err := llm.NewClient(&config.Config{LLM: config.LLMConfig{
+		Provider: "openai",
+		OpenAI: config.LLMProviderConfig{
+			APIKey:      apiKey,
+			APIURL:      "https://api.openai.com/v1",
+			Model:       "gpt-4o-mini",
+			Temperature: 0.7,
+			MaxTokens:   2000,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("create LLM client: %v", err)
+	}
+	t.Logf("🎙️  recording cassette to %s", path)
+	return llm.NewRecordingClient(real, path), func() {}
+}
+
+// TestDirectorEngine_CassetteMultiTurn 回放一段三轮的导演决策磁带，验证多轮行为稳定。
+// 每一轮都从上一轮的决策与对话推进状态，因此能覆盖 MockLLMClient 无法覆盖的多轮路径。
+// 仓库里的磁带目前是合成夹具（source=synthetic），只验证解析与流程；真实模型基线需重新录制。
+func TestDirectorEngine_CassetteMultiTurn(t *testing.T) {
+	client, verify := cassetteClient(t, "beat_director_multiturn.json")
+	defer verify()
+
+	cfg := &config.Config{Director: config.DirectorConfig{
+		EnableLLM:      true,
+		AvailableRoles: []string{"host", "economist", "skeptic"},
+	}}
+	d := NewDirectorEngine(cfg, client)
+
+	base := time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC)
+	state := &model.SessionState{
+		SessionID:       "cassette_session",
+		EntryID:         "econ_weekend_overtime",
+		MainObjective:   "理解机会成本：选择的代价是放弃的最好替代",
+		AvailableRoles:  []string{"host", "economist", "skeptic"},
+		MasteryEstimate: 0.2,
+		TensionLevel:    3,
+		CognitiveLoad:   3,
+	}
+
+	turns := []struct {
+		userInput string
+		// reply 模拟该轮角色说出的台词，用于推进下一轮的对话历史
+		reply    string
+		wantRole string
+		wantBeat string
+	}{
+		{
+			userInput: "",
+			reply:     "周末加班多赚800块，朋友约你看演唱会你没去——你觉得这周是赚了还是亏了？",
+			wantRole:  "host",
+			wantBeat:  "reveal",
+		},
+		{
+			userInput: "肯定是赚了啊，多了800块",
+			reply:     "别急着算钱。你放弃的那场演唱会，对你来说值多少？",
+			wantRole:  "economist",
+			wantBeat:  "twist",
+		},
+		{
+			userInput: "哦……那演唱会也算成本？",
+			reply:     "对，放弃的最好选择就是你的机会成本。用你自己的话说说看？",
+			wantRole:  "economist",
+			wantBeat:  "check",
+		},
+	}
+
+	ctx := context.Background()
+	for i, turn := range turns {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		if turn.userInput != "" {
+			state.Turns = append(state.Turns, model.Turn{Role: "user", Text: turn.userInput, TS: ts})
+			state.Signals.LastUserChars = len([]rune(turn.userInput))
+			state.Signals.LastUserLatencyMS = 1800
+		}
+
+		// 直接调用 decideLLM：回放未命中时必须失败，而不是像 Decide 那样静默降级到规则。
+		decision, err := d.decideLLM(ctx, state, turn.userInput)
+		if err != nil {
+			t.Fatalf("turn %d: %v", i+1, err)
+		}
+		decision = d.applyGuardrails(decision, state)
+
+		if decision.NextRole != turn.wantRole || decision.NextBeat != turn.wantBeat {
+			t.Errorf("turn %d: expected %s/%s, got %s/%s", i+1, turn.wantRole, turn.wantBeat, decision.NextRole, decision.NextBeat)
+		}
+
+		state.Turns = append(state.Turns, model.Turn{Role: decision.NextRole, Text: turn.reply, TS: ts.Add(10 * time.Second)})
+	}
+}
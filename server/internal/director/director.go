@@ -1,6 +1,7 @@
 package director
 
 import (
+	"context"
 	"strings"
 
 	"bubble-talk/server/internal/config"
@@ -14,6 +15,51 @@ type Director interface {
 	Decide(state *model.SessionState, userInput string) model.DirectorPlan
 }
 
+// ContextDirector 是可选能力：支持透传 ctx 的导演实现。
+// ctx 上可能挂有取消信号、用量观察者等，导演内部的 LLM 调用都应使用它。
+type ContextDirector interface {
+	DecideContext(ctx context.Context, state *model.SessionState, userInput string) model.DirectorPlan
+}
+
+// DecideWithContext 优先走 DecideContext，不支持时退回 Decide。
+func DecideWithContext(ctx context.Context, d Director, state *model.SessionState, userInput string) model.DirectorPlan {
+	if cd, ok := d.(ContextDirector); ok {
+		return cd.DecideContext(ctx, state, userInput)
+	}
+	return d.Decide(state, userInput)
+}
+
+// EarlyStartFunc 流式决策的提前开口回调。
+// plan.NextRole 是已完整到达并通过校验的角色序列，plan.Instruction 只基于 scene_direction 的开头生成；
+// 每次决策最多回调一次，最终计划仍以 Decide 的返回值为准。
+type EarlyStartFunc func(plan model.DirectorPlan)
+
+type earlyStartKey struct{}
+
+// WithEarlyStart 在 ctx 上挂提前开口回调。导演只有在拿到回调且配置开启时才走流式决策。
+func WithEarlyStart(ctx context.Context, fn EarlyStartFunc) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, earlyStartKey{}, fn)
+}
+
+// EarlyStartFromContext 取出 ctx 上的提前开口回调（没有时返回 nil），供包外的导演实现使用。
+func EarlyStartFromContext(ctx context.Context) EarlyStartFunc {
+	fn, _ := ctx.Value(earlyStartKey{}).(EarlyStartFunc)
+	return fn
+}
+
+// normalizePriority 规整导演给出的发言优先级；normal 与无法识别的值返回空串（网关按 normal 处理）。
+func normalizePriority(priority string) string {
+	switch p := strings.ToLower(strings.TrimSpace(priority)); p {
+	case "low", "urgent":
+		return p
+	default:
+		return ""
+	}
+}
+
 // NewDirector 根据配置选择导演实现。
 // 默认返回经典 DirectorEngine，避免影响现有行为。
 func NewDirector(cfg *config.Config, llmClient llm.Client) Director {
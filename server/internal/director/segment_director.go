@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // SegmentDirector 基于 Segment 的导演引擎
@@ -34,7 +35,11 @@ type SegmentDirector struct {
 // Decide 实现 Director 接口。
 // 将 SegmentPlan 映射为通用 DirectorPlan（角色 + 指令）。
 func (d *SegmentDirector) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
-	ctx := context.Background()
+	return d.DecideContext(context.Background(), state, userInput)
+}
+
+// DecideContext 实现 ContextDirector 接口。
+func (d *SegmentDirector) DecideContext(ctx context.Context, state *model.SessionState, userInput string) model.DirectorPlan {
 	segmentPlan, err := d.DecideSegment(ctx, state, userInput)
 	if err != nil {
 		log.Printf("⚠️ Segment decision failed, falling back to minimal directive: %v", err)
@@ -47,7 +52,35 @@ func (d *SegmentDirector) Decide(state *model.SessionState, userInput string) mo
 	return model.DirectorPlan{
 		NextRole:    segmentPlan.RoleID,
 		Instruction: d.buildSegmentInstruction(state, userInput, segmentPlan),
+		Scene:       d.buildScene(state, userInput, segmentPlan),
+		SegmentID:   segmentPlan.SegmentID,
+		Priority:    normalizePriority(segmentPlan.Priority),
+	}
+}
+
+// buildScene 把多角色片段的各拍映射为场景；每拍的指令 = 整段分镜 + 本角色这一拍的戏份
+func (d *SegmentDirector) buildScene(
+	state *model.SessionState,
+	userInput string,
+	plan *model.SegmentPlan,
+) []model.SceneBeat {
+	if len(plan.Beats) == 0 {
+		return nil
 	}
+	shared := d.buildSegmentInstruction(state, userInput, plan)
+	scene := make([]model.SceneBeat, 0, len(plan.Beats))
+	for i, beat := range plan.Beats {
+		scene = append(scene, model.SceneBeat{
+			Role:        beat.RoleID,
+			Instruction: beatInstruction(shared, i, len(plan.Beats), beat.Direction),
+		})
+	}
+	return scene
+}
+
+// beatInstruction 一拍的指令：整段分镜 + 本角色这一拍的戏份
+func beatInstruction(shared string, i, total int, direction string) string {
+	return shared + fmt.Sprintf("Your Beat (%d/%d): %s\n", i+1, total, direction)
 }
 
 func (d *SegmentDirector) fallbackRole(state *model.SessionState) string {
@@ -133,6 +166,11 @@ func (d *SegmentDirector) DecideSegment(
 		script = nil
 	}
 
+	// 预算已超：跳过对齐度/改剧本/进度摘要这些辅助调用，只做一次收束决策。
+	if state.BudgetExceeded {
+		return d.decideWrapUp(ctx, script, state, userInput)
+	}
+
 	// Step 2: 计算对齐度（如果有剧本）
 	alignmentScore := 0.5
 	alignmentMode := "ADAPT"
@@ -192,6 +230,41 @@ func (d *SegmentDirector) DecideSegment(
 	return segmentPlan, nil
 }
 
+// decideWrapUp 预算超限时的收束决策：候选只保留 Wrap/ExitTicket，沿用上一次的故事进度。
+func (d *SegmentDirector) decideWrapUp(
+	ctx context.Context,
+	script *model.Script,
+	state *model.SessionState,
+	userInput string,
+) (*model.SegmentPlan, error) {
+	log.Printf("💰 Session budget exceeded, director switching to wrap-up")
+
+	storyProgress := "对话已进行较长时间，需要收束。"
+	alignmentMode := "ADAPT"
+	if state.Script != nil {
+		if state.Script.StoryProgress != "" {
+			storyProgress = state.Script.StoryProgress
+		}
+		if state.Script.AlignmentMode != "" {
+			alignmentMode = state.Script.AlignmentMode
+		}
+	}
+
+	segmentPlan, err := d.decideSegmentWithLLM(
+		ctx,
+		script,
+		state,
+		userInput,
+		[]string{"Wrap", "ExitTicket"},
+		alignmentMode,
+		storyProgress,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("LLM wrap-up decision: %w", err)
+	}
+	return d.applySegmentGuardrails(segmentPlan, state), nil
+}
+
 // calculateAlignment 计算当前状态与剧本预期的对齐度
 func (d *SegmentDirector) calculateAlignment(
 	ctx context.Context,
@@ -266,6 +339,14 @@ func (d *SegmentDirector) calculateAlignment(
 		Strict: true,
 	}
 
+	// 语义缓存键：填充语不改变对齐度判断，按“去掉填充语后的输入”复用上次结果
+	ctx = llm.WithCacheKey(ctx, semanticCacheKey(
+		script.CurrentStory,
+		state.Script.StoryProgress,
+		lastMeaningfulUserInput(state, userInput),
+		fmt.Sprintf("%.2f|%v|%d", state.MasteryEstimate, state.MisconceptionTags, state.CognitiveLoad),
+	))
+
 	response, err := d.llmClient.Complete(ctx, messages, schema)
 	if err != nil {
 		log.Printf("⚠️ Alignment calculation failed: %v, using default 0.5", err)
@@ -411,6 +492,14 @@ func (d *SegmentDirector) shouldReviseScript(
 		Strict: true,
 	}
 
+	ctx = llm.WithCacheKey(ctx, semanticCacheKey(
+		script.OriginalStory,
+		script.CurrentStory,
+		state.Script.StoryProgress,
+		lastMeaningfulUserInput(state, userInput),
+		fmt.Sprintf("%.2f|%v|%.2f", state.MasteryEstimate, state.MisconceptionTags, alignmentScore),
+	))
+
 	response, err := d.llmClient.Complete(ctx, messages, schema)
 	if err != nil {
 		log.Printf("⚠️ Script revision check failed: %v", err)
@@ -440,6 +529,9 @@ func (d *SegmentDirector) shouldReviseScript(
 	}
 }
 
+// storyProgressCacheTag 故事摘要调用的缓存名（config llm.cache.ttls.story_progress）
+const storyProgressCacheTag = "story_progress"
+
 // summarizeStoryProgress 总结已发生的故事
 func (d *SegmentDirector) summarizeStoryProgress(
 	ctx context.Context,
@@ -503,6 +595,12 @@ func (d *SegmentDirector) summarizeStoryProgress(
 		{Role: "user", Content: userPrompt},
 	}
 
+	ctx = llm.WithCacheTag(ctx, storyProgressCacheTag)
+	ctx = llm.WithCacheKey(ctx, semanticCacheKey(
+		storyTurnsCacheKey(recentTurns),
+		fmt.Sprintf("%.2f|%v|%d", state.MasteryEstimate, state.MisconceptionTags, state.CognitiveLoad),
+	))
+
 	response, err := d.llmClient.Complete(ctx, messages, nil)
 	if err != nil {
 		log.Printf("⚠️ Story progress summary failed: %v", err)
@@ -512,6 +610,67 @@ func (d *SegmentDirector) summarizeStoryProgress(
 	return strings.TrimSpace(response)
 }
 
+// fillerUtterances 不推进剧情的填充语（语气词/附和），不应触发导演子调用重算。
+var fillerUtterances = map[string]bool{
+	"嗯": true, "嗯嗯": true, "恩": true, "哦": true, "噢": true, "啊": true, "呃": true,
+	"好": true, "好的": true, "好吧": true, "对": true, "对的": true, "是": true, "是的": true,
+	"行": true, "可以": true, "ok": true, "okay": true,
+}
+
+// isFillerUtterance 判断是否为填充语（去掉标点、空白后比对）
+func isFillerUtterance(text string) bool {
+	t := strings.ToLower(strings.TrimSpace(strings.Trim(strings.TrimSpace(text), "。，！？!?,.~～…")))
+	return t == "" || fillerUtterances[t]
+}
+
+// lastMeaningfulUserInput 当前输入是填充语时，回退到最近一次有实质内容的用户输入，
+// 使“说了句嗯”之后的子调用与上一轮命中同一个缓存键。
+func lastMeaningfulUserInput(state *model.SessionState, userInput string) string {
+	if !isFillerUtterance(userInput) {
+		return strings.TrimSpace(userInput)
+	}
+	for i := len(state.Turns) - 1; i >= 0; i-- {
+		turn := state.Turns[i]
+		if turn.Role == "user" && !isFillerUtterance(turn.Text) {
+			return strings.TrimSpace(turn.Text)
+		}
+	}
+	return ""
+}
+
+// storyTurnsCacheKey 故事摘要的语义键：只取到最近一次有实质内容的用户发言为止，并剔除填充语。
+// 代价是填充语之后的摘要会略微滞后于角色的最新台词，由缓存 TTL 兜底。
+func storyTurnsCacheKey(turns []model.Turn) string {
+	end := len(turns)
+	for i := len(turns) - 1; i >= 0; i-- {
+		if turns[i].Role == "user" && !isFillerUtterance(turns[i].Text) {
+			end = i + 1
+			break
+		}
+	}
+
+	var sb strings.Builder
+	for _, turn := range turns[:end] {
+		if turn.Role == "user" && isFillerUtterance(turn.Text) {
+			continue
+		}
+		sb.WriteString(turn.Role)
+		sb.WriteString(":")
+		sb.WriteString(strings.TrimSpace(turn.Text))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// subcallPromptVersion 子调用（对齐度/改剧本/进度摘要）user 提示词模板的版本。
+// system 提示词与 schema 由缓存层自动取指纹；改了 user 模板的措辞时递增它，让语义缓存失效。
+const subcallPromptVersion = "v1"
+
+// semanticCacheKey 拼接语义缓存键（由 llm.CachingClient 负责哈希）
+func semanticCacheKey(parts ...string) string {
+	return strings.Join(append([]string{subcallPromptVersion}, parts...), "\x1f")
+}
+
 // generateSegmentCandidates 生成候选 Segment 类型（应用硬约束）
 func (d *SegmentDirector) generateSegmentCandidates(
 	state *model.SessionState,
@@ -548,12 +707,16 @@ func (d *SegmentDirector) generateSegmentCandidates(
 	return candidates
 }
 
-var planData struct {
+// segmentPlanData 片段决策 LLM 输出的 JSON 结构（每次决策解码到局部变量，避免会话之间共享状态）
+type segmentPlanData struct {
 	RoleID         string   `json:"role_id"`
 	SceneDirection string   `json:"scene_direction"`
 	UserIntent     string   `json:"user_intent"`
 	UserMindState  []string `json:"user_mind_state"`
 
+	// 多角色顺序出场时每个角色的一拍
+	Beats []model.SegmentBeat `json:"beats"`
+
 	// response_approach 可能是 string 或 object
 	ResponseApproach responseApproach `json:"response_approach"`
 
@@ -575,6 +738,7 @@ var planData struct {
 	UserMustDoType   string `json:"user_must_do_type"`
 	UserMustDoPrompt string `json:"user_must_do_prompt"`
 	MaxDurationSec   int    `json:"max_duration_sec"`
+	Priority         string `json:"priority"`
 	ScriptReference  string `json:"script_reference"`
 	DirectorNotes    string `json:"director_notes"`
 }
@@ -646,6 +810,25 @@ func (d *SegmentDirector) decideSegmentWithLLM(
 					"type":        "string",
 					"description": "选择哪个角色主导这一段戏。支持单角色（如\"host\"）或多角色顺序（如\"host,economist\"，逗号分隔，不要空格）",
 				},
+				"beats": map[string]any{
+					"type":        "array",
+					"description": "多角色顺序出场时，按 role_id 的顺序给每个角色写一拍：说什么、怎么交给下一个角色。单角色时留空数组",
+					"items": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"role_id": map[string]any{
+								"type":        "string",
+								"description": "这一拍由哪个角色说",
+							},
+							"direction": map[string]any{
+								"type":        "string",
+								"description": "这一拍的具体戏份（50-150字）",
+							},
+						},
+						"required":             []string{"role_id", "direction"},
+						"additionalProperties": false,
+					},
+				},
 				"scene_direction": map[string]any{
 					"type":        "string",
 					"description": "具体的剧情戏份（导演分镜）：这个角色要说什么内容、用什么方式、达成什么效果、说完做什么。200-400字，详细描述这一段戏怎么演",
@@ -666,26 +849,32 @@ func (d *SegmentDirector) decideSegmentWithLLM(
 					"type":        "integer",
 					"description": "这段戏的最大时长（秒）",
 				},
+				"priority": map[string]any{
+					"type":        "string",
+					"enum":        []string{"low", "normal", "urgent"},
+					"description": "发言优先级：一般为 normal；角色要当场打断、立刻插话（如质疑者反驳）时用 urgent；可有可无的补充用 low",
+				},
 				"director_notes": map[string]any{
 					"type":        "string",
 					"description": "导演决策说明：为什么选这个角色、如何衔接上一段、为什么这样安排",
 				},
 			},
 			"required": []string{
-				"role_id", "scene_direction", "response_approach",
+				"role_id", "beats", "scene_direction", "response_approach",
 				"user_must_do_type", "user_must_do_prompt",
-				"max_duration_sec", "director_notes",
+				"max_duration_sec", "priority", "director_notes",
 			},
 			"additionalProperties": false,
 		},
 		Strict: true,
 	}
 
-	response, err := d.llmClient.Complete(ctx, messages, schema)
+	response, err := d.completePlan(ctx, state, userInput, messages, schema)
 	if err != nil {
 		return nil, fmt.Errorf("LLM complete: %w", err)
 	}
 
+	var planData segmentPlanData
 	if err := json.Unmarshal([]byte(response), &planData); err != nil {
 		return nil, fmt.Errorf("unmarshal: %w", err)
 	}
@@ -698,6 +887,8 @@ func (d *SegmentDirector) decideSegmentWithLLM(
 		SceneDirection: planData.SceneDirection,
 		MaxDurationSec: planData.MaxDurationSec,
 		DirectorNotes:  planData.DirectorNotes,
+		Beats:          planData.Beats,
+		Priority:       planData.Priority,
 	}
 
 	log.Printf("🎬 Segment Plan: role=%s, duration=%ds", planData.RoleID, planData.MaxDurationSec)
@@ -705,21 +896,101 @@ func (d *SegmentDirector) decideSegmentWithLLM(
 	return segmentPlan, nil
 }
 
+// defaultEarlyStartMinChars scene_direction 到达多少字后允许提前开口
+const defaultEarlyStartMinChars = 60
+
+// completePlan 调用 LLM 生成 segment_plan。
+// ctx 上挂了提前开口回调且配置开启时走流式：role_id 完整到达、scene_direction 到达足够字数后，
+// 先用这部分分镜让第一个角色开口，不必等整段 JSON 生成完。
+func (d *SegmentDirector) completePlan(
+	ctx context.Context,
+	state *model.SessionState,
+	userInput string,
+	messages []llm.Message,
+	schema *llm.JSONSchema,
+) (string, error) {
+	earlyStart := EarlyStartFromContext(ctx)
+	if earlyStart == nil || !d.config.StreamEarlyStart {
+		return d.llmClient.Complete(ctx, messages, schema)
+	}
+
+	minChars := d.config.EarlyStartMinChars
+	if minChars <= 0 {
+		minChars = defaultEarlyStartMinChars
+	}
+
+	var partial llm.PartialJSON
+	started := false
+	return llm.CompleteStream(ctx, d.llmClient, messages, schema, func(delta string) {
+		if started {
+			return
+		}
+		partial.Write(delta)
+
+		roleID, roleDone, _ := partial.StringField("role_id")
+		if !roleDone {
+			return
+		}
+		scene, sceneDone, _ := partial.StringField("scene_direction")
+		if !sceneDone && utf8.RuneCountInString(scene) < minChars {
+			return
+		}
+
+		// 角色全部无效时不提前开口，等完整计划走护栏兜底
+		roles, _ := filterRoles(roleID, state.AvailableRoles)
+		if len(roles) == 0 {
+			return
+		}
+
+		instruction := d.buildSegmentInstruction(state, userInput, &model.SegmentPlan{
+			RoleID:         strings.Join(roles, ","),
+			SceneDirection: scene,
+		})
+		// 多角色：第一个角色要带上自己这一拍的戏份（完整计划会跳过已提前开口的这一拍）。
+		// beats 在 scene_direction 之前输出，这里应已完整；没有拍的戏份时不提前开口。
+		if len(roles) > 1 {
+			raw, beatsDone := partial.RawField("beats")
+			if !beatsDone {
+				return
+			}
+			var beats []model.SegmentBeat
+			if err := json.Unmarshal([]byte(raw), &beats); err != nil || len(beats) == 0 || beats[0].RoleID != roles[0] {
+				return
+			}
+			instruction = beatInstruction(instruction, 0, len(roles), beats[0].Direction)
+		}
+
+		started = true
+		log.Printf("🎬 Early start: role=%s after %d chars of scene_direction", roles[0], utf8.RuneCountInString(scene))
+		earlyStart(model.DirectorPlan{
+			NextRole:    strings.Join(roles, ","),
+			Instruction: instruction,
+		})
+	})
+}
+
+// filterRoles 拆分角色序列（如 "host,economist"），按可用角色过滤。
+func filterRoles(roleID string, available []string) (valid, invalid []string) {
+	for _, role := range strings.Split(roleID, ",") {
+		role = strings.TrimSpace(role)
+		if contains(available, role) {
+			valid = append(valid, role)
+		} else {
+			invalid = append(invalid, role)
+		}
+	}
+	return valid, invalid
+}
+
 // applySegmentGuardrails 应用 Segment 护栏
 func (d *SegmentDirector) applySegmentGuardrails(
 	plan *model.SegmentPlan,
 	state *model.SessionState,
 ) *model.SegmentPlan {
 	// 验证 role_id (支持多角色，如 "host,economist")
-	roles := strings.Split(plan.RoleID, ",")
-	validRoles := make([]string, 0, len(roles))
-	for _, role := range roles {
-		role = strings.TrimSpace(role)
-		if contains(state.AvailableRoles, role) {
-			validRoles = append(validRoles, role)
-		} else {
-			log.Printf("⚠️ Invalid role '%s' in sequence '%s', skipping", role, plan.RoleID)
-		}
+	validRoles, invalidRoles := filterRoles(plan.RoleID, state.AvailableRoles)
+	for _, role := range invalidRoles {
+		log.Printf("⚠️ Invalid role '%s' in sequence '%s', skipping", role, plan.RoleID)
 	}
 
 	if len(validRoles) == 0 {
@@ -729,6 +1000,26 @@ func (d *SegmentDirector) applySegmentGuardrails(
 		plan.RoleID = strings.Join(validRoles, ",")
 	}
 
+	// 各拍按同样的规则过滤；有有效拍时以各拍的顺序为准
+	if len(plan.Beats) > 0 {
+		beats := plan.Beats[:0]
+		roles := make([]string, 0, len(plan.Beats))
+		for _, beat := range plan.Beats {
+			role := strings.TrimSpace(beat.RoleID)
+			if !contains(state.AvailableRoles, role) {
+				log.Printf("⚠️ Invalid role '%s' in beats, skipping", beat.RoleID)
+				continue
+			}
+			beat.RoleID = role
+			beats = append(beats, beat)
+			roles = append(roles, role)
+		}
+		plan.Beats = beats
+		if len(roles) > 0 {
+			plan.RoleID = strings.Join(roles, ",")
+		}
+	}
+
 	// 验证 scene_direction 不为空
 	if strings.TrimSpace(plan.SceneDirection) == "" {
 		log.Printf("⚠️ Empty scene_direction, this should not happen")
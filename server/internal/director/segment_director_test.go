@@ -6,6 +6,7 @@ import (
 	"bubble-talk/server/internal/model"
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -237,3 +238,220 @@ func TestSegmentDirector_StoryProgress(t *testing.T) {
 	t.Logf("✅ Story progress generated:")
 	t.Logf("%s", progress)
 }
+
+func TestSegmentDirector_FillerReusesSemanticCacheKey(t *testing.T) {
+	state := &model.SessionState{
+		Turns: []model.Turn{
+			{Role: "assistant", Text: "你觉得价格为什么会涨？"},
+			{Role: "user", Text: "因为买的人变多了"},
+			{Role: "assistant", Text: "没错，需求上升了。"},
+		},
+	}
+	before := storyTurnsCacheKey(state.Turns)
+	meaningful := lastMeaningfulUserInput(state, "因为买的人变多了")
+
+	state.Turns = append(state.Turns, model.Turn{Role: "user", Text: "嗯嗯。"})
+	if got := lastMeaningfulUserInput(state, "嗯嗯。"); got != meaningful {
+		t.Fatalf("expected filler to fall back to %q, got %q", meaningful, got)
+	}
+	if storyTurnsCacheKey(state.Turns) != before {
+		t.Fatalf("filler turn should not change the story summary cache key")
+	}
+
+	state.Turns = append(state.Turns, model.Turn{Role: "user", Text: "那供给呢？"})
+	if got := lastMeaningfulUserInput(state, "那供给呢？"); got != "那供给呢？" {
+		t.Fatalf("expected meaningful input to be used as-is, got %q", got)
+	}
+}
+
+// streamingSegmentClient 在 SegmentTestLLMClient 之上支持流式：按固定字节数切分响应逐段回调。
+type streamingSegmentClient struct {
+	SegmentTestLLMClient
+	chunkSize int
+	// deltas 已回调的增量数
+	deltas int
+}
+
+func (m *streamingSegmentClient) Stream(ctx context.Context, messages []llm.Message, schema *llm.JSONSchema, onDelta llm.StreamHandler) (string, error) {
+	resp, err := m.Complete(ctx, messages, schema)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < len(resp); i += m.chunkSize {
+		end := min(i+m.chunkSize, len(resp))
+		m.deltas++
+		onDelta(resp[i:end])
+	}
+	return resp, nil
+}
+
+// TestSegmentDirector_StreamEarlyStart 验证流式决策在 role_id 与分镜开头到达后提前开口，且只回调一次。
+func TestSegmentDirector_StreamEarlyStart(t *testing.T) {
+	cfg := &config.Config{
+		Director: config.DirectorConfig{
+			EnableLLM:          true,
+			StreamEarlyStart:   true,
+			EarlyStartMinChars: 10,
+		},
+	}
+
+	plan := `{"role_id":"economist,ghost","scene_direction":"经济学家先接住用户的猜测，再用演唱会门票的例子解释机会成本，最后请用户用自己的话复述。","response_approach":"先肯定再追问","user_must_do_type":"teach_back","user_must_do_prompt":"用自己的话说说","max_duration_sec":45,"director_notes":"轮到经济学家"}`
+	mockLLM := &streamingSegmentClient{
+		SegmentTestLLMClient: SegmentTestLLMClient{Responses: map[string]string{"": "进展", "segment_plan": plan}},
+		chunkSize:            16,
+	}
+	d := NewSegmentDirector(cfg, mockLLM)
+
+	state := &model.SessionState{
+		SessionID:      "test_session",
+		EntryID:        "test_entry",
+		AvailableRoles: []string{"host", "economist"},
+	}
+
+	var early []model.DirectorPlan
+	deltasAtStart := 0
+	ctx := WithEarlyStart(context.Background(), func(p model.DirectorPlan) {
+		early = append(early, p)
+		deltasAtStart = mockLLM.deltas
+	})
+
+	final := d.DecideContext(ctx, state, "为什么放弃演唱会也算成本")
+
+	if len(early) != 1 {
+		t.Fatalf("expected exactly one early start, got %d", len(early))
+	}
+	if early[0].NextRole != "economist" {
+		t.Fatalf("expected invalid roles filtered from early plan, got %q", early[0].NextRole)
+	}
+	if !strings.Contains(early[0].Instruction, "经济学家先接住") || strings.Contains(early[0].Instruction, "复述") {
+		t.Fatalf("expected early instruction to carry only the scene opening, got %q", early[0].Instruction)
+	}
+	if deltasAtStart >= mockLLM.deltas {
+		t.Fatalf("expected early start before stream finished (%d of %d deltas)", deltasAtStart, mockLLM.deltas)
+	}
+	if final.NextRole != "economist" || !strings.Contains(final.Instruction, "复述") {
+		t.Fatalf("unexpected final plan: %+v", final)
+	}
+
+	// 没挂回调时不走流式
+	mockLLM.deltas = 0
+	d.DecideContext(context.Background(), state, "为什么放弃演唱会也算成本")
+	if mockLLM.deltas != 0 {
+		t.Fatalf("expected blocking Complete without early-start hook, got %d deltas", mockLLM.deltas)
+	}
+}
+
+// TestSegmentDirector_StreamEarlyStartMultiRoleCarriesFirstBeat 多角色时提前开口的第一个角色带上自己这一拍的戏份
+func TestSegmentDirector_StreamEarlyStartMultiRoleCarriesFirstBeat(t *testing.T) {
+	cfg := &config.Config{
+		Director: config.DirectorConfig{
+			EnableLLM:          true,
+			StreamEarlyStart:   true,
+			EarlyStartMinChars: 10,
+		},
+	}
+	plan := `{"role_id":"host,economist","beats":[` +
+		`{"role_id":"host","direction":"主持人复述用户的猜测，然后交给经济学家"},` +
+		`{"role_id":"economist","direction":"经济学家解释机会成本"}],` +
+		`"scene_direction":"主持人和经济学家接力回应用户，先复述再解释，最后请用户复述。","response_approach":"先肯定再解释","user_must_do_type":"teach_back","user_must_do_prompt":"用自己的话说说","max_duration_sec":60,"priority":"urgent","director_notes":"接力"}`
+	mockLLM := &streamingSegmentClient{
+		SegmentTestLLMClient: SegmentTestLLMClient{Responses: map[string]string{"": "进展", "segment_plan": plan}},
+		chunkSize:            16,
+	}
+	d := NewSegmentDirector(cfg, mockLLM)
+	state := &model.SessionState{
+		SessionID:      "test_session",
+		EntryID:        "test_entry",
+		AvailableRoles: []string{"host", "economist"},
+	}
+
+	var early []model.DirectorPlan
+	ctx := WithEarlyStart(context.Background(), func(p model.DirectorPlan) { early = append(early, p) })
+	final := d.DecideContext(ctx, state, "加班赚了吧")
+
+	if len(early) != 1 || early[0].NextRole != "host,economist" {
+		t.Fatalf("early = %+v", early)
+	}
+	if !strings.Contains(early[0].Instruction, "Your Beat (1/2): 主持人复述用户的猜测") {
+		t.Fatalf("early instruction should carry the first beat, got %q", early[0].Instruction)
+	}
+	if len(final.Scene) != 2 || final.Scene[0].Role != "host" {
+		t.Fatalf("final scene = %+v", final.Scene)
+	}
+}
+
+// TestSegmentDirector_MultiRoleBeatsBecomeScene 验证多角色片段的各拍映射为场景，无效角色的拍被过滤。
+func TestSegmentDirector_MultiRoleBeatsBecomeScene(t *testing.T) {
+	cfg := &config.Config{Director: config.DirectorConfig{EnableLLM: true}}
+	plan := `{"role_id":"host,ghost,economist","beats":[` +
+		`{"role_id":"host","direction":"主持人复述用户的猜测，然后把话交给经济学家"},` +
+		`{"role_id":"ghost","direction":"不存在的角色"},` +
+		`{"role_id":"economist","direction":"经济学家用演唱会门票解释机会成本，最后请用户复述"}],` +
+		`"scene_direction":"主持人和经济学家接力回应用户。","response_approach":"先肯定再解释","user_must_do_type":"teach_back","user_must_do_prompt":"用自己的话说说","max_duration_sec":60,"priority":"urgent","director_notes":"接力"}`
+	d := NewSegmentDirector(cfg, &SegmentTestLLMClient{Responses: map[string]string{"": "进展", "segment_plan": plan}})
+
+	state := &model.SessionState{
+		SessionID:      "test_session",
+		EntryID:        "test_entry",
+		AvailableRoles: []string{"host", "economist"},
+	}
+	final := d.DecideContext(context.Background(), state, "加班赚了吧")
+
+	if final.NextRole != "host,economist" {
+		t.Fatalf("NextRole = %q", final.NextRole)
+	}
+	if len(final.Scene) != 2 || final.Scene[0].Role != "host" || final.Scene[1].Role != "economist" {
+		t.Fatalf("scene = %+v", final.Scene)
+	}
+	if final.Priority != "urgent" {
+		t.Errorf("Priority = %q", final.Priority)
+	}
+	if !strings.Contains(final.Scene[0].Instruction, "交给经济学家") || strings.Contains(final.Scene[0].Instruction, "演唱会门票") {
+		t.Errorf("host beat instruction = %q", final.Scene[0].Instruction)
+	}
+	if !strings.Contains(final.Scene[1].Instruction, "Your Beat (2/2)") || !strings.Contains(final.Scene[1].Instruction, "接力回应用户") {
+		t.Errorf("economist beat instruction = %q", final.Scene[1].Instruction)
+	}
+
+	// 单角色片段不带场景，下一次决策也不会沿用上一次的各拍
+	single := `{"role_id":"host","beats":[],"scene_direction":"主持人追问。","response_approach":"追问","user_must_do_type":"none","user_must_do_prompt":"","max_duration_sec":30,"priority":"normal","director_notes":"单人"}`
+	d = NewSegmentDirector(cfg, &SegmentTestLLMClient{Responses: map[string]string{"": "进展", "segment_plan": single}})
+	if p := d.DecideContext(context.Background(), state, "嗯"); len(p.Scene) != 0 || p.NextRole != "host" || p.Priority != "" {
+		t.Errorf("single-role plan = %+v", p)
+	}
+}
+
+// countingLLMClient 记录上游调用次数
+type countingLLMClient struct {
+	calls int
+}
+
+func (c *countingLLMClient) Complete(ctx context.Context, messages []llm.Message, schema *llm.JSONSchema) (string, error) {
+	c.calls++
+	return fmt.Sprintf("【剧情进展】：第 %d 次生成", c.calls), nil
+}
+
+// TestSegmentDirector_StoryProgressCachedByTag 验证故事摘要按 story_progress 标签缓存，其他纯文本调用不受这条 TTL 影响。
+func TestSegmentDirector_StoryProgressCachedByTag(t *testing.T) {
+	inner := &countingLLMClient{}
+	cached := llm.NewCachingClient(inner, llm.CacheOptions{
+		TTLs: map[string]time.Duration{storyProgressCacheTag: time.Minute},
+	}, llm.NewCacheMetrics())
+	director := NewSegmentDirector(&config.Config{Director: config.DirectorConfig{EnableLLM: true}}, cached)
+
+	state := &model.SessionState{
+		Turns: []model.Turn{{Role: "user", Text: "我觉得赚了啊", TS: time.Now()}},
+	}
+	first := director.summarizeStoryProgress(context.Background(), state)
+	second := director.summarizeStoryProgress(context.Background(), state)
+	if first != second || inner.calls != 1 {
+		t.Fatalf("expected story progress cache hit, got %q / %q (calls=%d)", first, second, inner.calls)
+	}
+
+	msgs := []llm.Message{{Role: "user", Content: "开场白"}}
+	_, _ = cached.Complete(context.Background(), msgs, nil)
+	_, _ = cached.Complete(context.Background(), msgs, nil)
+	if inner.calls != 3 {
+		t.Fatalf("expected untagged text calls to bypass cache, calls=%d", inner.calls)
+	}
+}
@@ -0,0 +1,192 @@
+// Package export 把会话的 Timeline 与 SessionState 渲染成可在应用外使用的文件：
+// 原始事件 JSONL、带角色名与导演批注的 Markdown 文字稿、WebVTT/SRT 字幕、测评结果 CSV。
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"bubble-talk/server/internal/model"
+	"bubble-talk/server/internal/session"
+	"bubble-talk/server/internal/timeline"
+)
+
+// Format 导出格式
+type Format string
+
+const (
+	FormatJSONL    Format = "jsonl" // 原始事件，一行一个 model.Event
+	FormatMarkdown Format = "md"    // 文字稿（角色名 + 导演批注）
+	FormatWebVTT   Format = "vtt"   // 字幕（caption 事件的时间轴）
+	FormatSRT      Format = "srt"   // 字幕（同上）
+	FormatCSV      Format = "csv"   // 测评结果（答题事件）
+)
+
+// Formats 支持的全部格式
+var Formats = []Format{FormatJSONL, FormatMarkdown, FormatWebVTT, FormatSRT, FormatCSV}
+
+// ParseFormat 解析格式名（不区分大小写，markdown 等同 md）
+func ParseFormat(name string) (Format, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "markdown" {
+		name = string(FormatMarkdown)
+	}
+	for _, f := range Formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown export format %q (want one of jsonl, md, vtt, srt, csv)", name)
+}
+
+// ContentType 返回 HTTP Content-Type
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	case FormatWebVTT:
+		return "text/vtt; charset=utf-8"
+	case FormatSRT:
+		return "application/x-subrip; charset=utf-8"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Session 一次导出的输入
+type Session struct {
+	SessionID string
+	// State 会话快照，可为空（CLI 只有事件文件时）
+	State *model.SessionState
+	// Events 按 seq 升序的 Timeline 事件
+	Events []model.Event
+	// RoleNames 角色 ID -> 展示名，缺省时用角色 ID
+	RoleNames map[string]string
+}
+
+// Load 从存储读取会话快照与全部 Timeline 事件
+func Load(ctx context.Context, sessions session.Store, events timeline.Store, sessionID string) (*Session, error) {
+	state, err := sessions.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	list, err := events.List(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list timeline: %w", err)
+	}
+	return &Session{SessionID: sessionID, State: state, Events: list}, nil
+}
+
+// Write 按格式把会话写入 w
+func Write(w io.Writer, format Format, s *Session) error {
+	switch format {
+	case FormatJSONL:
+		return WriteJSONL(w, s.Events)
+	case FormatMarkdown:
+		return WriteMarkdown(w, s)
+	case FormatWebVTT:
+		return WriteWebVTT(w, s)
+	case FormatSRT:
+		return WriteSRT(w, s)
+	case FormatCSV:
+		return WriteAssessmentCSV(w, s)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// WriteJSONL 每行写一个事件
+func WriteJSONL(w io.Writer, events []model.Event) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadJSONL 读取 WriteJSONL 的输出（跳过空行）
+func ReadJSONL(r io.Reader) ([]model.Event, error) {
+	var events []model.Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+		var evt model.Event
+		if err := json.Unmarshal([]byte(raw), &evt); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, evt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// WriteAssessmentCSV 每条答题事件一行；掌握度与误解标签取自会话快照（每行相同，便于跨会话合并分析）
+func WriteAssessmentCSV(w io.Writer, s *Session) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{
+		"session_id", "entry_id", "seq", "server_ts", "turn_id", "question_id", "answer",
+		"mastery_estimate", "misconception_tags",
+	}); err != nil {
+		return err
+	}
+
+	entryID, mastery, tags := "", "", ""
+	if s.State != nil {
+		entryID = s.State.EntryID
+		mastery = strconv.FormatFloat(s.State.MasteryEstimate, 'f', -1, 64)
+		tags = strings.Join(s.State.MisconceptionTags, ";")
+	}
+	for _, evt := range s.Events {
+		if evt.Type != "quiz_answer" {
+			continue
+		}
+		if err := cw.Write([]string{
+			s.SessionID, entryID, strconv.FormatInt(evt.Seq, 10), formatTS(evt.ServerTS),
+			evt.TurnID, evt.QuestionID, evt.Answer, mastery, tags,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatTS(ts time.Time) string {
+	if ts.IsZero() {
+		return ""
+	}
+	return ts.Format(time.RFC3339)
+}
+
+// roleName 角色展示名
+func (s *Session) roleName(role string) string {
+	if role == "" {
+		return "角色"
+	}
+	if name := s.RoleNames[role]; name != "" {
+		return name
+	}
+	return role
+}
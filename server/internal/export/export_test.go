@@ -0,0 +1,155 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/model"
+)
+
+func sampleSession() *Session {
+	ts := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	return &Session{
+		SessionID: "S_1",
+		State: &model.SessionState{
+			SessionID:         "S_1",
+			EntryID:           "econ_inflation",
+			Domain:            "economics",
+			MainObjective:     "理解通胀",
+			MasteryEstimate:   0.6,
+			MisconceptionTags: []string{"money_is_wealth", "price_level"},
+		},
+		RoleNames: map[string]string{"host": "主持人"},
+		Events: []model.Event{
+			{Seq: 1, Type: "user_utterance", Text: "什么是通胀？", ServerTS: ts},
+			{Seq: 2, Type: "director_plan", ServerTS: ts, DirectorPlan: &model.DirectorPlan{
+				NextRole:    "host,economist",
+				Instruction: "先用生活例子引入，\n再给定义",
+				Debug:       &model.DirectorDebug{BeatChoiceReason: "用户首次提问"},
+			}},
+			{Seq: 3, Type: "assistant_text", Role: "host", Text: "想想菜价。", ServerTS: ts},
+			{Seq: 4, Type: "caption", Text: "什么是通胀？", Caption: &model.Caption{Speaker: "user", StartMS: 500, EndMS: 1800}},
+			{Seq: 5, Type: "caption", Text: "想想 <菜价>。", Caption: &model.Caption{Speaker: "role", Role: "host", StartMS: 3723004, EndMS: 3725000}},
+			{Seq: 6, Type: "assistant_text", Role: "economist", Text: "物价普遍上涨。", ServerTS: ts},
+			{Seq: 7, Type: "quiz_answer", QuestionID: "q1", Answer: "B", ServerTS: ts},
+		},
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMarkdown(&buf, sampleSession()); err != nil {
+		t.Fatal(err)
+	}
+	md := buf.String()
+	for _, want := range []string{
+		"# 会话 S_1",
+		"- 泡泡：econ_inflation（economics）",
+		"**学习者**：什么是通胀？",
+		"> 🎬 导演 → 主持人、economist",
+		"> 拍点：用户首次提问",
+		"> 指令：先用生活例子引入， 再给定义",
+		"**主持人**：想想菜价。",
+		"**economist**：物价普遍上涨。",
+		"> 📝 答题 q1：B",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	// 字幕不重复出现在文字稿里
+	if strings.Count(md, "什么是通胀？") != 1 {
+		t.Errorf("learner line repeated:\n%s", md)
+	}
+}
+
+func TestWriteSubtitles(t *testing.T) {
+	var vtt, srt bytes.Buffer
+	if err := WriteWebVTT(&vtt, sampleSession()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSRT(&srt, sampleSession()); err != nil {
+		t.Fatal(err)
+	}
+
+	wantVTT := "WEBVTT\n\n" +
+		"1\n00:00:00.500 --> 00:00:01.800\n<v 学习者>什么是通胀？\n\n" +
+		"2\n01:02:03.004 --> 01:02:05.000\n<v 主持人>想想 &lt;菜价&gt;。\n\n"
+	if vtt.String() != wantVTT {
+		t.Errorf("vtt =\n%s\nwant\n%s", vtt.String(), wantVTT)
+	}
+	wantSRT := "1\n00:00:00,500 --> 00:00:01,800\n学习者：什么是通胀？\n\n" +
+		"2\n01:02:03,004 --> 01:02:05,000\n主持人：想想 <菜价>。\n\n"
+	if srt.String() != wantSRT {
+		t.Errorf("srt =\n%s\nwant\n%s", srt.String(), wantSRT)
+	}
+}
+
+// TestCaptionCuesAcrossTimelines 验证重连后从 0 重新计时的字幕按时间轴顺序排列，并加上 offset_ms 换算到会话时间
+func TestCaptionCuesAcrossTimelines(t *testing.T) {
+	sess := &Session{
+		RoleNames: map[string]string{"host": "主持人"},
+		Events: []model.Event{
+			{Seq: 1, Type: "caption", Text: "第一句", Caption: &model.Caption{Speaker: "user", StartMS: 8000, EndMS: 9000, Take: 1}},
+			{Seq: 2, Type: "caption", Text: "第二句", Caption: &model.Caption{Speaker: "role", Role: "host", StartMS: 10000, EndMS: 12000, Take: 1}},
+			// 重连：新 take 的时间轴从 0 开始，零点在会话第 20 秒
+			{Seq: 3, Type: "caption", Text: "第四句", Caption: &model.Caption{Speaker: "role", Role: "host", StartMS: 3000, EndMS: 4000, Take: 2, OffsetMS: 20000}},
+			{Seq: 4, Type: "caption", Text: "第三句", Caption: &model.Caption{Speaker: "user", StartMS: 1000, EndMS: 2000, Take: 2, OffsetMS: 20000}},
+		},
+	}
+	cues := captionCues(sess)
+	want := []struct {
+		text       string
+		start, end int64
+	}{
+		{"第一句", 8000, 9000},
+		{"第二句", 10000, 12000},
+		{"第三句", 21000, 22000},
+		{"第四句", 23000, 24000},
+	}
+	if len(cues) != len(want) {
+		t.Fatalf("cues = %+v", cues)
+	}
+	for i, w := range want {
+		if cues[i].text != w.text || cues[i].startMS != w.start || cues[i].endMS != w.end {
+			t.Errorf("cue %d = %+v, want %+v", i, cues[i], w)
+		}
+	}
+}
+
+func TestWriteAssessmentCSVAndJSONLRoundTrip(t *testing.T) {
+	sess := sampleSession()
+
+	var csvBuf bytes.Buffer
+	if err := Write(&csvBuf, FormatCSV, sess); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(csvBuf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("csv lines = %d:\n%s", len(lines), csvBuf.String())
+	}
+	if want := "S_1,econ_inflation,7,2026-03-01T10:00:00Z,,q1,B,0.6,money_is_wealth;price_level"; lines[1] != want {
+		t.Errorf("csv row = %q, want %q", lines[1], want)
+	}
+
+	var jsonl bytes.Buffer
+	if err := Write(&jsonl, FormatJSONL, sess); err != nil {
+		t.Fatal(err)
+	}
+	events, err := ReadJSONL(&jsonl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != len(sess.Events) || events[2].Role != "host" || events[1].DirectorPlan.NextRole != "host,economist" {
+		t.Errorf("round trip events = %+v", events)
+	}
+
+	if f, err := ParseFormat("Markdown"); err != nil || f != FormatMarkdown {
+		t.Errorf("ParseFormat(Markdown) = %q, %v", f, err)
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("ParseFormat(pdf) should fail")
+	}
+}
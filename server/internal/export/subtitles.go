@@ -0,0 +1,100 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// cue 一条字幕
+type cue struct {
+	timeline int // 所属字幕时间轴在 Timeline 中出现的次序
+	startMS  int64
+	endMS    int64
+	speaker  string
+	text     string
+}
+
+// captionCues 从 caption 事件取字幕。
+// 每个网关一条字幕时间轴（按 take/offset_ms 区分，重连后从 0 重新计时）：时间先加上 offset_ms 换算到会话时间，
+// 再按时间轴在 Timeline 中首次出现的顺序分组，组内按开始时间排序（同一时刻按 Timeline 顺序）。
+func captionCues(s *Session) []cue {
+	type timelineKey struct {
+		take     int
+		offsetMS int64
+	}
+	var cues []cue
+	order := make(map[timelineKey]int)
+	for _, evt := range s.Events {
+		c := evt.Caption
+		if evt.Type != "caption" || c == nil {
+			continue
+		}
+		text := oneLine(evt.Text)
+		if text == "" {
+			continue
+		}
+		speaker := learnerName
+		if c.Speaker == "role" {
+			speaker = s.roleName(c.Role)
+		}
+		end := c.EndMS
+		if end < c.StartMS {
+			end = c.StartMS
+		}
+		key := timelineKey{take: c.Take, offsetMS: c.OffsetMS}
+		group, ok := order[key]
+		if !ok {
+			group = len(order)
+			order[key] = group
+		}
+		cues = append(cues, cue{timeline: group, startMS: c.OffsetMS + c.StartMS, endMS: c.OffsetMS + end, speaker: speaker, text: text})
+	}
+	sort.SliceStable(cues, func(i, j int) bool {
+		if cues[i].timeline != cues[j].timeline {
+			return cues[i].timeline < cues[j].timeline
+		}
+		return cues[i].startMS < cues[j].startMS
+	})
+	return cues
+}
+
+// WriteWebVTT 写 WebVTT 字幕，说话人用 <v> 标签
+func WriteWebVTT(w io.Writer, s *Session) error {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for i, c := range captionCues(s) {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n<v %s>%s\n\n",
+			i+1, formatCueTime(c.startMS, '.'), formatCueTime(c.endMS, '.'), c.speaker, escapeVTT(c.text))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteSRT 写 SRT 字幕，说话人写在文本前
+func WriteSRT(w io.Writer, s *Session) error {
+	var b strings.Builder
+	for i, c := range captionCues(s) {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s：%s\n\n",
+			i+1, formatCueTime(c.startMS, ','), formatCueTime(c.endMS, ','), c.speaker, c.text)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatCueTime 毫秒 -> HH:MM:SS.mmm（SRT 用逗号分隔毫秒）
+func formatCueTime(ms int64, sep byte) string {
+	if ms < 0 {
+		ms = 0
+	}
+	h := ms / 3600000
+	m := ms / 60000 % 60
+	sec := ms / 1000 % 60
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", h, m, sec, sep, ms%1000)
+}
+
+// escapeVTT 转义 cue 文本中的 & < >
+func escapeVTT(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
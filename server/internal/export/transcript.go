@@ -0,0 +1,117 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"bubble-talk/server/internal/model"
+)
+
+// learnerName 文字稿与字幕里学习者的称呼
+const learnerName = "学习者"
+
+// noteMaxRunes 导演指令在批注里最多保留的字数（完整指令在 JSONL 里）
+const noteMaxRunes = 200
+
+// isLearnerText 学习者发言类事件（语音转写或文本输入）
+func isLearnerText(eventType string) bool {
+	switch eventType {
+	case "user_utterance", "user_message", "asr_final":
+		return true
+	}
+	return false
+}
+
+// WriteMarkdown 渲染文字稿：学习者与角色的发言按 Timeline 顺序排列，导演计划、插话、答题等以引用块批注。
+func WriteMarkdown(w io.Writer, s *Session) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# 会话 %s\n\n", s.SessionID)
+	if st := s.State; st != nil {
+		if st.EntryID != "" {
+			fmt.Fprintf(&b, "- 泡泡：%s", st.EntryID)
+			if st.Domain != "" {
+				fmt.Fprintf(&b, "（%s）", st.Domain)
+			}
+			b.WriteString("\n")
+		}
+		if st.MainObjective != "" {
+			fmt.Fprintf(&b, "- 目标：%s\n", st.MainObjective)
+		}
+		if !st.CreatedAt.IsZero() {
+			fmt.Fprintf(&b, "- 开始时间：%s\n", formatTS(st.CreatedAt))
+		}
+		fmt.Fprintf(&b, "- 掌握度估计：%.2f\n", st.MasteryEstimate)
+		if len(st.MisconceptionTags) > 0 {
+			fmt.Fprintf(&b, "- 误解标签：%s\n", strings.Join(st.MisconceptionTags, "、"))
+		}
+		b.WriteString("\n")
+	}
+
+	for _, evt := range s.Events {
+		switch {
+		case isLearnerText(evt.Type) && evt.Text != "":
+			fmt.Fprintf(&b, "**%s**：%s\n\n", learnerName, evt.Text)
+		case evt.Type == "assistant_text" && evt.Text != "":
+			fmt.Fprintf(&b, "**%s**：%s\n\n", s.roleName(evt.Role), evt.Text)
+		case evt.Type == "director_plan" && evt.DirectorPlan != nil:
+			writeDirectorNote(&b, s, evt.DirectorPlan)
+		case evt.Type == "quiz_answer":
+			fmt.Fprintf(&b, "> 📝 答题 %s：%s\n\n", evt.QuestionID, evt.Answer)
+		case evt.Type == "barge_in":
+			b.WriteString("> ✋ 学习者插话打断\n\n")
+		case evt.Type == "speech_dropped" && evt.SpeechDrop != nil:
+			fmt.Fprintf(&b, "> ⏭️ %s 的发言未播出（%s）\n\n", s.roleName(evt.SpeechDrop.Role), evt.SpeechDrop.Reason)
+		case evt.Type == "session_forked":
+			fmt.Fprintf(&b, "> 🍴 分叉点：%s\n\n", evt.Text)
+		case evt.Type == "exit_requested":
+			b.WriteString("> 🚪 学习者请求结束\n\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeDirectorNote(b *strings.Builder, s *Session, plan *model.DirectorPlan) {
+	var roles []string
+	if len(plan.Scene) > 0 {
+		for _, beat := range plan.Scene {
+			roles = append(roles, s.roleName(beat.Role))
+		}
+	} else {
+		for _, role := range strings.Split(plan.NextRole, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, s.roleName(role))
+			}
+		}
+	}
+
+	fmt.Fprintf(b, "> 🎬 导演 → %s\n", strings.Join(roles, "、"))
+	if d := plan.Debug; d != nil {
+		if d.BeatChoiceReason != "" {
+			fmt.Fprintf(b, ">\n> 拍点：%s\n", oneLine(d.BeatChoiceReason))
+		}
+		if d.RoleChoiceReason != "" {
+			fmt.Fprintf(b, ">\n> 选角：%s\n", oneLine(d.RoleChoiceReason))
+		}
+	}
+	if plan.Instruction != "" {
+		fmt.Fprintf(b, ">\n> 指令：%s\n", truncateRunes(oneLine(plan.Instruction), noteMaxRunes))
+	}
+	b.WriteString("\n")
+}
+
+// oneLine 把多行文本压成一行，避免破坏引用块
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
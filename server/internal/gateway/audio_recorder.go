@@ -0,0 +1,47 @@
+package gateway
+
+import "time"
+
+// AudioRecorder 会话录音（可选）：网关把学习者的麦克风音频和各角色的 TTS 音频交给它落盘。
+// 实现见 recording.Recorder；两个方法都在音频热路径上同步调用，实现需要自行保证足够快。
+type AudioRecorder interface {
+	RecordInput(pcm []byte)
+	RecordOutput(role string, pcm []byte)
+}
+
+// recordingTake 能给出 take 编号与开始时刻的录音器（recording.Recorder）：字幕时间轴据此与录音对齐
+type recordingTake interface {
+	Take() int
+	StartedAt() time.Time
+}
+
+// SetAudioRecorder 设置录音器（nil 表示停止录音）。
+// 录音只保存 PCM16：输入/输出格式不是 pcm16 的方向不会被录制。
+// 录音器实现 recordingTake 时，字幕时间轴改以该 take 的开始时刻为零点。
+func (g *MultiVoiceGateway) SetAudioRecorder(rec AudioRecorder) {
+	if take, ok := rec.(recordingTake); ok {
+		g.setCaptionTake(take.StartedAt(), take.Take())
+	}
+
+	g.recorderMu.Lock()
+	defer g.recorderMu.Unlock()
+	g.recorder = rec
+
+	if rec != nil {
+		for _, format := range []string{g.config.InputAudioFormat, g.config.OutputAudioFormat} {
+			if CodecFromFormat(format) != CodecPCM16 {
+				g.logger.Printf("[MultiVoiceGateway] ⚠️  Recording skips non-pcm16 audio format %q", format)
+			}
+		}
+	}
+}
+
+// audioRecorder 返回当前录音器；format 不是 pcm16 时返回 nil
+func (g *MultiVoiceGateway) audioRecorder(format string) AudioRecorder {
+	if CodecFromFormat(format) != CodecPCM16 {
+		return nil
+	}
+	g.recorderMu.RLock()
+	defer g.recorderMu.RUnlock()
+	return g.recorder
+}
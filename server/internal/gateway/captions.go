@@ -0,0 +1,329 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"bubble-talk/server/internal/audio"
+)
+
+// 实时字幕轨（caption 事件）。
+//
+// 时间轴以本次录音 take 的开始时刻为 0（没有录音时为网关创建时刻），与该 take 的音频对齐；
+// 每条字幕同时带上 take 与 offset_ms（时间轴零点相对会话开始的毫秒数），重连或语音/文本切换后
+// 时间轴重新从 0 开始，导出时按 start_ms+offset_ms 拼回会话时间：
+//   - 用户字幕：start 取 VAD 检测到开口的时刻，end 取停止说话（或转写完成）的时刻；
+//   - 角色字幕：start 取该发言第一帧音频（或第一段转写）到达的时刻，之后按已转发的音频时长推进，
+//     所以 delta 的 start_ms 就是这段文字在播放中出现的位置，final 的 end_ms 是整段音频播完的位置。
+//
+// partial/delta 只下发给前端做实时字幕；final 同时回灌 Orchestrator 落 Timeline，用于带字幕回放。
+
+// 字幕说话方
+const (
+	captionSpeakerUser = "user"
+	captionSpeakerRole = "role"
+)
+
+// 字幕类型
+const (
+	captionKindPartial = "partial" // 用户转写进行中（text 为目前为止的全文）
+	captionKindDelta   = "delta"   // 角色转写增量（text 为本段增量）
+	captionKindFinal   = "final"   // 最终字幕（text 为全文）
+)
+
+// Caption 一条字幕
+type Caption struct {
+	// CaptionID 同一句话的各条字幕共用：用户为转写 item_id，角色为 response_id
+	CaptionID string `json:"caption_id"`
+	Speaker   string `json:"speaker"` // user | role
+	Role      string `json:"role,omitempty"`
+	Avatar    string `json:"avatar,omitempty"`
+	Kind      string `json:"kind"` // partial | delta | final
+	Text      string `json:"text"`
+	// StreamID 角色字幕对应的下行音频流（与 tts_started 一致）
+	StreamID uint32 `json:"stream_id,omitempty"`
+	// StartMS/EndMS 相对本条时间轴零点（录音 take 开始/网关创建）的毫秒数；partial/delta 没有 end
+	StartMS int64 `json:"start_ms"`
+	EndMS   int64 `json:"end_ms,omitempty"`
+	// Cancelled 角色发言被打断/取消，text 只包含实际播出的部分
+	Cancelled bool `json:"cancelled,omitempty"`
+	// Take 时间轴所属的录音 take（未录音时为 0）
+	Take int `json:"take,omitempty"`
+	// OffsetMS 时间轴零点相对会话开始的毫秒数，start_ms+offset_ms 为会话时间
+	OffsetMS int64 `json:"offset_ms,omitempty"`
+}
+
+// userCaption 一句进行中的用户转写
+type userCaption struct {
+	text    strings.Builder
+	startMS int64
+}
+
+// roleCaption 一次进行中的角色发言
+type roleCaption struct {
+	role     string
+	streamID uint32
+	text     strings.Builder
+	startMS  int64   // 第一帧音频/第一段转写到达的时刻，-1 表示尚未开始
+	audioMS  float64 // 已转发给前端的音频时长
+}
+
+// captionClock 当前时刻在字幕时间轴上的位置
+func (g *MultiVoiceGateway) captionClock() int64 {
+	g.captionMu.Lock()
+	epoch := g.captionEpoch
+	g.captionMu.Unlock()
+	return time.Since(epoch).Milliseconds()
+}
+
+// setCaptionTake 字幕时间轴改以录音 take 的开始时刻为零点（在 Start 之前由 SetAudioRecorder 调用）
+func (g *MultiVoiceGateway) setCaptionTake(startedAt time.Time, take int) {
+	g.captionMu.Lock()
+	defer g.captionMu.Unlock()
+	g.captionEpoch = startedAt
+	g.captionTake = take
+}
+
+// captionOffsetLocked 字幕时间轴零点相对会话开始的毫秒数
+func (g *MultiVoiceGateway) captionOffsetLocked() int64 {
+	if g.config.SessionStart.IsZero() {
+		return 0
+	}
+	return g.captionEpoch.Sub(g.config.SessionStart).Milliseconds()
+}
+
+// markUserSpeech 记录用户开口/停止的时刻，给下一句用户字幕定时间
+func (g *MultiVoiceGateway) markUserSpeech(speaking bool) {
+	now := g.captionClock()
+	g.captionMu.Lock()
+	defer g.captionMu.Unlock()
+	if speaking {
+		g.userSpeechStartMS = now
+		g.userSpeechEndMS = -1
+		return
+	}
+	g.userSpeechEndMS = now
+}
+
+// userCaptionStartLocked 用户这句话的开始时刻：有 VAD 开口记录就用它，否则用当前时刻
+func (g *MultiVoiceGateway) userCaptionStartLocked(now int64) int64 {
+	if g.userSpeechStartMS >= 0 {
+		return g.userSpeechStartMS
+	}
+	return now
+}
+
+// captionUserPartial 用户转写增量，下发目前为止的全文
+func (g *MultiVoiceGateway) captionUserPartial(itemID string, delta string) {
+	if delta == "" {
+		return
+	}
+	now := g.captionClock()
+	g.captionMu.Lock()
+	uc, ok := g.userCaptions[itemID]
+	if !ok {
+		uc = &userCaption{startMS: g.userCaptionStartLocked(now)}
+		g.userCaptions[itemID] = uc
+	}
+	uc.text.WriteString(delta)
+	caption := &Caption{
+		CaptionID: itemID,
+		Speaker:   captionSpeakerUser,
+		Kind:      captionKindPartial,
+		Text:      uc.text.String(),
+		StartMS:   uc.startMS,
+	}
+	g.captionMu.Unlock()
+
+	g.sendCaption(caption)
+}
+
+// captionUserFinal 用户这句话转写完成
+func (g *MultiVoiceGateway) captionUserFinal(itemID string, transcript string) {
+	now := g.captionClock()
+	g.captionMu.Lock()
+	start := g.userCaptionStartLocked(now)
+	if uc, ok := g.userCaptions[itemID]; ok {
+		start = uc.startMS
+		delete(g.userCaptions, itemID)
+	}
+	end := now
+	if g.userSpeechEndMS >= start {
+		end = g.userSpeechEndMS
+	}
+	// 这句话已经收尾，下一句重新等 VAD 开口
+	g.userSpeechStartMS = -1
+	g.captionMu.Unlock()
+
+	if itemID == "" {
+		itemID = fmt.Sprintf("user_%d", time.Now().UnixNano())
+	}
+	g.sendCaption(&Caption{
+		CaptionID: itemID,
+		Speaker:   captionSpeakerUser,
+		Kind:      captionKindFinal,
+		Text:      transcript,
+		StartMS:   start,
+		EndMS:     end,
+	})
+}
+
+// roleCaptionLocked 取出（或新建）某次发言的字幕状态
+func (g *MultiVoiceGateway) roleCaptionLocked(role string, responseID string) *roleCaption {
+	rc, ok := g.roleCaptions[responseID]
+	if !ok {
+		rc = &roleCaption{role: role, startMS: -1}
+		g.roleCaptions[responseID] = rc
+	}
+	return rc
+}
+
+// captionRoleAudio 角色音频转发给前端后推进该发言的播放位置（n 为 Realtime 侧格式的字节数）
+func (g *MultiVoiceGateway) captionRoleAudio(role string, responseID string, streamID uint32, n int) {
+	g.transcodeMu.Lock()
+	format := g.realtimeOutputFormat
+	g.transcodeMu.Unlock()
+
+	now := g.captionClock()
+	g.captionMu.Lock()
+	defer g.captionMu.Unlock()
+	rc := g.roleCaptionLocked(role, responseID)
+	rc.streamID = streamID
+	if rc.startMS < 0 {
+		rc.startMS = now
+	}
+	rc.audioMS += audioDurationMS(format, n)
+}
+
+// captionRoleDelta 角色转写增量：start_ms 为它在播放中出现的位置（已播音频的末尾）
+func (g *MultiVoiceGateway) captionRoleDelta(role string, responseID string, delta string) {
+	if delta == "" || g.isRoleAudioMuted(role) {
+		// 已被闸门静音的发言前端听不到，字幕也不再推进
+		return
+	}
+	now := g.captionClock()
+	g.captionMu.Lock()
+	rc := g.roleCaptionLocked(role, responseID)
+	if rc.startMS < 0 {
+		rc.startMS = now
+	}
+	rc.text.WriteString(delta)
+	caption := &Caption{
+		CaptionID: responseID,
+		Speaker:   captionSpeakerRole,
+		Role:      role,
+		Kind:      captionKindDelta,
+		Text:      delta,
+		StreamID:  rc.streamID,
+		StartMS:   rc.startMS + int64(rc.audioMS),
+	}
+	g.captionMu.Unlock()
+
+	g.sendCaption(caption)
+}
+
+// captionRoleFinal 角色发言结束（完成或被取消）。
+// 完成时以 response.done 的全文为准；被取消时只保留实际播出的转写。
+func (g *MultiVoiceGateway) captionRoleFinal(role string, responseID string, finalText string, cancelled bool) {
+	now := g.captionClock()
+	g.captionMu.Lock()
+	rc, ok := g.roleCaptions[responseID]
+	delete(g.roleCaptions, responseID)
+	g.captionMu.Unlock()
+
+	if !ok && cancelled {
+		// 没播出任何内容，或已由 response.cancelled 收尾过
+		return
+	}
+	text := finalText
+	if ok && (cancelled || text == "") {
+		text = rc.text.String()
+	}
+	if text == "" {
+		return
+	}
+
+	caption := &Caption{
+		CaptionID: responseID,
+		Speaker:   captionSpeakerRole,
+		Role:      role,
+		Kind:      captionKindFinal,
+		Text:      text,
+		StartMS:   now,
+		EndMS:     now,
+		Cancelled: cancelled,
+	}
+	if ok && rc.startMS >= 0 {
+		caption.StreamID = rc.streamID
+		caption.StartMS = rc.startMS
+		caption.EndMS = rc.startMS + int64(rc.audioMS)
+		if rc.audioMS == 0 {
+			caption.EndMS = now
+		}
+	}
+	g.sendCaption(caption)
+}
+
+// finishRoleCaptions 角色断线：它所有进行中的字幕都按被取消收尾
+func (g *MultiVoiceGateway) finishRoleCaptions(role string) {
+	g.captionMu.Lock()
+	var responseIDs []string
+	for responseID, rc := range g.roleCaptions {
+		if rc.role == role {
+			responseIDs = append(responseIDs, responseID)
+		}
+	}
+	g.captionMu.Unlock()
+
+	for _, responseID := range responseIDs {
+		g.captionRoleFinal(role, responseID, "", true)
+	}
+}
+
+// sendCaption 补齐角色头像后下发；final 字幕同时回灌 Orchestrator 落 Timeline
+func (g *MultiVoiceGateway) sendCaption(caption *Caption) {
+	if caption.Role != "" {
+		caption.Avatar = g.config.RoleProfiles[caption.Role].Avatar
+	}
+	g.captionMu.Lock()
+	caption.Take = g.captionTake
+	caption.OffsetMS = g.captionOffsetLocked()
+	g.captionMu.Unlock()
+
+	_ = g.sendToClient(&ServerMessage{
+		Type:     EventTypeCaption,
+		Text:     caption.Text,
+		Caption:  caption,
+		ServerTS: time.Now(),
+	})
+
+	if caption.Kind != captionKindFinal {
+		return
+	}
+	persisted := *caption
+	_ = g.forwardToOrchestrator(&ClientMessage{
+		Type:     EventTypeCaption,
+		EventID:  fmt.Sprintf("caption_%s_%d", caption.CaptionID, time.Now().UnixNano()),
+		Text:     caption.Text,
+		ClientTS: time.Now(),
+		Caption:  &persisted,
+	})
+}
+
+// audioDurationMS n 字节音频的播放时长；压缩编码（如 Opus）无法按字节换算，返回 0
+func audioDurationMS(format audio.Format, n int) float64 {
+	var bytesPerSample int
+	switch format.Codec {
+	case audio.CodecPCM16:
+		bytesPerSample = 2
+	case audio.CodecG711ULaw, audio.CodecG711ALaw:
+		bytesPerSample = 1
+	default:
+		return 0
+	}
+	if format.SampleRate <= 0 {
+		return 0
+	}
+	return float64(n) * 1000 / float64(bytesPerSample*format.SampleRate)
+}
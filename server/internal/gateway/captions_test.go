@@ -0,0 +1,176 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/audio"
+	"bubble-talk/server/internal/gateway/realtimetest"
+)
+
+func TestMultiVoiceGateway_CaptionTrackWithRoleTiming(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	var mu sync.Mutex
+	var persisted []Caption
+	handler := func(ctx context.Context, msg *ClientMessage) error {
+		if msg.Type == EventTypeCaption && msg.Caption != nil {
+			mu.Lock()
+			persisted = append(persisted, *msg.Caption)
+			mu.Unlock()
+		}
+		return nil
+	}
+	gw, client := startMultiVoiceGatewayWithConfig(t, fake, handler, func(cfg *GatewayConfig) {
+		cfg.RoleProfiles = map[string]RoleProfile{
+			"host":      {Voice: "cedar", Avatar: "host.png"},
+			"economist": {Voice: "echo", Avatar: "economist.png"},
+		}
+	})
+	asr := waitVoiceConn(t, fake, "alloy")
+	host := waitVoiceConn(t, fake, "cedar")
+
+	// 用户：开口 → 转写增量（partial）→ 完成（final，start 为开口时刻）
+	if err := asr.EmitSpeechStarted(); err != nil {
+		t.Fatal(err)
+	}
+	client.waitEvent(t, EventTypeSpeechStarted, nil)
+	if err := asr.EmitTranscription("什么是通胀？"); err != nil {
+		t.Fatal(err)
+	}
+	partial := client.waitEvent(t, EventTypeCaption, func(m ServerMessage) bool {
+		return m.Caption != nil && m.Caption.Kind == captionKindPartial
+	})
+	userFinal := client.waitEvent(t, EventTypeCaption, func(m ServerMessage) bool {
+		return m.Caption != nil && m.Caption.Speaker == captionSpeakerUser && m.Caption.Kind == captionKindFinal
+	}).Caption
+	if partial.Caption.CaptionID != userFinal.CaptionID || userFinal.Text != "什么是通胀？" {
+		t.Errorf("user captions: partial=%+v final=%+v", partial.Caption, userFinal)
+	}
+	if userFinal.StartMS != partial.Caption.StartMS || userFinal.EndMS < userFinal.StartMS {
+		t.Errorf("user caption timing = %d..%d", userFinal.StartMS, userFinal.EndMS)
+	}
+
+	// 角色：两段转写，各跟 50ms 音频（24kHz PCM16）
+	fake.SetResponder(func(conn *realtimetest.Conn, req realtimetest.Event) realtimetest.Response {
+		return realtimetest.Response{Transcript: "物价普遍上涨。", Audio: make([]byte, 4800), Chunks: 2}
+	})
+	if err := gw.SendInstructions(context.Background(), "解释通胀", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := host.WaitFor("response.create", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	roleFinal := client.waitEvent(t, EventTypeCaption, func(m ServerMessage) bool {
+		return m.Caption != nil && m.Caption.Speaker == captionSpeakerRole && m.Caption.Kind == captionKindFinal
+	}).Caption
+	if roleFinal.Role != "host" || roleFinal.Avatar != "host.png" || roleFinal.Text != "物价普遍上涨。" || roleFinal.StreamID == 0 {
+		t.Errorf("role final caption = %+v", roleFinal)
+	}
+	if got := roleFinal.EndMS - roleFinal.StartMS; got != 100 {
+		t.Errorf("role caption duration = %dms, want 100 (audio length)", got)
+	}
+
+	client.mu.Lock()
+	var deltas []*Caption
+	for _, evt := range client.events {
+		if evt.Type == EventTypeCaption && evt.Caption.Kind == captionKindDelta {
+			deltas = append(deltas, evt.Caption)
+		}
+	}
+	client.mu.Unlock()
+	if len(deltas) != 2 {
+		t.Fatalf("role deltas = %d, want 2", len(deltas))
+	}
+	if deltas[0].StartMS != roleFinal.StartMS || deltas[1].StartMS != roleFinal.StartMS+50 {
+		t.Errorf("delta start = %d, %d (caption start %d)", deltas[0].StartMS, deltas[1].StartMS, roleFinal.StartMS)
+	}
+	if deltas[0].Text+deltas[1].Text != roleFinal.Text || deltas[0].Avatar != "host.png" {
+		t.Errorf("deltas = %+v %+v", deltas[0], deltas[1])
+	}
+
+	// 只有 final 字幕回灌 Orchestrator 落 Timeline
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(persisted)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("persisted captions = %d, want 2", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(persisted) != 2 || persisted[0].Speaker != captionSpeakerUser || persisted[1].Role != "host" {
+		t.Errorf("persisted captions = %+v", persisted)
+	}
+}
+
+// takeRecorder 带 take 编号与开始时刻的假录音器
+type takeRecorder struct {
+	take      int
+	startedAt time.Time
+}
+
+func (r takeRecorder) RecordInput(pcm []byte)               {}
+func (r takeRecorder) RecordOutput(role string, pcm []byte) {}
+func (r takeRecorder) Take() int                            { return r.take }
+func (r takeRecorder) StartedAt() time.Time                 { return r.startedAt }
+
+// TestMultiVoiceGateway_CaptionAnchoredToRecordingTake 验证字幕时间轴以录音 take 的开始时刻为零点，
+// 并带上 take 与相对会话开始的 offset_ms，重连后的字幕也能拼回会话时间。
+func TestMultiVoiceGateway_CaptionAnchoredToRecordingTake(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	sessionStart := time.Now().Add(-10 * time.Second)
+	takeStart := sessionStart.Add(4 * time.Second)
+	gw, client := startMultiVoiceGatewayWithConfig(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil }, func(cfg *GatewayConfig) {
+		cfg.SessionStart = sessionStart
+	})
+	gw.SetAudioRecorder(takeRecorder{take: 2, startedAt: takeStart})
+	asr := waitVoiceConn(t, fake, "alloy")
+
+	if err := asr.EmitSpeechStarted(); err != nil {
+		t.Fatal(err)
+	}
+	client.waitEvent(t, EventTypeSpeechStarted, nil)
+	if err := asr.EmitTranscription("什么是通胀？"); err != nil {
+		t.Fatal(err)
+	}
+	final := client.waitEvent(t, EventTypeCaption, func(m ServerMessage) bool {
+		return m.Caption != nil && m.Caption.Kind == captionKindFinal
+	}).Caption
+	if final.Take != 2 || final.OffsetMS != 4000 {
+		t.Errorf("caption take/offset = %d/%d, want 2/4000", final.Take, final.OffsetMS)
+	}
+	// 时间轴从 take 开始计：take 已开始约 6s
+	if final.StartMS < 5000 {
+		t.Errorf("caption start_ms = %d, want relative to take start", final.StartMS)
+	}
+}
+
+func TestAudioDurationMS(t *testing.T) {
+	cases := []struct {
+		format audio.Format
+		n      int
+		want   float64
+	}{
+		{audio.Format{Codec: audio.CodecPCM16, SampleRate: 24000}, 4800, 100},
+		{audio.Format{Codec: audio.CodecPCM16, SampleRate: 16000}, 320, 10},
+		{audio.Format{Codec: audio.CodecG711ULaw, SampleRate: 8000}, 160, 20},
+		{audio.Format{Codec: audio.CodecOpus, SampleRate: 48000}, 100, 0},
+	}
+	for _, c := range cases {
+		if got := audioDurationMS(c.format, c.n); got != c.want {
+			t.Errorf("audioDurationMS(%v, %d) = %v, want %v", c.format, c.n, got, c.want)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"bubble-talk/server/internal/audio"
 	"bubble-talk/server/internal/tool"
 
 	"github.com/gorilla/websocket"
@@ -19,6 +20,10 @@ import (
 // 返回error表示处理失败，网关会记录但继续运行
 type EventHandler func(ctx context.Context, event *ClientMessage) error
 
+// OutputObserver 旁路观察网关下发给客户端的每条 JSON 消息（已分配 seq），用于 SSE 等其他传输。
+// 在下发路径上同步调用，实现必须不阻塞。
+type OutputObserver func(msg ServerMessage)
+
 // InstructionSender 发送指令到OpenAI Realtime（由网关调用，Orchestrator实现）
 // 这个接口让Orchestrator能够控制Realtime的行为
 type InstructionSender interface {
@@ -85,7 +90,8 @@ type Gateway struct {
 type GatewayConfig struct {
 	// OpenAI Realtime配置
 	OpenAIAPIKey      string
-	OpenAIRealtimeURL string // wss://api.openai.com/v1/realtime?model=gpt-realtime-2025-08-28
+	OpenAIRealtimeURL string            // wss://api.openai.com/v1/realtime?model=gpt-realtime-2025-08-28
+	RealtimeHeaders   map[string]string // 额外握手头（代理认证、本地假服务等），覆盖默认头
 	Model             string
 	Voice             string
 	RoleProfiles      map[string]RoleProfile
@@ -102,6 +108,37 @@ type GatewayConfig struct {
 	InputAudioFormat             string // pcm16
 	OutputAudioFormat            string // pcm16
 	InputAudioTranscriptionModel string
+	// 客户端侧音频格式（仅 MultiVoiceGateway）：与上面的 Realtime 侧格式不同时由网关转码（见 internal/audio）。
+	// 格式名如 pcm16、pcm16@16000、g711_ulaw；为空表示与 Realtime 侧相同，直通不转码。
+	ClientInputAudioFormat  string
+	ClientOutputAudioFormat string
+	// LocalVAD 在网关侧对上行音频做能量 VAD（仅 MultiVoiceGateway），nil 表示关闭。
+	// 开口检测不再等待 Realtime 的 speech_started 往返，插话静音更及时；SampleRate 由网关按 Realtime 侧输入格式填写。
+	LocalVAD *audio.VADConfig
+
+	// 断线续传（仅 MultiVoiceGateway）
+	// ResumeGracePeriod 客户端断开后保留网关与角色连接的时长；<=0 表示断开即关闭。
+	ResumeGracePeriod time.Duration
+	// ReplayBufferSize 缓存最近多少条下行 JSON 消息用于重连补发；<=0 时取默认值。
+	ReplayBufferSize int
+
+	// SpeechTTL 发言请求在队列里等待开播的默认时限（仅 MultiVoiceGateway），超时丢弃；<=0 时取默认值。
+	SpeechTTL time.Duration
+
+	// 角色连接健康（仅 MultiVoiceGateway，见 role_health.go）
+	// RealtimePingInterval 角色连接保活 ping 周期，连续 3 个周期读不到任何帧即判定断线；<=0 关闭保活。
+	RealtimePingInterval time.Duration
+	// RoleReconnectAttempts 角色连接断线后的重连次数；<=0 时取默认值。
+	RoleReconnectAttempts int
+	// RoleRecoveryInterval 重连全部失败后后台重试的初始间隔（之后逐次翻倍，封顶 1 分钟）；<=0 时取默认值。
+	RoleRecoveryInterval time.Duration
+
+	// SessionStart 会话创建时刻（仅 MultiVoiceGateway）：字幕的 offset_ms 以它为零点；零值时 offset_ms 为 0。
+	SessionStart time.Time
+
+	// HistoryWindow 文本镜像逐字保留的最近轮次数（仅 MultiVoiceGateway，见 history.go），
+	// 更早的轮次从角色连接中删除并并入摘要；<=0 不限制。
+	HistoryWindow int
 }
 
 type RoleProfile struct {
@@ -168,21 +205,16 @@ func (g *Gateway) Start(ctx context.Context) error {
 
 // connectRealtime 连接到OpenAI Realtime API
 func (g *Gateway) connectRealtime(ctx context.Context) error {
-	url := g.config.OpenAIRealtimeURL
-	if url == "" {
-		model := g.config.Model
-		if model == "" {
-			model = "gpt-realtime-2025-08-28"
-		}
-		url = fmt.Sprintf("wss://api.openai.com/v1/realtime?model=%s", model)
+	model := g.config.Model
+	if model == "" {
+		model = "gpt-realtime-2025-08-28"
 	}
+	url := resolveRealtimeURL(g.config.OpenAIRealtimeURL, model)
 
 	g.logger.Printf("[Gateway] Connecting to: %s", url)
 	g.logger.Printf("[Gateway] API Key prefix: %s...", g.config.OpenAIAPIKey[:min(10, len(g.config.OpenAIAPIKey))])
 
-	headers := make(map[string][]string)
-	headers["Authorization"] = []string{"Bearer " + g.config.OpenAIAPIKey}
-	headers["OpenAI-Beta"] = []string{"realtime=v1"}
+	headers := realtimeHeaders(g.config.OpenAIAPIKey, g.config.RealtimeHeaders)
 
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 15 * time.Second,
@@ -236,6 +268,7 @@ func (g *Gateway) initRealtimeSession(_ context.Context) error {
 				CreateResponse:    false,
 			},
 			Temperature: 0.8,
+			Tools:       []interface{}{},
 		},
 	}
 
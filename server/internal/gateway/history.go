@@ -0,0 +1,235 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"bubble-talk/server/internal/llm"
+)
+
+// 对话历史窗口与滚动摘要。
+//
+// 文本镜像会把每一轮都写进所有角色连接的对话，长会话里 Realtime 的上下文（和费用）会一直涨。
+// 启用 VoicePoolConfig.HistoryWindow 后：
+//   - 只有最近 HistoryWindow 轮以原文保留；更早的轮次用 conversation.item.delete 从各角色连接中删除；
+//   - 删除的轮次交给 HistorySummarizer 并入滚动摘要，摘要以 system item 插在对话最前面（每次更新替换旧的）；
+//   - 新建/重连的角色连接先收到摘要，再收到窗口内的原文。
+
+// HistorySummarizer 把滑出窗口的轮次并入滚动摘要
+type HistorySummarizer interface {
+	// SummarizeHistory 基于已有摘要（可能为空）与新滑出的轮次，返回新的完整摘要
+	SummarizeHistory(ctx context.Context, summary string, turns []ConversationTurn) (string, error)
+}
+
+const (
+	// historySummaryTimeout 单次摘要生成的超时
+	historySummaryTimeout = 30 * time.Second
+	// historySummaryPrefix 摘要 item 的前缀，提示模型这是更早对话的概要而不是新指令
+	historySummaryPrefix = "【前情摘要】以下是本次对话更早部分的概要，供你保持上下文连贯：\n"
+)
+
+// SetHistorySummarizer 设置历史摘要器（nil 表示只按窗口删除、不生成摘要）
+func (vp *VoicePool) SetHistorySummarizer(summarizer HistorySummarizer) {
+	vp.summaryMu.Lock()
+	vp.summarizer = summarizer
+	vp.summaryMu.Unlock()
+}
+
+// HistorySummary 当前的滚动摘要（没有时为空串）
+func (vp *VoicePool) HistorySummary() string {
+	vp.summaryMu.Lock()
+	defer vp.summaryMu.Unlock()
+	return vp.summary
+}
+
+// historyPruneBatch 超出窗口多少轮才裁剪一次，避免每一轮都触发删除和摘要
+func historyPruneBatch(window int) int {
+	if batch := window / 4; batch > 1 {
+		return batch
+	}
+	return 1
+}
+
+// appendTurn 记录一轮对话并分配镜像 item ID；超出窗口时返回被裁掉的最早若干轮
+func (vp *VoicePool) appendTurn(turn ConversationTurn) (ConversationTurn, []ConversationTurn) {
+	vp.conversationHistoryMu.Lock()
+	defer vp.conversationHistoryMu.Unlock()
+
+	vp.historySeq++
+	turn.ItemID = fmt.Sprintf("hist_%d", vp.historySeq)
+	vp.conversationHistory = append(vp.conversationHistory, turn)
+
+	window := vp.config.HistoryWindow
+	if window <= 0 || len(vp.conversationHistory) < window+historyPruneBatch(window) {
+		return turn, nil
+	}
+
+	cut := len(vp.conversationHistory) - window
+	evicted := make([]ConversationTurn, cut)
+	copy(evicted, vp.conversationHistory[:cut])
+	kept := make([]ConversationTurn, window)
+	copy(kept, vp.conversationHistory[cut:])
+	vp.conversationHistory = kept
+	return turn, evicted
+}
+
+// evictTurns 从各角色连接删除滑出窗口的轮次，并排队并入摘要
+func (vp *VoicePool) evictTurns(evicted []ConversationTurn) {
+	if len(evicted) == 0 {
+		return
+	}
+	vp.logf("[VoicePool:%s] ✂️  Pruning %d turns out of history window", vp.sessionID, len(evicted))
+
+	vp.roleConnsMu.RLock()
+	for role, conn := range vp.roleConns {
+		ids := make([]string, 0, len(evicted))
+		for _, turn := range evicted {
+			if turn.Role == "assistant" && turn.FromRole == role {
+				// 角色自己的发言不是镜像进来的，而是它自己的响应输出
+				ids = append(ids, turn.SourceItemID)
+				continue
+			}
+			ids = append(ids, turn.ItemID)
+		}
+		if err := conn.deleteItems(ids); err != nil {
+			vp.logf("[VoicePool:%s] ⚠️  Failed to prune history from %s: %v", vp.sessionID, role, err)
+		}
+	}
+	vp.roleConnsMu.RUnlock()
+
+	vp.summaryMu.Lock()
+	defer vp.summaryMu.Unlock()
+	if vp.summarizer == nil {
+		return
+	}
+	vp.pendingSummary = append(vp.pendingSummary, evicted...)
+	if !vp.summarizing {
+		vp.summarizing = true
+		go vp.summaryLoop()
+	}
+}
+
+// summaryLoop 依次把待摘要的轮次并入摘要（串行：每次都基于上一版摘要）
+func (vp *VoicePool) summaryLoop() {
+	for {
+		vp.summaryMu.Lock()
+		turns := vp.pendingSummary
+		vp.pendingSummary = nil
+		if len(turns) == 0 || vp.summarizer == nil {
+			vp.summarizing = false
+			vp.summaryMu.Unlock()
+			return
+		}
+		summarizer := vp.summarizer
+		previous := vp.summary
+		vp.summaryMu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), historySummaryTimeout)
+		summary, err := summarizer.SummarizeHistory(ctx, previous, turns)
+		cancel()
+		if err != nil {
+			// 摘要失败不影响对话：这几轮已从角色连接删除，放回待摘要队列，随下一批滑出的轮次一起重试
+			vp.logf("[VoicePool:%s] ⚠️  Failed to summarize %d turns, will retry with the next batch: %v", vp.sessionID, len(turns), err)
+			vp.summaryMu.Lock()
+			arrived := len(vp.pendingSummary) > 0
+			vp.pendingSummary = append(turns, vp.pendingSummary...)
+			if !arrived {
+				vp.summarizing = false
+				vp.summaryMu.Unlock()
+				return
+			}
+			// 失败期间又有轮次滑出：evictTurns 不会再启动 summaryLoop，这里直接带上它们重试
+			vp.summaryMu.Unlock()
+			continue
+		}
+		vp.applySummary(summary)
+	}
+}
+
+// applySummary 用新摘要替换各角色连接里的旧摘要 item
+func (vp *VoicePool) applySummary(summary string) {
+	vp.summaryMu.Lock()
+	oldItemID := vp.summaryItemID
+	vp.summarySeq++
+	vp.summary = summary
+	vp.summaryItemID = fmt.Sprintf("hist_summary_%d", vp.summarySeq)
+	newItemID := vp.summaryItemID
+	vp.summaryMu.Unlock()
+
+	vp.logf("[VoicePool:%s] 📝 History summary updated (len=%d)", vp.sessionID, len(summary))
+
+	vp.roleConnsMu.RLock()
+	defer vp.roleConnsMu.RUnlock()
+	for role, conn := range vp.roleConns {
+		if err := conn.syncSummaryText(newItemID, historySummaryPrefix+summary); err != nil {
+			vp.logf("[VoicePool:%s] ⚠️  Failed to sync history summary to %s: %v", vp.sessionID, role, err)
+			continue
+		}
+		if oldItemID != "" {
+			_ = conn.deleteItems([]string{oldItemID})
+		}
+	}
+}
+
+// syncSummaryToRole 把当前摘要同步到新建的角色连接
+func (vp *VoicePool) syncSummaryToRole(role string, conn *RoleConn) {
+	vp.summaryMu.Lock()
+	summary, itemID := vp.summary, vp.summaryItemID
+	vp.summaryMu.Unlock()
+	if summary == "" {
+		return
+	}
+	if err := conn.syncSummaryText(itemID, historySummaryPrefix+summary); err != nil {
+		vp.logf("[VoicePool:%s] ⚠️  Failed to sync history summary to %s: %v", vp.sessionID, role, err)
+	}
+}
+
+// LLMHistorySummarizer 用 LLM 生成滚动摘要
+type LLMHistorySummarizer struct {
+	client llm.Client
+}
+
+// NewLLMHistorySummarizer 创建基于 LLM 的历史摘要器
+func NewLLMHistorySummarizer(client llm.Client) *LLMHistorySummarizer {
+	return &LLMHistorySummarizer{client: client}
+}
+
+const historySummarySystemPrompt = `你负责压缩一段多角色语音教学对话的历史。
+输入是已有摘要（可能为空）和紧接其后的若干轮对话，请输出合并后的新摘要：
+- 保留学习者提过的问题、表现出的误解与已经掌握的要点；
+- 保留各角色讲过的核心概念、举过的例子和尚未回答的问题；
+- 省略寒暄与重复内容，不要编造对话中没有的信息；
+- 只输出摘要正文（纯文本，不超过 300 字）。`
+
+// SummarizeHistory 实现 HistorySummarizer
+func (s *LLMHistorySummarizer) SummarizeHistory(ctx context.Context, summary string, turns []ConversationTurn) (string, error) {
+	var b strings.Builder
+	if summary != "" {
+		b.WriteString("已有摘要：\n")
+		b.WriteString(summary)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("新的对话：\n")
+	for _, turn := range turns {
+		speaker := "学习者"
+		if turn.Role == "assistant" {
+			speaker = turn.FromRole
+		}
+		fmt.Fprintf(&b, "%s：%s\n", speaker, turn.Text)
+	}
+
+	out, err := s.client.Complete(ctx, []llm.Message{
+		{Role: "system", Content: historySummarySystemPrompt},
+		{Role: "user", Content: b.String()},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("summarize history: %w", err)
+	}
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return "", fmt.Errorf("summarize history: empty summary")
+	}
+	return out, nil
+}
@@ -0,0 +1,203 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/gateway/realtimetest"
+	"bubble-talk/server/internal/llm"
+)
+
+type stubSummarizer struct {
+	mu        sync.Mutex
+	fail      int // 前 fail 次调用返回错误
+	previous  []string
+	turnCount []int
+	firstTurn []string
+}
+
+func (s *stubSummarizer) SummarizeHistory(ctx context.Context, summary string, turns []ConversationTurn) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.previous = append(s.previous, summary)
+	s.turnCount = append(s.turnCount, len(turns))
+	s.firstTurn = append(s.firstTurn, turns[0].Text)
+	if len(s.previous) <= s.fail {
+		return "", errors.New("llm unavailable")
+	}
+	return fmt.Sprintf("摘要v%d", len(s.previous)), nil
+}
+
+func (s *stubSummarizer) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.previous)
+}
+
+func waitItems(t *testing.T, conn *realtimetest.Conn, want ...string) {
+	t.Helper()
+	sort.Strings(want)
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		got := conn.Items()
+		sort.Strings(got)
+		if strings.Join(got, ",") == strings.Join(want, ",") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("items = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestVoicePool_HistoryWindowPrunesAndSummarizes(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	vp := NewVoicePool("history-session", VoicePoolConfig{
+		OpenAIAPIKey:  "test-key",
+		RealtimeURL:   fake.URL(),
+		Model:         "fake-realtime",
+		RoleVoices:    map[string]string{"host": "cedar", "economist": "echo"},
+		HistoryWindow: 4,
+	})
+	summarizer := &stubSummarizer{}
+	vp.SetHistorySummarizer(summarizer)
+	defer vp.Close()
+
+	if _, err := vp.GetRoleConn(context.Background(), "host"); err != nil {
+		t.Fatalf("get host conn: %v", err)
+	}
+	host := fake.Conns()[0]
+
+	// 窗口 4 轮：第 5 轮挤出第 1 轮并生成摘要；第 6 轮挤出第 2 轮，新摘要基于上一版并替换旧摘要 item
+	for i := 1; i <= 5; i++ {
+		if err := vp.SyncUserText(fmt.Sprintf("第%d句", i)); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	waitItems(t, host, "hist_2", "hist_3", "hist_4", "hist_5", "hist_summary_1")
+	if err := vp.SyncUserText("第6句"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	waitItems(t, host, "hist_3", "hist_4", "hist_5", "hist_6", "hist_summary_2")
+
+	if got := vp.HistorySummary(); got != "摘要v2" {
+		t.Fatalf("summary = %q", got)
+	}
+	summarizer.mu.Lock()
+	if len(summarizer.previous) != 2 || summarizer.previous[0] != "" || summarizer.previous[1] != "摘要v1" {
+		t.Errorf("summaries should build on the previous one: %v", summarizer.previous)
+	}
+	summarizer.mu.Unlock()
+	if history := vp.GetConversationHistory(); len(history) != 4 || history[0].Text != "第3句" {
+		t.Errorf("history window = %+v", history)
+	}
+
+	// 新建的角色连接：先收到摘要（插在最前的 system item），再收到窗口内原文
+	if _, err := vp.GetRoleConn(context.Background(), "economist"); err != nil {
+		t.Fatalf("get economist conn: %v", err)
+	}
+	economist, err := fake.WaitConn(2*time.Second, func(c *realtimetest.Conn) bool { return c.Voice() == "echo" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := economist.WaitFor("conversation.item.create", 5, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	first := economist.ReceivedOfType("conversation.item.create")[0]
+	item, _ := first["item"].(map[string]interface{})
+	if first["previous_item_id"] != "root" || item["role"] != "system" || item["id"] != "hist_summary_2" {
+		t.Errorf("first synced item should be the summary, got %v", first)
+	}
+}
+
+// TestVoicePool_FailedSummaryKeepsEvictedTurns 验证摘要失败时滑出的轮次不会丢：随下一批一起重新摘要
+func TestVoicePool_FailedSummaryKeepsEvictedTurns(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	vp := NewVoicePool("history-session", VoicePoolConfig{
+		OpenAIAPIKey:  "test-key",
+		RealtimeURL:   fake.URL(),
+		Model:         "fake-realtime",
+		RoleVoices:    map[string]string{"host": "cedar"},
+		HistoryWindow: 4,
+	})
+	summarizer := &stubSummarizer{fail: 1}
+	vp.SetHistorySummarizer(summarizer)
+	defer vp.Close()
+
+	if _, err := vp.GetRoleConn(context.Background(), "host"); err != nil {
+		t.Fatalf("get host conn: %v", err)
+	}
+	host := fake.Conns()[0]
+
+	for i := 1; i <= 5; i++ {
+		if err := vp.SyncUserText(fmt.Sprintf("第%d句", i)); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for summarizer.calls() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("summarizer not called")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := vp.SyncUserText("第6句"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	waitItems(t, host, "hist_3", "hist_4", "hist_5", "hist_6", "hist_summary_1")
+
+	summarizer.mu.Lock()
+	defer summarizer.mu.Unlock()
+	last := len(summarizer.turnCount) - 1
+	if summarizer.turnCount[last] != 2 || summarizer.firstTurn[last] != "第1句" {
+		t.Errorf("retry batch = %d turns starting with %q, want 2 starting with 第1句", summarizer.turnCount[last], summarizer.firstTurn[last])
+	}
+}
+
+type captureLLM struct {
+	messages []llm.Message
+	reply    string
+}
+
+func (c *captureLLM) Complete(ctx context.Context, messages []llm.Message, schema *llm.JSONSchema) (string, error) {
+	c.messages = messages
+	return c.reply, nil
+}
+
+func TestLLMHistorySummarizer_PromptIncludesSummaryAndSpeakers(t *testing.T) {
+	client := &captureLLM{reply: "  学习者问了通胀的成因。\n"}
+	summarizer := NewLLMHistorySummarizer(client)
+
+	got, err := summarizer.SummarizeHistory(context.Background(), "之前聊了货币。", []ConversationTurn{
+		{Role: "user", Text: "为什么会通胀？"},
+		{Role: "assistant", FromRole: "economist", Text: "钱多了，东西没变多。"},
+	})
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	if got != "学习者问了通胀的成因。" {
+		t.Errorf("summary = %q", got)
+	}
+	prompt := client.messages[len(client.messages)-1].Content
+	for _, want := range []string{"之前聊了货币。", "学习者：为什么会通胀？", "economist：钱多了，东西没变多。"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+
+	client.reply = "  "
+	if _, err := summarizer.SummarizeHistory(context.Background(), "", nil); err == nil {
+		t.Error("empty summary should be an error")
+	}
+}
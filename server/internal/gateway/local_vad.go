@@ -0,0 +1,162 @@
+package gateway
+
+import (
+	"fmt"
+	"time"
+
+	"bubble-talk/server/internal/audio"
+)
+
+// 用户开口/说完事件的来源（speech_started / speech_stopped 的 metadata.source）
+const (
+	vadSourceServer = "server_vad"
+	vadSourceLocal  = "local_vad"
+)
+
+// localVADDedupWindow 本地 VAD 发出 speech_stopped 之后这段时间内到达的服务端 speech_stopped 视为同一次说完，不再重复处理
+const localVADDedupWindow = 3 * time.Second
+
+// setupLocalVAD 按 Realtime 侧输入格式创建本地 VAD（Start 时调用，未配置时什么也不做）
+func (g *MultiVoiceGateway) setupLocalVAD() error {
+	if g.config.LocalVAD == nil {
+		return nil
+	}
+	format, err := audio.ParseFormat(g.config.InputAudioFormat)
+	if err != nil {
+		return fmt.Errorf("local vad: %w", err)
+	}
+	decoder, err := audio.NewCodec(format.Codec)
+	if err != nil {
+		return fmt.Errorf("local vad: %w", err)
+	}
+	cfg := *g.config.LocalVAD
+	cfg.SampleRate = format.SampleRate
+
+	g.vadMu.Lock()
+	g.vad = audio.NewVAD(cfg)
+	g.vadDecoder = decoder
+	g.vadMu.Unlock()
+
+	g.logger.Printf("[MultiVoiceGateway] ✅ Local VAD enabled: format=%s threshold=%.0fdB min_speech=%v hangover=%v",
+		format, cfg.ThresholdDB, cfg.MinSpeech, cfg.Hangover)
+	return nil
+}
+
+// runLocalVAD 对一块上行音频（Realtime 侧格式）做 VAD，并处理确认的开口/说完
+func (g *MultiVoiceGateway) runLocalVAD(data []byte) {
+	g.vadMu.Lock()
+	if g.vad == nil {
+		g.vadMu.Unlock()
+		return
+	}
+	pcm, err := g.vadDecoder.Decode(g.vadPCM[:0], data)
+	if err != nil {
+		g.vadMu.Unlock()
+		g.logger.Printf("[MultiVoiceGateway] ⚠️  Local VAD decode failed: %v", err)
+		return
+	}
+	g.vadPCM = pcm
+	events := g.vad.Process(pcm)
+	for _, evt := range events {
+		if evt.Type == audio.VADSpeechStopped {
+			g.localVADStoppedAt = time.Now()
+		}
+	}
+	g.vadMu.Unlock()
+
+	for _, evt := range events {
+		switch evt.Type {
+		case audio.VADSpeechStarted:
+			g.logger.Printf("[MultiVoiceGateway] 🎤 User started speaking (local VAD, onset=%v)", evt.At)
+			g.onUserSpeechStarted(vadSourceLocal)
+		case audio.VADSpeechStopped:
+			g.logger.Printf("[MultiVoiceGateway] User stopped speaking (local VAD, offset=%v)", evt.At)
+			g.onUserSpeechStopped(vadSourceLocal)
+		}
+	}
+}
+
+// localVADSpeaking 本地 VAD 已发出 speech_started 且还没说完：服务端的 speech_started 属于同一次开口。
+// 本地 VAD 已经说完时服务端再报开口就是新的一次，不做去重。
+func (g *MultiVoiceGateway) localVADSpeaking() bool {
+	g.vadMu.Lock()
+	defer g.vadMu.Unlock()
+	return g.vad != nil && g.vad.Speaking()
+}
+
+// localVADStopHandled 本地 VAD 还在跟踪这次发言，或刚发出过 speech_stopped（之后没有服务端报的新开口）
+func (g *MultiVoiceGateway) localVADStopHandled() bool {
+	g.vadMu.Lock()
+	defer g.vadMu.Unlock()
+	if g.vad == nil {
+		return false
+	}
+	return g.vad.Speaking() || (!g.localVADStoppedAt.IsZero() && time.Since(g.localVADStoppedAt) < localVADDedupWindow)
+}
+
+// forgetLocalVADStop 服务端报了本地 VAD 没听到的新开口：之后的服务端 speech_stopped 不再按本地的说完去重
+func (g *MultiVoiceGateway) forgetLocalVADStop() {
+	g.vadMu.Lock()
+	defer g.vadMu.Unlock()
+	g.localVADStoppedAt = time.Time{}
+}
+
+// onUserSpeechStarted 用户开口：通知前端、丢弃待播指令，并打断正在说话的角色。
+// 服务端 VAD 与本地 VAD 共用这一套插话逻辑，是对客户端 barge_in 的补充，防止客户端延迟或未发送 barge_in。
+func (g *MultiVoiceGateway) onUserSpeechStarted(source string) {
+	reason := source + "_speech_started"
+
+	activeSpeaker := ""
+	if g.voicePool != nil {
+		activeSpeaker = g.voicePool.GetSpeakingRole()
+	}
+
+	// 给前端一个“我听到了”的强信号，便于 UI 做录音态/打断态联动。
+	g.sendToClient(&ServerMessage{
+		Type:     EventTypeSpeechStarted,
+		Metadata: map[string]interface{}{"source": source},
+		ServerTS: time.Now(),
+	})
+
+	g.setLearnerSpeaking(true)
+	g.markUserSpeech(true)
+
+	// 用户开口时：丢弃尚未播放的旧指令，避免“还没说完就又发现要说另一段”的精神分裂感。
+	// 打断正在说话的角色时整段场景作废；角色之间开口时场景只是暂停（见 scene.go）。
+	if activeSpeaker != "" {
+		g.dropPendingSpeech(reason)
+	} else {
+		g.dropUnscenedSpeech(reason)
+	}
+
+	// 如果有角色正在说话，先在网关侧闸住音频，再取消 response
+	if activeSpeaker != "" {
+		g.muteRoleAudio(activeSpeaker, reason)
+	}
+	if g.voicePool == nil {
+		return
+	}
+	if err := g.voicePool.CancelCurrentResponse(); err != nil {
+		g.logger.Printf("[MultiVoiceGateway] ⚠️  Barge-in cancel failed (%s): %v", source, err)
+	} else if activeSpeaker != "" {
+		g.logger.Printf("[MultiVoiceGateway] ✅ Barge-in (%s): cancelled current response (role=%s)", source, activeSpeaker)
+	} else {
+		g.logger.Printf("[MultiVoiceGateway] ✅ Barge-in (%s): no active speaker", source)
+	}
+
+	// 仅在确实有 AI 在播时才清空缓冲，避免前端收到噪音事件。
+	if activeSpeaker != "" {
+		g.sendTTSInterruptedToClient(reason)
+	}
+}
+
+// onUserSpeechStopped 用户停止说话（可能只是句中停顿）：只通知前端，轮次结束仍以 ASR 的转写为准
+func (g *MultiVoiceGateway) onUserSpeechStopped(source string) {
+	g.setLearnerSpeaking(false)
+	g.markUserSpeech(false)
+	g.sendToClient(&ServerMessage{
+		Type:     EventTypeSpeechStopped,
+		Metadata: map[string]interface{}{"source": source},
+		ServerTS: time.Now(),
+	})
+}
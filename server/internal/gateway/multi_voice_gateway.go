@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"bubble-talk/server/internal/audio"
 	"bubble-talk/server/internal/tool"
 
 	"github.com/gorilla/websocket"
@@ -27,17 +28,69 @@ import (
 type MultiVoiceGateway struct {
 	sessionID string
 
-	// 客户端连接：与前端（Web/App）的 WebSocket 连接，传输音频流和控制指令
+	// 客户端连接：与前端（Web/App）的 WebSocket 连接，传输音频流和控制指令。
+	// 断线后在续传宽限期内为 nil，下行 JSON 消息只进 replay 缓冲。
 	clientConn     *websocket.Conn
 	clientConnLock sync.Mutex
 
+	// 断线续传：resumeToken 校验重连身份，replay 缓存最近的下行消息，
+	// replayFallback 在缺口超出缓冲时从 Timeline 重建；graceTimer/detachGen 由 clientConnLock 保护。
+	resumeToken    string
+	replay         *replayBuffer
+	replayFallback ReplayFallback
+	graceTimer     *time.Timer
+	detachGen      int64
+	// clientProtocol 当前客户端连接协商出的协议版本（ProtocolV1/V2），由 clientConnLock 保护
+	clientProtocol int
+
+	// 下行音频流：每次角色发言（responseID）分配一个 stream_id，帧序号在流内递增（v2 帧头使用）
+	audioStreamMu sync.Mutex
+	audioStreams  map[string]*audioStream
+	nextStreamID  uint32
+	// closedStreams 最近结束的 responseID（按结束顺序，最多 maxClosedAudioStreams 个）：
+	// 结束后才到的音频增量直接丢弃，不再补建流
+	closedStreams []string
+
+	// 音频转码（见 transcode.go）：客户端侧格式与 Realtime 侧不同时，上行一个转码器，下行每条流一个
+	transcodeMu          sync.Mutex
+	inputTranscoder      *audio.Transcoder
+	realtimeOutputFormat audio.Format
+	clientOutputFormat   audio.Format
+
+	// 本地 VAD（可选，见 local_vad.go）：vadMu 保护检测器状态与最近一次本地 speech_stopped 的时间
+	vadMu             sync.Mutex
+	vad               *audio.VAD
+	vadDecoder        audio.Codec
+	vadPCM            []int16
+	localVADStoppedAt time.Time
+
+	// 实时字幕轨（见 captions.go）：captionEpoch 为时间轴零点，captionTake 为对应的录音 take，均由 captionMu 保护
+	captionMu         sync.Mutex
+	captionEpoch      time.Time
+	captionTake       int
+	userCaptions      map[string]*userCaption // 转写 item_id → 进行中的用户字幕
+	roleCaptions      map[string]*roleCaption // responseID → 进行中的角色字幕
+	userSpeechStartMS int64                   // 最近一次 VAD 开口的时刻，-1 表示没有
+	userSpeechEndMS   int64                   // 最近一次 VAD 停止的时刻，-1 表示没有
+
+	// 会话录音（可选，SetAudioRecorder 注入）：只在音频格式为 pcm16 时写入
+	recorderMu sync.RWMutex
+	recorder   AudioRecorder
+
 	// 音色池（管理多个角色连接）：封装了与 OpenAI Realtime API 的多个连接
 	voicePool *VoicePool
+	// warmPool 服务级预热池（可选，SetWarmPool 注入），交给 voicePool 租用角色连接
+	warmPool *WarmPool
+	// historySummarizer 历史摘要器（可选，SetHistorySummarizer 注入），配合 GatewayConfig.HistoryWindow
+	historySummarizer HistorySummarizer
 	// voicePoolReady 用于在 Start 完成 voicePool 初始化后唤醒发言队列。
 	// 注意：SendInstructions 可能在 Start 之前被调用（比如开场编排更早到达）。
 	voicePoolReady chan struct{}
 	voicePoolOnce  sync.Once
 
+	// outputObserver 旁路观察下发消息（可选，SetOutputObserver 注入），在 clientConnLock 内调用
+	outputObserver OutputObserver
+
 	// 事件处理器（由 Orchestrator 注入）：用于将网关收到的业务事件（如用户说话、插话、退出等）转发给编排器
 	eventHandler EventHandler
 
@@ -62,9 +115,13 @@ type MultiVoiceGateway struct {
 	// - 任意时刻只允许一个角色 CreateResponse；下一个角色必须等上一个 response.done/cancelled。
 	speechMu       sync.Mutex
 	speechCond     *sync.Cond
-	speechQueue    []speechRequest
+	speechQueue    speechList     // 按优先级排序，同级 FIFO（见 speech_queue.go）
+	currentSpeech  *speechRequest // 正在播的发言（用于判断紧急发言能否抢占）
 	speechEndedCh  chan speechEnded
 	speechLoopOnce sync.Once
+	// 学习者是否正在说话/何时停下（场景交接用，见 scene.go），由 speechMu 保护
+	learnerSpeaking  bool
+	learnerStoppedAt time.Time
 
 	// ASR 事件源配置：解决"双终态事件源"问题
 	// true: 只使用 conversation.item.input_audio_transcription.completed
@@ -107,6 +164,13 @@ type speechRequest struct {
 	instructions string
 	metadata     map[string]interface{}
 	enqueuedAt   time.Time
+
+	// 调度字段，从 metadata 解析（见 speech_queue.go）
+	sceneID   string // 所属多角色场景（SendScene），为空表示单条指令
+	turnID    string
+	planID    string
+	priority  speechPriority
+	expiresAt time.Time
 }
 
 type speechEnded struct {
@@ -134,8 +198,17 @@ func NewMultiVoiceGateway(sessionID string, clientConn *websocket.Conn, config G
 		// 初始化元数据注册表
 		metadataRegistry: NewResponseMetadataRegistry(logger),
 		voicePoolReady:   make(chan struct{}),
-		speechQueue:      make([]speechRequest, 0, 8),
+		resumeToken:      newResumeToken(),
+		audioStreams:     make(map[string]*audioStream),
+		replay:           newReplayBuffer(config.ReplayBufferSize),
+		speechQueue:      make(speechList, 0, 8),
 		speechEndedCh:    make(chan speechEnded, 32),
+		captionEpoch:     time.Now(),
+		userCaptions:     make(map[string]*userCaption),
+		roleCaptions:     make(map[string]*roleCaption),
+
+		userSpeechStartMS: -1,
+		userSpeechEndMS:   -1,
 	}
 	g.speechCond = sync.NewCond(&g.speechMu)
 
@@ -152,6 +225,13 @@ func (g *MultiVoiceGateway) SetEventHandler(handler EventHandler) {
 	}
 }
 
+// SetOutputObserver 设置下发消息的旁路观察者（需在 Start 之前调用）
+func (g *MultiVoiceGateway) SetOutputObserver(observer OutputObserver) {
+	g.clientConnLock.Lock()
+	g.outputObserver = observer
+	g.clientConnLock.Unlock()
+}
+
 // SetToolRegistry 设置工具注册表
 func (g *MultiVoiceGateway) SetToolRegistry(registry *tool.ToolRegistry) {
 	g.toolRegistry = registry
@@ -161,6 +241,16 @@ func (g *MultiVoiceGateway) SetToolRegistry(registry *tool.ToolRegistry) {
 	}
 }
 
+// SetWarmPool 设置服务级角色连接预热池（需在 Start 之前调用）
+func (g *MultiVoiceGateway) SetWarmPool(pool *WarmPool) {
+	g.warmPool = pool
+}
+
+// SetHistorySummarizer 设置对话历史摘要器（需在 Start 之前调用）
+func (g *MultiVoiceGateway) SetHistorySummarizer(summarizer HistorySummarizer) {
+	g.historySummarizer = summarizer
+}
+
 // Start 启动网关
 func (g *MultiVoiceGateway) Start(ctx context.Context) error {
 	g.logger.Printf("[MultiVoiceGateway] Starting gateway for session %s", g.sessionID)
@@ -168,6 +258,12 @@ func (g *MultiVoiceGateway) Start(ctx context.Context) error {
 	if g.clientConn == nil {
 		return fmt.Errorf("clientConn is nil")
 	}
+	if err := g.setupTranscoding(); err != nil {
+		return err
+	}
+	if err := g.setupLocalVAD(); err != nil {
+		return err
+	}
 
 	// 1. 创建音色池
 	g.logger.Printf("[MultiVoiceGateway] Creating voice pool...")
@@ -179,16 +275,27 @@ func (g *MultiVoiceGateway) Start(ctx context.Context) error {
 
 	poolConfig := VoicePoolConfig{
 		OpenAIAPIKey:                 g.config.OpenAIAPIKey,
+		RealtimeURL:                  g.config.OpenAIRealtimeURL,
+		RealtimeHeaders:              g.config.RealtimeHeaders,
 		Model:                        g.config.Model,
 		DefaultInstructions:          g.config.DefaultInstructions,
 		InputAudioFormat:             g.config.InputAudioFormat,
 		OutputAudioFormat:            g.config.OutputAudioFormat,
 		InputAudioTranscriptionModel: g.config.InputAudioTranscriptionModel,
 		RoleVoices:                   roleVoices,
+		PingInterval:                 g.config.RealtimePingInterval,
+		HistoryWindow:                g.config.HistoryWindow,
 	}
 
 	g.voicePool = NewVoicePool(g.sessionID, poolConfig)
 
+	if g.warmPool != nil {
+		g.voicePool.SetWarmPool(g.warmPool)
+	}
+	if g.historySummarizer != nil {
+		g.voicePool.SetHistorySummarizer(g.historySummarizer)
+	}
+
 	// 传递工具注册表到音色池（如果已设置）
 	if g.toolRegistry != nil {
 		g.voicePool.SetToolRegistry(g.toolRegistry)
@@ -206,19 +313,32 @@ func (g *MultiVoiceGateway) Start(ctx context.Context) error {
 
 	// 3. 启动事件循环
 	g.logger.Printf("[MultiVoiceGateway] Starting event loops...")
-	go g.clientReadLoop()
+	go g.clientReadLoop(g.clientConn)
 	go g.asrReadLoop()
 	go g.roleConnsReadLoop()
 	g.speechLoopOnce.Do(func() { go g.speechLoop() })
 
+	// 4. 下发续传凭证与协商出的协议版本
+	g.clientConnLock.Lock()
+	g.clientProtocol = ProtocolVersion(g.clientConn.Subprotocol())
+	inputFormat, outputFormat := g.clientAudioFormats()
+	_ = g.sendToClientLocked(&ServerMessage{
+		Type:              EventTypeStreamReady,
+		ResumeToken:       g.resumeToken,
+		Protocol:          g.clientProtocol,
+		InputAudioFormat:  inputFormat,
+		OutputAudioFormat: outputFormat,
+		ServerTS:          time.Now(),
+	})
+	g.clientConnLock.Unlock()
+
 	g.logger.Printf("[MultiVoiceGateway] ✅ Gateway fully started for session %s", g.sessionID)
 	return nil
 }
 
 // clientReadLoop 从客户端读取消息（事件+音频）
-func (g *MultiVoiceGateway) clientReadLoop() {
-	defer g.Close()
-
+// 读失败视为客户端断开：交给 detachClient 决定立即关闭还是进入续传宽限期。
+func (g *MultiVoiceGateway) clientReadLoop(conn *websocket.Conn) {
 	for {
 		select {
 		case <-g.closeChan:
@@ -226,11 +346,12 @@ func (g *MultiVoiceGateway) clientReadLoop() {
 		default:
 		}
 
-		messageType, data, err := g.clientConn.ReadMessage()
+		messageType, data, err := conn.ReadMessage()
 		if err != nil {
 			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
 				g.logger.Printf("[MultiVoiceGateway] client read error: %v", err)
 			}
+			g.detachClient(conn)
 			return
 		}
 
@@ -273,7 +394,36 @@ func (g *MultiVoiceGateway) handleClientEvent(data []byte) error {
 }
 
 // handleClientAudio 处理客户端音频数据（发送到 ASR 连接）
+// v2 客户端的二进制帧带 AudioFrame 头，需要先剥离并校验编码；v1 是裸音频。
+// 客户端侧格式与 Realtime 侧不同时先转码。
 func (g *MultiVoiceGateway) handleClientAudio(audioData []byte) error {
+	g.clientConnLock.Lock()
+	protocol := g.clientProtocol
+	g.clientConnLock.Unlock()
+
+	if protocol == ProtocolV2 {
+		var frame AudioFrame
+		if err := frame.UnmarshalBinary(audioData); err != nil {
+			return err
+		}
+		if want := g.clientInputCodec(); frame.Codec != want {
+			return fmt.Errorf("unsupported input codec %s (session expects %s)", frame.Codec, want)
+		}
+		audioData = frame.Payload
+	}
+	audioData, err := g.transcodeInput(audioData)
+	if err != nil {
+		return fmt.Errorf("transcode input audio: %w", err)
+	}
+	if len(audioData) == 0 {
+		return nil
+	}
+	// 本地 VAD 先于转发执行：检测到开口时立即静音当前角色，不等 Realtime 的 speech_started 往返
+	g.runLocalVAD(audioData)
+	if rec := g.audioRecorder(g.config.InputAudioFormat); rec != nil {
+		rec.RecordInput(audioData)
+	}
+
 	// 将音频数据转发到 ASR 连接
 	asrConn, err := g.voicePool.GetASRConn()
 	if err != nil {
@@ -364,10 +514,23 @@ func (g *MultiVoiceGateway) asrReadLoop() {
 
 		messageType, data, err := asrConn.ReadMessage()
 		if err != nil {
-			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-				g.logger.Printf("[MultiVoiceGateway] ASR read error: %v", err)
+			reason, retryable := asrConn.classifyReadError(err)
+			select {
+			case <-g.closeChan:
+				return
+			default:
 			}
-			return
+			if !retryable {
+				g.logger.Printf("[MultiVoiceGateway] ASR read loop stopped: reason=%s", reason)
+				return
+			}
+
+			// 断线重连：ASR 连接只做转写，重建后继续在新连接上读
+			g.logger.Printf("[MultiVoiceGateway] ⚠️  ASR connection lost: reason=%s err=%v", reason, err)
+			if asrConn = g.reconnectASR(reason); asrConn == nil {
+				return
+			}
+			continue
 		}
 
 		if messageType == websocket.TextMessage {
@@ -402,51 +565,30 @@ func (g *MultiVoiceGateway) handleASREvent(data []byte) error {
 		// VAD 检测到用户开始说话
 		// 修复方案：服务端兜底的插话检测
 		g.logger.Printf("[MultiVoiceGateway] 🎤 User started speaking (server-side VAD)")
-
-		activeSpeaker := ""
-		if g.voicePool != nil {
-			activeSpeaker = g.voicePool.GetSpeakingRole()
-		}
-
-		// 给前端一个“我听到了”的强信号，便于 UI 做录音态/打断态联动。
-		g.sendToClient(&ServerMessage{
-			Type:     EventTypeSpeechStarted,
-			ServerTS: time.Now(),
-		})
-
-		// 用户开口时：丢弃尚未播放的旧指令，避免“还没说完就又发现要说另一段”的精神分裂感。
-		g.dropPendingSpeech("server_vad_speech_started")
-
-		// 服务端兜底：如果有角色正在说话，立即取消
-		// 这是对客户端 barge_in 的补充，防止客户端延迟或未发送 barge_in
-		if activeSpeaker != "" {
-			g.muteRoleAudio(activeSpeaker, "server_vad_speech_started")
-		}
-		if err := g.voicePool.CancelCurrentResponse(); err != nil {
-			g.logger.Printf("[MultiVoiceGateway] ⚠️  Server-side barge-in cancel failed: %v", err)
-		} else {
-			if activeSpeaker != "" {
-				g.logger.Printf("[MultiVoiceGateway] ✅ Server-side barge-in: cancelled current response (role=%s)", activeSpeaker)
-			} else {
-				g.logger.Printf("[MultiVoiceGateway] ✅ Server-side barge-in: no active speaker")
-			}
-		}
-
-		// 仅在确实有 AI 在播时才清空缓冲，避免前端收到噪音事件。
-		if activeSpeaker != "" {
-			g.sendTTSInterruptedToClient("server_vad_speech_started")
+		if g.localVADSpeaking() {
+			// 本地 VAD 已经更早完成了插话处理，不再重复取消/通知
+			g.logger.Printf("[MultiVoiceGateway] Server VAD speech_started already handled by local VAD")
+			return nil
 		}
-
+		g.forgetLocalVADStop()
+		g.onUserSpeechStarted(vadSourceServer)
 		return nil
 
 	case "input_audio_buffer.speech_stopped":
 		// VAD 检测到用户停止说话
 		// 注意不等同于用户真的说完了，可能只是短暂停顿、VAD 静音阈值触发
 		g.logger.Printf("[MultiVoiceGateway] User stopped speaking")
-		g.sendToClient(&ServerMessage{
-			Type:     EventTypeSpeechStopped,
-			ServerTS: time.Now(),
-		})
+		if g.localVADStopHandled() {
+			return nil
+		}
+		g.onUserSpeechStopped(vadSourceServer)
+		return nil
+
+	case "conversation.item.input_audio_transcription.delta":
+		// 用户转写增量：只用于实时字幕，轮次仍以 completed 为准
+		itemID, _ := event["item_id"].(string)
+		delta, _ := event["delta"].(string)
+		g.captionUserPartial(itemID, delta)
 		return nil
 
 	case "conversation.item.input_audio_transcription.completed":
@@ -570,6 +712,7 @@ func (g *MultiVoiceGateway) handleASRResponseDone(event map[string]interface{})
 	}
 
 	g.logger.Printf("[MultiVoiceGateway] 📝 ASR transcription: %s", transcript)
+	g.captionUserFinal(responseID, transcript)
 
 	// 取消 ASR response（我们不需要它的音频输出，防止它"说话"）
 	// 虽然 response 已经 done，但取消操作可以确保清理相关状态
@@ -587,7 +730,10 @@ func (g *MultiVoiceGateway) handleASRResponseDone(event map[string]interface{})
 		g.logger.Printf("[MultiVoiceGateway] ⚠️  Failed to sync user text: %v", err)
 	}
 
-	// 2. 转发给 Orchestrator 处理
+	// 2. 学习者的话成了新的一轮：暂停中的场景不再继续
+	g.abortScenes("", speechDropLearnerInterrupted)
+
+	// 3. 转发给 Orchestrator 处理
 	// Orchestrator 会根据这个文本决定下一步的剧情（Beat）或让哪个角色回答。
 	msg := &ClientMessage{
 		Type:     EventTypeASRFinal,
@@ -617,13 +763,18 @@ func (g *MultiVoiceGateway) handleASRTranscriptionCompleted(event map[string]int
 		Text:     transcript,
 		ServerTS: time.Now(),
 	})
+	itemID, _ := event["item_id"].(string)
+	g.captionUserFinal(itemID, transcript)
 
 	// 1. 同步用户文本到所有角色连接（文本镜像）
 	if err := g.voicePool.SyncUserText(transcript); err != nil {
 		g.logger.Printf("[MultiVoiceGateway] ⚠️  Failed to sync user text: %v", err)
 	}
 
-	// 2. 转发给 Orchestrator 处理
+	// 2. 学习者的话成了新的一轮：暂停中的场景不再继续
+	g.abortScenes("", speechDropLearnerInterrupted)
+
+	// 3. 转发给 Orchestrator 处理
 	msg := &ClientMessage{
 		Type:     EventTypeASRFinal,
 		EventID:  fmt.Sprintf("asr_%d", time.Now().UnixNano()),
@@ -660,10 +811,23 @@ func (g *MultiVoiceGateway) roleConnReadLoop(role string) {
 
 		messageType, data, err := conn.ReadMessage()
 		if err != nil {
-			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-				g.logger.Printf("[MultiVoiceGateway] Role %s read error: %v", role, err)
+			reason, retryable := conn.classifyReadError(err)
+			select {
+			case <-g.closeChan:
+				return
+			default:
 			}
-			return
+			if !retryable {
+				g.logger.Printf("[MultiVoiceGateway] Role %s read loop stopped: reason=%s", role, reason)
+				return
+			}
+
+			// 断线重连：重新下发 session.update 并回放对话历史，之后继续在新连接上读
+			g.logger.Printf("[MultiVoiceGateway] ⚠️  Role %s connection lost: reason=%s err=%v", role, reason, err)
+			if conn = g.reconnectRole(role, reason); conn == nil {
+				return
+			}
+			continue
 		}
 
 		if messageType == websocket.TextMessage {
@@ -713,8 +877,8 @@ func (g *MultiVoiceGateway) handleRoleConnEvent(role string, data []byte) error
 		// 如果该角色此前被“闸门静音”，说明上一次发言已被用户打断；新的 response.created 到来时恢复音频转发。
 		g.unmuteRoleAudio(role)
 
-		// 3. 发送 tts_started 给前端，包含角色信息，让前端显示"正在说话"的动画
-		g.sendTTSStartedToClient(role)
+		// 3. 发送 tts_started 给前端，包含角色信息与音频流 ID，让前端显示"正在说话"的动画
+		g.sendTTSStartedToClient(role, g.openAudioStream(responseID, role))
 
 	case "response.audio.delta":
 		// 音频增量 - 这是实时的语音数据
@@ -722,15 +886,18 @@ func (g *MultiVoiceGateway) handleRoleConnEvent(role string, data []byte) error
 		return g.handleAudioDelta(role, event)
 
 	case "response.audio_transcript.delta":
-		// 文本增量 - 实时字幕
-		// 目前只打印日志，如果前端需要实时逐字显示，可以转发这个事件
+		// 文本增量 - 实时字幕（按音频播放位置定时，见 captions.go）
 		delta, _ := event["delta"].(string)
+		responseID, _ := event["response_id"].(string)
 		g.logger.Printf("[MultiVoiceGateway] Role %s transcript delta: %s", role, delta)
+		g.captionRoleDelta(role, responseID, delta)
 
 	case "response.done":
 		// 响应完成 - 角色说完了一句话
 		// 1. 通知前端 TTS 结束
-		g.sendTTSCompletedToClient(role)
+		response, _ := event["response"].(map[string]interface{})
+		responseID, _ := response["id"].(string)
+		g.sendTTSCompletedToClient(role, g.closeAudioStream(responseID))
 		// 2. 提取完整文本，进行文本镜像（同步给其他角色）和业务处理
 		return g.handleResponseDone(role, event)
 
@@ -761,8 +928,9 @@ func (g *MultiVoiceGateway) handleRoleConnEvent(role string, data []byte) error
 			g.logger.Printf("[MultiVoiceGateway] ✅ Unregistered metadata for cancelled responseID=%s", responseID)
 		}
 
-		// 4. 通知前端 TTS 已中断
-		g.sendTTSCompletedToClient(role)
+		// 4. 通知前端 TTS 已中断，字幕按实际播出的部分收尾
+		g.sendTTSCompletedToClient(role, g.closeAudioStream(responseID))
+		g.captionRoleFinal(role, responseID, "", true)
 
 		g.notifySpeechEnded(speechEnded{
 			role:       role,
@@ -878,10 +1046,43 @@ func (g *MultiVoiceGateway) handleAudioDelta(role string, event map[string]inter
 		return fmt.Errorf("decode audio delta: %w", err)
 	}
 
-	// 转发给客户端（作为二进制消息）
+	// 流已结束后才到的增量（晚到或已取消的发言）直接丢弃
+	responseID, _ := event["response_id"].(string)
+	streamID, seq, transcoder, ok := g.nextAudioFrame(responseID, role)
+	if !ok {
+		return nil
+	}
+
+	if rec := g.audioRecorder(g.config.OutputAudioFormat); rec != nil {
+		rec.RecordOutput(role, audioData)
+	}
+	g.captionRoleAudio(role, responseID, streamID, len(audioData))
+	if transcoder != nil {
+		if audioData, err = transcoder.Convert(audioData); err != nil {
+			return fmt.Errorf("transcode output audio: %w", err)
+		}
+	}
+
+	// 转发给客户端（作为二进制消息）；断线期间的音频直接丢弃，不进 replay 缓冲
 	g.clientConnLock.Lock()
 	defer g.clientConnLock.Unlock()
 
+	if g.clientConn == nil {
+		return nil
+	}
+	if g.clientProtocol == ProtocolV2 {
+		frame, err := AudioFrame{
+			StreamID: streamID,
+			Seq:      seq,
+			Codec:    g.clientOutputCodec(),
+			Role:     role,
+			Payload:  audioData,
+		}.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("encode audio frame: %w", err)
+		}
+		audioData = frame
+	}
 	if err := g.clientConn.WriteMessage(websocket.BinaryMessage, audioData); err != nil {
 		return fmt.Errorf("write audio to client: %w", err)
 	}
@@ -919,11 +1120,14 @@ func (g *MultiVoiceGateway) handleResponseDone(role string, event map[string]int
 	// 提取最终文本
 	output, _ := response["output"].([]interface{})
 
-	var finalText string
+	var finalText, outputItemID string
 	for _, item := range output {
 		itemMap, _ := item.(map[string]interface{})
 		itemType, _ := itemMap["type"].(string)
 		if itemType == "message" {
+			if id, _ := itemMap["id"].(string); id != "" {
+				outputItemID = id
+			}
 			content, _ := itemMap["content"].([]interface{})
 			for _, c := range content {
 				cMap, _ := c.(map[string]interface{})
@@ -942,7 +1146,7 @@ func (g *MultiVoiceGateway) handleResponseDone(role string, event map[string]int
 		g.logger.Printf("[MultiVoiceGateway] Role %s final text: %s", role, finalText)
 
 		// 同步到所有其他角色连接（文本镜像）
-		if err := g.voicePool.SyncAssistantText(finalText, role); err != nil {
+		if err := g.voicePool.SyncAssistantOutput(finalText, role, outputItemID); err != nil {
 			g.logger.Printf("[MultiVoiceGateway] ⚠️  Failed to sync assistant text: %v", err)
 		}
 
@@ -963,10 +1167,27 @@ func (g *MultiVoiceGateway) handleResponseDone(role string, event map[string]int
 		})
 	}
 
+	// 用量回灌给 Orchestrator：每个角色一条连接，按角色记账
+	if usage := parseRealtimeUsage(response); usage != nil {
+		usage.Role = role
+		usage.Model = g.config.Model
+		usage.ResponseID = responseID
+		_ = g.forwardToOrchestrator(&ClientMessage{
+			Type:     EventTypeUsage,
+			EventID:  fmt.Sprintf("usage_%d", time.Now().UnixNano()),
+			Metadata: metadata,
+			ClientTS: time.Now(),
+			Usage:    usage,
+		})
+	}
+
+	// 被 response.cancel 取消的响应同样以 response.done 结束（status=cancelled）
+	status, _ := response["status"].(string)
+	g.captionRoleFinal(role, responseID, finalText, status == "cancelled")
 	g.notifySpeechEnded(speechEnded{
 		role:       role,
 		responseID: responseID,
-		cancelled:  false,
+		cancelled:  status == "cancelled",
 		endedAt:    time.Now(),
 	})
 
@@ -1046,6 +1267,9 @@ func (g *MultiVoiceGateway) snapshotActiveMetadata(role string) map[string]inter
 }
 
 // SendInstructions 发送指令到指定角色的连接
+//
+// metadata 中除 role 外还可以带调度字段：turn_id、plan_id、priority（low|normal|urgent）、ttl，
+// 分别用于同轮次新计划替换旧计划、紧急插话抢占、过期丢弃（丢弃时下发 speech_dropped）。
 func (g *MultiVoiceGateway) SendInstructions(ctx context.Context, instructions string, metadata map[string]interface{}) error {
 	// 从 metadata 中提取角色
 	role, ok := metadata["role"].(string)
@@ -1065,7 +1289,7 @@ func (g *MultiVoiceGateway) SendInstructions(ctx context.Context, instructions s
 	// 以保证任意时刻只有一个角色在说话，避免音频交错。
 	// 同时也避免阻塞 Orchestrator 的事件处理。
 	// 注意：这里对 metadata 做浅拷贝，防止后续外部修改影响队列中的数据。
-	g.enqueueSpeech(role, instructions, metadata)
+	g.enqueueSpeech(g.newSpeechRequest(role, instructions, metadata))
 	g.speechLoopOnce.Do(func() { go g.speechLoop() })
 
 	// 重要：这里不阻塞 Orchestrator（否则 EventQueue 会堆积，导致用户转写/插话延迟变大）。
@@ -1075,6 +1299,15 @@ func (g *MultiVoiceGateway) SendInstructions(ctx context.Context, instructions s
 
 // sendToClient 发送消息给客户端
 func (g *MultiVoiceGateway) sendToClient(msg *ServerMessage) error {
+	g.clientConnLock.Lock()
+	defer g.clientConnLock.Unlock()
+
+	return g.sendToClientLocked(msg)
+}
+
+// sendToClientLocked 分配 seq、写入 replay 缓冲并下发（调用方持有 clientConnLock）。
+// 在 clientConnLock 内分配 seq，保证线上顺序与 seq 顺序一致；客户端断开时只缓冲不下发。
+func (g *MultiVoiceGateway) sendToClientLocked(msg *ServerMessage) error {
 	g.seqLock.Lock()
 	g.seqCounter++
 	msg.Seq = g.seqCounter
@@ -1084,10 +1317,14 @@ func (g *MultiVoiceGateway) sendToClient(msg *ServerMessage) error {
 	if err != nil {
 		return fmt.Errorf("marshal server message: %w", err)
 	}
+	g.replay.add(msg.Seq, data)
+	if g.outputObserver != nil {
+		g.outputObserver(*msg)
+	}
 
-	g.clientConnLock.Lock()
-	defer g.clientConnLock.Unlock()
-
+	if g.clientConn == nil {
+		return nil
+	}
 	return g.clientConn.WriteMessage(websocket.TextMessage, data)
 }
 
@@ -1100,25 +1337,27 @@ func (g *MultiVoiceGateway) sendErrorToClient(errMsg string) {
 	})
 }
 
-// sendTTSStartedToClient 发送 TTS 开始事件给客户端（包含角色信息）
-func (g *MultiVoiceGateway) sendTTSStartedToClient(role string) {
+// sendTTSStartedToClient 发送 TTS 开始事件给客户端（包含角色信息与音频流 ID）
+func (g *MultiVoiceGateway) sendTTSStartedToClient(role string, streamID uint32) {
 	metadata := g.snapshotActiveMetadata(role)
 
-	g.logger.Printf("[MultiVoiceGateway] 📤 Sending tts_started to client: role=%s", role)
+	g.logger.Printf("[MultiVoiceGateway] 📤 Sending tts_started to client: role=%s stream=%d", role, streamID)
 
 	_ = g.sendToClient(&ServerMessage{
 		Type:     "tts_started",
+		StreamID: streamID,
 		Metadata: metadata,
 		ServerTS: time.Now(),
 	})
 }
 
 // sendTTSCompletedToClient 发送 TTS 完成事件给客户端
-func (g *MultiVoiceGateway) sendTTSCompletedToClient(role string) {
-	g.logger.Printf("[MultiVoiceGateway] 📤 Sending tts_completed to client: role=%s", role)
+func (g *MultiVoiceGateway) sendTTSCompletedToClient(role string, streamID uint32) {
+	g.logger.Printf("[MultiVoiceGateway] 📤 Sending tts_completed to client: role=%s stream=%d", role, streamID)
 
 	_ = g.sendToClient(&ServerMessage{
-		Type: "tts_completed",
+		Type:     "tts_completed",
+		StreamID: streamID,
 		Metadata: map[string]interface{}{
 			"role": role,
 		},
@@ -1176,9 +1415,14 @@ func (g *MultiVoiceGateway) Close() error {
 		if g.voicePool != nil {
 			_ = g.voicePool.Close()
 		}
+		g.resetAudioStreams()
 
 		// 关闭客户端连接
 		g.clientConnLock.Lock()
+		if g.graceTimer != nil {
+			g.graceTimer.Stop()
+			g.graceTimer = nil
+		}
 		if g.clientConn != nil {
 			_ = g.clientConn.Close()
 		}
@@ -1202,22 +1446,25 @@ func (g *MultiVoiceGateway) Done() <-chan struct{} {
 //     时刻最多只有一个角色在合成/播放音频（避免音频交错）。
 //  3. 在入队时对 metadata 做浅拷贝（cloneMetadata），避免后续外部修改影响队列中的数据。
 //  4. 通过 cond.Signal 唤醒等待的 speechLoop，以便尽快处理新入队的发言请求。
-func (g *MultiVoiceGateway) enqueueSpeech(role string, instructions string, metadata map[string]interface{}) {
-	req := speechRequest{
-		role:         role,
-		instructions: instructions,
-		metadata:     cloneMetadata(metadata),
-		enqueuedAt:   time.Now(),
-	}
-
+//  5. 入队时顺带清理过期请求、替换同轮次旧计划的请求；紧急请求会抢占正在播的低优先级发言。
+func (g *MultiVoiceGateway) enqueueSpeech(req speechRequest) {
 	g.speechMu.Lock()
-	g.speechQueue = append(g.speechQueue, req)
+	dropped := g.speechQueue.pruneExpired(time.Now())
+	dropped = append(dropped, g.speechQueue.supersede(req)...)
+	g.speechQueue.insert(req, false)
 	queueSize := len(g.speechQueue)
+	preempt := req.preempts(g.currentSpeech)
 	g.speechMu.Unlock()
 
-	g.logger.Printf("[MultiVoiceGateway] 🎙️ Speech enqueued: role=%s queue_size=%d", role, queueSize)
+	g.reportDroppedSpeech(dropped)
+	g.logger.Printf("[MultiVoiceGateway] 🎙️ Speech enqueued: role=%s priority=%s turn=%s plan=%s queue_size=%d",
+		req.role, req.priority, req.turnID, req.planID, queueSize)
 	// 唤醒可能正在等待队列的 speechLoop
 	g.speechCond.Signal()
+
+	if preempt {
+		g.preemptCurrentSpeech(req)
+	}
 }
 
 // dropPendingSpeech 丢弃所有尚未被 speechLoop 处理的发言请求。
@@ -1227,15 +1474,16 @@ func (g *MultiVoiceGateway) enqueueSpeech(role string, instructions string, meta
 //   - 此操作只影响“队列中还没开始执行”的请求，不会直接取消已经开始的 response；
 //     已开始的 response 由 voicePool.CancelCurrentResponse 来取消。
 //   - 使用此函数时通常会伴随一次 CancelCurrentResponse 或其他控制动作，以收敛系统状态。
+//   - 每条被丢弃的请求都会下发一次 speech_dropped，便于前端和 Timeline 对账。
 func (g *MultiVoiceGateway) dropPendingSpeech(reason string) {
 	g.speechMu.Lock()
-	dropped := len(g.speechQueue)
-	// 清空切片但保留底层容量，避免频繁的内存分配。
-	g.speechQueue = g.speechQueue[:0]
+	// 原地过滤，保留底层容量，避免频繁的内存分配。
+	dropped := g.speechQueue.remove(reason, func(speechRequest) bool { return true })
 	g.speechMu.Unlock()
 
-	if dropped > 0 {
-		g.logger.Printf("[MultiVoiceGateway] 🧹 Dropped pending speech: dropped=%d reason=%s", dropped, reason)
+	if len(dropped) > 0 {
+		g.logger.Printf("[MultiVoiceGateway] 🧹 Dropped pending speech: dropped=%d reason=%s", len(dropped), reason)
+		g.reportDroppedSpeech(dropped)
 	}
 }
 
@@ -1292,15 +1540,25 @@ func (g *MultiVoiceGateway) speechLoop() {
 			// 如果是“有人在说话”，把它重新塞回队列尾部；否则丢弃并继续。
 			if errors.Is(err, ErrRoleAlreadySpeaking) {
 				g.logger.Printf("[MultiVoiceGateway] ⚠️  Speech blocked by active speaker, requeue: role=%s err=%v", req.role, err)
-				g.enqueueSpeech(req.role, req.instructions, req.metadata)
+				g.speechMu.Lock()
+				g.speechQueue.insert(req, true)
+				g.speechMu.Unlock()
 				_ = g.waitAnySpeechEnded(maxWaitSpeechEnd)
 				continue
 			}
 
 			g.logger.Printf("[MultiVoiceGateway] ❌ Failed to start speech: role=%s err=%v", req.role, err)
+			if errors.Is(err, ErrRoleUnavailable) {
+				g.reportDroppedSpeech([]droppedSpeech{{req: req, reason: speechDropRoleUnavailable}})
+			}
 			continue
 		}
 
+		g.speechMu.Lock()
+		current := req
+		g.currentSpeech = &current
+		g.speechMu.Unlock()
+
 		// 等待本次播报结束（done/cancelled）。
 		timer := time.NewTimer(maxWaitSpeechEnd)
 		for {
@@ -1317,17 +1575,26 @@ func (g *MultiVoiceGateway) speechLoop() {
 				}
 
 				timer.Stop()
+				// 场景中的一拍没有正常说完（被打断/抢占），剩余各拍作废
+				if ev.cancelled && req.sceneID != "" {
+					g.abortScenes(req.sceneID, speechDropSceneAborted)
+				}
 				goto next
 
 			case <-timer.C:
 				// 兜底：避免 roleConn 异常导致队列永久卡死。
 				g.logger.Printf("[MultiVoiceGateway] ⏱️ Speech end timeout, force cancel: role=%s", req.role)
 				_ = g.voicePool.CancelCurrentResponse()
+				if req.sceneID != "" {
+					g.abortScenes(req.sceneID, speechDropSceneAborted)
+				}
 				goto next
 			}
 		}
 	next:
-		continue
+		g.speechMu.Lock()
+		g.currentSpeech = nil
+		g.speechMu.Unlock()
 	}
 }
 
@@ -1336,24 +1603,53 @@ func (g *MultiVoiceGateway) speechLoop() {
 // - 使用 g.speechCond 条件变量与 g.speechMu 互斥锁配合，避免忙等待并能在新请求到来时迅速唤醒。
 // - 返回值第二个布尔位表示成功取到请求（true）或因网关关闭而退出（false）。
 // - 从队列头移除元素时采用两步：先 copy 前移，再缩短切片长度，以避免内存泄露或保留已用元素的引用。
+// - 出队前丢弃已过期的请求（例如在一段长讲解后面排了太久），并下发 speech_dropped。
 func (g *MultiVoiceGateway) nextSpeechRequest() (speechRequest, bool) {
 	g.speechMu.Lock()
-	defer g.speechMu.Unlock()
-
-	for len(g.speechQueue) == 0 {
+	var expired []droppedSpeech
+	for {
+		now := time.Now()
+		expired = append(expired, g.speechQueue.pruneExpired(now)...)
+		if len(g.speechQueue) > 0 {
+			wait := g.sceneHandoffWaitLocked(g.speechQueue[0], now)
+			if wait == 0 {
+				break
+			}
+			// 场景暂停：学习者在角色之间开口了，等 TA 说完（或转写到来把场景作废）
+			timer := time.AfterFunc(wait, g.speechCond.Broadcast)
+			g.speechCond.Wait()
+			timer.Stop()
+			select {
+			case <-g.closeChan:
+				g.speechMu.Unlock()
+				return speechRequest{}, false
+			default:
+			}
+			continue
+		}
+		if len(expired) > 0 {
+			// 队列被清空：先把过期通知发出去，再继续等待
+			g.speechMu.Unlock()
+			g.reportDroppedSpeech(expired)
+			expired = nil
+			g.speechMu.Lock()
+			continue
+		}
 		// 等待直到有新的发言被入队或网关关闭
 		g.speechCond.Wait()
 		select {
 		case <-g.closeChan:
+			g.speechMu.Unlock()
 			return speechRequest{}, false
 		default:
 		}
 	}
 
 	// 取出队首元素并将切片前移
-	req := g.speechQueue[0]
-	copy(g.speechQueue, g.speechQueue[1:])
-	g.speechQueue = g.speechQueue[:len(g.speechQueue)-1]
+	req := g.speechQueue.pop()
+	g.speechMu.Unlock()
+
+	g.reportDroppedSpeech(expired)
 	return req, true
 }
 
@@ -1389,3 +1685,76 @@ func cloneMetadata(src map[string]interface{}) map[string]interface{} {
 	}
 	return dst
 }
+
+// maxClosedAudioStreams 记住最近结束的音频流数量（只用于识别晚到的增量）
+const maxClosedAudioStreams = 64
+
+// audioStream 一次角色发言对应的下行音频流
+type audioStream struct {
+	id         uint32
+	role       string
+	nextSeq    uint64
+	transcoder *audio.Transcoder // 直通时为 nil
+}
+
+// openAudioStream 为新的 response 分配 stream_id
+func (g *MultiVoiceGateway) openAudioStream(responseID, role string) uint32 {
+	g.audioStreamMu.Lock()
+	defer g.audioStreamMu.Unlock()
+
+	if stream, ok := g.audioStreams[responseID]; ok {
+		return stream.id
+	}
+	g.nextStreamID++
+	g.audioStreams[responseID] = &audioStream{id: g.nextStreamID, role: role, transcoder: g.newOutputTranscoder()}
+	return g.nextStreamID
+}
+
+// nextAudioFrame 返回该 response 的 stream_id、下一帧序号与转码器（response.created 丢失时补建流）。
+// 流已结束（response.done / 取消之后才到的增量）时 ok 为 false，调用方丢弃该帧。
+func (g *MultiVoiceGateway) nextAudioFrame(responseID, role string) (streamID uint32, seq uint64, transcoder *audio.Transcoder, ok bool) {
+	g.audioStreamMu.Lock()
+	defer g.audioStreamMu.Unlock()
+
+	stream, found := g.audioStreams[responseID]
+	if !found {
+		for _, closed := range g.closedStreams {
+			if closed == responseID {
+				return 0, 0, nil, false
+			}
+		}
+		g.nextStreamID++
+		stream = &audioStream{id: g.nextStreamID, role: role, transcoder: g.newOutputTranscoder()}
+		g.audioStreams[responseID] = stream
+	}
+	seq = stream.nextSeq
+	stream.nextSeq++
+	return stream.id, seq, stream.transcoder, true
+}
+
+// closeAudioStream 结束 response 对应的音频流，返回其 stream_id（未知时为 0）
+func (g *MultiVoiceGateway) closeAudioStream(responseID string) uint32 {
+	g.audioStreamMu.Lock()
+	defer g.audioStreamMu.Unlock()
+
+	if responseID != "" {
+		g.closedStreams = append(g.closedStreams, responseID)
+		if len(g.closedStreams) > maxClosedAudioStreams {
+			g.closedStreams = g.closedStreams[len(g.closedStreams)-maxClosedAudioStreams:]
+		}
+	}
+	stream, ok := g.audioStreams[responseID]
+	if !ok {
+		return 0
+	}
+	delete(g.audioStreams, responseID)
+	return stream.id
+}
+
+// resetAudioStreams 会话结束时清空所有音频流
+func (g *MultiVoiceGateway) resetAudioStreams() {
+	g.audioStreamMu.Lock()
+	defer g.audioStreamMu.Unlock()
+	g.audioStreams = make(map[string]*audioStream)
+	g.closedStreams = nil
+}
@@ -0,0 +1,835 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/audio"
+	"bubble-talk/server/internal/gateway/realtimetest"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeClient 扮演前端：收集网关下发的 JSON 事件与音频帧
+type fakeClient struct {
+	conn *websocket.Conn
+
+	mu          sync.Mutex
+	events      []ServerMessage
+	audioBytes  int
+	audioFrames [][]byte
+	changed     chan struct{}
+}
+
+func (c *fakeClient) readLoop() {
+	for {
+		typ, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		if typ == websocket.BinaryMessage {
+			c.audioBytes += len(data)
+			c.audioFrames = append(c.audioFrames, data)
+		} else {
+			var msg ServerMessage
+			if json.Unmarshal(data, &msg) == nil {
+				c.events = append(c.events, msg)
+			}
+		}
+		close(c.changed)
+		c.changed = make(chan struct{})
+		c.mu.Unlock()
+	}
+}
+
+// waitEvent 等待一条满足条件的服务端事件
+func (c *fakeClient) waitEvent(t *testing.T, eventType EventType, match func(ServerMessage) bool) ServerMessage {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		c.mu.Lock()
+		for _, evt := range c.events {
+			if evt.Type == eventType && (match == nil || match(evt)) {
+				c.mu.Unlock()
+				return evt
+			}
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("timeout waiting for client event %s", eventType)
+		}
+	}
+}
+
+// startMultiVoiceGateway 在假 Realtime 服务上启动一个 MultiVoiceGateway，并接上一个假前端
+// subprotocols 为空时模拟旧版客户端（v1）
+func startMultiVoiceGateway(t *testing.T, fake *realtimetest.Server, handler EventHandler, subprotocols ...string) (*MultiVoiceGateway, *fakeClient) {
+	t.Helper()
+	return startMultiVoiceGatewayWithConfig(t, fake, handler, nil, subprotocols...)
+}
+
+// startMultiVoiceGatewayWithConfig 同 startMultiVoiceGateway，configure 可在启动前调整网关配置
+func startMultiVoiceGatewayWithConfig(t *testing.T, fake *realtimetest.Server, handler EventHandler, configure func(*GatewayConfig), subprotocols ...string) (*MultiVoiceGateway, *fakeClient) {
+	t.Helper()
+
+	config := GatewayConfig{
+		OpenAIAPIKey:      "test-key",
+		OpenAIRealtimeURL: fake.URL(),
+		RealtimeHeaders:   map[string]string{"X-Test-Session": "e2e"},
+		Model:             "fake-realtime",
+		RoleProfiles: map[string]RoleProfile{
+			"host":      {Voice: "cedar"},
+			"economist": {Voice: "echo"},
+		},
+	}
+	if configure != nil {
+		configure(&config)
+	}
+
+	gwCh := make(chan *MultiVoiceGateway, 1)
+	upgrader := websocket.Upgrader{Subprotocols: Subprotocols}
+	clientServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		gw := NewMultiVoiceGateway("e2e-session", conn, config)
+		gw.SetEventHandler(handler)
+		if err := gw.Start(context.Background()); err != nil {
+			t.Errorf("start gateway: %v", err)
+		}
+		gwCh <- gw
+	}))
+	t.Cleanup(clientServer.Close)
+
+	url := "ws" + strings.TrimPrefix(clientServer.URL, "http")
+	dialer := websocket.Dialer{Subprotocols: subprotocols}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial gateway: %v", err)
+	}
+	client := &fakeClient{conn: conn, changed: make(chan struct{})}
+	go client.readLoop()
+
+	var gw *MultiVoiceGateway
+	select {
+	case gw = <-gwCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout starting gateway")
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = gw.Close()
+	})
+	return gw, client
+}
+
+func waitVoiceConn(t *testing.T, fake *realtimetest.Server, voice string) *realtimetest.Conn {
+	t.Helper()
+	conn, err := fake.WaitConn(5*time.Second, func(c *realtimetest.Conn) bool { return c.Voice() == voice })
+	if err != nil {
+		t.Fatalf("voice %s: %v", voice, err)
+	}
+	return conn
+}
+
+func TestMultiVoiceGateway_FakeRealtimeEndToEnd(t *testing.T) {
+	fake := realtimetest.NewServer(realtimetest.WithAPIKey("test-key"))
+	defer fake.Close()
+
+	var mu sync.Mutex
+	var received []ClientMessage
+	handler := func(ctx context.Context, msg *ClientMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, *msg)
+		return nil
+	}
+
+	gw, client := startMultiVoiceGateway(t, fake, handler)
+
+	asr := waitVoiceConn(t, fake, "alloy")
+	host := waitVoiceConn(t, fake, "cedar")
+	economist := waitVoiceConn(t, fake, "echo")
+
+	// 端点与认证都来自配置
+	if asr.Model != "fake-realtime" {
+		t.Errorf("model query = %q", asr.Model)
+	}
+	if got := host.Header.Get("X-Test-Session"); got != "e2e" {
+		t.Errorf("extra header = %q", got)
+	}
+
+	// 1. 用户音频 -> ASR 连接
+	if err := client.conn.WriteMessage(websocket.BinaryMessage, make([]byte, 320)); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	if _, err := asr.WaitFor("input_audio_buffer.append", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2. 转写完成 -> asr_final 下发前端，并以文本镜像同步给各角色
+	if err := asr.EmitTranscription("为什么要降息？"); err != nil {
+		t.Fatalf("emit transcription: %v", err)
+	}
+	client.waitEvent(t, EventTypeASRFinal, func(m ServerMessage) bool { return m.Text == "为什么要降息？" })
+	if _, err := economist.WaitFor("conversation.item.create", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// 3. 导演指令 -> host 连接 response.create -> 音频/文本回到前端
+	fake.SetResponder(func(conn *realtimetest.Conn, req realtimetest.Event) realtimetest.Response {
+		return realtimetest.Response{Transcript: "因为要刺激消费。", Audio: make([]byte, 960), Chunks: 3}
+	})
+	if err := gw.SendInstructions(context.Background(), "回答用户", map[string]interface{}{"role": "host", "beat": "explain"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	if _, err := host.WaitFor("response.create", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	text := client.waitEvent(t, EventTypeAssistantText, nil)
+	if text.Text != "因为要刺激消费。" {
+		t.Errorf("assistant_text = %q", text.Text)
+	}
+	if text.Metadata["role"] != "host" {
+		t.Errorf("assistant_text metadata = %+v", text.Metadata)
+	}
+	client.mu.Lock()
+	audio := client.audioBytes
+	client.mu.Unlock()
+	if audio != 960 {
+		t.Errorf("client audio bytes = %d, want 960", audio)
+	}
+
+	// 4. host 的回复镜像给 economist（用户一句 + host 一句）
+	if _, err := economist.WaitFor("conversation.item.create", 2, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// 5. Orchestrator 依次收到 asr_final、assistant_text 与 usage
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		var types []string
+		for _, m := range received {
+			types = append(types, string(m.Type))
+		}
+		mu.Unlock()
+		joined := strings.Join(types, ",")
+		if strings.Contains(joined, string(EventTypeASRFinal)) && strings.Contains(joined, string(EventTypeAssistantText)) && strings.Contains(joined, string(EventTypeUsage)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("orchestrator events = %v", types)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMultiVoiceGateway_FakeRealtimeBargeInCancels(t *testing.T) {
+	fake := realtimetest.NewServer(realtimetest.WithResponder(func(conn *realtimetest.Conn, req realtimetest.Event) realtimetest.Response {
+		return realtimetest.Response{
+			Transcript: "这是一段很长很长的讲解",
+			Audio:      make([]byte, 4800),
+			Chunks:     10,
+			ChunkDelay: 50 * time.Millisecond,
+		}
+	}))
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGateway(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil })
+	host := waitVoiceConn(t, fake, "cedar")
+
+	if err := gw.SendInstructions(context.Background(), "讲解", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	client.waitEvent(t, EventTypeTTSStarted, nil)
+
+	barge, _ := json.Marshal(ClientMessage{Type: EventTypeBargeIn, EventID: "b1"})
+	if err := client.conn.WriteMessage(websocket.TextMessage, barge); err != nil {
+		t.Fatalf("write barge_in: %v", err)
+	}
+	if _, err := host.WaitFor("response.cancel", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	client.waitEvent(t, EventTypeTTSInterrupted, nil)
+}
+
+func TestMultiVoiceGateway_ProtocolV2AudioFrames(t *testing.T) {
+	fake := realtimetest.NewServer(realtimetest.WithResponder(func(conn *realtimetest.Conn, req realtimetest.Event) realtimetest.Response {
+		return realtimetest.Response{Transcript: "你好", Audio: make([]byte, 960), Chunks: 3}
+	}))
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGateway(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil }, SubprotocolV2)
+	asr := waitVoiceConn(t, fake, "alloy")
+
+	ready := client.waitEvent(t, EventTypeStreamReady, nil)
+	if ready.Protocol != ProtocolV2 {
+		t.Fatalf("negotiated protocol = %d, want 2", ready.Protocol)
+	}
+
+	// 上行：带头的帧剥离后只把 payload 送进 ASR
+	up, _ := AudioFrame{Codec: CodecPCM16, Payload: make([]byte, 320)}.MarshalBinary()
+	if err := client.conn.WriteMessage(websocket.BinaryMessage, up); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	if _, err := asr.WaitFor("input_audio_buffer.append", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := asr.AudioBytes(); got != 320 {
+		t.Errorf("asr audio bytes = %d, want 320", got)
+	}
+
+	// 下行：帧头带角色、流 ID 与递增序号，流 ID 与 tts_started 一致
+	if err := gw.SendInstructions(context.Background(), "打招呼", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	started := client.waitEvent(t, EventTypeTTSStarted, nil)
+	completed := client.waitEvent(t, EventTypeTTSCompleted, nil)
+	if started.StreamID == 0 || completed.StreamID != started.StreamID {
+		t.Errorf("stream ids: started=%d completed=%d", started.StreamID, completed.StreamID)
+	}
+
+	client.mu.Lock()
+	frames := append([][]byte(nil), client.audioFrames...)
+	client.mu.Unlock()
+	if len(frames) != 3 {
+		t.Fatalf("audio frames = %d, want 3", len(frames))
+	}
+	payload := 0
+	for i, data := range frames {
+		var frame AudioFrame
+		if err := frame.UnmarshalBinary(data); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if frame.Role != "host" || frame.StreamID != started.StreamID || frame.Seq != uint64(i) || frame.Codec != CodecPCM16 {
+			t.Errorf("frame %d header = %+v", i, frame)
+		}
+		payload += len(frame.Payload)
+	}
+	if payload != 960 {
+		t.Errorf("payload bytes = %d, want 960", payload)
+	}
+}
+
+func TestMultiVoiceGateway_ProtocolV1RawAudio(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGateway(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil })
+	if ready := client.waitEvent(t, EventTypeStreamReady, nil); ready.Protocol != ProtocolV1 {
+		t.Fatalf("negotiated protocol = %d, want 1", ready.Protocol)
+	}
+	if err := gw.SendInstructions(context.Background(), "打招呼", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	client.waitEvent(t, EventTypeTTSCompleted, nil)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.audioBytes != 4800 {
+		t.Errorf("raw audio bytes = %d, want 4800 (no frame header)", client.audioBytes)
+	}
+}
+
+// fakeRecorder 记录网关交给录音器的音频字节数
+type fakeRecorder struct {
+	mu     sync.Mutex
+	input  int
+	output map[string]int
+}
+
+func (r *fakeRecorder) RecordInput(pcm []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.input += len(pcm)
+}
+
+func (r *fakeRecorder) RecordOutput(role string, pcm []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output[role] += len(pcm)
+}
+
+func TestMultiVoiceGateway_RecordsInputAndRoleAudio(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGateway(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil }, SubprotocolV2)
+	rec := &fakeRecorder{output: make(map[string]int)}
+	gw.SetAudioRecorder(rec)
+	asr := waitVoiceConn(t, fake, "alloy")
+	client.waitEvent(t, EventTypeStreamReady, nil)
+
+	// 上行录的是剥掉帧头后的 PCM
+	up, _ := AudioFrame{Codec: CodecPCM16, Payload: make([]byte, 640)}.MarshalBinary()
+	if err := client.conn.WriteMessage(websocket.BinaryMessage, up); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	if _, err := asr.WaitFor("input_audio_buffer.append", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gw.SendInstructions(context.Background(), "打招呼", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	client.waitEvent(t, EventTypeTTSCompleted, nil)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.input != 640 {
+		t.Errorf("recorded input bytes = %d, want 640", rec.input)
+	}
+	if rec.output["host"] != 4800 || len(rec.output) != 1 {
+		t.Errorf("recorded output = %v, want host=4800", rec.output)
+	}
+}
+
+func TestMultiVoiceGateway_TranscodesClientAudioFormats(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGatewayWithConfig(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil }, func(c *GatewayConfig) {
+		c.ClientInputAudioFormat = "g711_ulaw"
+		c.ClientOutputAudioFormat = "pcm16@16000"
+	}, SubprotocolV2)
+	asr := waitVoiceConn(t, fake, "alloy")
+
+	ready := client.waitEvent(t, EventTypeStreamReady, nil)
+	if ready.InputAudioFormat != "g711_ulaw" || ready.OutputAudioFormat != "pcm16@16000" {
+		t.Fatalf("stream_ready formats = %q / %q", ready.InputAudioFormat, ready.OutputAudioFormat)
+	}
+
+	// 编码不符的帧被丢弃，不会送进 ASR（读循环按序处理，下面的字节数断言可以覆盖）
+	wrong, _ := AudioFrame{Codec: CodecPCM16, Payload: make([]byte, 320)}.MarshalBinary()
+	if err := client.conn.WriteMessage(websocket.BinaryMessage, wrong); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+
+	// 上行：20ms 的 8k μ-law（160 字节）→ Realtime 侧 24k pcm16（约 960 字节）
+	up, _ := AudioFrame{Codec: CodecG711ULaw, Payload: make([]byte, 160)}.MarshalBinary()
+	if err := client.conn.WriteMessage(websocket.BinaryMessage, up); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	if _, err := asr.WaitFor("input_audio_buffer.append", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := asr.AudioBytes(); got < 954 || got > 960 {
+		t.Errorf("asr audio bytes = %d, want ~960", got)
+	}
+
+	// 下行：24k 的 4800 字节（2400 样本）→ 16k 约 1600 样本
+	if err := gw.SendInstructions(context.Background(), "打招呼", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	client.waitEvent(t, EventTypeTTSCompleted, nil)
+
+	client.mu.Lock()
+	frames := append([][]byte(nil), client.audioFrames...)
+	client.mu.Unlock()
+	payload := 0
+	for _, data := range frames {
+		var frame AudioFrame
+		if err := frame.UnmarshalBinary(data); err != nil {
+			t.Fatalf("frame: %v", err)
+		}
+		if frame.Codec != CodecPCM16 {
+			t.Errorf("frame codec = %s", frame.Codec)
+		}
+		payload += len(frame.Payload)
+	}
+	if payload < 3196 || payload > 3200 {
+		t.Errorf("downlink payload = %d bytes, want ~3200", payload)
+	}
+}
+
+func TestMultiVoiceGateway_RejectsUnsupportedClientFormat(t *testing.T) {
+	gw := NewMultiVoiceGateway("s", nil, GatewayConfig{ClientInputAudioFormat: "opus"})
+	if err := gw.setupTranscoding(); !errors.Is(err, audio.ErrUnsupportedCodec) {
+		t.Fatalf("setup err = %v, want ErrUnsupportedCodec", err)
+	}
+}
+
+// loudPCM 生成 n 个 24kHz 的响亮方波采样（pcm16 little-endian）
+func loudPCM(n int) []byte {
+	buf := make([]byte, n*2)
+	for i := 0; i < n; i++ {
+		v := int16(12000)
+		if (i/40)%2 == 1 {
+			v = -12000
+		}
+		buf[2*i] = byte(uint16(v))
+		buf[2*i+1] = byte(uint16(v) >> 8)
+	}
+	return buf
+}
+
+func TestMultiVoiceGateway_LocalVADBargesInBeforeServerVAD(t *testing.T) {
+	fake := realtimetest.NewServer(realtimetest.WithResponder(func(conn *realtimetest.Conn, req realtimetest.Event) realtimetest.Response {
+		return realtimetest.Response{
+			Transcript: "这是一段很长很长的讲解",
+			Audio:      make([]byte, 9600),
+			Chunks:     20,
+			ChunkDelay: 50 * time.Millisecond,
+		}
+	}))
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGatewayWithConfig(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil }, func(c *GatewayConfig) {
+		c.LocalVAD = &audio.VADConfig{MinSpeech: 60 * time.Millisecond}
+	})
+	host := waitVoiceConn(t, fake, "cedar")
+	asr := waitVoiceConn(t, fake, "alloy")
+
+	if err := gw.SendInstructions(context.Background(), "讲解", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	client.waitEvent(t, EventTypeTTSStarted, nil)
+
+	// 先一帧静音校准底噪，再持续说话；假 Realtime 不会发 speech_started，只能靠本地 VAD
+	frames := [][]byte{make([]byte, 960)}
+	for i := 0; i < 10; i++ {
+		frames = append(frames, loudPCM(480))
+	}
+	for _, frame := range frames {
+		if err := client.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			t.Fatalf("write audio: %v", err)
+		}
+	}
+
+	started := client.waitEvent(t, EventTypeSpeechStarted, nil)
+	if started.Metadata["source"] != vadSourceLocal {
+		t.Errorf("speech_started source = %v", started.Metadata["source"])
+	}
+	if _, err := host.WaitFor("response.cancel", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	interrupted := client.waitEvent(t, EventTypeTTSInterrupted, nil)
+	if interrupted.Metadata["reason"] != "local_vad_speech_started" {
+		t.Errorf("tts_interrupted reason = %v", interrupted.Metadata["reason"])
+	}
+
+	// 随后到达的服务端 speech_started 视为同一次开口，不再重复通知
+	asr.EmitSpeechStarted()
+	asr.EmitSpeechStopped()
+	time.Sleep(200 * time.Millisecond)
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	count := 0
+	for _, evt := range client.events {
+		if evt.Type == EventTypeSpeechStarted || evt.Type == EventTypeTTSInterrupted {
+			count++
+		}
+	}
+	if count != 2 {
+		t.Errorf("speech_started + tts_interrupted events = %d, want 2 (no duplicates from server VAD)", count)
+	}
+}
+
+// TestMultiVoiceGateway_ServerVADStartAfterLocalStopIsHandled 验证本地 VAD 说完之后服务端报的开口是新的一次，
+// 不被本地事件去重；紧跟本地说完的服务端 speech_stopped 仍视为重复。
+func TestMultiVoiceGateway_ServerVADStartAfterLocalStopIsHandled(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	_, client := startMultiVoiceGatewayWithConfig(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil }, func(c *GatewayConfig) {
+		c.LocalVAD = &audio.VADConfig{MinSpeech: 60 * time.Millisecond, Hangover: 100 * time.Millisecond}
+	})
+	asr := waitVoiceConn(t, fake, "alloy")
+
+	// 静音校准 → 说话 → 静音超过 hangover：本地 VAD 先后报开口与说完
+	frames := [][]byte{make([]byte, 960)}
+	for i := 0; i < 10; i++ {
+		frames = append(frames, loudPCM(480))
+	}
+	for i := 0; i < 10; i++ {
+		frames = append(frames, make([]byte, 960))
+	}
+	for _, frame := range frames {
+		if err := client.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			t.Fatalf("write audio: %v", err)
+		}
+	}
+	client.waitEvent(t, EventTypeSpeechStopped, func(m ServerMessage) bool { return m.Metadata["source"] == vadSourceLocal })
+
+	// 本地说完后服务端才报的 speech_stopped 与本地重复
+	asr.EmitSpeechStopped()
+	// 之后服务端报的开口是新的一次
+	asr.EmitSpeechStarted()
+	client.waitEvent(t, EventTypeSpeechStarted, func(m ServerMessage) bool { return m.Metadata["source"] == vadSourceServer })
+	asr.EmitSpeechStopped()
+	client.waitEvent(t, EventTypeSpeechStopped, func(m ServerMessage) bool { return m.Metadata["source"] == vadSourceServer })
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	stops := 0
+	for _, evt := range client.events {
+		if evt.Type == EventTypeSpeechStopped {
+			stops++
+		}
+	}
+	if stops != 2 {
+		t.Errorf("speech_stopped events = %d, want 2 (local + server after new onset)", stops)
+	}
+}
+
+func TestMultiVoiceGateway_UrgentSpeechPreemptsActiveSpeaker(t *testing.T) {
+	fake := realtimetest.NewServer(realtimetest.WithResponder(func(conn *realtimetest.Conn, req realtimetest.Event) realtimetest.Response {
+		return realtimetest.Response{
+			Transcript: "这是一段很长很长的讲解",
+			Audio:      make([]byte, 9600),
+			Chunks:     20,
+			ChunkDelay: 50 * time.Millisecond,
+		}
+	}))
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGateway(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil })
+	host := waitVoiceConn(t, fake, "cedar")
+
+	if err := gw.SendInstructions(context.Background(), "讲解", map[string]interface{}{"role": "host", "turn_id": "t1", "plan_id": "p1"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	client.waitEvent(t, EventTypeTTSStarted, nil)
+
+	if err := gw.SendInstructions(context.Background(), "插一句", map[string]interface{}{"role": "economist", "turn_id": "t1", "plan_id": "p1", "priority": "urgent"}); err != nil {
+		t.Fatalf("send urgent instructions: %v", err)
+	}
+	if _, err := host.WaitFor("response.cancel", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	interrupted := client.waitEvent(t, EventTypeTTSInterrupted, nil)
+	if interrupted.Metadata["reason"] != "preempted" {
+		t.Errorf("tts_interrupted reason = %v", interrupted.Metadata["reason"])
+	}
+
+	economist := waitVoiceConn(t, fake, "echo")
+	if _, err := economist.WaitFor("response.create", 1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultiVoiceGateway_ScenePausesWhileLearnerSpeaksThenHandsOff(t *testing.T) {
+	fake := realtimetest.NewServer(realtimetest.WithResponder(func(conn *realtimetest.Conn, req realtimetest.Event) realtimetest.Response {
+		return realtimetest.Response{Transcript: "说完了", Audio: make([]byte, 960)}
+	}))
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGateway(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil })
+	host := waitVoiceConn(t, fake, "cedar")
+	economist := waitVoiceConn(t, fake, "echo")
+	asr := waitVoiceConn(t, fake, "alloy")
+
+	// 学习者在角色之间开口：场景暂停，谁都不说话
+	asr.EmitSpeechStarted()
+	client.waitEvent(t, EventTypeSpeechStarted, nil)
+	err := gw.SendScene(context.Background(), Scene{
+		Beats: []SceneBeat{
+			{Role: "host", Instructions: "抛出问题"},
+			{Role: "economist", Instructions: "解释机制"},
+		},
+		Metadata: map[string]interface{}{"turn_id": "t1", "plan_id": "p1"},
+	})
+	if err != nil {
+		t.Fatalf("send scene: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if got := len(host.ReceivedOfType("response.create")); got != 0 {
+		t.Fatalf("host started %d responses while learner was speaking", got)
+	}
+
+	// 学习者停下且没有转写：过了恢复延迟后场景按顺序继续
+	stoppedAt := time.Now()
+	asr.EmitSpeechStopped()
+	if _, err := host.WaitFor("response.create", 1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(stoppedAt); waited < sceneResumeDelay-100*time.Millisecond {
+		t.Errorf("scene resumed after %v, want >= %v", waited, sceneResumeDelay)
+	}
+	if _, err := economist.WaitFor("response.create", 1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	done := client.waitEvent(t, EventTypeTTSCompleted, func(m ServerMessage) bool { return m.Metadata["role"] == "host" })
+	started := client.waitEvent(t, EventTypeTTSStarted, func(m ServerMessage) bool { return m.Metadata["role"] == "economist" })
+	if started.Seq < done.Seq {
+		t.Errorf("economist started (seq %d) before host finished (seq %d)", started.Seq, done.Seq)
+	}
+}
+
+func TestMultiVoiceGateway_SceneAbortsWhenLearnerTakesTheTurn(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGateway(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil })
+	host := waitVoiceConn(t, fake, "cedar")
+	asr := waitVoiceConn(t, fake, "alloy")
+
+	asr.EmitSpeechStarted()
+	client.waitEvent(t, EventTypeSpeechStarted, nil)
+	if err := gw.SendScene(context.Background(), Scene{
+		Beats: []SceneBeat{
+			{Role: "host", Instructions: "抛出问题"},
+			{Role: "economist", Instructions: "解释机制"},
+		},
+		Metadata: map[string]interface{}{"turn_id": "t1", "plan_id": "p1"},
+	}); err != nil {
+		t.Fatalf("send scene: %v", err)
+	}
+	asr.EmitSpeechStopped()
+	asr.EmitTranscription("等一下，我有个问题")
+
+	dropped := client.waitEvent(t, EventTypeSpeechDropped, func(m ServerMessage) bool { return m.Metadata["role"] == "economist" })
+	if dropped.Metadata["reason"] != speechDropLearnerInterrupted || dropped.TurnID != "t1" {
+		t.Errorf("speech_dropped = %+v", dropped)
+	}
+	time.Sleep(sceneResumeDelay + 200*time.Millisecond)
+	if got := len(host.ReceivedOfType("response.create")); got != 0 {
+		t.Errorf("host started %d responses after the scene was aborted", got)
+	}
+}
+
+func TestMultiVoiceGateway_RoleConnReconnectsAndReplaysHistory(t *testing.T) {
+	fake := realtimetest.NewServer(realtimetest.WithResponder(func(conn *realtimetest.Conn, req realtimetest.Event) realtimetest.Response {
+		return realtimetest.Response{
+			Transcript: "这是一段很长很长的讲解",
+			Audio:      make([]byte, 9600),
+			Chunks:     20,
+			ChunkDelay: 50 * time.Millisecond,
+		}
+	}))
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGateway(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil })
+	host := waitVoiceConn(t, fake, "cedar")
+	if err := gw.voicePool.SyncUserText("什么是通胀"); err != nil {
+		t.Fatalf("sync user text: %v", err)
+	}
+	if _, err := host.WaitFor("conversation.item.create", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gw.SendInstructions(context.Background(), "讲解", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	client.waitEvent(t, EventTypeTTSStarted, nil)
+
+	// 说到一半 host 的 Realtime 连接断了：本段按打断结束，连接自动重建
+	host.Close()
+	interrupted := client.waitEvent(t, EventTypeTTSInterrupted, nil)
+	if interrupted.Metadata["reason"] != "role_disconnected" {
+		t.Errorf("tts_interrupted reason = %v", interrupted.Metadata["reason"])
+	}
+	for _, status := range []string{roleHealthDisconnected, roleHealthReconnecting, roleHealthHealthy} {
+		client.waitEvent(t, EventTypeRoleHealth, func(msg ServerMessage) bool {
+			return msg.Metadata["role"] == "host" && msg.Metadata["status"] == status
+		})
+	}
+
+	// 新连接重新下发了 session.update，并回放了断线前的对话历史
+	rebuilt, err := fake.WaitConn(5*time.Second, func(c *realtimetest.Conn) bool { return c != host && c.Voice() == "cedar" })
+	if err != nil {
+		t.Fatalf("host not reconnected: %v", err)
+	}
+	evt, err := rebuilt.WaitFor("conversation.item.create", 1, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, _ := evt["item"].(map[string]interface{})
+	content, _ := item["content"].([]interface{})
+	if len(content) == 0 || content[0].(map[string]interface{})["text"] != "什么是通胀" {
+		t.Errorf("replayed history item = %v", item)
+	}
+
+	// 重连后角色照常发言
+	if err := gw.SendInstructions(context.Background(), "继续", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	if _, err := rebuilt.WaitFor("response.create", 1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultiVoiceGateway_ASRConnReconnects(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGateway(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil })
+	asr := waitVoiceConn(t, fake, "alloy")
+
+	// ASR 连接断了：自动重建，之后的转写照常下发
+	asr.Close()
+	for _, status := range []string{roleHealthDisconnected, roleHealthReconnecting, roleHealthHealthy} {
+		client.waitEvent(t, EventTypeRoleHealth, func(msg ServerMessage) bool {
+			return msg.Metadata["role"] == asrHealthRole && msg.Metadata["status"] == status
+		})
+	}
+	rebuilt, err := fake.WaitConn(5*time.Second, func(c *realtimetest.Conn) bool { return c != asr && c.Voice() == "alloy" })
+	if err != nil {
+		t.Fatalf("asr not reconnected: %v", err)
+	}
+	if conn, _ := gw.voicePool.GetASRConn(); conn == nil {
+		t.Fatal("voice pool has no ASR conn after reconnect")
+	}
+
+	if err := client.conn.WriteMessage(websocket.BinaryMessage, make([]byte, 320)); err != nil {
+		t.Fatalf("write audio: %v", err)
+	}
+	if _, err := rebuilt.WaitFor("input_audio_buffer.append", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := rebuilt.EmitTranscription("断线后还能听见吗"); err != nil {
+		t.Fatalf("emit transcription: %v", err)
+	}
+	client.waitEvent(t, EventTypeASRFinal, func(m ServerMessage) bool { return m.Text == "断线后还能听见吗" })
+}
+
+func TestMultiVoiceGateway_UnavailableRoleRecoversInBackground(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	gw, client := startMultiVoiceGatewayWithConfig(t, fake, func(ctx context.Context, msg *ClientMessage) error { return nil }, func(config *GatewayConfig) {
+		config.RoleReconnectAttempts = 1
+		config.RoleRecoveryInterval = 50 * time.Millisecond
+	})
+	host := waitVoiceConn(t, fake, "cedar")
+
+	// Realtime 暂时拒绝握手：立即重连失败，host 标记为不可用
+	fake.SetRejectConnections(true)
+	host.Close()
+	client.waitEvent(t, EventTypeRoleHealth, func(msg ServerMessage) bool {
+		return msg.Metadata["role"] == "host" && msg.Metadata["status"] == roleHealthUnavailable
+	})
+	if _, err := gw.voicePool.GetRoleConn(context.Background(), "host"); !errors.Is(err, ErrRoleUnavailable) {
+		t.Fatalf("GetRoleConn while down = %v, want ErrRoleUnavailable", err)
+	}
+
+	// 服务恢复：后台重试把 host 接回来，之后照常发言
+	fake.SetRejectConnections(false)
+	client.waitEvent(t, EventTypeRoleHealth, func(msg ServerMessage) bool {
+		return msg.Metadata["role"] == "host" && msg.Metadata["status"] == roleHealthHealthy
+	})
+	rebuilt, err := fake.WaitConn(5*time.Second, func(c *realtimetest.Conn) bool { return c != host && c.Voice() == "cedar" })
+	if err != nil {
+		t.Fatalf("host not recovered: %v", err)
+	}
+	if err := gw.SendInstructions(context.Background(), "继续", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	if _, err := rebuilt.WaitFor("response.create", 1, 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
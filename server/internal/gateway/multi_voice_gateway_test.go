@@ -368,3 +368,31 @@ func Example_multiVoiceGatewayUsage() {
 
 	// Output:
 }
+
+// TestMultiVoiceGatewayLateAudioAfterClose 结束后才到的音频增量不补建流，也不留在 audioStreams 里
+func TestMultiVoiceGatewayLateAudioAfterClose(t *testing.T) {
+	gw := NewMultiVoiceGateway("test-session", nil, GatewayConfig{})
+
+	id := gw.openAudioStream("resp_1", "host")
+	if streamID, seq, _, ok := gw.nextAudioFrame("resp_1", "host"); !ok || streamID != id || seq != 0 {
+		t.Fatalf("frame = %d/%d ok=%v", streamID, seq, ok)
+	}
+	if got := gw.closeAudioStream("resp_1"); got != id {
+		t.Fatalf("closed stream = %d, want %d", got, id)
+	}
+	if _, _, _, ok := gw.nextAudioFrame("resp_1", "host"); ok {
+		t.Fatal("late delta should be dropped")
+	}
+	// response.created 丢失的新发言照常补建流
+	if _, _, _, ok := gw.nextAudioFrame("resp_2", "host"); !ok {
+		t.Fatal("unknown response should open a stream")
+	}
+	if len(gw.audioStreams) != 1 {
+		t.Fatalf("audio streams = %v", gw.audioStreams)
+	}
+
+	_ = gw.Close()
+	if len(gw.audioStreams) != 0 {
+		t.Fatalf("audio streams after close = %v", gw.audioStreams)
+	}
+}
@@ -0,0 +1,225 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrGatewayClosed 网关已关闭（宽限期已过或会话结束），客户端需要新建连接
+	ErrGatewayClosed = errors.New("gateway: closed")
+)
+
+// ReplayFallback 在 replay 缓冲无法覆盖客户端缺口时，返回用于 resync 的历史消息快照。
+// 由 API 层注入（通常从 Timeline 的 asr_final / assistant_text 事件重建）。
+type ReplayFallback func(ctx context.Context) ([]ServerMessage, error)
+
+// SetReplayFallback 设置 Timeline 兜底
+func (g *MultiVoiceGateway) SetReplayFallback(fn ReplayFallback) {
+	g.clientConnLock.Lock()
+	defer g.clientConnLock.Unlock()
+	g.replayFallback = fn
+}
+
+// ResumeToken 返回本网关的续传凭证（stream_ready 中已下发给客户端）
+func (g *MultiVoiceGateway) ResumeToken() string {
+	return g.resumeToken
+}
+
+// CheckResumeToken 常量时间比较续传凭证
+func (g *MultiVoiceGateway) CheckResumeToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(g.resumeToken)) == 1
+}
+
+// AttachClient 把新的客户端连接接到仍存活的网关上（断线重连，或新标签页接管旧连接）。
+// lastSeq 是客户端已收到的最大 seq：缓冲中更新的消息先按序补发，再恢复实时下行；
+// 缺口超出缓冲时改为下发一条 resync（Timeline 快照），客户端据此重建对话。
+func (g *MultiVoiceGateway) AttachClient(conn *websocket.Conn, lastSeq int64) error {
+	if conn == nil {
+		return fmt.Errorf("clientConn is nil")
+	}
+	select {
+	case <-g.closeChan:
+		return ErrGatewayClosed
+	default:
+	}
+
+	// Timeline 查询可能较慢，放在锁外；缓冲只会继续淘汰旧消息，锁内复查结果只会更“不完整”。
+	var snapshot []ServerMessage
+	var snapshotErr error
+	snapshotLoaded := false
+	if _, complete := g.replay.since(lastSeq); !complete {
+		snapshot, snapshotErr = g.loadReplayFallback()
+		snapshotLoaded = true
+	}
+
+	g.clientConnLock.Lock()
+	select {
+	case <-g.closeChan:
+		g.clientConnLock.Unlock()
+		return ErrGatewayClosed
+	default:
+	}
+
+	old := g.clientConn
+	g.clientConn = conn
+	g.clientProtocol = ProtocolVersion(conn.Subprotocol())
+	g.detachGen++
+	if g.graceTimer != nil {
+		g.graceTimer.Stop()
+		g.graceTimer = nil
+	}
+
+	missed, complete := g.replay.since(lastSeq)
+	replayed := 0
+	var writeErr error
+	if complete {
+		for _, data := range missed {
+			if writeErr = conn.WriteMessage(websocket.TextMessage, data); writeErr != nil {
+				break
+			}
+			replayed++
+		}
+	} else {
+		if !snapshotLoaded {
+			snapshot, snapshotErr = g.loadReplayFallbackLocked()
+		}
+		if snapshotErr != nil {
+			g.logger.Printf("[MultiVoiceGateway] ⚠️  Replay fallback failed: %v", snapshotErr)
+		}
+		writeErr = g.sendToClientLocked(&ServerMessage{
+			Type:     EventTypeResync,
+			Replay:   snapshot,
+			Metadata: map[string]interface{}{"source": "timeline", "last_seq": lastSeq},
+			ServerTS: time.Now(),
+		})
+	}
+	if writeErr == nil {
+		inputFormat, outputFormat := g.clientAudioFormats()
+		writeErr = g.sendToClientLocked(&ServerMessage{
+			Type:              EventTypeStreamResumed,
+			ResumeToken:       g.resumeToken,
+			Protocol:          g.clientProtocol,
+			InputAudioFormat:  inputFormat,
+			OutputAudioFormat: outputFormat,
+			Metadata: map[string]interface{}{
+				"last_seq": lastSeq,
+				"replayed": replayed,
+				"complete": complete,
+			},
+			ServerTS: time.Now(),
+		})
+	}
+	g.clientConnLock.Unlock()
+
+	// 旧连接的读循环会发现自己已不是当前连接，不会触发 detach
+	if old != nil {
+		_ = old.Close()
+	}
+
+	// 即使补发失败也要启动读循环：连接若已坏，读循环会走 detach 重新进入宽限期
+	go g.clientReadLoop(conn)
+
+	g.logger.Printf("[MultiVoiceGateway] ✅ Client re-attached: session=%s last_seq=%d replayed=%d complete=%v",
+		g.sessionID, lastSeq, replayed, complete)
+	if writeErr != nil {
+		return fmt.Errorf("replay to client: %w", writeErr)
+	}
+	return nil
+}
+
+// Resync 主动下发一次 Timeline 快照（网关已过期、客户端重连到新网关时使用）
+func (g *MultiVoiceGateway) Resync() error {
+	snapshot, err := g.loadReplayFallback()
+	if err != nil {
+		return fmt.Errorf("load replay fallback: %w", err)
+	}
+	return g.sendToClient(&ServerMessage{
+		Type:     EventTypeResync,
+		Replay:   snapshot,
+		Metadata: map[string]interface{}{"source": "timeline"},
+		ServerTS: time.Now(),
+	})
+}
+
+func (g *MultiVoiceGateway) loadReplayFallback() ([]ServerMessage, error) {
+	g.clientConnLock.Lock()
+	fn := g.replayFallback
+	g.clientConnLock.Unlock()
+	if fn == nil {
+		return nil, nil
+	}
+	return fn(g.ctx)
+}
+
+func (g *MultiVoiceGateway) loadReplayFallbackLocked() ([]ServerMessage, error) {
+	if g.replayFallback == nil {
+		return nil, nil
+	}
+	return g.replayFallback(g.ctx)
+}
+
+// detachClient 客户端连接断开：未配置宽限期时直接关闭网关（旧行为）；
+// 否则保留 VoicePool 与发言队列，宽限期内没有重连再关闭。
+// 已被 AttachClient 替换掉的旧连接断开时什么也不做。
+func (g *MultiVoiceGateway) detachClient(conn *websocket.Conn) {
+	select {
+	case <-g.closeChan:
+		return
+	default:
+	}
+
+	g.clientConnLock.Lock()
+	if g.clientConn != conn {
+		g.clientConnLock.Unlock()
+		return
+	}
+
+	grace := g.config.ResumeGracePeriod
+	if grace <= 0 {
+		g.clientConnLock.Unlock()
+		_ = g.Close()
+		return
+	}
+
+	g.clientConn = nil
+	_ = conn.Close()
+	g.detachGen++
+	gen := g.detachGen
+	if g.graceTimer != nil {
+		g.graceTimer.Stop()
+	}
+	g.graceTimer = time.AfterFunc(grace, func() { g.expireDetached(gen) })
+	g.clientConnLock.Unlock()
+
+	g.logger.Printf("[MultiVoiceGateway] 🔌 Client detached: session=%s, keeping gateway for %v", g.sessionID, grace)
+}
+
+// expireDetached 宽限期到期：期间没有新连接接入则关闭网关
+func (g *MultiVoiceGateway) expireDetached(gen int64) {
+	g.clientConnLock.Lock()
+	expired := g.clientConn == nil && g.detachGen == gen
+	g.clientConnLock.Unlock()
+	if !expired {
+		return
+	}
+
+	g.logger.Printf("[MultiVoiceGateway] ⏱️  Resume grace period expired: session=%s", g.sessionID)
+	_ = g.Close()
+}
+
+// newResumeToken 生成随机续传凭证
+func newResumeToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("rt_%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
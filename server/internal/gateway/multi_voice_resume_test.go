@@ -0,0 +1,211 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/gateway/realtimetest"
+
+	"github.com/gorilla/websocket"
+)
+
+// resumableGateway 模拟 /stream 路由：首个连接新建网关，带 last_seq 的连接走 AttachClient
+type resumableGateway struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu sync.Mutex
+	gw *MultiVoiceGateway
+}
+
+func newResumableGateway(t *testing.T, fake *realtimetest.Server, configure func(*GatewayConfig)) *resumableGateway {
+	t.Helper()
+	config := GatewayConfig{
+		OpenAIAPIKey:      "test-key",
+		OpenAIRealtimeURL: fake.URL(),
+		RoleProfiles:      map[string]RoleProfile{"host": {Voice: "cedar"}},
+		ResumeGracePeriod: 2 * time.Second,
+	}
+	if configure != nil {
+		configure(&config)
+	}
+
+	rg := &resumableGateway{t: t}
+	upgrader := websocket.Upgrader{}
+	rg.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		rg.mu.Lock()
+		defer rg.mu.Unlock()
+		if rg.gw == nil {
+			rg.gw = NewMultiVoiceGateway("resume-session", conn, config)
+			rg.gw.SetEventHandler(func(ctx context.Context, msg *ClientMessage) error { return nil })
+			if err := rg.gw.Start(context.Background()); err != nil {
+				t.Errorf("start gateway: %v", err)
+			}
+			return
+		}
+		lastSeq, _ := strconv.ParseInt(r.URL.Query().Get("last_seq"), 10, 64)
+		if err := rg.gw.AttachClient(conn, lastSeq); err != nil {
+			t.Errorf("attach client: %v", err)
+		}
+	}))
+	t.Cleanup(func() {
+		rg.server.Close()
+		if gw := rg.gateway(); gw != nil {
+			_ = gw.Close()
+		}
+	})
+	return rg
+}
+
+func (rg *resumableGateway) gateway() *MultiVoiceGateway {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	return rg.gw
+}
+
+func (rg *resumableGateway) dial(lastSeq int64) *fakeClient {
+	rg.t.Helper()
+	url := "ws" + strings.TrimPrefix(rg.server.URL, "http")
+	if lastSeq > 0 {
+		url += "?last_seq=" + strconv.FormatInt(lastSeq, 10)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		rg.t.Fatalf("dial: %v", err)
+	}
+	client := &fakeClient{conn: conn, changed: make(chan struct{})}
+	go client.readLoop()
+	return client
+}
+
+func (c *fakeClient) snapshot() []ServerMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ServerMessage(nil), c.events...)
+}
+
+func waitDetached(t *testing.T, gw *MultiVoiceGateway) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		gw.clientConnLock.Lock()
+		detached := gw.clientConn == nil
+		gw.clientConnLock.Unlock()
+		if detached {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("gateway did not detach client")
+}
+
+func TestMultiVoiceGateway_ResumeReplaysMissedMessages(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+	rg := newResumableGateway(t, fake, nil)
+
+	first := rg.dial(0)
+	ready := first.waitEvent(t, EventTypeStreamReady, nil)
+	if ready.ResumeToken == "" || !rg.gateway().CheckResumeToken(ready.ResumeToken) {
+		t.Fatalf("stream_ready token = %q", ready.ResumeToken)
+	}
+	gw := rg.gateway()
+	host := waitVoiceConn(t, fake, "cedar")
+
+	_ = gw.sendToClient(&ServerMessage{Type: EventTypeASRFinal, Text: "A", ServerTS: time.Now()})
+	seen := first.waitEvent(t, EventTypeASRFinal, nil)
+
+	// 断线：网关与角色连接保留，期间的消息进入缓冲
+	_ = first.conn.Close()
+	waitDetached(t, gw)
+	_ = gw.sendToClient(&ServerMessage{Type: EventTypeAssistantText, Text: "B", ServerTS: time.Now()})
+	select {
+	case <-gw.Done():
+		t.Fatal("gateway closed during grace period")
+	default:
+	}
+
+	second := rg.dial(seen.Seq)
+	resumed := second.waitEvent(t, EventTypeStreamResumed, nil)
+	if resumed.Metadata["complete"] != true || resumed.Metadata["replayed"] != float64(1) {
+		t.Errorf("stream_resumed metadata = %+v", resumed.Metadata)
+	}
+	events := second.snapshot()
+	if events[0].Type != EventTypeAssistantText || events[0].Text != "B" || events[0].Seq != seen.Seq+1 {
+		t.Errorf("first replayed message = %+v", events[0])
+	}
+
+	// 角色连接没有被重建，恢复后仍能正常发言
+	if n := len(fake.Conns()); n != 2 {
+		t.Errorf("realtime conns = %d, want 2 (asr + host)", n)
+	}
+	if err := gw.SendInstructions(context.Background(), "继续", map[string]interface{}{"role": "host"}); err != nil {
+		t.Fatalf("send instructions: %v", err)
+	}
+	if _, err := host.WaitFor("response.create", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	second.waitEvent(t, EventTypeAssistantText, func(m ServerMessage) bool { return m.Text == "好的。" })
+}
+
+func TestMultiVoiceGateway_ResumeGapFallsBackToTimeline(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+	rg := newResumableGateway(t, fake, func(c *GatewayConfig) { c.ReplayBufferSize = 2 })
+
+	first := rg.dial(0)
+	first.waitEvent(t, EventTypeStreamReady, nil)
+	gw := rg.gateway()
+	gw.SetReplayFallback(func(ctx context.Context) ([]ServerMessage, error) {
+		return []ServerMessage{
+			{Type: EventTypeASRFinal, Text: "为什么？"},
+			{Type: EventTypeAssistantText, Text: "因为机会成本。"},
+		}, nil
+	})
+
+	_ = first.conn.Close()
+	waitDetached(t, gw)
+	for i := 0; i < 5; i++ {
+		_ = gw.sendToClient(&ServerMessage{Type: EventTypeTTSCompleted, ServerTS: time.Now()})
+	}
+
+	second := rg.dial(1)
+	resync := second.waitEvent(t, EventTypeResync, nil)
+	if len(resync.Replay) != 2 || resync.Replay[1].Text != "因为机会成本。" {
+		t.Errorf("resync replay = %+v", resync.Replay)
+	}
+	resumed := second.waitEvent(t, EventTypeStreamResumed, nil)
+	if resumed.Metadata["complete"] != false {
+		t.Errorf("stream_resumed metadata = %+v", resumed.Metadata)
+	}
+}
+
+func TestMultiVoiceGateway_ClosesAfterGracePeriod(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+	rg := newResumableGateway(t, fake, func(c *GatewayConfig) { c.ResumeGracePeriod = 100 * time.Millisecond })
+
+	client := rg.dial(0)
+	client.waitEvent(t, EventTypeStreamReady, nil)
+	gw := rg.gateway()
+	_ = client.conn.Close()
+
+	select {
+	case <-gw.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("gateway still open after grace period")
+	}
+	if err := gw.AttachClient(&websocket.Conn{}, 0); err != ErrGatewayClosed {
+		t.Errorf("attach after expiry = %v, want ErrGatewayClosed", err)
+	}
+}
@@ -0,0 +1,148 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 客户端协议（/api/sessions/:id/stream）
+//
+// 版本通过 WebSocket 子协议协商（Sec-WebSocket-Protocol）：
+//   - bubbletalk.v2：二进制帧 = AudioFrame（带头部），文本帧 = JSON 控制消息
+//   - bubbletalk.v1 或未声明：二进制帧 = 裸音频（旧版 Web 客户端），文本帧 = JSON 控制消息
+//
+// JSON 控制消息：上行 ClientMessage，下行 ServerMessage（均以 type 区分）。
+// 下行 stream_ready 的 protocol 字段告知协商结果；tts_started / tts_completed 的
+// stream_id 与音频帧头中的 stream_id 对应，客户端可据此丢弃已被打断的音频流。
+const (
+	ProtocolV1 = 1
+	ProtocolV2 = 2
+
+	SubprotocolV1 = "bubbletalk.v1"
+	SubprotocolV2 = "bubbletalk.v2"
+)
+
+// Subprotocols 服务端支持的子协议（按优先级），供 websocket.Upgrader 使用
+var Subprotocols = []string{SubprotocolV2, SubprotocolV1}
+
+// ProtocolVersion 根据协商结果（conn.Subprotocol()）返回协议版本；未协商视为 v1
+func ProtocolVersion(subprotocol string) int {
+	if subprotocol == SubprotocolV2 {
+		return ProtocolV2
+	}
+	return ProtocolV1
+}
+
+// AudioCodec 音频帧编码
+type AudioCodec uint8
+
+const (
+	CodecUnknown  AudioCodec = 0
+	CodecPCM16    AudioCodec = 1 // 单声道 16-bit little-endian；采样率按连接时协商的格式（pcm16@16000 等，默认 24kHz）
+	CodecG711ULaw AudioCodec = 2
+	CodecG711ALaw AudioCodec = 3
+	CodecOpus     AudioCodec = 4
+)
+
+var codecFormats = map[AudioCodec]string{
+	CodecPCM16:    "pcm16",
+	CodecG711ULaw: "g711_ulaw",
+	CodecG711ALaw: "g711_alaw",
+	CodecOpus:     "opus",
+}
+
+// CodecFromFormat 把音频格式名（pcm16 / pcm16@16000 / g711_ulaw / g711_alaw）映射为帧编码；空串按 pcm16。
+// 帧头不携带采样率，采样率以连接时约定的格式为准（stream_ready 的 output_audio_format）。
+func CodecFromFormat(format string) AudioCodec {
+	if format == "" {
+		return CodecPCM16
+	}
+	format, _, _ = strings.Cut(strings.ToLower(format), "@")
+	for codec, name := range codecFormats {
+		if name == format {
+			return codec
+		}
+	}
+	return CodecUnknown
+}
+
+// Format 返回编码对应的 Realtime 格式名
+func (c AudioCodec) Format() string {
+	return codecFormats[c]
+}
+
+func (c AudioCodec) String() string {
+	if name, ok := codecFormats[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("codec(%d)", uint8(c))
+}
+
+// audioFrameKind 帧类型（为后续扩展预留，目前只有音频）
+const audioFrameKind = 1
+
+// audioFrameHeaderSize 固定头长度（不含 role）
+//
+// v2 音频帧布局（大端序）：
+//
+//	offset  size  field
+//	0       1     version   = 2
+//	1       1     kind      = 1（音频）
+//	2       1     codec     AudioCodec
+//	3       1     role_len  N（0-255）
+//	4       4     stream_id 下行：一次角色发言（response）一个流；上行：客户端自定义，通常为 0
+//	8       8     seq       流内帧序号，从 0 开始
+//	16      N     role      UTF-8 角色名（上行可为空）
+//	16+N    ...   payload   音频数据
+const audioFrameHeaderSize = 16
+
+// ErrInvalidAudioFrame 二进制帧不是合法的 v2 音频帧
+var ErrInvalidAudioFrame = errors.New("gateway: invalid audio frame")
+
+// AudioFrame v2 二进制音频帧
+type AudioFrame struct {
+	StreamID uint32
+	Seq      uint64
+	Codec    AudioCodec
+	Role     string
+	Payload  []byte
+}
+
+// MarshalBinary 编码为 v2 二进制帧
+func (f AudioFrame) MarshalBinary() ([]byte, error) {
+	if len(f.Role) > 255 {
+		return nil, fmt.Errorf("%w: role too long (%d bytes)", ErrInvalidAudioFrame, len(f.Role))
+	}
+	buf := make([]byte, audioFrameHeaderSize+len(f.Role)+len(f.Payload))
+	buf[0] = ProtocolV2
+	buf[1] = audioFrameKind
+	buf[2] = byte(f.Codec)
+	buf[3] = byte(len(f.Role))
+	binary.BigEndian.PutUint32(buf[4:8], f.StreamID)
+	binary.BigEndian.PutUint64(buf[8:16], f.Seq)
+	copy(buf[audioFrameHeaderSize:], f.Role)
+	copy(buf[audioFrameHeaderSize+len(f.Role):], f.Payload)
+	return buf, nil
+}
+
+// UnmarshalBinary 解码 v2 二进制帧；Payload 引用 data 的底层数组，不做拷贝
+func (f *AudioFrame) UnmarshalBinary(data []byte) error {
+	if len(data) < audioFrameHeaderSize {
+		return fmt.Errorf("%w: short header (%d bytes)", ErrInvalidAudioFrame, len(data))
+	}
+	if data[0] != ProtocolV2 || data[1] != audioFrameKind {
+		return fmt.Errorf("%w: version=%d kind=%d", ErrInvalidAudioFrame, data[0], data[1])
+	}
+	roleLen := int(data[3])
+	if len(data) < audioFrameHeaderSize+roleLen {
+		return fmt.Errorf("%w: truncated role", ErrInvalidAudioFrame)
+	}
+	f.Codec = AudioCodec(data[2])
+	f.StreamID = binary.BigEndian.Uint32(data[4:8])
+	f.Seq = binary.BigEndian.Uint64(data[8:16])
+	f.Role = string(data[audioFrameHeaderSize : audioFrameHeaderSize+roleLen])
+	f.Payload = data[audioFrameHeaderSize+roleLen:]
+	return nil
+}
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAudioFrame_RoundTrip(t *testing.T) {
+	in := AudioFrame{StreamID: 7, Seq: 1 << 40, Codec: CodecG711ULaw, Role: "经济学家", Payload: []byte{1, 2, 3}}
+	data, err := in.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != audioFrameHeaderSize+len(in.Role)+3 {
+		t.Fatalf("frame size = %d", len(data))
+	}
+
+	var out AudioFrame
+	if err := out.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if out.StreamID != in.StreamID || out.Seq != in.Seq || out.Codec != in.Codec || out.Role != in.Role || !bytes.Equal(out.Payload, in.Payload) {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+}
+
+func TestAudioFrame_Invalid(t *testing.T) {
+	valid, _ := AudioFrame{Role: "host", Payload: []byte{1}}.MarshalBinary()
+	cases := map[string][]byte{
+		"short":          valid[:10],
+		"wrong version":  append([]byte{1}, valid[1:]...),
+		"truncated role": valid[:audioFrameHeaderSize+2],
+	}
+	for name, data := range cases {
+		var f AudioFrame
+		if err := f.UnmarshalBinary(data); !errors.Is(err, ErrInvalidAudioFrame) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+
+	long := make([]byte, 256)
+	if _, err := (AudioFrame{Role: string(long)}).MarshalBinary(); !errors.Is(err, ErrInvalidAudioFrame) {
+		t.Errorf("long role: err = %v", err)
+	}
+}
+
+func TestCodecFromFormat(t *testing.T) {
+	cases := map[string]AudioCodec{"": CodecPCM16, "pcm16": CodecPCM16, "g711_alaw": CodecG711ALaw, "mp3": CodecUnknown}
+	for format, want := range cases {
+		if got := CodecFromFormat(format); got != want {
+			t.Errorf("CodecFromFormat(%q) = %v, want %v", format, got, want)
+		}
+	}
+	if ProtocolVersion(SubprotocolV2) != ProtocolV2 || ProtocolVersion("") != ProtocolV1 {
+		t.Error("unexpected protocol negotiation")
+	}
+}
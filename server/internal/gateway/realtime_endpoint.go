@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// defaultRealtimeBaseURL OpenAI 官方 Realtime 端点（未配置 RealtimeURL 时使用）
+const defaultRealtimeBaseURL = "wss://api.openai.com/v1/realtime"
+
+// resolveRealtimeURL 计算最终拨号地址。
+// - base 为空时使用官方端点；
+// - base 已带 model 查询参数时原样使用（显式配置优先）；
+// - 否则把 model 补进查询参数（model 为空则不补）。
+func resolveRealtimeURL(base, model string) string {
+	if base == "" {
+		base = defaultRealtimeBaseURL
+	}
+	if model == "" {
+		return base
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	q := u.Query()
+	if q.Get("model") != "" {
+		return base
+	}
+	q.Set("model", model)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// realtimeHeaders 构造握手头：有 API Key 时带 Bearer 认证，extra 可覆盖/追加任意头
+// （用于代理网关的自定义认证、本地假服务等）。
+func realtimeHeaders(apiKey string, extra map[string]string) http.Header {
+	headers := http.Header{}
+	if apiKey != "" {
+		headers.Set("Authorization", "Bearer "+apiKey)
+	}
+	headers.Set("OpenAI-Beta", "realtime=v1")
+	for k, v := range extra {
+		if v == "" {
+			headers.Del(k)
+			continue
+		}
+		headers.Set(k, v)
+	}
+	return headers
+}
@@ -0,0 +1,42 @@
+package gateway
+
+import "testing"
+
+func TestResolveRealtimeURL(t *testing.T) {
+	cases := []struct {
+		base, model, want string
+	}{
+		{"", "gpt-realtime", "wss://api.openai.com/v1/realtime?model=gpt-realtime"},
+		{"ws://127.0.0.1:9000/v1/realtime", "m1", "ws://127.0.0.1:9000/v1/realtime?model=m1"},
+		{"wss://proxy.example.com/rt?model=pinned", "m1", "wss://proxy.example.com/rt?model=pinned"},
+		{"wss://proxy.example.com/rt?tenant=a", "m1", "wss://proxy.example.com/rt?model=m1&tenant=a"},
+		{"ws://127.0.0.1:9000/v1/realtime", "", "ws://127.0.0.1:9000/v1/realtime"},
+	}
+	for _, tc := range cases {
+		if got := resolveRealtimeURL(tc.base, tc.model); got != tc.want {
+			t.Errorf("resolveRealtimeURL(%q, %q) = %q, want %q", tc.base, tc.model, got, tc.want)
+		}
+	}
+}
+
+func TestRealtimeHeaders(t *testing.T) {
+	h := realtimeHeaders("sk-test", map[string]string{"X-Tenant": "a", "OpenAI-Beta": ""})
+	if got := h.Get("Authorization"); got != "Bearer sk-test" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := h.Get("X-Tenant"); got != "a" {
+		t.Errorf("X-Tenant = %q", got)
+	}
+	if _, ok := h["Openai-Beta"]; ok {
+		t.Errorf("OpenAI-Beta should be removed by empty override")
+	}
+
+	// 没有 key（如代理自行注入认证）时不发空的 Bearer
+	h = realtimeHeaders("", map[string]string{"Authorization": "Token proxy"})
+	if got := h.Get("Authorization"); got != "Token proxy" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := h.Get("OpenAI-Beta"); got != "realtime=v1" {
+		t.Errorf("OpenAI-Beta = %q", got)
+	}
+}
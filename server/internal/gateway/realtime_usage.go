@@ -0,0 +1,55 @@
+package gateway
+
+// RealtimeUsage 一次 Realtime response 的用量（来自 response.done 的 response.usage）。
+type RealtimeUsage struct {
+	Role       string
+	Model      string
+	ResponseID string
+
+	InputTokens  int
+	OutputTokens int
+	// CachedTokens/AudioInputTokens/AudioOutputTokens 都已包含在 Input/Output 总数中
+	CachedTokens      int
+	AudioInputTokens  int
+	AudioOutputTokens int
+}
+
+// parseRealtimeUsage 从 response.done 的 response 对象中解析用量；没有 usage 字段时返回 nil。
+//
+// 结构参考：
+//
+//	"usage": {
+//	  "input_tokens": 120, "output_tokens": 80,
+//	  "input_token_details": {"cached_tokens": 64, "audio_tokens": 40, "text_tokens": 80},
+//	  "output_token_details": {"audio_tokens": 60, "text_tokens": 20}
+//	}
+func parseRealtimeUsage(response map[string]interface{}) *RealtimeUsage {
+	raw, ok := response["usage"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	u := &RealtimeUsage{
+		InputTokens:  intField(raw, "input_tokens"),
+		OutputTokens: intField(raw, "output_tokens"),
+	}
+	if in, ok := raw["input_token_details"].(map[string]interface{}); ok {
+		u.CachedTokens = intField(in, "cached_tokens")
+		u.AudioInputTokens = intField(in, "audio_tokens")
+	}
+	if out, ok := raw["output_token_details"].(map[string]interface{}); ok {
+		u.AudioOutputTokens = intField(out, "audio_tokens")
+	}
+	return u
+}
+
+func intField(m map[string]interface{}, key string) int {
+	switch v := m[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
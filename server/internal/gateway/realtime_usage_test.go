@@ -0,0 +1,37 @@
+package gateway
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseRealtimeUsage(t *testing.T) {
+	raw := `{
+		"id": "resp_1",
+		"status": "completed",
+		"usage": {
+			"total_tokens": 200,
+			"input_tokens": 120,
+			"output_tokens": 80,
+			"input_token_details": {"cached_tokens": 64, "audio_tokens": 40, "text_tokens": 80},
+			"output_token_details": {"audio_tokens": 60, "text_tokens": 20}
+		}
+	}`
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &response); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	u := parseRealtimeUsage(response)
+	if u == nil {
+		t.Fatal("expected usage parsed")
+	}
+	if u.InputTokens != 120 || u.OutputTokens != 80 || u.CachedTokens != 64 ||
+		u.AudioInputTokens != 40 || u.AudioOutputTokens != 60 {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+
+	if parseRealtimeUsage(map[string]interface{}{"id": "resp_2"}) != nil {
+		t.Fatal("expected nil when usage is absent")
+	}
+}
@@ -0,0 +1,719 @@
+// Package realtimetest 提供一个本地假 Realtime WebSocket 服务，用于离线驱动 Gateway / MultiVoiceGateway。
+//
+// 支持的协议子集（与 OpenAI Realtime v1 事件格式一致）：
+//   - session.update -> session.updated
+//   - conversation.item.create -> conversation.item.created
+//   - conversation.item.delete -> conversation.item.deleted（item 不存在时返回 error）
+//   - input_audio_buffer.append / commit / clear
+//   - response.create -> response.created, 若干 audio/transcript/text delta, *.done, response.done
+//   - response.cancel -> 进行中的响应以 response.done(status=cancelled) 结束
+//
+// 服务端主动事件（语音检测、转写、函数调用）由测试通过 Conn 上的 Emit* 方法触发。
+package realtimetest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Event 一条 Realtime 事件（客户端发来或服务端发出）
+type Event map[string]interface{}
+
+// Type 返回事件类型
+func (e Event) Type() string {
+	t, _ := e["type"].(string)
+	return t
+}
+
+// Response 一次 response.create 的脚本化回放内容
+type Response struct {
+	Transcript   string        // 音频转写（response.audio_transcript.delta）
+	Text         string        // 纯文本输出（response.text.delta），用于 modalities=[text]
+	Audio        []byte        // 音频数据（response.audio.delta，base64 编码后发送）
+	Chunks       int           // 每种增量切成几段，<=0 时为 1
+	ChunkDelay   time.Duration // 增量之间的间隔（测试取消时有用）
+	FunctionCall *FunctionCall // 非空时输出一个函数调用而不是消息
+	Usage        *Usage        // response.done 中的用量；nil 时按文本长度估算
+}
+
+// FunctionCall 脚本化的函数调用输出
+type FunctionCall struct {
+	Name      string
+	CallID    string
+	Arguments string
+}
+
+// Usage response.done 中的 usage 字段
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// Responder 根据 response.create 请求决定回放内容
+type Responder func(conn *Conn, request Event) Response
+
+// DefaultResponder 回一句固定的话加 100ms 静音（24kHz PCM16）
+func DefaultResponder(conn *Conn, request Event) Response {
+	return Response{
+		Transcript: "好的。",
+		Audio:      make([]byte, 4800),
+		Chunks:     2,
+	}
+}
+
+// Server 假 Realtime 服务
+type Server struct {
+	httpServer *httptest.Server
+	upgrader   websocket.Upgrader
+
+	mu        sync.Mutex
+	conns     []*Conn
+	connAdded chan struct{}
+	responder Responder
+	apiKey    string
+	rejecting bool
+}
+
+// Option 配置 Server
+type Option func(*Server)
+
+// WithResponder 设置 response.create 的回放脚本
+func WithResponder(r Responder) Option {
+	return func(s *Server) { s.responder = r }
+}
+
+// WithAPIKey 要求握手带 "Authorization: Bearer <key>"，否则返回 401
+func WithAPIKey(key string) Option {
+	return func(s *Server) { s.apiKey = key }
+}
+
+// NewServer 启动假服务；测试结束时调用 Close
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		connAdded: make(chan struct{}),
+		responder: DefaultResponder,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.httpServer = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL 返回 ws:// 形式的端点地址（可直接作为 RealtimeURL）
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.httpServer.URL, "http") + "/v1/realtime"
+}
+
+// SetResponder 运行中替换回放脚本（对之后的 response.create 生效）
+func (s *Server) SetResponder(r Responder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r == nil {
+		r = DefaultResponder
+	}
+	s.responder = r
+}
+
+// SetRejectConnections 开启后新的握手一律返回 503（模拟 Realtime 服务不可用），已有连接不受影响
+func (s *Server) SetRejectConnections(reject bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejecting = reject
+}
+
+// Conns 返回目前为止建立的所有连接（按建立顺序）
+func (s *Server) Conns() []*Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Conn(nil), s.conns...)
+}
+
+// WaitConn 等待一个满足 match 的连接出现（match 为 nil 时匹配任意连接）
+func (s *Server) WaitConn(timeout time.Duration, match func(*Conn) bool) (*Conn, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		for _, c := range s.conns {
+			if match == nil || match(c) {
+				s.mu.Unlock()
+				return c, nil
+			}
+		}
+		added := s.connAdded
+		s.mu.Unlock()
+
+		select {
+		case <-added:
+		case <-time.After(20 * time.Millisecond):
+			// Conn 的会话配置（voice 等）在连接建立后才到达，需要定期复查
+		case <-deadline:
+			return nil, errors.New("realtimetest: timeout waiting for connection")
+		}
+	}
+}
+
+// Close 关闭所有连接并停止服务
+func (s *Server) Close() {
+	for _, c := range s.Conns() {
+		c.Close()
+	}
+	s.httpServer.Close()
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if s.apiKey != "" && r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	rejecting := s.rejecting
+	s.mu.Unlock()
+	if rejecting {
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	c := &Conn{
+		server:  s,
+		ws:      ws,
+		ID:      fmt.Sprintf("sess_%d", len(s.conns)+1),
+		Header:  r.Header.Clone(),
+		Model:   r.URL.Query().Get("model"),
+		closed:  make(chan struct{}),
+		arrived: make(chan struct{}),
+	}
+	s.conns = append(s.conns, c)
+	close(s.connAdded)
+	s.connAdded = make(chan struct{})
+	s.mu.Unlock()
+
+	c.Send(Event{
+		"type":    "session.created",
+		"session": map[string]interface{}{"id": c.ID, "model": c.Model},
+	})
+	go c.readLoop()
+}
+
+func (s *Server) currentResponder() Responder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.responder
+}
+
+// Conn 一条客户端连接（对应一个 RoleConn / Gateway 的 Realtime 连接）
+type Conn struct {
+	server *Server
+	ws     *websocket.Conn
+
+	ID     string      // 会话 ID（session.created 中下发）
+	Header http.Header // 握手请求头
+	Model  string      // 握手 URL 中的 model 参数
+
+	writeMu sync.Mutex
+
+	mu         sync.Mutex
+	received   []Event
+	arrived    chan struct{} // 每收到一条事件就关闭并替换，用于 WaitFor
+	session    map[string]interface{}
+	audioBytes int
+	seq        int
+	active     *activeResponse
+	items      []string // 服务端对话中现存的 item（用户消息、响应输出、提交的音频）
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+type activeResponse struct {
+	id        string
+	cancelled chan struct{}
+	once      sync.Once
+}
+
+func (r *activeResponse) cancel() { r.once.Do(func() { close(r.cancelled) }) }
+
+// Send 向客户端发送一条事件（自动补 event_id）
+func (c *Conn) Send(evt Event) error {
+	if _, ok := evt["event_id"]; !ok {
+		evt["event_id"] = c.nextID("event")
+	}
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+// Close 断开连接
+func (c *Conn) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		_ = c.ws.Close()
+	})
+}
+
+// Received 返回收到的全部客户端事件（按到达顺序）
+func (c *Conn) Received() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.received...)
+}
+
+// ReceivedOfType 返回指定类型的客户端事件
+func (c *Conn) ReceivedOfType(eventType string) []Event {
+	var out []Event
+	for _, evt := range c.Received() {
+		if evt.Type() == eventType {
+			out = append(out, evt)
+		}
+	}
+	return out
+}
+
+// WaitFor 等待第 n 条（从 1 开始）指定类型的客户端事件
+func (c *Conn) WaitFor(eventType string, n int, timeout time.Duration) (Event, error) {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		count := 0
+		for _, evt := range c.received {
+			if evt.Type() == eventType {
+				count++
+				if count == n {
+					c.mu.Unlock()
+					return evt, nil
+				}
+			}
+		}
+		arrived := c.arrived
+		c.mu.Unlock()
+
+		select {
+		case <-arrived:
+		case <-deadline:
+			return nil, fmt.Errorf("realtimetest: timeout waiting for %s #%d on %s", eventType, n, c.ID)
+		}
+	}
+}
+
+// Session 返回最近一次 session.update 的 session 配置
+func (c *Conn) Session() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// Voice 返回会话配置中的 voice（未配置时为空）
+func (c *Conn) Voice() string {
+	voice, _ := c.Session()["voice"].(string)
+	return voice
+}
+
+// Items 返回服务端对话中现存的 item ID（按创建顺序）
+func (c *Conn) Items() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.items...)
+}
+
+func (c *Conn) addItem(id string) {
+	c.mu.Lock()
+	c.items = append(c.items, id)
+	c.mu.Unlock()
+}
+
+// AudioBytes 返回 input_audio_buffer.append 累计收到的音频字节数（解码后）
+func (c *Conn) AudioBytes() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.audioBytes
+}
+
+// EmitSpeechStarted 模拟服务端 VAD 检测到用户开口
+func (c *Conn) EmitSpeechStarted() error {
+	return c.Send(Event{
+		"type":           "input_audio_buffer.speech_started",
+		"audio_start_ms": 0,
+		"item_id":        c.nextID("item"),
+	})
+}
+
+// EmitSpeechStopped 模拟服务端 VAD 检测到用户停止说话
+func (c *Conn) EmitSpeechStopped() error {
+	return c.Send(Event{
+		"type":         "input_audio_buffer.speech_stopped",
+		"audio_end_ms": 0,
+		"item_id":      c.nextID("item"),
+	})
+}
+
+// EmitTranscription 模拟一段用户语音的转写：delta 后跟 completed
+func (c *Conn) EmitTranscription(transcript string) error {
+	itemID := c.nextID("item")
+	if err := c.Send(Event{
+		"type":          "conversation.item.input_audio_transcription.delta",
+		"item_id":       itemID,
+		"content_index": 0,
+		"delta":         transcript,
+	}); err != nil {
+		return err
+	}
+	return c.Send(Event{
+		"type":          "conversation.item.input_audio_transcription.completed",
+		"item_id":       itemID,
+		"content_index": 0,
+		"transcript":    transcript,
+	})
+}
+
+// EmitFunctionCall 在一个独立响应中输出函数调用（不需要客户端先发 response.create）
+func (c *Conn) EmitFunctionCall(call FunctionCall) error {
+	return c.play(Response{FunctionCall: &call}, nil, c.beginResponse())
+}
+
+func (c *Conn) nextID(prefix string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	return fmt.Sprintf("%s_%s_%d", prefix, c.ID, c.seq)
+}
+
+func (c *Conn) record(evt Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.received = append(c.received, evt)
+	close(c.arrived)
+	c.arrived = make(chan struct{})
+}
+
+func (c *Conn) readLoop() {
+	defer c.Close()
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var evt Event
+		if err := json.Unmarshal(data, &evt); err != nil {
+			c.sendError("invalid_request_error", "invalid_json", err.Error())
+			continue
+		}
+		c.record(evt)
+		c.handle(evt)
+	}
+}
+
+func (c *Conn) handle(evt Event) {
+	switch evt.Type() {
+	case "session.update":
+		session, _ := evt["session"].(map[string]interface{})
+		c.mu.Lock()
+		c.session = session
+		c.mu.Unlock()
+		c.Send(Event{"type": "session.updated", "session": session})
+
+	case "conversation.item.create":
+		item, _ := evt["item"].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+		}
+		if _, ok := item["id"]; !ok {
+			item["id"] = c.nextID("item")
+		}
+		id, _ := item["id"].(string)
+		c.addItem(id)
+		c.Send(Event{"type": "conversation.item.created", "item": item})
+
+	case "conversation.item.delete":
+		id, _ := evt["item_id"].(string)
+		c.mu.Lock()
+		found := false
+		for i, existing := range c.items {
+			if existing == id {
+				c.items = append(c.items[:i], c.items[i+1:]...)
+				found = true
+				break
+			}
+		}
+		c.mu.Unlock()
+		if !found {
+			c.sendError("invalid_request_error", "item_not_found", "Item with item_id not found: "+id)
+			return
+		}
+		c.Send(Event{"type": "conversation.item.deleted", "item_id": id})
+
+	case "input_audio_buffer.append":
+		audio, _ := evt["audio"].(string)
+		c.mu.Lock()
+		c.audioBytes += decodedLen(audio)
+		c.mu.Unlock()
+
+	case "input_audio_buffer.commit":
+		id := c.nextID("item")
+		c.addItem(id)
+		c.Send(Event{"type": "input_audio_buffer.committed", "item_id": id})
+
+	case "input_audio_buffer.clear":
+		c.Send(Event{"type": "input_audio_buffer.cleared"})
+
+	case "response.create":
+		resp := c.server.currentResponder()(c, evt)
+		var metadata interface{}
+		if r, ok := evt["response"].(map[string]interface{}); ok {
+			metadata = r["metadata"]
+		}
+		active := c.beginResponse()
+		go c.play(resp, metadata, active)
+
+	case "response.cancel":
+		c.mu.Lock()
+		active := c.active
+		c.mu.Unlock()
+		if id, _ := evt["response_id"].(string); active == nil || (id != "" && id != active.id) {
+			c.sendError("invalid_request_error", "response_cancel_not_active", "Cancellation failed: no active response found")
+			return
+		}
+		active.cancel()
+
+	default:
+		c.sendError("invalid_request_error", "unknown_event", "Unsupported event type: "+evt.Type())
+	}
+}
+
+func (c *Conn) sendError(errType, code, message string) {
+	c.Send(Event{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    errType,
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+// beginResponse 登记一个新的进行中响应（同一连接上后来者覆盖先来者，与真实服务一致地只允许取消最新的）
+func (c *Conn) beginResponse() *activeResponse {
+	r := &activeResponse{id: c.nextID("resp"), cancelled: make(chan struct{})}
+	c.mu.Lock()
+	c.active = r
+	c.mu.Unlock()
+	return r
+}
+
+func (c *Conn) endResponse(r *activeResponse) {
+	c.mu.Lock()
+	if c.active == r {
+		c.active = nil
+	}
+	c.mu.Unlock()
+}
+
+// play 按脚本回放一次响应；被取消时以 status=cancelled 的 response.done 结束
+func (c *Conn) play(resp Response, metadata interface{}, active *activeResponse) error {
+	defer c.endResponse(active)
+
+	responseID := active.id
+	itemID := c.nextID("item")
+	c.addItem(itemID)
+	chunks := resp.Chunks
+	if chunks <= 0 {
+		chunks = 1
+	}
+
+	created := map[string]interface{}{"id": responseID, "object": "realtime.response", "status": "in_progress"}
+	if metadata != nil {
+		created["metadata"] = metadata
+	}
+	if err := c.Send(Event{"type": "response.created", "response": created}); err != nil {
+		return err
+	}
+
+	base := func(eventType string) Event {
+		return Event{"type": eventType, "response_id": responseID, "item_id": itemID, "output_index": 0, "content_index": 0}
+	}
+
+	// 函数调用输出
+	if call := resp.FunctionCall; call != nil {
+		callID := call.CallID
+		if callID == "" {
+			callID = c.nextID("call")
+		}
+		item := map[string]interface{}{
+			"id": itemID, "type": "function_call", "status": "completed",
+			"name": call.Name, "call_id": callID, "arguments": call.Arguments,
+		}
+		c.Send(Event{"type": "response.output_item.added", "response_id": responseID, "output_index": 0, "item": item})
+		for _, part := range split(call.Arguments, chunks) {
+			evt := base("response.function_call_arguments.delta")
+			evt["call_id"] = callID
+			evt["delta"] = part
+			c.Send(evt)
+		}
+		done := base("response.function_call_arguments.done")
+		done["call_id"] = callID
+		done["name"] = call.Name
+		done["arguments"] = call.Arguments
+		c.Send(done)
+		c.Send(Event{"type": "response.output_item.done", "response_id": responseID, "output_index": 0, "item": item})
+		return c.sendResponseDone(responseID, "completed", metadata, []interface{}{item}, resp.Usage, call.Arguments)
+	}
+
+	c.Send(Event{
+		"type": "response.output_item.added", "response_id": responseID, "output_index": 0,
+		"item": map[string]interface{}{"id": itemID, "type": "message", "role": "assistant", "status": "in_progress"},
+	})
+
+	transcriptParts := split(resp.Transcript, chunks)
+	textParts := split(resp.Text, chunks)
+	audioParts := splitBytes(resp.Audio, chunks)
+
+	var sentTranscript, sentText strings.Builder
+	status := "completed"
+	for i := 0; i < chunks; i++ {
+		if i > 0 && resp.ChunkDelay > 0 {
+			select {
+			case <-time.After(resp.ChunkDelay):
+			case <-active.cancelled:
+			case <-c.closed:
+				return nil
+			}
+		}
+		select {
+		case <-active.cancelled:
+			status = "cancelled"
+		default:
+		}
+		if status == "cancelled" {
+			break
+		}
+
+		if i < len(textParts) && textParts[i] != "" {
+			evt := base("response.text.delta")
+			evt["delta"] = textParts[i]
+			c.Send(evt)
+			sentText.WriteString(textParts[i])
+		}
+		if i < len(transcriptParts) && transcriptParts[i] != "" {
+			evt := base("response.audio_transcript.delta")
+			evt["delta"] = transcriptParts[i]
+			c.Send(evt)
+			sentTranscript.WriteString(transcriptParts[i])
+		}
+		if i < len(audioParts) && len(audioParts[i]) > 0 {
+			evt := base("response.audio.delta")
+			evt["delta"] = encodeBase64(audioParts[i])
+			c.Send(evt)
+		}
+	}
+
+	if status == "completed" {
+		if resp.Text != "" {
+			evt := base("response.text.done")
+			evt["text"] = resp.Text
+			c.Send(evt)
+		}
+		if len(resp.Audio) > 0 {
+			c.Send(base("response.audio.done"))
+		}
+		if resp.Transcript != "" {
+			evt := base("response.audio_transcript.done")
+			evt["transcript"] = resp.Transcript
+			c.Send(evt)
+		}
+	}
+
+	var content []interface{}
+	if sentText.Len() > 0 {
+		content = append(content, map[string]interface{}{"type": "text", "text": sentText.String()})
+	}
+	if sentTranscript.Len() > 0 || len(resp.Audio) > 0 {
+		content = append(content, map[string]interface{}{"type": "audio", "transcript": sentTranscript.String()})
+	}
+	item := map[string]interface{}{"id": itemID, "type": "message", "role": "assistant", "status": status, "content": content}
+	c.Send(Event{"type": "response.output_item.done", "response_id": responseID, "output_index": 0, "item": item})
+
+	return c.sendResponseDone(responseID, status, metadata, []interface{}{item}, resp.Usage, sentText.String()+sentTranscript.String())
+}
+
+func (c *Conn) sendResponseDone(responseID, status string, metadata interface{}, output []interface{}, usage *Usage, outputText string) error {
+	if usage == nil {
+		// 粗略估算：足够让用量统计链路跑通
+		out := len([]rune(outputText))
+		usage = &Usage{InputTokens: 10, OutputTokens: out, TotalTokens: 10 + out}
+	}
+	response := map[string]interface{}{
+		"id":     responseID,
+		"object": "realtime.response",
+		"status": status,
+		"output": output,
+		"usage":  usage,
+	}
+	if metadata != nil {
+		response["metadata"] = metadata
+	}
+	return c.Send(Event{"type": "response.done", "response": response})
+}
+
+// split 把字符串按字符均分成 n 段（不足 n 个字符时段数更少）
+func split(s string, n int) []string {
+	if s == "" {
+		return nil
+	}
+	runes := []rune(s)
+	if n > len(runes) {
+		n = len(runes)
+	}
+	parts := make([]string, 0, n)
+	size := (len(runes) + n - 1) / n
+	for i := 0; i < len(runes); i += size {
+		end := min(i+size, len(runes))
+		parts = append(parts, string(runes[i:end]))
+	}
+	return parts
+}
+
+func splitBytes(b []byte, n int) [][]byte {
+	if len(b) == 0 {
+		return nil
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+	parts := make([][]byte, 0, n)
+	size := (len(b) + n - 1) / n
+	for i := 0; i < len(b); i += size {
+		parts = append(parts, b[i:min(i+size, len(b))])
+	}
+	return parts
+}
+
+func encodeBase64(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decodedLen(s string) int {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
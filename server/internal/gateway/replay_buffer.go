@@ -0,0 +1,69 @@
+package gateway
+
+import "sync"
+
+// defaultReplayBufferSize 默认保留最近多少条下行 JSON 消息用于断线续传
+const defaultReplayBufferSize = 256
+
+// replayBuffer 有界环形缓冲：按 seq 保存已序列化的 ServerMessage，供客户端重连后补发。
+// 只缓存 JSON 事件；音频二进制帧不缓存（过期音频补播没有意义，断线期间的发言以 assistant_text 为准）。
+type replayBuffer struct {
+	mu      sync.Mutex
+	entries []replayEntry
+	start   int // 最旧一条在 entries 中的位置
+	size    int
+}
+
+type replayEntry struct {
+	seq  int64
+	data []byte
+}
+
+func newReplayBuffer(capacity int) *replayBuffer {
+	if capacity <= 0 {
+		capacity = defaultReplayBufferSize
+	}
+	return &replayBuffer{entries: make([]replayEntry, capacity)}
+}
+
+// add 追加一条消息；满了覆盖最旧的一条
+func (b *replayBuffer) add(seq int64, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	capacity := len(b.entries)
+	if b.size < capacity {
+		b.entries[(b.start+b.size)%capacity] = replayEntry{seq: seq, data: data}
+		b.size++
+		return
+	}
+	b.entries[b.start] = replayEntry{seq: seq, data: data}
+	b.start = (b.start + 1) % capacity
+}
+
+// since 返回 seq > lastSeq 的所有消息（按 seq 递增）。
+// complete=false 表示缓冲区已覆盖掉客户端缺失的部分，或 lastSeq 不属于本网关的序号空间，
+// 调用方需要用 Timeline 兜底重建。
+func (b *replayBuffer) since(lastSeq int64) (out [][]byte, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.size == 0 {
+		return nil, lastSeq == 0
+	}
+
+	capacity := len(b.entries)
+	oldest := b.entries[b.start].seq
+	newest := b.entries[(b.start+b.size-1)%capacity].seq
+	if lastSeq > newest {
+		return nil, false
+	}
+
+	for i := 0; i < b.size; i++ {
+		entry := b.entries[(b.start+i)%capacity]
+		if entry.seq > lastSeq {
+			out = append(out, entry.data)
+		}
+	}
+	return out, lastSeq >= oldest-1
+}
@@ -0,0 +1,44 @@
+package gateway
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReplayBuffer_Since(t *testing.T) {
+	b := newReplayBuffer(3)
+
+	if out, complete := b.since(0); len(out) != 0 || !complete {
+		t.Fatalf("empty buffer: out=%d complete=%v", len(out), complete)
+	}
+	if _, complete := b.since(5); complete {
+		t.Fatal("empty buffer with lastSeq>0 should be incomplete")
+	}
+
+	for seq := int64(1); seq <= 5; seq++ {
+		b.add(seq, []byte(fmt.Sprint(seq)))
+	}
+
+	// 缓冲里是 3,4,5
+	cases := []struct {
+		lastSeq  int64
+		want     string
+		complete bool
+	}{
+		{2, "345", true},
+		{4, "5", true},
+		{5, "", true},
+		{1, "345", false}, // 2 已被淘汰
+		{9, "", false},    // 不属于本网关的序号
+	}
+	for _, tc := range cases {
+		out, complete := b.since(tc.lastSeq)
+		got := ""
+		for _, data := range out {
+			got += string(data)
+		}
+		if got != tc.want || complete != tc.complete {
+			t.Errorf("since(%d) = %q,%v want %q,%v", tc.lastSeq, got, complete, tc.want, tc.complete)
+		}
+	}
+}
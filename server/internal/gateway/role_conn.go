@@ -1,12 +1,16 @@
 package gateway
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"bubble-talk/server/internal/tool"
@@ -44,11 +48,48 @@ type RoleConn struct {
 	config RoleConnConfig
 
 	logger *log.Logger
+
+	// 读泵（见 readPump）：底层连接只有一个读者，消息经 incoming 交给当前使用方。
+	// 连接在会话之间复用（WarmPool）时，detach 关闭即让上一个使用方的 ReadMessage 返回 errRoleConnReleased。
+	incoming  chan roleConnMessage
+	readErr   error
+	readDone  chan struct{}
+	detach    chan struct{}
+	connected time.Time
+	lastPong  atomic.Int64 // UnixNano
+
+	// 保活（见 SetKeepalive）：按周期 ping，读超过 roleConnReadTimeoutFactor 个周期没有任何帧（含 pong）判定断线
+	keepalive     atomic.Int64 // time.Duration，0 表示关闭
+	keepaliveOnce sync.Once
+
+	// 服务端对话里现存的 item（复用连接前逐个删除，见 resetConversation）
+	itemsMu sync.Mutex
+	items   map[string]struct{}
+}
+
+// roleConnMessage 读泵读到的一条消息
+type roleConnMessage struct {
+	messageType int
+	data        []byte
 }
 
+// errRoleConnReleased 连接已归还 WarmPool，原使用方不能再读
+var errRoleConnReleased = errors.New("role conn released to warm pool")
+
+// errRoleConnClosed 连接已被本地关闭
+var errRoleConnClosed = errors.New("role conn closed")
+
+// roleConnReadTimeoutFactor 读超时 = 保活周期 × 该系数（容忍偶发丢一两个 pong）
+const roleConnReadTimeoutFactor = 3
+
+// roleConnPingTimeout ping 控制帧的写超时
+const roleConnPingTimeout = 5 * time.Second
+
 // RoleConnConfig 单个角色连接的配置
 type RoleConnConfig struct {
 	OpenAIAPIKey                 string
+	RealtimeURL                  string            // 为空时使用官方端点；未带 model 参数时自动补上 Model
+	RealtimeHeaders              map[string]string // 额外握手头（覆盖默认头；值为空表示删除该头）
 	Model                        string
 	Voice                        string
 	Instructions                 string
@@ -71,21 +112,22 @@ func NewRoleConn(role string, voice string, config RoleConnConfig) *RoleConn {
 		closeChan: make(chan struct{}),
 		config:    config,
 		logger:    log.Default(),
+		detach:    make(chan struct{}),
+		items:     make(map[string]struct{}),
 	}
 }
 
 // Connect 连接到 OpenAI Realtime API（带重试）
 func (rc *RoleConn) Connect(ctx context.Context) error {
-	url := fmt.Sprintf("wss://api.openai.com/v1/realtime?model=%s", rc.config.Model)
-	if rc.config.Model == "" {
-		url = "wss://api.openai.com/v1/realtime?model=gpt-4o-realtime-preview-2024-12-17"
+	model := rc.config.Model
+	if model == "" {
+		model = "gpt-4o-realtime-preview-2024-12-17"
 	}
+	url := resolveRealtimeURL(rc.config.RealtimeURL, model)
 
 	rc.logger.Printf("[RoleConn:%s] Connecting to: %s with voice: %s", rc.role, url, rc.voice)
 
-	headers := make(map[string][]string)
-	headers["Authorization"] = []string{"Bearer " + rc.config.OpenAIAPIKey}
-	headers["OpenAI-Beta"] = []string{"realtime=v1"}
+	headers := realtimeHeaders(rc.config.OpenAIAPIKey, rc.config.RealtimeHeaders)
 
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 15 * time.Second,
@@ -131,14 +173,151 @@ func (rc *RoleConn) Connect(ctx context.Context) error {
 		}
 	}
 
+	conn.SetPongHandler(func(string) error {
+		rc.lastPong.Store(time.Now().UnixNano())
+		// pong 也算活着：只收到 pong 的安静期不应触发读超时
+		if timeout := rc.readTimeout(); timeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		}
+		return nil
+	})
+
 	rc.connLock.Lock()
 	rc.conn = conn
+	rc.connected = time.Now()
+	rc.incoming = make(chan roleConnMessage, 64)
+	rc.readDone = make(chan struct{})
 	rc.connLock.Unlock()
+	rc.lastPong.Store(time.Now().UnixNano())
+
+	go rc.readPump(conn)
 
 	rc.logger.Printf("[RoleConn:%s] ✅ Connected successfully", rc.role)
 	return nil
 }
 
+// readPump 持续读取底层连接，记录对话 item 后交给 incoming；读失败时关闭 incoming
+func (rc *RoleConn) readPump(conn *websocket.Conn) {
+	defer close(rc.readDone)
+	defer close(rc.incoming)
+
+	for {
+		if timeout := rc.readTimeout(); timeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		} else {
+			_ = conn.SetReadDeadline(time.Time{})
+		}
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			rc.readErr = err
+			return
+		}
+		if messageType == websocket.TextMessage {
+			rc.trackConversationItem(data)
+		}
+		select {
+		case rc.incoming <- roleConnMessage{messageType: messageType, data: data}:
+		case <-rc.closeChan:
+			rc.readErr = errRoleConnClosed
+			return
+		}
+	}
+}
+
+// SetKeepalive 开启保活：每个周期发送一次 ping，并给读设置超时（周期 × roleConnReadTimeoutFactor）。
+// 半开连接（对端消失但 TCP 没断）因此能被及时发现，而不是一直等不到 response.done。interval<=0 关闭。
+func (rc *RoleConn) SetKeepalive(interval time.Duration) {
+	if interval < 0 {
+		interval = 0
+	}
+	rc.keepalive.Store(int64(interval))
+	if interval > 0 {
+		rc.keepaliveOnce.Do(func() { go rc.keepaliveLoop() })
+	}
+}
+
+func (rc *RoleConn) readTimeout() time.Duration {
+	return time.Duration(rc.keepalive.Load()) * roleConnReadTimeoutFactor
+}
+
+// keepaliveLoop 按保活周期发送 ping，直到连接关闭
+func (rc *RoleConn) keepaliveLoop() {
+	for {
+		interval := time.Duration(rc.keepalive.Load())
+		if interval <= 0 {
+			return
+		}
+		select {
+		case <-rc.closeChan:
+			return
+		case <-time.After(interval):
+		}
+		if err := rc.ping(roleConnPingTimeout); err != nil {
+			rc.logger.Printf("[RoleConn:%s] ⚠️  Keepalive ping failed: %v", rc.role, err)
+		}
+	}
+}
+
+// classifyReadError 判断读错误的类别与是否值得重连。
+// 本地关闭、归还预热池不重连；读超时（保活失败）、对端关闭、网络错误都重连。
+func (rc *RoleConn) classifyReadError(err error) (reason string, retryable bool) {
+	select {
+	case <-rc.closeChan:
+		return "closed", false
+	default:
+	}
+
+	var netErr net.Error
+	var closeErr *websocket.CloseError
+	switch {
+	case errors.Is(err, errRoleConnReleased):
+		return "released", false
+	case errors.Is(err, errRoleConnClosed):
+		return "closed", false
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout", true
+	case errors.As(err, &closeErr):
+		return fmt.Sprintf("remote_closed_%d", closeErr.Code), true
+	default:
+		return "network", true
+	}
+}
+
+// trackConversationItem 维护服务端对话中的 item 集合（只解析与 item 相关的事件，音频增量直接跳过）
+func (rc *RoleConn) trackConversationItem(data []byte) {
+	if !bytes.Contains(data, []byte(`"conversation.item.`)) &&
+		!bytes.Contains(data, []byte(`"response.output_item.added"`)) &&
+		!bytes.Contains(data, []byte(`"input_audio_buffer.committed"`)) {
+		return
+	}
+
+	var event struct {
+		Type   string `json:"type"`
+		ItemID string `json:"item_id"`
+		Item   struct {
+			ID string `json:"id"`
+		} `json:"item"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return
+	}
+
+	rc.itemsMu.Lock()
+	defer rc.itemsMu.Unlock()
+	switch event.Type {
+	case "conversation.item.created", "response.output_item.added":
+		if event.Item.ID != "" {
+			rc.items[event.Item.ID] = struct{}{}
+		}
+	case "input_audio_buffer.committed":
+		if event.ItemID != "" {
+			rc.items[event.ItemID] = struct{}{}
+		}
+	case "conversation.item.deleted":
+		delete(rc.items, event.ItemID)
+	}
+}
+
 // Initialize 初始化会话配置（固定 voice）
 func (rc *RoleConn) Initialize(ctx context.Context) error {
 	// 构造 session.update 指令，固定 voice
@@ -161,15 +340,14 @@ func (rc *RoleConn) Initialize(ctx context.Context) error {
 		Temperature: 0.8,
 	}
 
-	// 如果有工具注册表，添加工具定义
+	// 工具定义总是下发：没有工具时发空数组，复用的连接不会留着上一个会话的工具
+	sessionConfig.Tools = []interface{}{}
 	if rc.toolRegistry != nil {
 		toolDefs := rc.toolRegistry.GetAllDefinitions()
+		for _, def := range toolDefs {
+			sessionConfig.Tools = append(sessionConfig.Tools, def)
+		}
 		if len(toolDefs) > 0 {
-			tools := make([]interface{}, len(toolDefs))
-			for i, def := range toolDefs {
-				tools[i] = def
-			}
-			sessionConfig.Tools = tools
 			rc.logger.Printf("[RoleConn:%s] 🔧 Registered %d tools to session", rc.role, len(toolDefs))
 		}
 	}
@@ -228,22 +406,137 @@ func (rc *RoleConn) SendMessage(msg interface{}) error {
 // ReadMessage 从 OpenAI Realtime 读取消息
 func (rc *RoleConn) ReadMessage() (int, []byte, error) {
 	rc.connLock.Lock()
-	conn := rc.conn
+	incoming := rc.incoming
+	detach := rc.detach
 	rc.connLock.Unlock()
 
-	if conn == nil {
+	if incoming == nil {
 		return 0, nil, fmt.Errorf("connection not established")
 	}
 
-	return conn.ReadMessage()
+	select {
+	case msg, ok := <-incoming:
+		if !ok {
+			return 0, nil, rc.readErr
+		}
+		return msg.messageType, msg.data, nil
+	case <-detach:
+		return 0, nil, errRoleConnReleased
+	case <-rc.closeChan:
+		return 0, nil, errRoleConnClosed
+	}
+}
+
+// detachReader 让当前使用方阻塞中的 ReadMessage 立即返回 errRoleConnReleased（连接归还 WarmPool 时调用）
+func (rc *RoleConn) detachReader() {
+	rc.connLock.Lock()
+	close(rc.detach)
+	rc.detach = make(chan struct{})
+	rc.connLock.Unlock()
+}
+
+// discardUntil 丢弃读到的消息直到 stop 关闭或连接断开（空闲连接留在池中时由 WarmPool 调用）
+func (rc *RoleConn) discardUntil(stop <-chan struct{}) {
+	rc.connLock.Lock()
+	incoming := rc.incoming
+	rc.connLock.Unlock()
+	if incoming == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case _, ok := <-incoming:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// alive 连接已建立、未关闭且读泵仍在运行
+func (rc *RoleConn) alive() bool {
+	rc.connLock.Lock()
+	conn, readDone := rc.conn, rc.readDone
+	rc.connLock.Unlock()
+	if conn == nil || readDone == nil {
+		return false
+	}
+	select {
+	case <-readDone:
+		return false
+	case <-rc.closeChan:
+		return false
+	default:
+		return true
+	}
+}
+
+// ping 发送 WebSocket ping；对应的 pong 由读泵处理并刷新 lastPong
+func (rc *RoleConn) ping(timeout time.Duration) error {
+	rc.connLock.Lock()
+	conn := rc.conn
+	rc.connLock.Unlock()
+	if conn == nil {
+		return fmt.Errorf("connection not established")
+	}
+	return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(timeout))
+}
+
+// lastPongAt 最近一次收到 pong 的时间（连接建立时初始化为建连时间）
+func (rc *RoleConn) lastPongAt() time.Time {
+	return time.Unix(0, rc.lastPong.Load())
+}
+
+// connectedAt 建连时间
+func (rc *RoleConn) connectedAt() time.Time {
+	rc.connLock.Lock()
+	defer rc.connLock.Unlock()
+	return rc.connected
+}
+
+// resetConversation 删除服务端对话中的全部 item，并清掉上一个使用方留下的响应状态。
+// Realtime 没有“清空对话”的事件，只能按 conversation.item.delete 逐个删除。
+func (rc *RoleConn) resetConversation() error {
+	rc.itemsMu.Lock()
+	ids := make([]string, 0, len(rc.items))
+	for id := range rc.items {
+		ids = append(ids, id)
+	}
+	rc.items = make(map[string]struct{})
+	rc.itemsMu.Unlock()
+
+	rc.ClearActiveResponse()
+	_ = rc.GetPendingMetadata()
+
+	for _, id := range ids {
+		if err := rc.SendMessage(map[string]interface{}{
+			"type":    "conversation.item.delete",
+			"item_id": id,
+		}); err != nil {
+			return fmt.Errorf("delete item %s: %w", id, err)
+		}
+	}
+	if len(ids) > 0 {
+		rc.logger.Printf("[RoleConn:%s] 🧹 Deleted %d conversation items", rc.role, len(ids))
+	}
+	return nil
 }
 
 // SyncUserText 同步用户文本到该连接的对话历史
 // 这是实现"共享对话"的关键：所有角色连接都会收到用户说了什么
 func (rc *RoleConn) SyncUserText(text string) error {
+	return rc.syncUserText("", text)
+}
+
+// syncUserText 同 SyncUserText，itemID 非空时用它作为 item ID（便于之后按 ID 删除）
+func (rc *RoleConn) syncUserText(itemID string, text string) error {
 	item := RealtimeConversationItemCreate{
 		Type: "conversation.item.create",
 		Item: RealtimeConversationItem{
+			ID:   itemID,
 			Type: "message",
 			Role: "user",
 			Content: []RealtimeContentPart{
@@ -262,6 +555,11 @@ func (rc *RoleConn) SyncUserText(text string) error {
 // SyncAssistantText 同步助手文本到该连接的对话历史
 // 这确保所有角色都能"看到"其他角色说了什么
 func (rc *RoleConn) SyncAssistantText(text string, fromRole string) error {
+	return rc.syncAssistantText("", text, fromRole)
+}
+
+// syncAssistantText 同 SyncAssistantText，itemID 非空时用它作为 item ID
+func (rc *RoleConn) syncAssistantText(itemID string, text string, fromRole string) error {
 	// 如果是自己说的，不需要同步（已经在对话历史中了）
 	if fromRole == rc.role {
 		rc.logger.Printf("[RoleConn:%s] Skip syncing own message", rc.role)
@@ -271,6 +569,7 @@ func (rc *RoleConn) SyncAssistantText(text string, fromRole string) error {
 	item := RealtimeConversationItemCreate{
 		Type: "conversation.item.create",
 		Item: RealtimeConversationItem{
+			ID:   itemID,
 			Type: "message",
 			Role: "assistant",
 			Content: []RealtimeContentPart{
@@ -286,6 +585,45 @@ func (rc *RoleConn) SyncAssistantText(text string, fromRole string) error {
 	return rc.SendMessage(item)
 }
 
+// syncSummaryText 把对话摘要作为 system item 插到对话最前面
+func (rc *RoleConn) syncSummaryText(itemID string, text string) error {
+	item := RealtimeConversationItemCreate{
+		Type:           "conversation.item.create",
+		PreviousItemID: "root",
+		Item: RealtimeConversationItem{
+			ID:   itemID,
+			Type: "message",
+			Role: "system",
+			Content: []RealtimeContentPart{
+				{
+					Type: "input_text",
+					Text: text,
+				},
+			},
+		},
+	}
+
+	rc.logger.Printf("[RoleConn:%s] Syncing history summary (len=%d)", rc.role, len(text))
+	return rc.SendMessage(item)
+}
+
+// deleteItems 删除服务端对话中的指定 item（历史滑出窗口时调用）
+func (rc *RoleConn) deleteItems(ids []string) error {
+	var lastErr error
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if err := rc.SendMessage(map[string]interface{}{
+			"type":    "conversation.item.delete",
+			"item_id": id,
+		}); err != nil {
+			lastErr = fmt.Errorf("delete item %s: %w", id, err)
+		}
+	}
+	return lastErr
+}
+
 // CreateResponse 在该连接上创建响应（生成该角色的语音）
 func (rc *RoleConn) CreateResponse(instructions string, metadata map[string]interface{}) error {
 	create := RealtimeResponseCreate{
@@ -360,6 +698,12 @@ func (rc *RoleConn) GetPendingMetadata() map[string]interface{} {
 	return metadata
 }
 
+// assign 把连接交给新的角色（WarmPool 租出时调用，之后由 Initialize 下发新的 session 配置）
+func (rc *RoleConn) assign(role string, config RoleConnConfig) {
+	rc.role = role
+	rc.config = config
+}
+
 // SetToolRegistry 设置工具注册表
 func (rc *RoleConn) SetToolRegistry(registry *tool.ToolRegistry) {
 	rc.toolRegistry = registry
@@ -2,8 +2,12 @@ package gateway
 
 import (
 	"context"
+	"io"
+	"os"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 // TestRoleConnCreation 测试 RoleConn 创建
@@ -341,3 +345,31 @@ func TestRoleConnMultipleVoices(t *testing.T) {
 		})
 	}
 }
+
+func TestRoleConnClassifyReadError(t *testing.T) {
+	rc := NewRoleConn("host", "cedar", RoleConnConfig{})
+
+	cases := []struct {
+		err       error
+		reason    string
+		retryable bool
+	}{
+		{errRoleConnReleased, "released", false},
+		{errRoleConnClosed, "closed", false},
+		{os.ErrDeadlineExceeded, "timeout", true},
+		{&websocket.CloseError{Code: websocket.CloseGoingAway}, "remote_closed_1001", true},
+		{io.ErrUnexpectedEOF, "network", true},
+	}
+	for _, c := range cases {
+		reason, retryable := rc.classifyReadError(c.err)
+		if reason != c.reason || retryable != c.retryable {
+			t.Errorf("classify(%v) = %s,%v want %s,%v", c.err, reason, retryable, c.reason, c.retryable)
+		}
+	}
+
+	// 本地已关闭的连接一律不重连
+	_ = rc.Close()
+	if reason, retryable := rc.classifyReadError(io.ErrUnexpectedEOF); reason != "closed" || retryable {
+		t.Errorf("closed conn classify = %s,%v", reason, retryable)
+	}
+}
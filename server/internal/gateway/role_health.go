@@ -0,0 +1,173 @@
+package gateway
+
+import (
+	"time"
+)
+
+// 角色连接健康状态（role_health 事件的 status）
+const (
+	roleHealthDisconnected = "disconnected" // 读失败/保活超时，连接已断
+	roleHealthReconnecting = "reconnecting" // 正在重连（metadata.attempt 为第几次）
+	roleHealthHealthy      = "healthy"      // 重连成功，session 与对话历史已恢复
+	roleHealthUnavailable  = "unavailable"  // 重连全部失败，后台按退避间隔继续重试，恢复后再发 healthy
+)
+
+// asrHealthRole ASR 连接在 role_health 事件里的 role
+const asrHealthRole = "asr"
+
+// defaultRoleReconnectAttempts 角色连接断线后的默认重连次数
+const defaultRoleReconnectAttempts = 3
+
+// 重连全部失败后的后台重试间隔：从 defaultRoleRecoveryInterval 起逐次翻倍，封顶 maxRoleRecoveryInterval
+const (
+	defaultRoleRecoveryInterval = 5 * time.Second
+	maxRoleRecoveryInterval     = time.Minute
+)
+
+// speechDropRoleUnavailable 角色不可用时丢弃其发言
+const speechDropRoleUnavailable = "role_unavailable"
+
+// reconnectRole 角色连接断线后重建连接，返回新连接；只有网关关闭时返回 nil。
+// 该角色正在说话时先结束本次发言（前端收到 tts_interrupted），让发言队列继续推进。
+// 重连全部失败时该角色标记为不可用、丢弃其排队的发言，并转入后台退避重试，恢复后继续使用。
+func (g *MultiVoiceGateway) reconnectRole(role string, reason string) *RoleConn {
+	g.sendRoleHealth(role, roleHealthDisconnected, reason, 0)
+	g.endSpeechOnDisconnect(role)
+
+	attempts := g.roleReconnectAttempts()
+	conn, err := g.voicePool.ReconnectRole(g.ctx, role, attempts, func(attempt int) {
+		g.sendRoleHealth(role, roleHealthReconnecting, reason, attempt)
+	})
+	if err != nil {
+		select {
+		case <-g.closeChan:
+			return nil
+		default:
+		}
+		g.logger.Printf("[MultiVoiceGateway] ❌ Role %s unavailable: %v", role, err)
+		g.sendRoleHealth(role, roleHealthUnavailable, reason, attempts)
+		g.dropRoleSpeech(role)
+
+		conn = g.recoverConn(role, func() (*RoleConn, error) {
+			return g.voicePool.ReconnectRole(g.ctx, role, 1, nil)
+		})
+		if conn == nil {
+			return nil
+		}
+	}
+
+	g.sendRoleHealth(role, roleHealthHealthy, reason, 0)
+	return conn
+}
+
+// reconnectASR ASR 连接断线后重建（没有它就听不到学习者说话），返回新连接；只有网关关闭时返回 nil。
+// 重连全部失败时同样转入后台退避重试。
+func (g *MultiVoiceGateway) reconnectASR(reason string) *RoleConn {
+	g.sendRoleHealth(asrHealthRole, roleHealthDisconnected, reason, 0)
+
+	attempts := g.roleReconnectAttempts()
+	conn, err := g.voicePool.ReconnectASR(g.ctx, attempts, func(attempt int) {
+		g.sendRoleHealth(asrHealthRole, roleHealthReconnecting, reason, attempt)
+	})
+	if err != nil {
+		select {
+		case <-g.closeChan:
+			return nil
+		default:
+		}
+		g.logger.Printf("[MultiVoiceGateway] ❌ ASR unavailable: %v", err)
+		g.sendRoleHealth(asrHealthRole, roleHealthUnavailable, reason, attempts)
+
+		conn = g.recoverConn(asrHealthRole, func() (*RoleConn, error) {
+			return g.voicePool.ReconnectASR(g.ctx, 1, nil)
+		})
+		if conn == nil {
+			return nil
+		}
+	}
+
+	select {
+	case <-g.closeChan:
+		// 重连期间网关已关闭：VoicePool 已经关过连接，新建的这条要自己关掉
+		_ = conn.Close()
+		return nil
+	default:
+	}
+	g.sendRoleHealth(asrHealthRole, roleHealthHealthy, reason, 0)
+	return conn
+}
+
+// roleReconnectAttempts 断线后立即重连的次数
+func (g *MultiVoiceGateway) roleReconnectAttempts() int {
+	if g.config.RoleReconnectAttempts > 0 {
+		return g.config.RoleReconnectAttempts
+	}
+	return defaultRoleReconnectAttempts
+}
+
+// recoverConn 重连全部失败后按退避间隔继续重试 reconnect，直到成功或网关关闭（返回 nil）
+func (g *MultiVoiceGateway) recoverConn(role string, reconnect func() (*RoleConn, error)) *RoleConn {
+	interval := g.config.RoleRecoveryInterval
+	if interval <= 0 {
+		interval = defaultRoleRecoveryInterval
+	}
+
+	for {
+		select {
+		case <-g.closeChan:
+			return nil
+		case <-time.After(interval):
+		}
+
+		conn, err := reconnect()
+		if err == nil {
+			g.logger.Printf("[MultiVoiceGateway] ✅ %s recovered by background retry", role)
+			return conn
+		}
+		if interval *= 2; interval > maxRoleRecoveryInterval {
+			interval = maxRoleRecoveryInterval
+		}
+		g.logger.Printf("[MultiVoiceGateway] ⚠️  %s still unavailable, retrying in %s: %v", role, interval, err)
+	}
+}
+
+// endSpeechOnDisconnect 断线的角色正在说话：这段话不会再有 response.done，直接按被取消结束
+func (g *MultiVoiceGateway) endSpeechOnDisconnect(role string) {
+	if g.voicePool == nil || g.voicePool.GetSpeakingRole() != role {
+		return
+	}
+	g.logger.Printf("[MultiVoiceGateway] ⚠️  Active speaker %s disconnected, ending its speech", role)
+
+	g.muteRoleAudio(role, "role_disconnected")
+	g.voicePool.ClearSpeakingRole()
+	g.sendTTSInterruptedToClient("role_disconnected")
+	g.finishRoleCaptions(role)
+	g.notifySpeechEnded(speechEnded{role: role, cancelled: true, endedAt: time.Now()})
+}
+
+// dropRoleSpeech 丢弃不可用角色排队中的发言
+func (g *MultiVoiceGateway) dropRoleSpeech(role string) {
+	g.speechMu.Lock()
+	dropped := g.speechQueue.remove(speechDropRoleUnavailable, func(req speechRequest) bool { return req.role == role })
+	g.speechMu.Unlock()
+	g.reportDroppedSpeech(dropped)
+}
+
+// sendRoleHealth 下发角色连接健康状态变化
+func (g *MultiVoiceGateway) sendRoleHealth(role string, status string, reason string, attempt int) {
+	g.logger.Printf("[MultiVoiceGateway] 🩺 Role health: role=%s status=%s reason=%s attempt=%d", role, status, reason, attempt)
+
+	metadata := map[string]interface{}{
+		"role":   role,
+		"status": status,
+		"reason": reason,
+	}
+	if attempt > 0 {
+		metadata["attempt"] = attempt
+	}
+	_ = g.sendToClient(&ServerMessage{
+		Type:     EventTypeRoleHealth,
+		Metadata: metadata,
+		ServerTS: time.Now(),
+	})
+}
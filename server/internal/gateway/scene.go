@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Scene 一次导演计划里按顺序出场的多个角色（多角色“场景”）。
+//
+// 各拍依次进入发言队列，由 speechLoop 按交接规则执行：
+//   - 上一个角色说完（response.done）后下一个角色才开口；
+//   - 拍与拍之间学习者开口：后续各拍暂停，学习者停下并过了 sceneResumeDelay 仍没有转写才继续；
+//   - 学习者打断正在说话的角色、或停顿期间的发言转写成了新的一轮：放弃剩余各拍（speech_dropped）。
+type Scene struct {
+	Beats []SceneBeat
+	// Metadata 各拍共用的调度字段（turn_id、plan_id、priority、ttl，见 SendInstructions）
+	Metadata map[string]interface{}
+}
+
+// SceneBeat 场景中的一拍：一个角色按自己的指令说一段
+type SceneBeat struct {
+	Role         string
+	Instructions string
+	// Metadata 本拍额外的 metadata（会覆盖 Scene.Metadata 的同名字段）
+	Metadata map[string]interface{}
+}
+
+// sceneResumeDelay 学习者停止说话后，场景至少再等这么久才继续下一拍，
+// 给 ASR 留出产出转写的时间：转写一到，这次发言就算打断，场景作废。
+const sceneResumeDelay = 1500 * time.Millisecond
+
+// speech_dropped 的场景相关原因
+const (
+	speechDropSceneAborted       = "scene_aborted"       // 场景中某一拍被取消（打断/抢占/超时）
+	speechDropLearnerInterrupted = "learner_interrupted" // 停顿期间学习者的发言成了新的一轮
+)
+
+// SendScene 把一个多角色场景下发到发言队列（不阻塞，同 SendInstructions）。
+// 未知角色的那一拍跳过，其余各拍照常出场；没有任何可用的拍时返回错误。
+func (g *MultiVoiceGateway) SendScene(ctx context.Context, scene Scene) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	reqs, err := sceneSpeechRequests(scene, g.config.RoleProfiles, g.newSpeechRequest, func(i int, role string) {
+		g.logger.Printf("[MultiVoiceGateway] ⚠️  Scene beat %d skipped: unknown role %s", i, role)
+	})
+	if err != nil {
+		return err
+	}
+	g.logger.Printf("[MultiVoiceGateway] 🎬 Enqueue scene %s with %d beats", reqs[0].sceneID, len(reqs))
+
+	for _, req := range reqs {
+		g.enqueueSpeech(req)
+	}
+	g.speechLoopOnce.Do(func() { go g.speechLoop() })
+	return nil
+}
+
+// sceneSpeechRequests 把场景展开为各拍的发言请求（共用同一个 scene_id，sequence/total 按可用的拍重新编号）；
+// 不在 roles 里的角色那一拍跳过并回调 skipped，没有任何可用的拍时返回错误。
+func sceneSpeechRequests(
+	scene Scene,
+	roles map[string]RoleProfile,
+	newRequest func(role string, instructions string, metadata map[string]interface{}) speechRequest,
+	skipped func(i int, role string),
+) ([]speechRequest, error) {
+	if len(scene.Beats) == 0 {
+		return nil, fmt.Errorf("scene has no beats")
+	}
+	beats := make([]SceneBeat, 0, len(scene.Beats))
+	for i, beat := range scene.Beats {
+		if _, exists := roles[beat.Role]; !exists {
+			skipped(i, beat.Role)
+			continue
+		}
+		beats = append(beats, beat)
+	}
+	if len(beats) == 0 {
+		return nil, fmt.Errorf("scene has no beats with known roles")
+	}
+
+	sceneID := fmt.Sprintf("scene_%d", time.Now().UnixNano())
+	reqs := make([]speechRequest, 0, len(beats))
+	for i, beat := range beats {
+		metadata := cloneMetadata(scene.Metadata)
+		if metadata == nil {
+			metadata = make(map[string]interface{}, len(beat.Metadata)+4)
+		}
+		metadata["sequence"] = fmt.Sprintf("%d", i)
+		metadata["total"] = fmt.Sprintf("%d", len(beats))
+		for k, v := range beat.Metadata {
+			metadata[k] = v
+		}
+		metadata["role"] = beat.Role
+		metadata["scene_id"] = sceneID
+
+		req := newRequest(beat.Role, beat.Instructions, metadata)
+		req.sceneID = sceneID
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// sceneHandoffWaitLocked 队首是场景中的一拍且学习者正在说话/刚停下时，返回还需等待的时长（调用方持有 speechMu）
+func (g *MultiVoiceGateway) sceneHandoffWaitLocked(req speechRequest, now time.Time) time.Duration {
+	if req.sceneID == "" {
+		return 0
+	}
+	if g.learnerSpeaking {
+		// speech_stopped 会 Broadcast 唤醒；这里的时长只是兜底复查（防止丢了 stopped 事件永久暂停）
+		return sceneResumeDelay
+	}
+	if g.learnerStoppedAt.IsZero() {
+		return 0
+	}
+	if wait := sceneResumeDelay - now.Sub(g.learnerStoppedAt); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// setLearnerSpeaking 记录学习者的开口/停止状态，并唤醒 speechLoop 重新检查场景交接
+func (g *MultiVoiceGateway) setLearnerSpeaking(speaking bool) {
+	g.speechMu.Lock()
+	g.learnerSpeaking = speaking
+	if !speaking {
+		g.learnerStoppedAt = time.Now()
+	}
+	g.speechMu.Unlock()
+	g.speechCond.Broadcast()
+}
+
+// dropUnscenedSpeech 丢弃不属于场景的待播请求（学习者在角色之间开口时：场景暂停，零散指令作废）
+func (g *MultiVoiceGateway) dropUnscenedSpeech(reason string) {
+	g.speechMu.Lock()
+	dropped := g.speechQueue.remove(reason, func(req speechRequest) bool { return req.sceneID == "" })
+	g.speechMu.Unlock()
+	g.reportDroppedSpeech(dropped)
+}
+
+// abortScenes 放弃场景的剩余各拍；sceneID 为空表示所有场景
+func (g *MultiVoiceGateway) abortScenes(sceneID string, reason string) {
+	g.speechMu.Lock()
+	dropped := g.speechQueue.remove(reason, func(req speechRequest) bool {
+		return req.sceneID != "" && (sceneID == "" || req.sceneID == sceneID)
+	})
+	g.speechMu.Unlock()
+
+	if len(dropped) > 0 {
+		g.logger.Printf("[MultiVoiceGateway] 🎬 Scene aborted: scene=%s dropped_beats=%d reason=%s", sceneID, len(dropped), reason)
+		g.reportDroppedSpeech(dropped)
+	}
+}
@@ -0,0 +1,254 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 发言请求的调度字段（SendInstructions 的 metadata 键）。
+// 值都是字符串：metadata 会原样作为 response.metadata 透传给 Realtime，而后者只接受字符串。
+const (
+	speechMetaTurnID   = "turn_id"  // 所属用户轮次
+	speechMetaPlanID   = "plan_id"  // 产生该发言的导演计划；同一轮次的新计划会替换旧计划尚未开播的发言
+	speechMetaPriority = "priority" // low | normal | urgent
+	speechMetaTTL      = "ttl"      // 排队超过该时长仍未开播则丢弃（如 "20s"），缺省用 GatewayConfig.SpeechTTL
+)
+
+// defaultSpeechTTL 发言请求默认的排队时限
+const defaultSpeechTTL = 60 * time.Second
+
+// speech_dropped 的原因
+const (
+	speechDropExpired    = "expired"
+	speechDropSuperseded = "superseded"
+	speechDropCancelled  = "cancelled"
+)
+
+// speechPriority 发言优先级：队列按优先级出队，同级保持 FIFO
+type speechPriority int
+
+const (
+	speechPriorityLow speechPriority = iota - 1
+	speechPriorityNormal
+	// speechPriorityUrgent 紧急插话（如质疑者打断）：排到最前，并抢占正在播的低优先级发言
+	speechPriorityUrgent
+)
+
+func parseSpeechPriority(s string) speechPriority {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "low":
+		return speechPriorityLow
+	case "urgent":
+		return speechPriorityUrgent
+	default:
+		return speechPriorityNormal
+	}
+}
+
+func (p speechPriority) String() string {
+	switch p {
+	case speechPriorityLow:
+		return "low"
+	case speechPriorityUrgent:
+		return "urgent"
+	default:
+		return "normal"
+	}
+}
+
+// droppedSpeech 一条未开播就被丢弃的发言请求
+type droppedSpeech struct {
+	req    speechRequest
+	reason string
+}
+
+// speechList 发言队列：按优先级排序，同级 FIFO。
+// 语音网关与文本网关共用这套调度规则（优先级、TTL、同轮替换、场景），队列本身不加锁，由各网关的 speechMu 保护。
+type speechList []speechRequest
+
+// newSpeechRequest 从 metadata 中解析轮次、计划、优先级与过期时间；ttl 写错时用 defaultTTL，并返回 ok=false 供调用方告警
+func newSpeechRequest(role string, instructions string, metadata map[string]interface{}, defaultTTL time.Duration) (req speechRequest, ok bool) {
+	now := time.Now()
+	req = speechRequest{
+		role:         role,
+		instructions: instructions,
+		metadata:     cloneMetadata(metadata),
+		enqueuedAt:   now,
+	}
+	req.turnID, _ = metadata[speechMetaTurnID].(string)
+	req.planID, _ = metadata[speechMetaPlanID].(string)
+	priority, _ := metadata[speechMetaPriority].(string)
+	req.priority = parseSpeechPriority(priority)
+
+	ttl := defaultTTL
+	if ttl <= 0 {
+		ttl = defaultSpeechTTL
+	}
+	ok = true
+	if s, _ := metadata[speechMetaTTL].(string); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			ttl = d
+		} else {
+			ok = false
+		}
+	}
+	req.expiresAt = now.Add(ttl)
+	return req, ok
+}
+
+// newSpeechRequest 按网关配置的默认 TTL 构建发言请求
+func (g *MultiVoiceGateway) newSpeechRequest(role string, instructions string, metadata map[string]interface{}) speechRequest {
+	req, ok := newSpeechRequest(role, instructions, metadata, g.config.SpeechTTL)
+	if !ok {
+		g.logger.Printf("[MultiVoiceGateway] ⚠️  Invalid speech ttl %q, using %v", metadata[speechMetaTTL], req.expiresAt.Sub(req.enqueuedAt))
+	}
+	return req
+}
+
+// insert 按优先级插入队列。
+// front=false 排在同级末尾（新请求）；front=true 排在同级最前（被挡回的队首请求重新入队）。
+func (q *speechList) insert(req speechRequest, front bool) {
+	pos := len(*q)
+	for i, queued := range *q {
+		if queued.priority < req.priority || (front && queued.priority == req.priority) {
+			pos = i
+			break
+		}
+	}
+	*q = append(*q, speechRequest{})
+	copy((*q)[pos+1:], (*q)[pos:])
+	(*q)[pos] = req
+}
+
+// pop 取出队首（调用方保证队列非空）
+func (q *speechList) pop() speechRequest {
+	items := *q
+	req := items[0]
+	copy(items, items[1:])
+	items[len(items)-1] = speechRequest{}
+	*q = items[:len(items)-1]
+	return req
+}
+
+// remove 移除满足条件的排队请求并返回
+func (q *speechList) remove(reason string, match func(speechRequest) bool) []droppedSpeech {
+	var dropped []droppedSpeech
+	items := *q
+	kept := items[:0]
+	for _, req := range items {
+		if match(req) {
+			dropped = append(dropped, droppedSpeech{req: req, reason: reason})
+			continue
+		}
+		kept = append(kept, req)
+	}
+	// 清掉尾部残留引用，避免 instructions/metadata 无法回收
+	for i := len(kept); i < len(items); i++ {
+		items[i] = speechRequest{}
+	}
+	*q = kept
+	return dropped
+}
+
+// pruneExpired 丢弃已过期的排队请求
+func (q *speechList) pruneExpired(now time.Time) []droppedSpeech {
+	return q.remove(speechDropExpired, func(req speechRequest) bool {
+		return !req.expiresAt.IsZero() && now.After(req.expiresAt)
+	})
+}
+
+// supersede 同一轮次的新导演计划到达时，丢弃旧计划尚未开播的发言
+func (q *speechList) supersede(req speechRequest) []droppedSpeech {
+	if req.turnID == "" || req.planID == "" {
+		return nil
+	}
+	return q.remove(speechDropSuperseded, func(queued speechRequest) bool {
+		return queued.turnID == req.turnID && queued.planID != "" && queued.planID != req.planID
+	})
+}
+
+// preempts 紧急发言是否需要抢占正在播的发言（current 为 nil 表示没人在说）
+func (req speechRequest) preempts(current *speechRequest) bool {
+	return req.priority == speechPriorityUrgent && current != nil && current.priority < speechPriorityUrgent
+}
+
+// droppedSpeechMessages 一条被丢弃的发言对应的下发消息（给前端）与回灌事件（落 Timeline）
+func droppedSpeechMessages(d droppedSpeech) (*ServerMessage, *ClientMessage) {
+	metadata := map[string]interface{}{
+		"role":     d.req.role,
+		"plan_id":  d.req.planID,
+		"priority": d.req.priority.String(),
+		"reason":   d.reason,
+	}
+	now := time.Now()
+	notice := &ServerMessage{
+		Type:     EventTypeSpeechDropped,
+		TurnID:   d.req.turnID,
+		Metadata: metadata,
+		ServerTS: now,
+	}
+	event := &ClientMessage{
+		Type:     EventTypeSpeechDropped,
+		EventID:  fmt.Sprintf("speech_dropped_%d", now.UnixNano()),
+		TurnID:   d.req.turnID,
+		Metadata: cloneMetadata(metadata),
+		ClientTS: now,
+	}
+	return notice, event
+}
+
+// preemptCurrentSpeech 打断正在播的低优先级发言，让紧急发言尽快开口
+func (g *MultiVoiceGateway) preemptCurrentSpeech(req speechRequest) {
+	if g.voicePool == nil {
+		return
+	}
+	active := g.voicePool.GetSpeakingRole()
+	if active == "" {
+		return
+	}
+	g.logger.Printf("[MultiVoiceGateway] ⏭️  Urgent speech preempts active speaker: active_role=%s urgent_role=%s", active, req.role)
+
+	g.muteRoleAudio(active, "preempted")
+	if err := g.voicePool.CancelCurrentResponse(); err != nil {
+		g.logger.Printf("[MultiVoiceGateway] ⚠️  Preempt cancel failed: %v", err)
+	}
+	g.sendTTSInterruptedToClient("preempted")
+}
+
+// CancelSpeech 撤回某个计划里某个角色的发言：丢弃尚未开播的请求，正在播的则打断。
+// 用于提前开口的角色与最终计划不一致时，避免两个角色先后接同一句话。
+func (g *MultiVoiceGateway) CancelSpeech(planID string, role string) {
+	if planID == "" || role == "" {
+		return
+	}
+	match := func(req speechRequest) bool { return req.planID == planID && req.role == role }
+
+	g.speechMu.Lock()
+	dropped := g.speechQueue.remove(speechDropCancelled, match)
+	speaking := g.currentSpeech != nil && match(*g.currentSpeech)
+	g.speechMu.Unlock()
+
+	g.reportDroppedSpeech(dropped)
+	if !speaking || g.voicePool == nil || g.voicePool.GetSpeakingRole() != role {
+		return
+	}
+	g.logger.Printf("[MultiVoiceGateway] ⏹️  Cancelling active speech: role=%s plan=%s", role, planID)
+	g.muteRoleAudio(role, speechDropCancelled)
+	if err := g.voicePool.CancelCurrentResponse(); err != nil {
+		g.logger.Printf("[MultiVoiceGateway] ⚠️  Cancel speech failed: %v", err)
+	}
+	g.sendTTSInterruptedToClient(speechDropCancelled)
+}
+
+// reportDroppedSpeech 通知前端并回灌 Orchestrator（落 Timeline），调用方不能持有 speechMu
+func (g *MultiVoiceGateway) reportDroppedSpeech(dropped []droppedSpeech) {
+	for _, d := range dropped {
+		g.logger.Printf("[MultiVoiceGateway] 🗑️  Speech dropped: role=%s turn=%s plan=%s priority=%s reason=%s queued=%v",
+			d.req.role, d.req.turnID, d.req.planID, d.req.priority, d.reason, time.Since(d.req.enqueuedAt).Round(time.Millisecond))
+
+		notice, event := droppedSpeechMessages(d)
+		_ = g.sendToClient(notice)
+		_ = g.forwardToOrchestrator(event)
+	}
+}
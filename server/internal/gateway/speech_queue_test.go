@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func newQueueTestGateway() *MultiVoiceGateway {
+	return NewMultiVoiceGateway("queue-session", nil, GatewayConfig{
+		RoleProfiles: map[string]RoleProfile{
+			"host":      {Voice: "cedar"},
+			"economist": {Voice: "echo"},
+			"skeptic":   {Voice: "shimmer"},
+		},
+	})
+}
+
+// droppedEvents 从 replay 缓冲中取出已下发的 speech_dropped 事件
+func droppedEvents(t *testing.T, g *MultiVoiceGateway) []ServerMessage {
+	t.Helper()
+	raw, _ := g.replay.since(0)
+	var out []ServerMessage
+	for _, data := range raw {
+		var msg ServerMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if msg.Type == EventTypeSpeechDropped {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+func queuedRoles(g *MultiVoiceGateway) []string {
+	g.speechMu.Lock()
+	defer g.speechMu.Unlock()
+	roles := make([]string, 0, len(g.speechQueue))
+	for _, req := range g.speechQueue {
+		roles = append(roles, req.role)
+	}
+	return roles
+}
+
+func TestSpeechQueue_PriorityOrderKeepsFIFOWithinLevel(t *testing.T) {
+	g := newQueueTestGateway()
+	enqueue := func(role, priority string) {
+		g.enqueueSpeech(g.newSpeechRequest(role, "say something", map[string]interface{}{"role": role, "priority": priority}))
+	}
+	enqueue("host", "")
+	enqueue("economist", "low")
+	enqueue("skeptic", "urgent")
+	enqueue("economist", "normal")
+
+	want := []string{"skeptic", "host", "economist", "economist"}
+	got := queuedRoles(g)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("queue = %v, want %v", got, want)
+		}
+	}
+	if req, _ := g.nextSpeechRequest(); req.priority != speechPriorityUrgent {
+		t.Errorf("first dequeued priority = %s", req.priority)
+	}
+	if req, _ := g.nextSpeechRequest(); req.role != "host" {
+		t.Errorf("second dequeued = %s", req.role)
+	}
+}
+
+func TestSpeechQueue_NewPlanSupersedesOlderPlanForSameTurn(t *testing.T) {
+	g := newQueueTestGateway()
+	enqueue := func(role, turn, plan string) {
+		g.enqueueSpeech(g.newSpeechRequest(role, "line", map[string]interface{}{"role": role, "turn_id": turn, "plan_id": plan}))
+	}
+	enqueue("host", "turn_1", "plan_a")
+	enqueue("economist", "turn_1", "plan_a")
+	enqueue("host", "turn_2", "plan_x")
+	// 同一计划的后续角色不会互相替换
+	if dropped := droppedEvents(t, g); len(dropped) != 0 {
+		t.Fatalf("unexpected drops: %+v", dropped)
+	}
+
+	enqueue("skeptic", "turn_1", "plan_b")
+
+	got := queuedRoles(g)
+	if len(got) != 2 || got[0] != "host" || got[1] != "skeptic" {
+		t.Fatalf("queue = %v, want [host(turn_2) skeptic]", got)
+	}
+	dropped := droppedEvents(t, g)
+	if len(dropped) != 2 {
+		t.Fatalf("dropped = %+v, want 2", dropped)
+	}
+	for _, evt := range dropped {
+		if evt.TurnID != "turn_1" || evt.Metadata["plan_id"] != "plan_a" || evt.Metadata["reason"] != speechDropSuperseded {
+			t.Errorf("dropped event = %+v", evt)
+		}
+	}
+}
+
+func TestSpeechQueue_ExpiredRequestsAreDropped(t *testing.T) {
+	g := newQueueTestGateway()
+	g.enqueueSpeech(g.newSpeechRequest("host", "stale", map[string]interface{}{"role": "host", "turn_id": "turn_1", "ttl": "10ms"}))
+	g.enqueueSpeech(g.newSpeechRequest("economist", "fresh", map[string]interface{}{"role": "economist"}))
+	time.Sleep(30 * time.Millisecond)
+
+	req, ok := g.nextSpeechRequest()
+	if !ok || req.role != "economist" {
+		t.Fatalf("dequeued = %+v, ok=%v", req, ok)
+	}
+	dropped := droppedEvents(t, g)
+	if len(dropped) != 1 || dropped[0].Metadata["role"] != "host" || dropped[0].Metadata["reason"] != speechDropExpired {
+		t.Fatalf("dropped = %+v", dropped)
+	}
+}
+
+func TestSpeechQueue_BargeInReportsEveryDroppedRequest(t *testing.T) {
+	g := newQueueTestGateway()
+	g.enqueueSpeech(g.newSpeechRequest("host", "a", map[string]interface{}{"role": "host"}))
+	g.enqueueSpeech(g.newSpeechRequest("economist", "b", map[string]interface{}{"role": "economist"}))
+
+	g.dropPendingSpeech("client_barge_in")
+
+	if roles := queuedRoles(g); len(roles) != 0 {
+		t.Fatalf("queue not empty: %v", roles)
+	}
+	dropped := droppedEvents(t, g)
+	if len(dropped) != 2 || dropped[0].Metadata["reason"] != "client_barge_in" {
+		t.Fatalf("dropped = %+v", dropped)
+	}
+}
+
+func TestSpeechQueue_CancelSpeechDropsOnlyThatPlanAndRole(t *testing.T) {
+	g := newQueueTestGateway()
+	enqueue := func(role, turn, plan string) {
+		g.enqueueSpeech(g.newSpeechRequest(role, "line", map[string]interface{}{"role": role, "turn_id": turn, "plan_id": plan}))
+	}
+	enqueue("economist", "turn_1", "plan_a")
+	enqueue("host", "turn_1", "plan_a")
+	enqueue("economist", "turn_2", "plan_b")
+
+	g.CancelSpeech("plan_a", "economist")
+
+	if roles := queuedRoles(g); len(roles) != 2 || roles[0] != "host" || roles[1] != "economist" {
+		t.Fatalf("queue = %v", roles)
+	}
+	dropped := droppedEvents(t, g)
+	if len(dropped) != 1 || dropped[0].Metadata["plan_id"] != "plan_a" || dropped[0].Metadata["reason"] != speechDropCancelled {
+		t.Fatalf("dropped = %+v", dropped)
+	}
+}
+
+func TestSendScene_SkipsUnknownRoleBeatsAndHonorsContext(t *testing.T) {
+	g := newQueueTestGateway()
+	g.speechLoopOnce.Do(func() {}) // 只看入队结果，不启动 speechLoop
+
+	scene := Scene{Beats: []SceneBeat{
+		{Role: "host", Instructions: "抛出问题"},
+		{Role: "ghost", Instructions: "不存在的角色"},
+		{Role: "economist", Instructions: "解释机制"},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.SendScene(ctx, scene); err == nil || len(queuedRoles(g)) != 0 {
+		t.Fatalf("cancelled context should not enqueue, err = %v", err)
+	}
+
+	if err := g.SendScene(context.Background(), scene); err != nil {
+		t.Fatalf("send scene: %v", err)
+	}
+	if got := queuedRoles(g); len(got) != 2 || got[0] != "host" || got[1] != "economist" {
+		t.Fatalf("queue = %v", got)
+	}
+	g.speechMu.Lock()
+	total := g.speechQueue[1].metadata["total"]
+	g.speechMu.Unlock()
+	if total != "2" {
+		t.Fatalf("total = %v, want 2", total)
+	}
+
+	if err := g.SendScene(context.Background(), Scene{Beats: []SceneBeat{{Role: "ghost"}}}); err == nil {
+		t.Fatal("scene without known roles should be rejected")
+	}
+}
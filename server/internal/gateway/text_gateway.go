@@ -0,0 +1,570 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"bubble-talk/server/internal/llm"
+
+	"github.com/gorilla/websocket"
+)
+
+// TextGateway 纯文本网关：给聊天式嵌入与自动化测试用，走同一个 /stream 协议但不涉及音频与 Realtime。
+//
+// 与 MultiVoiceGateway 的对应关系：
+//   - 用户输入：客户端发 user_message（Text 为内容），等价于 asr_final，转发给 Orchestrator；
+//   - 角色输出：SendInstructions / SendScene 入队，按顺序用 llm.Client 生成，增量以 assistant_text_delta 下发，
+//     结束时下发 assistant_text 并回灌 Orchestrator；metadata 与语音网关一致（role、sequence、turn_id 等）；
+//   - 发言队列：与语音网关共用调度规则（speechList）：优先级、TTL、同轮次新计划替换旧计划、紧急发言抢占、
+//     场景中一拍被打断时剩余各拍作废；
+//   - 插话：新的 user_message / barge_in 取消正在生成的发言并丢弃排队的发言（下发 speech_dropped）。
+//
+// Orchestrator 不需要感知差异：它只依赖 SendInstructions / SendScene。
+type TextGateway struct {
+	sessionID string
+	client    llm.Client
+
+	clientConn     *websocket.Conn
+	clientConnLock sync.Mutex
+	outputObserver OutputObserver
+	// headless 没有客户端连接（SSE 客户端）：输入经 HandleClientMessage 进来，输出只交给 outputObserver
+	headless bool
+
+	eventHandler EventHandler
+	eventQueue   *EventQueue
+
+	// 发言队列：任意时刻只生成一个角色的发言；cancelCurrent 取消正在生成的那条（currentSpeech）
+	speechMu      sync.Mutex
+	speechCond    *sync.Cond
+	speechQueue   speechList
+	currentSpeech *speechRequest
+	cancelCurrent context.CancelFunc
+
+	// history 已说出的对话（用户与各角色），作为 LLM 的上下文
+	historyMu sync.Mutex
+	history   []ConversationTurn
+
+	seqCounter   int64
+	seqLock      sync.Mutex
+	responseSeq  int64
+	responseLock sync.Mutex
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	closeChan chan struct{}
+
+	config GatewayConfig
+	logger *log.Logger
+}
+
+// textSpeechDropUserMessage 学习者发来新消息时丢弃尚未生成的发言
+const textSpeechDropUserMessage = "user_message"
+
+// NewTextGateway 创建纯文本网关；client 负责生成角色发言（支持 llm.StreamingClient 时逐段下发）
+func NewTextGateway(sessionID string, clientConn *websocket.Conn, config GatewayConfig, client llm.Client) *TextGateway {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &TextGateway{
+		sessionID:  sessionID,
+		client:     client,
+		clientConn: clientConn,
+		ctx:        ctx,
+		cancel:     cancel,
+		closeChan:  make(chan struct{}),
+		config:     config,
+		logger:     log.Default(),
+	}
+	g.speechCond = sync.NewCond(&g.speechMu)
+	return g
+}
+
+// NewHeadlessTextGateway 创建没有客户端连接的文本网关：给只连了 SSE 的客户端用，
+// 用户消息由 HTTP 事件接口经 HandleClientMessage 送入，角色输出经 SetOutputObserver 旁路给 SSE。
+func NewHeadlessTextGateway(sessionID string, config GatewayConfig, client llm.Client) *TextGateway {
+	g := NewTextGateway(sessionID, nil, config, client)
+	g.headless = true
+	return g
+}
+
+// Headless 是否为没有客户端连接的文本网关
+func (g *TextGateway) Headless() bool {
+	return g.headless
+}
+
+// SetEventHandler 设置事件处理器（Orchestrator 注入）
+func (g *TextGateway) SetEventHandler(handler EventHandler) {
+	g.eventHandler = handler
+	if g.eventQueue == nil {
+		g.eventQueue = NewEventQueue(g.sessionID, handler, g.logger)
+	}
+}
+
+// SetOutputObserver 设置下发消息的旁路观察者（需在 Start 之前调用）
+func (g *TextGateway) SetOutputObserver(observer OutputObserver) {
+	g.clientConnLock.Lock()
+	g.outputObserver = observer
+	g.clientConnLock.Unlock()
+}
+
+// Start 启动网关
+func (g *TextGateway) Start(ctx context.Context) error {
+	g.logger.Printf("[TextGateway] Starting gateway for session %s", g.sessionID)
+
+	if g.clientConn == nil && !g.headless {
+		return fmt.Errorf("clientConn is nil")
+	}
+	if g.client == nil {
+		return fmt.Errorf("llm client is nil")
+	}
+
+	if !g.headless {
+		go g.clientReadLoop()
+	}
+	go g.speechLoop()
+
+	_ = g.sendToClient(&ServerMessage{
+		Type:     EventTypeStreamReady,
+		Metadata: map[string]interface{}{"mode": "text"},
+		ServerTS: time.Now(),
+	})
+	g.logger.Printf("[TextGateway] ✅ Gateway started for session %s", g.sessionID)
+	return nil
+}
+
+// clientReadLoop 读取客户端 JSON 事件；连接断开即关闭网关（文本网关不做续传）
+func (g *TextGateway) clientReadLoop() {
+	defer g.Close()
+	for {
+		messageType, data, err := g.clientConn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				select {
+				case <-g.closeChan:
+				default:
+					g.logger.Printf("[TextGateway] client read error: %v", err)
+				}
+			}
+			return
+		}
+		if messageType != websocket.TextMessage {
+			g.sendErrorToClient("text gateway does not accept binary frames")
+			continue
+		}
+		if err := g.handleClientEvent(data); err != nil {
+			g.logger.Printf("[TextGateway] handle client event error: %v", err)
+			g.sendErrorToClient(err.Error())
+		}
+	}
+}
+
+// handleClientEvent 处理客户端 JSON 事件
+func (g *TextGateway) handleClientEvent(data []byte) error {
+	var msg ClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("unmarshal client message: %w", err)
+	}
+	return g.HandleClientMessage(&msg)
+}
+
+// HandleClientMessage 处理一条客户端事件（WebSocket 读循环与无头网关的 HTTP 输入共用）
+func (g *TextGateway) HandleClientMessage(msg *ClientMessage) error {
+	select {
+	case <-g.closeChan:
+		return ErrGatewayClosed
+	default:
+	}
+	if msg.ClientTS.IsZero() {
+		msg.ClientTS = time.Now()
+	}
+
+	g.logger.Printf("[TextGateway] client event: type=%s event_id=%s", msg.Type, msg.EventID)
+
+	switch msg.Type {
+	case EventTypeUserMessage:
+		text := strings.TrimSpace(msg.Text)
+		if text == "" {
+			return fmt.Errorf("user_message text is empty")
+		}
+		msg.Text = text
+		// 学习者开口：正在生成和排队的发言都作废
+		g.interrupt(textSpeechDropUserMessage)
+		g.appendHistory(ConversationTurn{Role: "user", Text: text})
+		return g.forwardToOrchestrator(msg)
+	case EventTypeBargeIn:
+		g.interrupt("client_barge_in")
+		return g.forwardToOrchestrator(msg)
+	case EventTypeAudioFrame:
+		return fmt.Errorf("text gateway does not accept audio")
+	default:
+		return g.forwardToOrchestrator(msg)
+	}
+}
+
+// forwardToOrchestrator 经事件队列串行转发给 Orchestrator
+func (g *TextGateway) forwardToOrchestrator(msg *ClientMessage) error {
+	if g.eventQueue == nil {
+		g.logger.Printf("[TextGateway] ⚠️  no event handler set, dropping event: %s", msg.Type)
+		return nil
+	}
+	return g.eventQueue.Enqueue(msg)
+}
+
+// SendInstructions 让指定角色按指令说一段（入队后立即返回，由 speechLoop 串行生成）
+func (g *TextGateway) SendInstructions(ctx context.Context, instructions string, metadata map[string]interface{}) error {
+	role, _ := metadata["role"].(string)
+	if role == "" {
+		return fmt.Errorf("role not specified in metadata")
+	}
+	if _, exists := g.config.RoleProfiles[role]; !exists {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+	g.enqueueSpeech(g.newSpeechRequest(role, instructions, metadata))
+	return nil
+}
+
+// SendScene 把一个多角色场景下发到发言队列（不阻塞，同 SendInstructions）；规则与语音网关一致
+func (g *TextGateway) SendScene(ctx context.Context, scene Scene) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	reqs, err := sceneSpeechRequests(scene, g.config.RoleProfiles, g.newSpeechRequest, func(i int, role string) {
+		g.logger.Printf("[TextGateway] ⚠️  Scene beat %d skipped: unknown role %s", i, role)
+	})
+	if err != nil {
+		return err
+	}
+	g.logger.Printf("[TextGateway] 🎬 Enqueue scene %s with %d beats", reqs[0].sceneID, len(reqs))
+	for _, req := range reqs {
+		g.enqueueSpeech(req)
+	}
+	return nil
+}
+
+// CancelSpeech 撤回某个计划里某个角色的发言：丢弃尚未生成的请求，正在生成的则取消
+func (g *TextGateway) CancelSpeech(planID string, role string) {
+	if planID == "" || role == "" {
+		return
+	}
+	match := func(req speechRequest) bool { return req.planID == planID && req.role == role }
+
+	g.speechMu.Lock()
+	dropped := g.speechQueue.remove(speechDropCancelled, match)
+	var cancel context.CancelFunc
+	if g.currentSpeech != nil && match(*g.currentSpeech) {
+		cancel = g.cancelCurrent
+	}
+	g.speechMu.Unlock()
+
+	g.reportDroppedSpeech(dropped)
+	if cancel != nil {
+		g.logger.Printf("[TextGateway] ⏹️  Cancelling active speech: role=%s plan=%s", role, planID)
+		cancel()
+	}
+}
+
+// newSpeechRequest 按网关配置的默认 TTL 构建发言请求
+func (g *TextGateway) newSpeechRequest(role string, instructions string, metadata map[string]interface{}) speechRequest {
+	req, ok := newSpeechRequest(role, instructions, metadata, g.config.SpeechTTL)
+	if !ok {
+		g.logger.Printf("[TextGateway] ⚠️  Invalid speech ttl %q, using %v", metadata[speechMetaTTL], req.expiresAt.Sub(req.enqueuedAt))
+	}
+	return req
+}
+
+// enqueueSpeech 入队：顺带清理过期请求、替换同轮次旧计划的请求；紧急请求取消正在生成的低优先级发言
+func (g *TextGateway) enqueueSpeech(req speechRequest) {
+	g.speechMu.Lock()
+	dropped := g.speechQueue.pruneExpired(time.Now())
+	dropped = append(dropped, g.speechQueue.supersede(req)...)
+	g.speechQueue.insert(req, false)
+	queueSize := len(g.speechQueue)
+	var preempt context.CancelFunc
+	if req.preempts(g.currentSpeech) {
+		preempt = g.cancelCurrent
+	}
+	g.speechMu.Unlock()
+
+	g.reportDroppedSpeech(dropped)
+	g.logger.Printf("[TextGateway] 🎙️ Speech enqueued: role=%s priority=%s turn=%s plan=%s queue_size=%d",
+		req.role, req.priority, req.turnID, req.planID, queueSize)
+	g.speechCond.Signal()
+
+	if preempt != nil {
+		g.logger.Printf("[TextGateway] ⏭️  Urgent speech preempts active speaker: urgent_role=%s", req.role)
+		preempt()
+	}
+}
+
+// interrupt 取消正在生成的发言并丢弃排队的发言
+func (g *TextGateway) interrupt(reason string) {
+	g.speechMu.Lock()
+	dropped := g.speechQueue.remove(reason, func(speechRequest) bool { return true })
+	cancel := g.cancelCurrent
+	g.speechMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	g.reportDroppedSpeech(dropped)
+}
+
+// abortScene 放弃场景的剩余各拍（其中一拍被打断/抢占时）
+func (g *TextGateway) abortScene(sceneID string) {
+	g.speechMu.Lock()
+	dropped := g.speechQueue.remove(speechDropSceneAborted, func(req speechRequest) bool { return req.sceneID == sceneID })
+	g.speechMu.Unlock()
+
+	if len(dropped) > 0 {
+		g.logger.Printf("[TextGateway] 🎬 Scene aborted: scene=%s dropped_beats=%d", sceneID, len(dropped))
+		g.reportDroppedSpeech(dropped)
+	}
+}
+
+// reportDroppedSpeech 通知前端并回灌 Orchestrator（落 Timeline），调用方不能持有 speechMu
+func (g *TextGateway) reportDroppedSpeech(dropped []droppedSpeech) {
+	for _, d := range dropped {
+		g.logger.Printf("[TextGateway] 🗑️  Speech dropped: role=%s turn=%s plan=%s reason=%s", d.req.role, d.req.turnID, d.req.planID, d.reason)
+		notice, event := droppedSpeechMessages(d)
+		_ = g.sendToClient(notice)
+		_ = g.forwardToOrchestrator(event)
+	}
+}
+
+// speechLoop 依次生成排队的发言；出队前丢弃已过期的请求
+func (g *TextGateway) speechLoop() {
+	for {
+		g.speechMu.Lock()
+		var expired []droppedSpeech
+		for {
+			expired = append(expired, g.speechQueue.pruneExpired(time.Now())...)
+			if len(g.speechQueue) > 0 {
+				break
+			}
+			select {
+			case <-g.closeChan:
+				g.speechMu.Unlock()
+				return
+			default:
+			}
+			if len(expired) > 0 {
+				g.speechMu.Unlock()
+				g.reportDroppedSpeech(expired)
+				expired = nil
+				g.speechMu.Lock()
+				continue
+			}
+			g.speechCond.Wait()
+		}
+		req := g.speechQueue.pop()
+		ctx, cancel := context.WithCancel(g.ctx)
+		current := req
+		g.currentSpeech = &current
+		g.cancelCurrent = cancel
+		g.speechMu.Unlock()
+
+		g.reportDroppedSpeech(expired)
+		completed := g.speak(ctx, req)
+
+		g.speechMu.Lock()
+		g.currentSpeech = nil
+		g.cancelCurrent = nil
+		g.speechMu.Unlock()
+		cancel()
+
+		// 场景中的一拍没有正常说完（被打断/抢占），剩余各拍作废
+		if !completed && req.sceneID != "" {
+			g.abortScene(req.sceneID)
+		}
+	}
+}
+
+// speak 生成一段角色发言：增量逐段下发，完成后下发全文、记入历史并回灌 Orchestrator。
+// 被取消时返回 false（生成失败不算被打断，场景照常继续）。
+func (g *TextGateway) speak(ctx context.Context, req speechRequest) bool {
+	metadata := cloneMetadata(req.metadata)
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["role"] = req.role
+	metadata["response_id"] = g.nextResponseID()
+
+	g.logger.Printf("[TextGateway] 💬 Generating speech: role=%s response_id=%s", req.role, metadata["response_id"])
+
+	var streamed strings.Builder
+	text, err := llm.CompleteStream(ctx, g.client, g.buildMessages(req), nil, func(delta string) {
+		if delta == "" || ctx.Err() != nil {
+			return
+		}
+		streamed.WriteString(delta)
+		_ = g.sendToClient(&ServerMessage{
+			Type:     EventTypeAssistantTextDelta,
+			TurnID:   req.turnID,
+			Text:     delta,
+			Metadata: cloneMetadata(metadata),
+			ServerTS: time.Now(),
+		})
+	})
+	if ctx.Err() != nil {
+		// 被学习者打断：已下发的增量就是实际“说出”的部分
+		g.logger.Printf("[TextGateway] Speech cancelled: role=%s", req.role)
+		if partial := streamed.String(); partial != "" {
+			metadata["cancelled"] = true
+			g.finishSpeech(req, partial, metadata)
+		}
+		return false
+	}
+	if err != nil {
+		g.logger.Printf("[TextGateway] ❌ Failed to generate speech for %s: %v", req.role, err)
+		g.sendErrorToClient(fmt.Sprintf("generate %s speech: %v", req.role, err))
+		return true
+	}
+	if text = strings.TrimSpace(text); text != "" {
+		g.finishSpeech(req, text, metadata)
+	}
+	return true
+}
+
+// finishSpeech 下发完整发言、记入历史并回灌 Orchestrator
+func (g *TextGateway) finishSpeech(req speechRequest, text string, metadata map[string]interface{}) {
+	g.appendHistory(ConversationTurn{Role: "assistant", FromRole: req.role, Text: text})
+
+	_ = g.sendToClient(&ServerMessage{
+		Type:     EventTypeAssistantText,
+		TurnID:   req.turnID,
+		Text:     text,
+		Metadata: metadata,
+		ServerTS: time.Now(),
+	})
+	_ = g.forwardToOrchestrator(&ClientMessage{
+		Type:     EventTypeAssistantText,
+		EventID:  fmt.Sprintf("assistant_%d", time.Now().UnixNano()),
+		TurnID:   req.turnID,
+		Text:     text,
+		Metadata: cloneMetadata(metadata),
+		ClientTS: time.Now(),
+	})
+}
+
+// buildMessages 角色人设（默认指令 + 导演给该角色的指令）作为 system，历史对话按角色视角排列：
+// 该角色自己的发言是 assistant，学习者与其他角色的发言是 user（其他角色带上名字）
+func (g *TextGateway) buildMessages(req speechRequest) []llm.Message {
+	system := req.instructions
+	if base := strings.TrimSpace(g.config.DefaultInstructions); base != "" {
+		system = base + "\n\n" + req.instructions
+	}
+	messages := []llm.Message{{Role: "system", Content: system}}
+
+	g.historyMu.Lock()
+	defer g.historyMu.Unlock()
+	for _, turn := range g.history {
+		switch {
+		case turn.Role == "user":
+			messages = append(messages, llm.Message{Role: "user", Content: turn.Text})
+		case turn.FromRole == req.role:
+			messages = append(messages, llm.Message{Role: "assistant", Content: turn.Text})
+		default:
+			messages = append(messages, llm.Message{Role: "user", Content: fmt.Sprintf("[%s]: %s", turn.FromRole, turn.Text)})
+		}
+	}
+	return messages
+}
+
+func (g *TextGateway) appendHistory(turn ConversationTurn) {
+	g.historyMu.Lock()
+	defer g.historyMu.Unlock()
+	g.history = append(g.history, turn)
+	if window := g.config.HistoryWindow; window > 0 && len(g.history) > window {
+		g.history = append([]ConversationTurn(nil), g.history[len(g.history)-window:]...)
+	}
+}
+
+func (g *TextGateway) nextResponseID() string {
+	g.responseLock.Lock()
+	defer g.responseLock.Unlock()
+	g.responseSeq++
+	return fmt.Sprintf("text_resp_%d", g.responseSeq)
+}
+
+// sendToClient 分配 seq 并下发
+func (g *TextGateway) sendToClient(msg *ServerMessage) error {
+	g.clientConnLock.Lock()
+	defer g.clientConnLock.Unlock()
+
+	g.seqLock.Lock()
+	g.seqCounter++
+	msg.Seq = g.seqCounter
+	g.seqLock.Unlock()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal server message: %w", err)
+	}
+	if g.outputObserver != nil {
+		g.outputObserver(*msg)
+	}
+	if g.clientConn == nil {
+		return nil
+	}
+	if g.config.WriteTimeout > 0 {
+		_ = g.clientConn.SetWriteDeadline(time.Now().Add(g.config.WriteTimeout))
+	}
+	return g.clientConn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (g *TextGateway) sendErrorToClient(errMsg string) {
+	_ = g.sendToClient(&ServerMessage{
+		Type:     "error",
+		Error:    errMsg,
+		ServerTS: time.Now(),
+	})
+}
+
+// SendQuizToClient 发送选择题到客户端
+func (g *TextGateway) SendQuizToClient(quizID, question string, options []string, context string) error {
+	return g.sendToClient(&ServerMessage{
+		Type: EventTypeQuizShow,
+		QuizData: &QuizMessageData{
+			QuizID:   quizID,
+			Question: question,
+			Options:  options,
+			Context:  context,
+		},
+		ServerTS: time.Now(),
+	})
+}
+
+// Close 关闭网关
+func (g *TextGateway) Close() error {
+	g.closeOnce.Do(func() {
+		g.logger.Printf("[TextGateway] Closing gateway for session %s", g.sessionID)
+		g.cancel()
+		close(g.closeChan)
+
+		g.speechMu.Lock()
+		g.speechCond.Broadcast()
+		g.speechMu.Unlock()
+
+		if g.eventQueue != nil {
+			if err := g.eventQueue.Close(); err != nil {
+				g.logger.Printf("[TextGateway] ⚠️  Error closing event queue: %v", err)
+			}
+		}
+
+		g.clientConnLock.Lock()
+		if g.clientConn != nil {
+			_ = g.clientConn.Close()
+		}
+		g.clientConnLock.Unlock()
+	})
+	return nil
+}
+
+// Done 返回一个在网关关闭时关闭的 channel
+func (g *TextGateway) Done() <-chan struct{} {
+	return g.closeChan
+}
@@ -0,0 +1,243 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/llm"
+
+	"github.com/gorilla/websocket"
+)
+
+// scriptedLLM 按角色回放台词，按字切成增量；block 非 nil 时在第一段增量后等待取消
+type scriptedLLM struct {
+	mu       sync.Mutex
+	replies  map[string]string
+	requests [][]llm.Message
+	block    chan struct{}
+}
+
+func (s *scriptedLLM) Complete(ctx context.Context, messages []llm.Message, schema *llm.JSONSchema) (string, error) {
+	return s.Stream(ctx, messages, schema, nil)
+}
+
+func (s *scriptedLLM) Stream(ctx context.Context, messages []llm.Message, schema *llm.JSONSchema, onDelta llm.StreamHandler) (string, error) {
+	s.mu.Lock()
+	s.requests = append(s.requests, messages)
+	reply := "……"
+	for role, r := range s.replies {
+		if strings.Contains(messages[0].Content, "ROLE="+role) {
+			reply = r
+		}
+	}
+	block := s.block
+	s.mu.Unlock()
+
+	for i, r := range []rune(reply) {
+		if onDelta != nil {
+			onDelta(string(r))
+		}
+		if i == 0 && block != nil {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-block:
+			}
+		}
+	}
+	return reply, nil
+}
+
+func startTextGateway(t *testing.T, model llm.Client, handler func(gw *TextGateway, msg *ClientMessage) error) (*TextGateway, *fakeClient) {
+	t.Helper()
+
+	gwCh := make(chan *TextGateway, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		gw := NewTextGateway("text-session", conn, GatewayConfig{
+			RoleProfiles:        map[string]RoleProfile{"host": {}, "economist": {}},
+			DefaultInstructions: "你是 BubbleTalk 的角色。",
+		}, model)
+		gw.SetEventHandler(func(ctx context.Context, msg *ClientMessage) error { return handler(gw, msg) })
+		if err := gw.Start(context.Background()); err != nil {
+			t.Errorf("start: %v", err)
+		}
+		gwCh <- gw
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	client := &fakeClient{conn: conn, changed: make(chan struct{})}
+	go client.readLoop()
+
+	gw := <-gwCh
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = gw.Close()
+	})
+	return gw, client
+}
+
+func sendUserMessage(t *testing.T, client *fakeClient, text string) {
+	t.Helper()
+	data, _ := json.Marshal(ClientMessage{Type: EventTypeUserMessage, Text: text})
+	if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestTextGateway_StreamsRoleOutputWithMetadata(t *testing.T) {
+	model := &scriptedLLM{replies: map[string]string{"host": "欢迎！", "economist": "通胀是物价上涨。"}}
+
+	var mu sync.Mutex
+	var forwarded []ClientMessage
+	_, client := startTextGateway(t, model, func(gw *TextGateway, msg *ClientMessage) error {
+		mu.Lock()
+		forwarded = append(forwarded, *msg)
+		mu.Unlock()
+		if msg.Type == EventTypeUserMessage {
+			// 模拟 Orchestrator：两拍场景逐拍下发
+			for i, role := range []string{"host", "economist"} {
+				_ = gw.SendInstructions(context.Background(), "ROLE="+role, map[string]interface{}{
+					"role": role, "turn_id": "t1", "sequence": []string{"0", "1"}[i], "total": "2",
+				})
+			}
+		}
+		return nil
+	})
+
+	client.waitEvent(t, EventTypeStreamReady, nil)
+	sendUserMessage(t, client, "  什么是通胀？ ")
+
+	final := client.waitEvent(t, EventTypeAssistantText, func(m ServerMessage) bool { return m.Metadata["role"] == "economist" })
+	if final.Text != "通胀是物价上涨。" || final.Metadata["sequence"] != "1" || final.TurnID != "t1" {
+		t.Errorf("economist final = %+v", final)
+	}
+
+	// 增量按顺序下发、带相同的角色与序号元数据，seq 单调递增
+	client.mu.Lock()
+	var hostText strings.Builder
+	var lastSeq int64
+	for _, evt := range client.events {
+		if evt.Seq <= lastSeq {
+			t.Errorf("seq not increasing: %d after %d", evt.Seq, lastSeq)
+		}
+		lastSeq = evt.Seq
+		if evt.Type == EventTypeAssistantTextDelta && evt.Metadata["role"] == "host" {
+			if evt.Metadata["sequence"] != "0" || evt.Metadata["response_id"] == "" {
+				t.Errorf("host delta metadata = %+v", evt.Metadata)
+			}
+			hostText.WriteString(evt.Text)
+		}
+	}
+	client.mu.Unlock()
+	if hostText.String() != "欢迎！" {
+		t.Errorf("host deltas = %q", hostText.String())
+	}
+
+	// economist 看到的上下文：学习者与 host 的话都是 user，host 带名字
+	model.mu.Lock()
+	last := model.requests[len(model.requests)-1]
+	model.mu.Unlock()
+	if len(last) != 3 || last[1].Content != "什么是通胀？" || last[2].Content != "[host]: 欢迎！" {
+		t.Errorf("economist messages = %+v", last)
+	}
+	if !strings.HasPrefix(last[0].Content, "你是 BubbleTalk 的角色。") {
+		t.Errorf("system prompt = %q", last[0].Content)
+	}
+
+	// Orchestrator 收到 user_message 与两条 assistant_text
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		var types []string
+		for _, m := range forwarded {
+			types = append(types, string(m.Type))
+		}
+		mu.Unlock()
+		if strings.Join(types, ",") == "user_message,assistant_text,assistant_text" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("forwarded = %v", types)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTextGateway_UserMessageInterruptsSpeech(t *testing.T) {
+	model := &scriptedLLM{replies: map[string]string{"host": "很长很长的一段话"}, block: make(chan struct{})}
+	defer close(model.block)
+
+	gw, client := startTextGateway(t, model, func(gw *TextGateway, msg *ClientMessage) error { return nil })
+	client.waitEvent(t, EventTypeStreamReady, nil)
+
+	_ = gw.SendInstructions(context.Background(), "ROLE=host", map[string]interface{}{"role": "host", "turn_id": "t1"})
+	_ = gw.SendInstructions(context.Background(), "ROLE=economist", map[string]interface{}{"role": "economist", "turn_id": "t1"})
+	client.waitEvent(t, EventTypeAssistantTextDelta, nil)
+
+	// 学习者插话：生成中的 host 以已下发的部分收尾，排队的 economist 被丢弃
+	sendUserMessage(t, client, "等一下")
+	cut := client.waitEvent(t, EventTypeAssistantText, nil)
+	if cut.Text != "很" || cut.Metadata["cancelled"] != true {
+		t.Errorf("cancelled speech = %+v", cut)
+	}
+	dropped := client.waitEvent(t, EventTypeSpeechDropped, nil)
+	if dropped.Metadata["role"] != "economist" || dropped.Metadata["reason"] != textSpeechDropUserMessage {
+		t.Errorf("dropped = %+v", dropped.Metadata)
+	}
+
+	if err := gw.SendInstructions(context.Background(), "x", map[string]interface{}{"role": "skeptic"}); err == nil {
+		t.Error("unknown role should be rejected")
+	}
+}
+
+// TestTextGateway_SharesSpeechQueueRules 验证文本网关沿用语音网关的调度规则：
+// 同轮次新计划替换旧计划尚未生成的拍，紧急发言抢占正在生成的一拍。
+func TestTextGateway_SharesSpeechQueueRules(t *testing.T) {
+	model := &scriptedLLM{replies: map[string]string{"host": "很长很长的一段话"}, block: make(chan struct{})}
+	defer close(model.block)
+
+	gw, client := startTextGateway(t, model, func(gw *TextGateway, msg *ClientMessage) error { return nil })
+	client.waitEvent(t, EventTypeStreamReady, nil)
+
+	err := gw.SendScene(context.Background(), Scene{
+		Metadata: map[string]interface{}{"turn_id": "t1", "plan_id": "p1"},
+		Beats: []SceneBeat{
+			{Role: "host", Instructions: "ROLE=host"},
+			{Role: "economist", Instructions: "ROLE=economist"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("send scene: %v", err)
+	}
+	client.waitEvent(t, EventTypeAssistantTextDelta, nil)
+
+	// 同一轮次的新计划：p1 尚未生成的 economist 一拍被替换
+	_ = gw.SendInstructions(context.Background(), "ROLE=economist", map[string]interface{}{"role": "economist", "turn_id": "t1", "plan_id": "p2"})
+	superseded := client.waitEvent(t, EventTypeSpeechDropped, nil)
+	if superseded.Metadata["plan_id"] != "p1" || superseded.Metadata["reason"] != speechDropSuperseded {
+		t.Errorf("superseded = %+v", superseded.Metadata)
+	}
+
+	// 紧急发言：正在生成的 host 一拍被取消，紧急发言排到队首先生成
+	_ = gw.SendInstructions(context.Background(), "ROLE=host", map[string]interface{}{"role": "host", "turn_id": "t2", "plan_id": "p3", "priority": "urgent"})
+	cut := client.waitEvent(t, EventTypeAssistantText, nil)
+	if cut.Metadata["plan_id"] != "p1" || cut.Metadata["cancelled"] != true {
+		t.Errorf("preempted speech = %+v", cut.Metadata)
+	}
+	client.waitEvent(t, EventTypeAssistantTextDelta, func(msg ServerMessage) bool { return msg.Metadata["plan_id"] == "p3" })
+}
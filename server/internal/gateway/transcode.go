@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"fmt"
+
+	"bubble-talk/server/internal/audio"
+)
+
+// setupTranscoding 解析客户端侧与 Realtime 侧的音频格式（Start 时调用）。
+// 两侧相同时为直通；任何一个方向不支持（如未注册的 opus）都会让 Start 失败，而不是在音频路径上静默出错。
+func (g *MultiVoiceGateway) setupTranscoding() error {
+	realtimeIn, clientIn, err := resolveAudioFormats(g.config.InputAudioFormat, g.config.ClientInputAudioFormat)
+	if err != nil {
+		return fmt.Errorf("input audio format: %w", err)
+	}
+	realtimeOut, clientOut, err := resolveAudioFormats(g.config.OutputAudioFormat, g.config.ClientOutputAudioFormat)
+	if err != nil {
+		return fmt.Errorf("output audio format: %w", err)
+	}
+
+	input, err := audio.NewTranscoder(clientIn, realtimeIn)
+	if err != nil {
+		return fmt.Errorf("input audio %s -> %s: %w", clientIn, realtimeIn, err)
+	}
+	// 下行每条音频流一个转码器，这里只校验能否创建
+	if _, err := audio.NewTranscoder(realtimeOut, clientOut); err != nil {
+		return fmt.Errorf("output audio %s -> %s: %w", realtimeOut, clientOut, err)
+	}
+
+	g.transcodeMu.Lock()
+	g.inputTranscoder = input
+	g.realtimeOutputFormat = realtimeOut
+	g.clientOutputFormat = clientOut
+	g.transcodeMu.Unlock()
+
+	if !input.Passthrough() || realtimeOut != clientOut {
+		g.logger.Printf("[MultiVoiceGateway] 🔁 Audio transcoding: input %s -> %s, output %s -> %s",
+			clientIn, realtimeIn, realtimeOut, clientOut)
+	}
+	return nil
+}
+
+// resolveAudioFormats 返回 Realtime 侧与客户端侧格式；客户端侧为空时与 Realtime 侧相同
+func resolveAudioFormats(realtimeName, clientName string) (audio.Format, audio.Format, error) {
+	realtime, err := audio.ParseFormat(realtimeName)
+	if err != nil {
+		return audio.Format{}, audio.Format{}, err
+	}
+	if clientName == "" {
+		return realtime, realtime, nil
+	}
+	client, err := audio.ParseFormat(clientName)
+	if err != nil {
+		return audio.Format{}, audio.Format{}, err
+	}
+	return realtime, client, nil
+}
+
+// clientInputCodec 客户端上行音频的帧编码（v2 帧头校验用）
+func (g *MultiVoiceGateway) clientInputCodec() AudioCodec {
+	g.transcodeMu.Lock()
+	defer g.transcodeMu.Unlock()
+	if g.inputTranscoder == nil {
+		return CodecFromFormat(g.config.InputAudioFormat)
+	}
+	return CodecFromFormat(g.inputTranscoder.From.Codec)
+}
+
+// clientOutputCodec 客户端下行音频的帧编码
+func (g *MultiVoiceGateway) clientOutputCodec() AudioCodec {
+	g.transcodeMu.Lock()
+	defer g.transcodeMu.Unlock()
+	if g.clientOutputFormat.Codec == "" {
+		return CodecFromFormat(g.config.OutputAudioFormat)
+	}
+	return CodecFromFormat(g.clientOutputFormat.Codec)
+}
+
+// transcodeInput 把客户端上行音频转换为 Realtime 侧格式。
+// 上行只有一条流，但续传接管时新旧读循环可能短暂并存，所以加锁。
+func (g *MultiVoiceGateway) transcodeInput(data []byte) ([]byte, error) {
+	g.transcodeMu.Lock()
+	defer g.transcodeMu.Unlock()
+	if g.inputTranscoder == nil {
+		return data, nil
+	}
+	return g.inputTranscoder.Convert(data)
+}
+
+// newOutputTranscoder 为一条下行音频流创建转码器；直通时返回 nil
+func (g *MultiVoiceGateway) newOutputTranscoder() *audio.Transcoder {
+	g.transcodeMu.Lock()
+	from, to := g.realtimeOutputFormat, g.clientOutputFormat
+	g.transcodeMu.Unlock()
+	if from == to {
+		return nil
+	}
+	tc, err := audio.NewTranscoder(from, to)
+	if err != nil {
+		// setupTranscoding 已校验过，正常不会走到这里
+		g.logger.Printf("[MultiVoiceGateway] ⚠️  Failed to create output transcoder: %v", err)
+		return nil
+	}
+	return tc
+}
+
+// clientAudioFormats 返回客户端侧的上行/下行格式名（stream_ready 下发）
+func (g *MultiVoiceGateway) clientAudioFormats() (string, string) {
+	g.transcodeMu.Lock()
+	defer g.transcodeMu.Unlock()
+	if g.inputTranscoder == nil {
+		return "", ""
+	}
+	return g.inputTranscoder.From.String(), g.clientOutputFormat.String()
+}
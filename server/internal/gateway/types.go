@@ -17,6 +17,8 @@ const (
 	EventTypeTTSInterrupted EventType = "tts_interrupted" // TTS被打断
 	EventTypeSpeechStarted  EventType = "speech_started"  // VAD检测到用户开始说话（服务端→客户端）
 	EventTypeSpeechStopped  EventType = "speech_stopped"  // VAD检测到用户停止说话（服务端→客户端）
+	EventTypeSpeechDropped  EventType = "speech_dropped"  // 排队的发言未开播即被丢弃（过期/被替换/插话），也回灌 Timeline
+	EventTypeCaption        EventType = "caption"         // 实时字幕（用户转写/角色转写，带时间轴），final 回灌 Timeline
 
 	// 工具/控制事件
 	EventTypeQuizAnswer    EventType = "quiz_answer"    // 答题
@@ -24,11 +26,21 @@ const (
 	EventTypeBargeIn       EventType = "barge_in"       // 插话中断
 	EventTypeExitRequested EventType = "exit_requested" // 退出请求
 	EventTypeWorldEntered  EventType = "world_entered"  // 进入World，触发导演主动开场
+	EventTypeUserMessage   EventType = "user_message"   // 文本输入（TextGateway），等价于 asr_final
 
 	// 系统/导演事件
 	EventTypeDirectorPlan  EventType = "director_plan"  // 导演计划（内部）
 	EventTypeAssistantText EventType = "assistant_text" // 助手文本输出
-	EventTypeInstructions  EventType = "instructions"   // 向Realtime发送指令
+	// EventTypeAssistantTextDelta 助手文本增量（TextGateway 流式输出，metadata 与 assistant_text 相同）
+	EventTypeAssistantTextDelta EventType = "assistant_text_delta"
+	EventTypeInstructions       EventType = "instructions" // 向Realtime发送指令
+	EventTypeUsage              EventType = "usage"        // Realtime 用量（内部，回灌给Orchestrator）
+
+	// 连接/续传事件（服务端→客户端）
+	EventTypeStreamReady   EventType = "stream_ready"   // 网关就绪，下发 resume_token
+	EventTypeStreamResumed EventType = "stream_resumed" // 重连成功，缺失消息已补发
+	EventTypeResync        EventType = "resync"         // 缺口超出缓冲区，用 Timeline 快照重建（replay 字段）
+	EventTypeRoleHealth    EventType = "role_health"    // 角色 Realtime 连接健康状态变化（断线/重连中/恢复/不可用）
 )
 
 // ClientMessage 客户端发送给网关的消息（WebSocket文本帧）
@@ -41,6 +53,10 @@ type ClientMessage struct {
 	Answer     string                 `json:"answer,omitempty"`      // 答题答案
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`    // 扩展字段
 	ClientTS   time.Time              `json:"client_ts,omitempty"`   // 客户端时间戳
+	// Usage 仅用于网关内部回灌 usage 事件，不参与客户端协议
+	Usage *RealtimeUsage `json:"-"`
+	// Caption 仅用于网关内部回灌 caption 事件（final 字幕落 Timeline），不参与客户端协议
+	Caption *Caption `json:"-"`
 }
 
 // ServerMessage 网关发送给客户端的消息
@@ -49,11 +65,24 @@ type ServerMessage struct {
 	Seq       int64                  `json:"seq,omitempty"`        // 服务端序号
 	TurnID    string                 `json:"turn_id,omitempty"`    // 轮次关联
 	Text      string                 `json:"text,omitempty"`       // 文本内容
-	AudioData []byte                 `json:"audio_data,omitempty"` // 音频数据（Base64编码）
+	AudioData []byte                 `json:"audio_data,omitempty"` // Deprecated: 音频走二进制帧（见 protocol.go），此字段不再下发
 	QuizData  *QuizMessageData       `json:"quiz_data,omitempty"`  // 选择题数据
+	Caption   *Caption               `json:"caption,omitempty"`    // 字幕数据（caption 事件）
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`   // 扩展字段
 	ServerTS  time.Time              `json:"server_ts"`            // 服务端时间戳
 	Error     string                 `json:"error,omitempty"`      // 错误信息
+
+	// ResumeToken 续传凭证（stream_ready / stream_resumed 携带），重连时原样带回
+	ResumeToken string `json:"resume_token,omitempty"`
+	// Replay resync 消息携带的历史消息快照（来自 Timeline，不带 seq）
+	Replay []ServerMessage `json:"replay,omitempty"`
+	// StreamID tts_started / tts_completed 对应的下行音频流（与 v2 音频帧头一致）
+	StreamID uint32 `json:"stream_id,omitempty"`
+	// Protocol stream_ready / stream_resumed 携带的协商结果（ProtocolV1/V2）
+	Protocol int `json:"protocol,omitempty"`
+	// InputAudioFormat/OutputAudioFormat stream_ready 携带的客户端侧音频格式（如 pcm16@16000、g711_ulaw）
+	InputAudioFormat  string `json:"input_audio_format,omitempty"`
+	OutputAudioFormat string `json:"output_audio_format,omitempty"`
 }
 
 // QuizMessageData 选择题消息数据
@@ -87,7 +116,7 @@ type RealtimeSessionConfig struct {
 	OutputAudioFormat       string                         `json:"output_audio_format,omitempty"`
 	TurnDetection           *TurnDetectionConfig           `json:"turn_detection,omitempty"` // VAD配置
 	InputAudioTranscription *InputAudioTranscriptionConfig `json:"input_audio_transcription,omitempty"`
-	Tools                   []interface{}                  `json:"tools,omitempty"` // Function calling（第一阶段不用）
+	Tools                   []interface{}                  `json:"tools"` // Function calling；总是下发（空数组清掉连接上之前的工具）
 	Temperature             float64                        `json:"temperature,omitempty"`
 	MaxTokens               int                            `json:"max_tokens,omitempty"`
 }
@@ -150,13 +179,15 @@ type RealtimeInputAudioBufferClear struct {
 
 // RealtimeConversationItemCreate 创建对话项（手动注入消息）
 type RealtimeConversationItemCreate struct {
-	Type    string                   `json:"type"` // "conversation.item.create"
-	EventID string                   `json:"event_id,omitempty"`
-	Item    RealtimeConversationItem `json:"item"`
+	Type           string                   `json:"type"` // "conversation.item.create"
+	EventID        string                   `json:"event_id,omitempty"`
+	PreviousItemID string                   `json:"previous_item_id,omitempty"` // 插在该 item 之后；"root" 表示插到最前
+	Item           RealtimeConversationItem `json:"item"`
 }
 
 // RealtimeConversationItem 对话项
 type RealtimeConversationItem struct {
+	ID      string                `json:"id,omitempty"`      // 客户端指定的 item ID（为空由服务端分配）
 	Type    string                `json:"type"`              // "message"/"function_call"/"function_call_output"
 	Role    string                `json:"role,omitempty"`    // "user"/"assistant"/"system"
 	Content []RealtimeContentPart `json:"content,omitempty"` // 内容部分
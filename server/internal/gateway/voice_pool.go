@@ -27,6 +27,10 @@ type VoicePool struct {
 	roleConnCreating   map[string]chan struct{}
 	roleConnCreatingMu sync.Mutex
 
+	// 断线后重连失败的角色（role -> 最后一次错误），GetRoleConn 对其直接返回 ErrRoleUnavailable
+	roleDown   map[string]error
+	roleDownMu sync.RWMutex
+
 	// ASR 专用连接（只做语音识别，不输出音频）
 	asrConn   *RoleConn
 	asrConnMu sync.RWMutex
@@ -35,13 +39,26 @@ type VoicePool struct {
 	speakingRole   string
 	speakingRoleMu sync.RWMutex
 
-	// 对话历史（用于文本镜像同步）
+	// 对话历史（用于文本镜像同步）：启用 HistoryWindow 后只保留窗口内的轮次，更早的进入滚动摘要（见 history.go）
 	conversationHistory   []ConversationTurn
 	conversationHistoryMu sync.RWMutex
+	historySeq            int
+
+	// 滚动摘要：summaryMu 保护摘要文本、摘要 item 与待摘要的轮次
+	summarizer     HistorySummarizer
+	summaryMu      sync.Mutex
+	summary        string
+	summaryItemID  string
+	summarySeq     int
+	pendingSummary []ConversationTurn
+	summarizing    bool
 
 	// 工具注册表
 	toolRegistry *tool.ToolRegistry
 
+	// 服务级预热池（可选，SetWarmPool 注入）：角色连接从这里租用，Close 时归还
+	warmPool *WarmPool
+
 	// 配置
 	config VoicePoolConfig
 
@@ -52,6 +69,9 @@ const roleConnCreateTimeout = 45 * time.Second // 增加到 45 秒，允许 3 
 
 var ErrRoleAlreadySpeaking = errors.New("voice pool: another response is already in progress")
 
+// ErrRoleUnavailable 角色连接断线且重连失败，该角色在本会话中不可用
+var ErrRoleUnavailable = errors.New("voice pool: role unavailable")
+
 func (vp *VoicePool) logf(format string, args ...any) {
 	if vp.logger != nil {
 		vp.logger.Printf(format, args...)
@@ -65,17 +85,26 @@ type ConversationTurn struct {
 	Role     string // "user" or "assistant"
 	Text     string
 	FromRole string // 对于 assistant，记录是哪个角色说的
+
+	// ItemID 镜像到各角色连接时使用的 item ID（各连接相同），滑出历史窗口时按它删除
+	ItemID string
+	// SourceItemID assistant 轮次在发言角色自己连接里的输出 item（服务端分配）
+	SourceItemID string
 }
 
 // VoicePoolConfig 音色池配置
 type VoicePoolConfig struct {
 	OpenAIAPIKey                 string
+	RealtimeURL                  string            // Realtime 端点（为空时使用官方端点）
+	RealtimeHeaders              map[string]string // 额外握手头
 	Model                        string
 	DefaultInstructions          string
 	InputAudioFormat             string
 	OutputAudioFormat            string
 	InputAudioTranscriptionModel string
 	RoleVoices                   map[string]string // role -> voice
+	PingInterval                 time.Duration     // 角色连接保活周期（见 RoleConn.SetKeepalive），<=0 关闭
+	HistoryWindow                int               // 逐字镜像的最近轮次数，更早的删除并并入摘要；<=0 不限制
 }
 
 // NewVoicePool 创建一个新的音色池
@@ -84,6 +113,7 @@ func NewVoicePool(sessionID string, config VoicePoolConfig) *VoicePool {
 		sessionID:           sessionID,
 		roleConns:           make(map[string]*RoleConn),
 		roleConnCreating:    make(map[string]chan struct{}),
+		roleDown:            make(map[string]error),
 		conversationHistory: make([]ConversationTurn, 0),
 		config:              config,
 		logger:              log.Default(),
@@ -109,6 +139,8 @@ func (vp *VoicePool) Initialize(ctx context.Context) error {
 func (vp *VoicePool) newRoleConn(ctx context.Context, role string, voice string) (*RoleConn, error) {
 	config := RoleConnConfig{
 		OpenAIAPIKey:                 vp.config.OpenAIAPIKey,
+		RealtimeURL:                  vp.config.RealtimeURL,
+		RealtimeHeaders:              vp.config.RealtimeHeaders,
 		Model:                        vp.config.Model,
 		Voice:                        voice,
 		Instructions:                 vp.config.DefaultInstructions,
@@ -118,6 +150,15 @@ func (vp *VoicePool) newRoleConn(ctx context.Context, role string, voice string)
 		EnableAudioOutput:            true,
 	}
 
+	if vp.warmPool != nil {
+		roleConn, err := vp.warmPool.Lease(ctx, role, config, vp.toolRegistry)
+		if err != nil {
+			return nil, fmt.Errorf("lease warm conn: %w", err)
+		}
+		roleConn.SetKeepalive(vp.config.PingInterval)
+		return roleConn, nil
+	}
+
 	roleConn := NewRoleConn(role, voice, config)
 
 	// 设置工具注册表（如果有）
@@ -134,6 +175,7 @@ func (vp *VoicePool) newRoleConn(ctx context.Context, role string, voice string)
 		_ = roleConn.Close()
 		return nil, fmt.Errorf("initialize: %w", err)
 	}
+	roleConn.SetKeepalive(vp.config.PingInterval)
 
 	return roleConn, nil
 }
@@ -142,6 +184,8 @@ func (vp *VoicePool) newRoleConn(ctx context.Context, role string, voice string)
 func (vp *VoicePool) createASRConn(ctx context.Context) error {
 	config := RoleConnConfig{
 		OpenAIAPIKey:                 vp.config.OpenAIAPIKey,
+		RealtimeURL:                  vp.config.RealtimeURL,
+		RealtimeHeaders:              vp.config.RealtimeHeaders,
 		Model:                        vp.config.Model,
 		Voice:                        "alloy",
 		Instructions:                 vp.config.DefaultInstructions,
@@ -185,6 +229,9 @@ func (vp *VoicePool) GetRoleConn(ctx context.Context, role string) (*RoleConn, e
 	if exists {
 		return conn, nil
 	}
+	if err := vp.roleDownErr(role); err != nil {
+		return nil, err
+	}
 
 	// 检查是否有其他 goroutine 正在创建
 	vp.roleConnCreatingMu.Lock()
@@ -207,6 +254,9 @@ func (vp *VoicePool) GetRoleConn(ctx context.Context, role string) (*RoleConn, e
 			if exists {
 				return conn, nil
 			}
+			if err := vp.roleDownErr(role); err != nil {
+				return nil, err
+			}
 			return nil, fmt.Errorf("role conn creation completed but conn not found for '%s'", role)
 		case <-ctx.Done():
 			return nil, ctx.Err()
@@ -265,12 +315,160 @@ func (vp *VoicePool) GetRoleConn(ctx context.Context, role string) (*RoleConn, e
 	return roleConn, nil
 }
 
+// ReconnectRole 角色连接断线后重建：关闭旧连接，重新拨号并下发 session.update（newRoleConn），
+// 再用 syncConversationHistoryToRole 回放对话历史，最后替换 roleConns 中的连接。
+// 重建期间占用创建标记，并发的 GetRoleConn 会等待结果而不是各自拨号；
+// attempts 次都失败后该角色标记为不可用（ErrRoleUnavailable）。onAttempt 在每次尝试前回调（可为 nil）。
+func (vp *VoicePool) ReconnectRole(ctx context.Context, role string, attempts int, onAttempt func(attempt int)) (*RoleConn, error) {
+	voice, ok := vp.config.RoleVoices[role]
+	if !ok {
+		return nil, fmt.Errorf("role '%s' not configured in RoleVoices", role)
+	}
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	vp.roleConnCreatingMu.Lock()
+	if vp.roleConnCreating == nil {
+		vp.roleConnCreating = make(map[string]chan struct{})
+	}
+	if _, busy := vp.roleConnCreating[role]; busy {
+		vp.roleConnCreatingMu.Unlock()
+		return nil, fmt.Errorf("role conn for '%s' is already being created", role)
+	}
+	creatingChan := make(chan struct{})
+	vp.roleConnCreating[role] = creatingChan
+	vp.roleConnCreatingMu.Unlock()
+
+	defer func() {
+		vp.roleConnCreatingMu.Lock()
+		delete(vp.roleConnCreating, role)
+		close(creatingChan)
+		vp.roleConnCreatingMu.Unlock()
+	}()
+
+	// 断掉的连接不归还预热池，直接关闭
+	vp.roleConnsMu.Lock()
+	old := vp.roleConns[role]
+	delete(vp.roleConns, role)
+	vp.roleConnsMu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+
+	var lastErr error
+retry:
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if onAttempt != nil {
+			onAttempt(attempt)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, roleConnCreateTimeout)
+		roleConn, err := vp.newRoleConn(attemptCtx, role, voice)
+		cancel()
+		if err == nil {
+			vp.syncConversationHistoryToRole(role, roleConn)
+
+			vp.roleConnsMu.Lock()
+			vp.roleConns[role] = roleConn
+			vp.roleConnsMu.Unlock()
+
+			// 之前重连失败被标记为不可用的角色（后台重试成功）恢复可用
+			vp.roleDownMu.Lock()
+			delete(vp.roleDown, role)
+			vp.roleDownMu.Unlock()
+
+			vp.logf("[VoicePool:%s] ✅ Role conn for '%s' reconnected (attempt %d/%d)", vp.sessionID, role, attempt, attempts)
+			return roleConn, nil
+		}
+
+		lastErr = err
+		vp.logf("[VoicePool:%s] ⚠️  Reconnect attempt %d/%d for '%s' failed: %v", vp.sessionID, attempt, attempts, role, err)
+		if attempt == attempts {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			lastErr = ctx.Err()
+			break retry
+		}
+	}
+
+	vp.roleDownMu.Lock()
+	if vp.roleDown == nil {
+		vp.roleDown = make(map[string]error)
+	}
+	vp.roleDown[role] = lastErr
+	vp.roleDownMu.Unlock()
+
+	vp.logf("[VoicePool:%s] ❌ Role '%s' unavailable after %d reconnect attempts: %v", vp.sessionID, role, attempts, lastErr)
+	return nil, fmt.Errorf("%w: %s: %v", ErrRoleUnavailable, role, lastErr)
+}
+
+// ReconnectASR ASR 连接断线后重建：关闭旧连接，重新拨号并下发 session.update（createASRConn）。
+// ASR 连接只做转写，不镜像对话历史，重建后无需回放。attempts 次都失败时返回最后一次错误；
+// onAttempt 在每次尝试前回调（可为 nil）。
+func (vp *VoicePool) ReconnectASR(ctx context.Context, attempts int, onAttempt func(attempt int)) (*RoleConn, error) {
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	vp.asrConnMu.Lock()
+	old := vp.asrConn
+	vp.asrConn = nil
+	vp.asrConnMu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if onAttempt != nil {
+			onAttempt(attempt)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, roleConnCreateTimeout)
+		err := vp.createASRConn(attemptCtx)
+		cancel()
+		if err == nil {
+			vp.logf("[VoicePool:%s] ✅ ASR conn reconnected (attempt %d/%d)", vp.sessionID, attempt, attempts)
+			return vp.GetASRConn()
+		}
+
+		lastErr = err
+		vp.logf("[VoicePool:%s] ⚠️  ASR reconnect attempt %d/%d failed: %v", vp.sessionID, attempt, attempts, err)
+		if attempt == attempts {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("reconnect ASR conn: %w", ctx.Err())
+		}
+	}
+	return nil, fmt.Errorf("reconnect ASR conn: %w", lastErr)
+}
+
+// roleDownErr 角色重连失败时返回 ErrRoleUnavailable
+func (vp *VoicePool) roleDownErr(role string) error {
+	vp.roleDownMu.RLock()
+	defer vp.roleDownMu.RUnlock()
+	if err, down := vp.roleDown[role]; down {
+		return fmt.Errorf("%w: %s: %v", ErrRoleUnavailable, role, err)
+	}
+	return nil
+}
+
 // syncConversationHistoryToRole 将现有对话历史同步到指定角色连接
 func (vp *VoicePool) syncConversationHistoryToRole(role string, conn *RoleConn) {
 	if conn == nil {
 		return
 	}
 
+	// 先放摘要（插在最前），再放窗口内的原文
+	vp.syncSummaryToRole(role, conn)
+
 	vp.conversationHistoryMu.RLock()
 	history := make([]ConversationTurn, len(vp.conversationHistory))
 	copy(history, vp.conversationHistory)
@@ -285,12 +483,12 @@ func (vp *VoicePool) syncConversationHistoryToRole(role string, conn *RoleConn)
 	for _, turn := range history {
 		switch turn.Role {
 		case "user":
-			if err := conn.SyncUserText(turn.Text); err != nil {
+			if err := conn.syncUserText(turn.ItemID, turn.Text); err != nil {
 				vp.logf("[VoicePool:%s] ⚠️  Failed to sync historical user text to %s: %v", vp.sessionID, role, err)
 			}
 
 		case "assistant":
-			if err := conn.SyncAssistantText(turn.Text, turn.FromRole); err != nil {
+			if err := conn.syncAssistantText(turn.ItemID, turn.Text, turn.FromRole); err != nil {
 				vp.logf("[VoicePool:%s] ⚠️  Failed to sync historical assistant text to %s: %v", vp.sessionID, role, err)
 			}
 		}
@@ -312,12 +510,11 @@ func (vp *VoicePool) GetASRConn() (*RoleConn, error) {
 func (vp *VoicePool) SyncUserText(text string) error {
 	vp.logf("[VoicePool:%s] Syncing user text to all role conns: %s", vp.sessionID, text)
 
-	vp.conversationHistoryMu.Lock()
-	vp.conversationHistory = append(vp.conversationHistory, ConversationTurn{
+	turn, evicted := vp.appendTurn(ConversationTurn{
 		Role: "user",
 		Text: text,
 	})
-	vp.conversationHistoryMu.Unlock()
+	defer vp.evictTurns(evicted)
 
 	// 遍历配置的所有角色
 	var lastErr error
@@ -329,7 +526,7 @@ func (vp *VoicePool) SyncUserText(text string) error {
 
 		if exists {
 			// 连接已存在，直接同步
-			if err := conn.SyncUserText(text); err != nil {
+			if err := conn.syncUserText(turn.ItemID, text); err != nil {
 				vp.logf("[VoicePool:%s] ⚠️  Failed to sync user text to %s: %v", vp.sessionID, role, err)
 				lastErr = err
 			}
@@ -348,15 +545,21 @@ func (vp *VoicePool) SyncUserText(text string) error {
 
 // SyncAssistantText 同步助手文本到所有角色连接
 func (vp *VoicePool) SyncAssistantText(text string, fromRole string) error {
+	return vp.SyncAssistantOutput(text, fromRole, "")
+}
+
+// SyncAssistantOutput 同 SyncAssistantText；sourceItemID 是发言角色自己连接里的输出 item，
+// 该轮滑出历史窗口时用它从发言角色的对话中删除。
+func (vp *VoicePool) SyncAssistantOutput(text string, fromRole string, sourceItemID string) error {
 	vp.logf("[VoicePool:%s] Syncing assistant text from %s to all role conns: %s", vp.sessionID, fromRole, text)
 
-	vp.conversationHistoryMu.Lock()
-	vp.conversationHistory = append(vp.conversationHistory, ConversationTurn{
-		Role:     "assistant",
-		Text:     text,
-		FromRole: fromRole,
+	turn, evicted := vp.appendTurn(ConversationTurn{
+		Role:         "assistant",
+		Text:         text,
+		FromRole:     fromRole,
+		SourceItemID: sourceItemID,
 	})
-	vp.conversationHistoryMu.Unlock()
+	defer vp.evictTurns(evicted)
 
 	// 只同步到已存在的连接，避免阻塞
 	vp.roleConnsMu.RLock()
@@ -376,7 +579,7 @@ func (vp *VoicePool) SyncAssistantText(text string, fromRole string) error {
 			continue
 		}
 
-		if err := conn.SyncAssistantText(text, fromRole); err != nil {
+		if err := conn.syncAssistantText(turn.ItemID, text, fromRole); err != nil {
 			vp.logf("[VoicePool:%s] ⚠️  Failed to sync assistant text to %s: %v", vp.sessionID, role, err)
 			lastErr = err
 		} else {
@@ -490,12 +693,27 @@ func (vp *VoicePool) SetToolRegistry(registry *tool.ToolRegistry) {
 	vp.asrConnMu.RUnlock()
 }
 
-// Close 关闭所有连接
+// SetWarmPool 设置服务级预热池（需在创建角色连接之前调用）。
+// 预热池的 Realtime 配置与本会话不一致时忽略，仍按需拨号。
+func (vp *VoicePool) SetWarmPool(pool *WarmPool) {
+	if pool != nil && !pool.compatible(vp.config) {
+		vp.logf("[VoicePool:%s] ⚠️  Warm pool config mismatch (model/url/key), dialing role conns on demand", vp.sessionID)
+		return
+	}
+	vp.warmPool = pool
+}
+
+// Close 关闭所有连接（来自预热池的角色连接归还给池）
 func (vp *VoicePool) Close() error {
 	vp.logf("[VoicePool:%s] Closing voice pool", vp.sessionID)
 
 	vp.roleConnsMu.Lock()
 	for role, conn := range vp.roleConns {
+		if vp.warmPool != nil {
+			vp.logf("[VoicePool:%s] Releasing role conn to warm pool: %s", vp.sessionID, role)
+			vp.warmPool.Release(conn)
+			continue
+		}
 		vp.logf("[VoicePool:%s] Closing role conn: %s", vp.sessionID, role)
 		_ = conn.Close()
 	}
@@ -0,0 +1,417 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"bubble-talk/server/internal/tool"
+)
+
+// WarmPool 服务级的 Realtime 角色连接预热池（按音色分组，跨会话复用）。
+//
+// 按需拨号（握手 + session.update，失败还要重试）会让每个新会话的角色开口明显卡顿。
+// WarmPool 为每个音色预先建好若干条连接，会话通过 Lease 租用、关闭时 Release 归还：
+//   - 租用时删除上一个会话留下的对话 item，并用 session.update 套上新角色的指令与工具；
+//   - 空闲连接定期 ping，超过 MaxAge、断开或 pong 超时的连接被淘汰；
+//   - 每个音色的空闲连接数补足到 MinIdle，归还时超过 MaxIdle 的直接关闭；
+//   - 池里没有空闲连接时 Lease 现场拨号（与不启用预热池时相同）。
+type WarmPool struct {
+	config WarmPoolConfig
+
+	mu      sync.Mutex
+	idle    map[string][]*warmConn // voice -> 空闲连接（末尾最新）
+	dialing map[string]int         // voice -> 正在补充的连接数
+	closed  bool
+
+	refill    chan struct{}
+	closeChan chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	logger *log.Logger
+}
+
+// WarmPoolConfig 预热池配置。Realtime 相关字段应与会话的 VoicePoolConfig 一致：
+// model 建连后不能再改，不一致的会话不会使用预热池（见 compatible）。
+type WarmPoolConfig struct {
+	OpenAIAPIKey                 string
+	RealtimeURL                  string
+	RealtimeHeaders              map[string]string
+	Model                        string
+	DefaultInstructions          string
+	InputAudioFormat             string
+	OutputAudioFormat            string
+	InputAudioTranscriptionModel string
+
+	// Voices 需要预热的音色
+	Voices []string
+	// MinIdle 每个音色至少保持的空闲连接数
+	MinIdle int
+	// MaxIdle 每个音色最多保留的空闲连接数；<MinIdle 时取 MinIdle
+	MaxIdle int
+	// MaxAge 连接的最长寿命（Realtime 会话有时长上限），超过后不再租出；<=0 时取默认值
+	MaxAge time.Duration
+	// HealthInterval 健康检查（ping、淘汰、补充）的周期；<=0 时取默认值
+	HealthInterval time.Duration
+}
+
+const (
+	defaultWarmPoolMaxAge         = 25 * time.Minute
+	defaultWarmPoolHealthInterval = 30 * time.Second
+	warmPoolDialTimeout           = roleConnCreateTimeout
+	warmPoolPingTimeout           = 5 * time.Second
+)
+
+// warmConn 池中的一条空闲连接
+type warmConn struct {
+	conn      *RoleConn
+	idleSince time.Time
+	stop      chan struct{} // 关闭后停止丢弃读到的消息（租出或淘汰前）
+	drained   chan struct{}
+}
+
+// NewWarmPool 创建预热池；调用 Start 后开始预热与健康检查
+func NewWarmPool(config WarmPoolConfig) *WarmPool {
+	if config.MinIdle < 0 {
+		config.MinIdle = 0
+	}
+	if config.MaxIdle < config.MinIdle {
+		config.MaxIdle = config.MinIdle
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = defaultWarmPoolMaxAge
+	}
+	if config.HealthInterval <= 0 {
+		config.HealthInterval = defaultWarmPoolHealthInterval
+	}
+
+	return &WarmPool{
+		config:    config,
+		idle:      make(map[string][]*warmConn),
+		dialing:   make(map[string]int),
+		refill:    make(chan struct{}, 1),
+		closeChan: make(chan struct{}),
+		logger:    log.Default(),
+	}
+}
+
+// Start 启动后台维护（立即补足 MinIdle，之后按 HealthInterval 周期检查）
+func (wp *WarmPool) Start() {
+	wp.startOnce.Do(func() {
+		wp.logger.Printf("[WarmPool] Starting: voices=%v min_idle=%d max_idle=%d max_age=%v",
+			wp.config.Voices, wp.config.MinIdle, wp.config.MaxIdle, wp.config.MaxAge)
+		wp.wg.Add(1)
+		go wp.maintainLoop()
+		wp.kick()
+	})
+}
+
+// compatible 会话的 Realtime 配置是否能使用池中的连接
+func (wp *WarmPool) compatible(config VoicePoolConfig) bool {
+	return config.Model == wp.config.Model &&
+		config.RealtimeURL == wp.config.RealtimeURL &&
+		config.OpenAIAPIKey == wp.config.OpenAIAPIKey
+}
+
+// Lease 租用一条指定音色的连接：重置对话并按 config 下发 session.update（角色指令、工具）。
+// 池里没有可用连接时现场拨号。
+func (wp *WarmPool) Lease(ctx context.Context, role string, config RoleConnConfig, registry *tool.ToolRegistry) (*RoleConn, error) {
+	voice := config.Voice
+	conn := wp.takeIdle(voice)
+	if conn != nil {
+		wp.logger.Printf("[WarmPool] ✅ Leased warm conn: voice=%s role=%s", voice, role)
+		wp.kick()
+	} else {
+		wp.logger.Printf("[WarmPool] ⚠️  No warm conn for voice=%s, dialing for role=%s", voice, role)
+		var err error
+		if conn, err = wp.dialRoleConn(ctx, voice); err != nil {
+			return nil, err
+		}
+	}
+
+	conn.assign(role, config)
+	// 没有注册表也要重置，否则连接会带着上一个租户的工具
+	conn.SetToolRegistry(registry)
+	if err := conn.resetConversation(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("reset conversation: %w", err)
+	}
+	if err := conn.Initialize(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	return conn, nil
+}
+
+// Release 归还连接：健康且未超过 MaxIdle 的放回池中，否则关闭
+func (wp *WarmPool) Release(conn *RoleConn) {
+	if conn == nil {
+		return
+	}
+	conn.detachReader()
+
+	// 上一个会话可能正在说话：取消掉，残余的增量由空闲期的丢弃循环吞掉
+	conn.activeResponseIDLock.RLock()
+	speaking := conn.activeResponseID != ""
+	conn.activeResponseIDLock.RUnlock()
+	if speaking {
+		_ = conn.CancelResponse()
+	}
+
+	if reason := wp.evictReason(conn, time.Now()); reason != "" {
+		wp.logger.Printf("[WarmPool] 🗑️  Closing released conn: voice=%s reason=%s", conn.voice, reason)
+		_ = conn.Close()
+		return
+	}
+
+	wp.mu.Lock()
+	if wp.closed || !wp.hasVoice(conn.voice) || len(wp.idle[conn.voice]) >= wp.config.MaxIdle {
+		wp.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	wp.pushIdleLocked(conn)
+	wp.mu.Unlock()
+	wp.logger.Printf("[WarmPool] ♻️  Conn returned to pool: voice=%s", conn.voice)
+}
+
+// IdleCount 指定音色当前的空闲连接数
+func (wp *WarmPool) IdleCount(voice string) int {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return len(wp.idle[voice])
+}
+
+// Close 停止维护并关闭所有空闲连接（已租出的连接由会话关闭时自行关闭）
+func (wp *WarmPool) Close() error {
+	wp.closeOnce.Do(func() {
+		wp.mu.Lock()
+		wp.closed = true
+		idle := wp.idle
+		wp.idle = make(map[string][]*warmConn)
+		wp.mu.Unlock()
+
+		close(wp.closeChan)
+		for _, conns := range idle {
+			for _, wc := range conns {
+				wc.release()
+				_ = wc.conn.Close()
+			}
+		}
+		wp.wg.Wait()
+		wp.logger.Printf("[WarmPool] ✅ Closed")
+	})
+	return nil
+}
+
+// takeIdle 取出一条可用的空闲连接（优先最新的，剩余寿命最长）
+func (wp *WarmPool) takeIdle(voice string) *RoleConn {
+	now := time.Now()
+	for {
+		wp.mu.Lock()
+		conns := wp.idle[voice]
+		if wp.closed || len(conns) == 0 {
+			wp.mu.Unlock()
+			return nil
+		}
+		wc := conns[len(conns)-1]
+		wp.idle[voice] = conns[:len(conns)-1]
+		wp.mu.Unlock()
+
+		wc.release()
+		if reason := wp.evictReason(wc.conn, now); reason != "" {
+			wp.logger.Printf("[WarmPool] 🗑️  Evicting idle conn on lease: voice=%s reason=%s", voice, reason)
+			_ = wc.conn.Close()
+			continue
+		}
+		return wc.conn
+	}
+}
+
+// evictReason 连接不应再使用的原因；空串表示健康
+func (wp *WarmPool) evictReason(conn *RoleConn, now time.Time) string {
+	switch {
+	case !conn.alive():
+		return "closed"
+	case now.Sub(conn.connectedAt()) >= wp.config.MaxAge:
+		return "max_age"
+	case now.Sub(conn.lastPongAt()) > 2*wp.config.HealthInterval+warmPoolPingTimeout:
+		return "pong_timeout"
+	default:
+		return ""
+	}
+}
+
+func (wp *WarmPool) hasVoice(voice string) bool {
+	for _, v := range wp.config.Voices {
+		if v == voice {
+			return true
+		}
+	}
+	return false
+}
+
+// pushIdleLocked 放入空闲列表，并开始丢弃该连接读到的消息（调用方持有 mu）
+func (wp *WarmPool) pushIdleLocked(conn *RoleConn) {
+	wc := &warmConn{
+		conn:      conn,
+		idleSince: time.Now(),
+		stop:      make(chan struct{}),
+		drained:   make(chan struct{}),
+	}
+	go func() {
+		defer close(wc.drained)
+		conn.discardUntil(wc.stop)
+	}()
+	wp.idle[conn.voice] = append(wp.idle[conn.voice], wc)
+}
+
+// release 停止丢弃循环，之后连接的消息交给新的使用方
+func (wc *warmConn) release() {
+	close(wc.stop)
+	<-wc.drained
+}
+
+// kick 请求一次立即补充（非阻塞）
+func (wp *WarmPool) kick() {
+	select {
+	case wp.refill <- struct{}{}:
+	default:
+	}
+}
+
+// maintainLoop 周期性健康检查；收到 kick 时只补充连接
+func (wp *WarmPool) maintainLoop() {
+	defer wp.wg.Done()
+
+	ticker := time.NewTicker(wp.config.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wp.closeChan:
+			return
+		case <-ticker.C:
+			wp.checkHealth()
+			wp.fill()
+		case <-wp.refill:
+			wp.fill()
+		}
+	}
+}
+
+// checkHealth 淘汰断开/过期/pong 超时的空闲连接，其余发送 ping
+func (wp *WarmPool) checkHealth() {
+	now := time.Now()
+	var evicted []*warmConn
+	var alive []*RoleConn
+
+	wp.mu.Lock()
+	for voice, conns := range wp.idle {
+		kept := conns[:0]
+		for _, wc := range conns {
+			if reason := wp.evictReason(wc.conn, now); reason != "" {
+				wp.logger.Printf("[WarmPool] 🗑️  Evicting idle conn: voice=%s reason=%s idle=%v",
+					voice, reason, now.Sub(wc.idleSince).Round(time.Second))
+				evicted = append(evicted, wc)
+				continue
+			}
+			kept = append(kept, wc)
+			alive = append(alive, wc.conn)
+		}
+		for i := len(kept); i < len(conns); i++ {
+			conns[i] = nil
+		}
+		wp.idle[voice] = kept
+	}
+	wp.mu.Unlock()
+
+	for _, wc := range evicted {
+		wc.release()
+		_ = wc.conn.Close()
+	}
+	for _, conn := range alive {
+		if err := conn.ping(warmPoolPingTimeout); err != nil {
+			wp.logger.Printf("[WarmPool] ⚠️  Ping failed: voice=%s err=%v", conn.voice, err)
+		}
+	}
+}
+
+// fill 为每个音色补足 MinIdle（异步拨号，失败等下个周期再试）
+func (wp *WarmPool) fill() {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	if wp.closed {
+		return
+	}
+
+	for _, voice := range wp.config.Voices {
+		need := wp.config.MinIdle - len(wp.idle[voice]) - wp.dialing[voice]
+		for i := 0; i < need; i++ {
+			wp.dialing[voice]++
+			wp.wg.Add(1)
+			go wp.dialIdle(voice)
+		}
+	}
+}
+
+// dialIdle 拨号一条空闲连接放入池中
+func (wp *WarmPool) dialIdle(voice string) {
+	defer wp.wg.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), warmPoolDialTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-wp.closeChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	conn, err := wp.dialRoleConn(ctx, voice)
+
+	wp.mu.Lock()
+	wp.dialing[voice]--
+	if err != nil {
+		wp.mu.Unlock()
+		wp.logger.Printf("[WarmPool] ❌ Failed to warm conn for voice=%s: %v", voice, err)
+		return
+	}
+	if wp.closed {
+		wp.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	wp.pushIdleLocked(conn)
+	wp.mu.Unlock()
+	wp.logger.Printf("[WarmPool] ✅ Warmed conn: voice=%s", voice)
+}
+
+// dialRoleConn 拨号并初始化一条连接（池中连接的角色名为 "warm"，租用时改为实际角色）
+func (wp *WarmPool) dialRoleConn(ctx context.Context, voice string) (*RoleConn, error) {
+	conn := NewRoleConn("warm", voice, RoleConnConfig{
+		OpenAIAPIKey:                 wp.config.OpenAIAPIKey,
+		RealtimeURL:                  wp.config.RealtimeURL,
+		RealtimeHeaders:              wp.config.RealtimeHeaders,
+		Model:                        wp.config.Model,
+		Voice:                        voice,
+		Instructions:                 wp.config.DefaultInstructions,
+		InputAudioFormat:             wp.config.InputAudioFormat,
+		OutputAudioFormat:            wp.config.OutputAudioFormat,
+		InputAudioTranscriptionModel: wp.config.InputAudioTranscriptionModel,
+		EnableAudioOutput:            true,
+	})
+	if err := conn.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	if err := conn.Initialize(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	return conn, nil
+}
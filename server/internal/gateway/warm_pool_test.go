@@ -0,0 +1,197 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/gateway/realtimetest"
+	"bubble-talk/server/internal/tool"
+)
+
+func newTestWarmPool(fake *realtimetest.Server, interval time.Duration) *WarmPool {
+	return NewWarmPool(WarmPoolConfig{
+		OpenAIAPIKey:   "test-key",
+		RealtimeURL:    fake.URL(),
+		Model:          "fake-realtime",
+		Voices:         []string{"cedar"},
+		MinIdle:        1,
+		MaxIdle:        2,
+		HealthInterval: interval,
+	})
+}
+
+func waitIdleCount(t *testing.T, wp *WarmPool, voice string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for wp.IdleCount(voice) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("idle count for %s: got %d want %d", voice, wp.IdleCount(voice), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWarmPool_LeaseResetsConversationAndAppliesRole(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	wp := newTestWarmPool(fake, time.Minute)
+	wp.Start()
+	defer wp.Close()
+	waitIdleCount(t, wp, "cedar", 1)
+	warm := fake.Conns()[0]
+
+	// 租出预热好的连接，套上 host 的指令；池随后补回一条空闲连接
+	cfg := RoleConnConfig{Voice: "cedar", Instructions: "You are the host."}
+	conn, err := wp.Lease(context.Background(), "host", cfg, nil)
+	if err != nil {
+		t.Fatalf("lease: %v", err)
+	}
+	if _, err := warm.WaitFor("session.update", 2, 2*time.Second); err != nil {
+		t.Fatalf("lease should re-apply session.update: %v", err)
+	}
+	if got := warm.Session()["instructions"]; got != "You are the host." {
+		t.Fatalf("instructions = %v", got)
+	}
+	waitIdleCount(t, wp, "cedar", 1)
+
+	// 上一个会话留下对话 item，归还后原读者立即被摘下
+	if err := conn.SyncUserText("第一个会话的发言"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if _, err := warm.WaitFor("conversation.item.create", 1, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(50 * time.Millisecond) // 等读泵记下 conversation.item.created
+	wp.Release(conn)
+	select {
+	case err := <-readErr:
+		if !errors.Is(err, errRoleConnReleased) {
+			t.Fatalf("reader error = %v, want errRoleConnReleased", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reader not detached on release")
+	}
+	waitIdleCount(t, wp, "cedar", 2)
+
+	// 再次租用拿到最近归还的那条：旧对话被逐条删除
+	again, err := wp.Lease(context.Background(), "economist", RoleConnConfig{Voice: "cedar", Instructions: "You are the economist."}, nil)
+	if err != nil {
+		t.Fatalf("second lease: %v", err)
+	}
+	if again != conn {
+		t.Fatal("expected the most recently released conn to be reused")
+	}
+	if _, err := warm.WaitFor("conversation.item.delete", 1, 2*time.Second); err != nil {
+		t.Fatalf("lease should delete old items: %v", err)
+	}
+	if _, err := warm.WaitFor("session.update", 3, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if items := warm.Items(); len(items) != 0 {
+		t.Fatalf("items after reset = %v", items)
+	}
+	if got := len(fake.Conns()); got != 2 {
+		t.Fatalf("dialed %d conns, want 2 (one warm + one refill)", got)
+	}
+}
+
+func TestWarmPool_LeaseClearsPreviousTools(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	wp := newTestWarmPool(fake, time.Minute)
+	wp.Start()
+	defer wp.Close()
+	waitIdleCount(t, wp, "cedar", 1)
+	warm := fake.Conns()[0]
+
+	registry := tool.NewToolRegistry()
+	registry.Register(tool.NewQuizTool(nil))
+	conn, err := wp.Lease(context.Background(), "host", RoleConnConfig{Voice: "cedar"}, registry)
+	if err != nil {
+		t.Fatalf("lease: %v", err)
+	}
+	if _, err := warm.WaitFor("session.update", 2, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if tools, _ := warm.Session()["tools"].([]interface{}); len(tools) != 1 {
+		t.Fatalf("tools = %v", warm.Session()["tools"])
+	}
+	waitIdleCount(t, wp, "cedar", 1)
+	wp.Release(conn)
+	waitIdleCount(t, wp, "cedar", 2)
+
+	// 下一个租户没有工具：本地注册表与服务端的工具都要清掉
+	again, err := wp.Lease(context.Background(), "economist", RoleConnConfig{Voice: "cedar"}, nil)
+	if err != nil {
+		t.Fatalf("second lease: %v", err)
+	}
+	if again != conn || again.toolRegistry != nil {
+		t.Fatalf("reused = %v, registry = %v", again == conn, again.toolRegistry)
+	}
+	if _, err := warm.WaitFor("session.update", 3, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	tools, ok := warm.Session()["tools"].([]interface{})
+	if !ok || len(tools) != 0 {
+		t.Fatalf("tools after second lease = %#v", warm.Session()["tools"])
+	}
+}
+
+func TestWarmPool_EvictsDeadIdleConnAndRefills(t *testing.T) {
+	fake := realtimetest.NewServer()
+	defer fake.Close()
+
+	wp := newTestWarmPool(fake, 50*time.Millisecond)
+	wp.Start()
+	defer wp.Close()
+	waitIdleCount(t, wp, "cedar", 1)
+
+	// 服务端断开空闲连接：健康检查淘汰它并补上一条新的
+	first := fake.Conns()[0]
+	first.Close()
+	if _, err := fake.WaitConn(5*time.Second, func(c *realtimetest.Conn) bool { return c != first }); err != nil {
+		t.Fatalf("pool did not refill: %v", err)
+	}
+	waitIdleCount(t, wp, "cedar", 1)
+
+	conn, err := wp.Lease(context.Background(), "host", RoleConnConfig{Voice: "cedar"}, nil)
+	if err != nil {
+		t.Fatalf("lease: %v", err)
+	}
+	if !conn.alive() {
+		t.Fatal("leased conn should be alive")
+	}
+	// 健康连接持续收到 pong
+	before := conn.lastPongAt()
+	if err := conn.ping(time.Second); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for !conn.lastPongAt().After(before) {
+		if time.Now().After(deadline) {
+			t.Fatal("no pong received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	wp.Release(conn)
+}
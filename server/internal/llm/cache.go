@@ -0,0 +1,354 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheMaxEntries 内存 LRU 默认容量
+const defaultCacheMaxEntries = 512
+
+// CacheOptions 响应缓存配置。
+type CacheOptions struct {
+	// MaxEntries 内存 LRU 容量，<=0 使用默认值
+	MaxEntries int
+	// Dir 可选磁盘层目录；为空时只用内存
+	Dir string
+	// Namespace 缓存命名空间（通常是 provider/model），切换模型后磁盘缓存自然失效
+	Namespace string
+	// TTLs 缓存名 -> TTL。缓存名默认为 schema 名；无 schema 的纯文本调用只有通过 WithCacheTag 打了标签才会缓存，
+	// 缓存名即标签。未列出的一律不缓存：导演主决策（segment_plan/director_plan）不是幂等的，不能缓存。
+	TTLs map[string]time.Duration
+}
+
+type cacheKeyCtxKey struct{}
+
+type cacheTagCtxKey struct{}
+
+// WithCacheTag 为本次调用指定缓存名（按它查 TTL、记命中统计），替代 schema 名。
+// 无 schema 的纯文本调用必须显式打标签才可能被缓存，避免面向学习者的自由文本被跨会话复用。
+func WithCacheTag(ctx context.Context, tag string) context.Context {
+	if tag == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, cacheTagCtxKey{}, tag)
+}
+
+// cacheName 本次调用的缓存名；返回 false 表示不参与缓存（未打标签的纯文本调用）
+func cacheName(ctx context.Context, schema *JSONSchema) (string, bool) {
+	if tag, _ := ctx.Value(cacheTagCtxKey{}).(string); tag != "" {
+		return tag, true
+	}
+	return schemaName(schema), schema != nil
+}
+
+// WithCacheKey 为本次调用指定语义缓存键，替代默认的“按完整消息内容寻址”。
+// 适用于调用方知道哪些输入才是“有意义的变化”的场景（如忽略填充语气词后的对话轮次）。
+func WithCacheKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, cacheKeyCtxKey{}, key)
+}
+
+// CacheStats 单个 schema 的缓存计数。
+type CacheStats struct {
+	Schema string `json:"schema"`
+	// Hits 内存命中
+	Hits int64 `json:"hits"`
+	// DiskHits 磁盘层命中（随后回填内存）
+	DiskHits int64 `json:"disk_hits"`
+	Misses   int64 `json:"misses"`
+	// Bypass 未配置 TTL、直接透传的调用
+	Bypass int64 `json:"bypass"`
+}
+
+// CacheMetrics 记录各 schema 的缓存命中情况。
+type CacheMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*CacheStats
+}
+
+// NewCacheMetrics 创建缓存计数器
+func NewCacheMetrics() *CacheMetrics {
+	return &CacheMetrics{stats: make(map[string]*CacheStats)}
+}
+
+// DefaultCacheMetrics 进程级默认缓存计数器，NewClient 创建的缓存客户端都记到这里。
+var DefaultCacheMetrics = NewCacheMetrics()
+
+func (m *CacheMetrics) record(schema string, update func(s *CacheStats)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.stats[schema]
+	if !ok {
+		s = &CacheStats{Schema: schema}
+		m.stats[schema] = s
+	}
+	update(s)
+}
+
+// Snapshot 返回当前计数的副本（按 schema 排序）。
+func (m *CacheMetrics) Snapshot() []CacheStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]CacheStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Schema < out[j].Schema })
+	return out
+}
+
+type cacheEntry struct {
+	key       string
+	Schema    string    `json:"schema"`
+	Response  string    `json:"response"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CachingClient 内容寻址的响应缓存装饰器（内存 LRU + 可选磁盘层）。
+//
+// 契约：
+// - 只缓存配置了 TTL 的 schema 或调用标签，其余调用（含未打标签的纯文本调用）直接透传。
+// - 只缓存成功结果；放在 ValidatingClient 外层时，缓存的都是已校验通过的输出。
+// - 缓存命中不产生 LLM 调用，因此不会上报用量。
+type CachingClient struct {
+	inner   Client
+	opts    CacheOptions
+	metrics *CacheMetrics
+	now     func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// NewCachingClient 创建缓存装饰器；metrics 为 nil 时使用 DefaultCacheMetrics。
+func NewCachingClient(inner Client, opts CacheOptions, metrics *CacheMetrics) *CachingClient {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultCacheMaxEntries
+	}
+	if metrics == nil {
+		metrics = DefaultCacheMetrics
+	}
+	return &CachingClient{
+		inner:   inner,
+		opts:    opts,
+		metrics: metrics,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Unwrap 返回被装饰的客户端
+func (c *CachingClient) Unwrap() Client {
+	return c.inner
+}
+
+// Complete 实现 Client 接口
+func (c *CachingClient) Complete(ctx context.Context, messages []Message, schema *JSONSchema) (string, error) {
+	return c.complete(ctx, messages, schema, nil)
+}
+
+// Stream 实现 StreamingClient 接口；命中缓存时把完整结果作为唯一一段增量回调。
+func (c *CachingClient) Stream(ctx context.Context, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error) {
+	if onDelta == nil {
+		onDelta = func(string) {}
+	}
+	return c.complete(ctx, messages, schema, onDelta)
+}
+
+// complete onDelta 非 nil 时未命中的调用走流式。
+func (c *CachingClient) complete(ctx context.Context, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error) {
+	call := func() (string, error) {
+		if onDelta != nil {
+			return CompleteStream(ctx, c.inner, messages, schema, onDelta)
+		}
+		return c.inner.Complete(ctx, messages, schema)
+	}
+	hit := func(resp string) (string, error) {
+		if onDelta != nil {
+			onDelta(resp)
+		}
+		return resp, nil
+	}
+
+	name, cacheable := cacheName(ctx, schema)
+	ttl, ok := c.opts.TTLs[name]
+	if !cacheable || !ok || ttl <= 0 {
+		c.metrics.record(name, func(s *CacheStats) { s.Bypass++ })
+		return call()
+	}
+
+	key := c.cacheKey(ctx, messages, schema)
+
+	if resp, ok := c.getMemory(key); ok {
+		c.metrics.record(name, func(s *CacheStats) { s.Hits++ })
+		return hit(resp)
+	}
+	if entry, ok := c.getDisk(key); ok {
+		c.putMemory(entry)
+		c.metrics.record(name, func(s *CacheStats) { s.DiskHits++ })
+		return hit(entry.Response)
+	}
+
+	c.metrics.record(name, func(s *CacheStats) { s.Misses++ })
+	resp, err := call()
+	if err != nil {
+		return "", err
+	}
+
+	entry := &cacheEntry{
+		key:       key,
+		Schema:    name,
+		Response:  resp,
+		ExpiresAt: c.now().Add(ttl),
+	}
+	c.putMemory(entry)
+	c.putDisk(entry)
+	return resp, nil
+}
+
+// cacheKey 默认按完整请求寻址；调用方通过 WithCacheKey 指定语义键时改用语义键。
+// 语义键同时混入提示词指纹（system 消息 + schema 名与定义）：既不会在不同子调用之间串用，
+// 改了提示词或 schema 后磁盘上按旧提示词产出的结果也不会再命中。
+func (c *CachingClient) cacheKey(ctx context.Context, messages []Message, schema *JSONSchema) string {
+	semantic, _ := ctx.Value(cacheKeyCtxKey{}).(string)
+	if semantic == "" {
+		return RequestKey(messages, schema)
+	}
+	sum := sha256.Sum256([]byte(promptFingerprint(messages, schema) + "\x00" + semantic))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// promptFingerprint 只取请求里的固定部分（system 消息与 schema），随调用变化的 user/assistant 内容由语义键负责
+func promptFingerprint(messages []Message, schema *JSONSchema) string {
+	var system []Message
+	for _, m := range messages {
+		if strings.EqualFold(strings.TrimSpace(m.Role), "system") {
+			system = append(system, m)
+		}
+	}
+	return RequestKey(system, schema)
+}
+
+func (c *CachingClient) getMemory(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.ExpiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return entry.Response, true
+}
+
+func (c *CachingClient) putMemory(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.opts.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *CachingClient) diskPath(key string) string {
+	return filepath.Join(c.opts.Dir, sanitizeNamespace(c.opts.Namespace), key+".json")
+}
+
+func (c *CachingClient) getDisk(key string) (*cacheEntry, bool) {
+	if c.opts.Dir == "" {
+		return nil, false
+	}
+
+	path := c.diskPath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Printf("[LLMCache] ⚠️  corrupt cache file %s: %v", path, err)
+		_ = os.Remove(path)
+		return nil, false
+	}
+	if !c.now().Before(entry.ExpiresAt) {
+		_ = os.Remove(path)
+		return nil, false
+	}
+	entry.key = key
+	return &entry, true
+}
+
+// putDisk 写磁盘层失败只记日志：缓存是优化，不能影响主流程。
+func (c *CachingClient) putDisk(entry *cacheEntry) {
+	if c.opts.Dir == "" {
+		return
+	}
+
+	path := c.diskPath(entry.key)
+	if err := writeCacheFile(path, entry); err != nil {
+		log.Printf("[LLMCache] ⚠️  failed to write cache file %s: %v", path, err)
+	}
+}
+
+func writeCacheFile(path string, entry *cacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal cache entry: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func sanitizeNamespace(ns string) string {
+	if ns == "" {
+		return "default"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, ns)
+}
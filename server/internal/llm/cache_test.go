@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestCachingClient(inner Client, opts CacheOptions) (*CachingClient, *CacheMetrics) {
+	if opts.TTLs == nil {
+		opts.TTLs = map[string]time.Duration{"alignment_score": time.Minute, "summary": time.Minute}
+	}
+	metrics := NewCacheMetrics()
+	return NewCachingClient(inner, opts, metrics), metrics
+}
+
+// summaryCtx 无 schema 的测试调用打上 "summary" 标签才会缓存
+var summaryCtx = WithCacheTag(context.Background(), "summary")
+
+func cacheStatsFor(m *CacheMetrics, schema string) CacheStats {
+	for _, s := range m.Snapshot() {
+		if s.Schema == schema {
+			return s
+		}
+	}
+	return CacheStats{Schema: schema}
+}
+
+func TestCachingClient_HitAfterMiss(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{`{"score":0.8}`, `{"score":0.1}`}}
+	client, metrics := newTestCachingClient(inner, CacheOptions{})
+	ctx := context.Background()
+	msgs := []Message{{Role: "user", Content: "对齐度?"}}
+
+	for i := 0; i < 2; i++ {
+		got, err := client.Complete(ctx, msgs, testAlignmentSchema)
+		if err != nil {
+			t.Fatalf("Complete error: %v", err)
+		}
+		if got != `{"score":0.8}` {
+			t.Fatalf("call %d: expected cached response, got %q", i, got)
+		}
+	}
+	if len(inner.calls) != 1 {
+		t.Fatalf("expected 1 upstream call, got %d", len(inner.calls))
+	}
+	stats := cacheStatsFor(metrics, "alignment_score")
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCachingClient_BypassesUnconfiguredSchema(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{`{"a":1}`, `{"a":2}`}}
+	client, metrics := newTestCachingClient(inner, CacheOptions{})
+	schema := &JSONSchema{Name: "segment_plan"}
+	msgs := []Message{{Role: "user", Content: "plan"}}
+
+	first, _ := client.Complete(context.Background(), msgs, schema)
+	second, _ := client.Complete(context.Background(), msgs, schema)
+	if first == second {
+		t.Fatalf("expected bypass to call upstream each time, got %q twice", first)
+	}
+	if stats := cacheStatsFor(metrics, "segment_plan"); stats.Bypass != 2 {
+		t.Fatalf("expected 2 bypass, got %+v", stats)
+	}
+}
+
+// TestCachingClient_UntaggedTextBypasses 验证无 schema 的纯文本调用没打标签时不缓存（即使配置了同名 TTL）。
+func TestCachingClient_UntaggedTextBypasses(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{"第一句", "第二句", "第三句"}}
+	client, metrics := newTestCachingClient(inner, CacheOptions{TTLs: map[string]time.Duration{"text": time.Minute}})
+	msgs := []Message{{Role: "user", Content: "开场"}}
+
+	first, _ := client.Complete(context.Background(), msgs, nil)
+	second, _ := client.Complete(context.Background(), msgs, nil)
+	if first == second {
+		t.Fatalf("expected untagged text calls to bypass cache, got %q twice", first)
+	}
+	if stats := cacheStatsFor(metrics, "text"); stats.Bypass != 2 {
+		t.Fatalf("expected 2 bypass, got %+v", stats)
+	}
+
+	// 打了标签的调用按标签查 TTL
+	tagged := WithCacheTag(context.Background(), "text")
+	third, _ := client.Complete(tagged, msgs, nil)
+	if len(inner.calls) != 3 {
+		t.Fatalf("expected tagged miss to call upstream, calls=%d", len(inner.calls))
+	}
+	if again, _ := client.Complete(tagged, msgs, nil); again != third || len(inner.calls) != 3 {
+		t.Fatalf("expected tagged call to hit cache, got %q (calls=%d)", again, len(inner.calls))
+	}
+}
+
+func TestCachingClient_TTLExpiry(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{"old", "new"}}
+	client, _ := newTestCachingClient(inner, CacheOptions{})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	client.now = func() time.Time { return now }
+	msgs := []Message{{Role: "user", Content: "summary"}}
+
+	if got, _ := client.Complete(summaryCtx, msgs, nil); got != "old" {
+		t.Fatalf("expected old, got %q", got)
+	}
+	now = now.Add(2 * time.Minute)
+	if got, _ := client.Complete(summaryCtx, msgs, nil); got != "new" {
+		t.Fatalf("expected entry to expire, got %q", got)
+	}
+}
+
+func TestCachingClient_LRUEviction(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{"a1", "b1", "a2"}}
+	client, _ := newTestCachingClient(inner, CacheOptions{MaxEntries: 1})
+	ctx := summaryCtx
+	a := []Message{{Role: "user", Content: "a"}}
+	b := []Message{{Role: "user", Content: "b"}}
+
+	client.Complete(ctx, a, nil)
+	client.Complete(ctx, b, nil)
+	if got, _ := client.Complete(ctx, a, nil); got != "a2" {
+		t.Fatalf("expected a to be evicted, got %q", got)
+	}
+}
+
+func TestCachingClient_DiskLayerSharedAcrossInstances(t *testing.T) {
+	dir := t.TempDir()
+	msgs := []Message{{Role: "user", Content: "summary"}}
+
+	first, _ := newTestCachingClient(&scriptedClient{outputs: []string{"persisted"}}, CacheOptions{Dir: dir, Namespace: "openai/gpt-4o"})
+	if _, err := first.Complete(summaryCtx, msgs, nil); err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+
+	inner := &scriptedClient{}
+	second, metrics := newTestCachingClient(inner, CacheOptions{Dir: dir, Namespace: "openai/gpt-4o"})
+	got, err := second.Complete(summaryCtx, msgs, nil)
+	if err != nil || got != "persisted" {
+		t.Fatalf("expected disk hit, got %q (err=%v)", got, err)
+	}
+	if len(inner.calls) != 0 {
+		t.Fatalf("expected no upstream call on disk hit")
+	}
+	if stats := cacheStatsFor(metrics, "summary"); stats.DiskHits != 1 {
+		t.Fatalf("expected 1 disk hit, got %+v", stats)
+	}
+
+	other, _ := newTestCachingClient(&scriptedClient{outputs: []string{"fresh"}}, CacheOptions{Dir: dir, Namespace: "anthropic/claude"})
+	if got, _ := other.Complete(summaryCtx, msgs, nil); got != "fresh" {
+		t.Fatalf("expected namespaces to be isolated, got %q", got)
+	}
+}
+
+func TestCachingClient_SemanticKey(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{`{"score":0.7}`}}
+	client, _ := newTestCachingClient(inner, CacheOptions{})
+	ctx := WithCacheKey(context.Background(), "story|用户说需求下降")
+
+	// 提示词不同（多了一轮填充语），语义键相同 → 命中
+	client.Complete(ctx, []Message{{Role: "user", Content: "用户说需求下降"}}, testAlignmentSchema)
+	got, err := client.Complete(ctx, []Message{{Role: "user", Content: "用户说需求下降\n用户：嗯"}}, testAlignmentSchema)
+	if err != nil || got != `{"score":0.7}` {
+		t.Fatalf("expected semantic hit, got %q (err=%v)", got, err)
+	}
+
+	// 同一语义键不会跨 schema 串用
+	inner.outputs = []string{"summary"}
+	if got, _ := client.Complete(ctx, []Message{{Role: "user", Content: "x"}}, nil); got != "summary" {
+		t.Fatalf("expected schema to scope semantic key, got %q", got)
+	}
+
+	// 提示词改了（system 消息不同），同一语义键不再命中旧结果
+	inner.outputs = []string{`{"score":0.2}`}
+	msgs := []Message{{Role: "system", Content: "新版评分规则"}, {Role: "user", Content: "用户说需求下降"}}
+	if got, _ := client.Complete(ctx, msgs, testAlignmentSchema); got != `{"score":0.2}` {
+		t.Fatalf("expected prompt change to miss, got %q", got)
+	}
+}
@@ -0,0 +1,272 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cassetteVersion 磁带文件格式版本；格式变化时递增，回放端拒绝不认识的版本。
+const cassetteVersion = 1
+
+// ErrCassetteMiss 回放时找不到匹配的录制请求。
+var ErrCassetteMiss = errors.New("llm: no recorded interaction for request")
+
+// CassetteMissError 回放未命中的详细信息，便于定位是哪条提示词发生了变化。
+type CassetteMissError struct {
+	Path   string
+	Key    string
+	Schema string
+	// LastMessage 最后一条消息的前 200 个字符
+	LastMessage string
+}
+
+func (e *CassetteMissError) Error() string {
+	return fmt.Sprintf("llm: cassette %s has no interaction for key %s (schema=%s, last message=%q); re-record the cassette if the prompt changed on purpose",
+		e.Path, e.Key, e.Schema, e.LastMessage)
+}
+
+func (e *CassetteMissError) Unwrap() error {
+	return ErrCassetteMiss
+}
+
+// Interaction 一次录制的请求/响应对。
+type Interaction struct {
+	Key      string    `json:"key"`
+	Schema   string    `json:"schema"`
+	Messages []Message `json:"messages"`
+	Response string    `json:"response"`
+}
+
+// Cassette 磁带文件内容（JSON）。
+type Cassette struct {
+	Version int `json:"version"`
+	// Source 磁带来源：recorded 为 RecordingClient 对真实 provider 的录制；
+	// synthetic 为手写的合成夹具，只能验证解析与多轮流程，不能当作真实模型行为的依据
+	Source string `json:"source"`
+	// RecordedAt 录制时间（合成夹具为空）
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+	// Note 说明（合成夹具写明用途与如何替换为真实录制）
+	Note         string        `json:"note,omitempty"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// 磁带来源
+const (
+	CassetteRecorded  = "recorded"
+	CassetteSynthetic = "synthetic"
+)
+
+// LoadCassette 读取磁带文件
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	if c.Version != cassetteVersion {
+		return nil, fmt.Errorf("cassette %s: unsupported version %d (want %d)", path, c.Version, cassetteVersion)
+	}
+	return &c, nil
+}
+
+// Save 写入磁带文件（先写临时文件再 rename，避免录制中断留下半个文件）。
+func (c *Cassette) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create cassette dir: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal cassette: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// RequestKey 计算请求的归一化哈希，作为录制/回放的匹配键。
+//
+// 归一化规则：
+// - 角色名转小写；内容统一换行符为 \n，并去掉每行行尾空白与首尾空行。
+// - schema 只参与名称与结构（按 JSON 序列化，map 键天然有序）；nil schema 记为 text。
+// 这样提示词里无意义的空白调整不会让磁带失效，但任何实质改动都会导致未命中。
+func RequestKey(messages []Message, schema *JSONSchema) string {
+	h := sha256.New()
+	for _, m := range messages {
+		h.Write([]byte(strings.ToLower(strings.TrimSpace(m.Role))))
+		h.Write([]byte{0})
+		h.Write([]byte(normalizeContent(m.Content)))
+		h.Write([]byte{0})
+	}
+
+	h.Write([]byte(schemaName(schema)))
+	if schema != nil && schema.Schema != nil {
+		if b, err := json.Marshal(schema.Schema); err == nil {
+			h.Write(b)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func normalizeContent(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// RecordingClient 录制装饰器：透传给真实客户端，并把请求/响应对写入磁带。
+//
+// 每次成功调用后立即落盘，测试中途失败也能保留已录制的部分。
+// 失败的调用不录制（回放时同一请求会未命中，提示重新录制）。
+type RecordingClient struct {
+	inner Client
+	path  string
+
+	mu       sync.Mutex
+	cassette *Cassette
+}
+
+// NewRecordingClient 创建录制客户端；会覆盖 path 上已有的磁带。
+func NewRecordingClient(inner Client, path string) *RecordingClient {
+	now := time.Now().UTC()
+	return &RecordingClient{
+		inner: inner,
+		path:  path,
+		cassette: &Cassette{
+			Version:    cassetteVersion,
+			Source:     CassetteRecorded,
+			RecordedAt: &now,
+		},
+	}
+}
+
+// Complete 实现 Client 接口
+func (c *RecordingClient) Complete(ctx context.Context, messages []Message, schema *JSONSchema) (string, error) {
+	response, err := c.inner.Complete(ctx, messages, schema)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cassette.Interactions = append(c.cassette.Interactions, Interaction{
+		Key:      RequestKey(messages, schema),
+		Schema:   schemaName(schema),
+		Messages: append([]Message(nil), messages...),
+		Response: response,
+	})
+	if err := c.cassette.Save(c.path); err != nil {
+		return "", fmt.Errorf("record interaction: %w", err)
+	}
+	return response, nil
+}
+
+// ReplayClient 回放客户端：完全离线，只返回磁带里录制过的响应。
+//
+// 匹配规则：按 RequestKey 匹配；同一请求录制了多次时按录制顺序依次返回，
+// 用完后重复返回最后一次（导演对同一状态重复决策时保持稳定）。
+// 未命中时返回 *CassetteMissError，绝不静默兜底。
+type ReplayClient struct {
+	path   string
+	source string
+
+	mu     sync.Mutex
+	byKey  map[string][]Interaction
+	served map[string]int
+}
+
+// NewReplayClient 从磁带文件创建回放客户端
+func NewReplayClient(path string) (*ReplayClient, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string][]Interaction)
+	for _, it := range cassette.Interactions {
+		byKey[it.Key] = append(byKey[it.Key], it)
+	}
+	return &ReplayClient{
+		path:   path,
+		source: cassette.Source,
+		byKey:  byKey,
+		served: make(map[string]int),
+	}, nil
+}
+
+// Synthetic 磁带是否为手写的合成夹具
+func (c *ReplayClient) Synthetic() bool {
+	return c.source == CassetteSynthetic
+}
+
+// Complete 实现 Client 接口
+func (c *ReplayClient) Complete(ctx context.Context, messages []Message, schema *JSONSchema) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	key := RequestKey(messages, schema)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	recorded, ok := c.byKey[key]
+	if !ok {
+		last := ""
+		if len(messages) > 0 {
+			last = messages[len(messages)-1].Content
+			if r := []rune(last); len(r) > 200 {
+				last = string(r[:200])
+			}
+		}
+		return "", &CassetteMissError{
+			Path:        c.path,
+			Key:         key,
+			Schema:      schemaName(schema),
+			LastMessage: last,
+		}
+	}
+
+	idx := c.served[key]
+	if idx >= len(recorded) {
+		idx = len(recorded) - 1
+	}
+	c.served[key]++
+	return recorded[idx].Response, nil
+}
+
+// Unused 返回从未被回放过的录制键，用于断言测试走完了录制时的全部调用。
+func (c *ReplayClient) Unused() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var unused []string
+	for key := range c.byKey {
+		if c.served[key] == 0 {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
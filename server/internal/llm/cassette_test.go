@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequestKey_Normalization(t *testing.T) {
+	a := []Message{{Role: "system", Content: "你是导演\r\n规则一  \n"}, {Role: "user", Content: "hi"}}
+	b := []Message{{Role: "System", Content: "\n你是导演\n规则一"}, {Role: "user", Content: "hi"}}
+	if RequestKey(a, nil) != RequestKey(b, nil) {
+		t.Fatal("whitespace-only differences must produce the same key")
+	}
+
+	c := []Message{{Role: "system", Content: "你是导演\n规则二"}, {Role: "user", Content: "hi"}}
+	if RequestKey(a, nil) == RequestKey(c, nil) {
+		t.Fatal("content changes must produce a different key")
+	}
+	if RequestKey(a, nil) == RequestKey(a, testAlignmentSchema) {
+		t.Fatal("schema must be part of the key")
+	}
+}
+
+func TestCassette_RecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "session.json")
+	inner := &scriptedClient{outputs: []string{`{"n":1}`, `{"n":2}`, "总结"}}
+	recorder := NewRecordingClient(inner, path)
+
+	ask := []Message{{Role: "user", Content: "决策"}}
+	summary := []Message{{Role: "user", Content: "总结"}}
+	ctx := context.Background()
+
+	for _, call := range []struct {
+		msgs   []Message
+		schema *JSONSchema
+	}{{ask, testAlignmentSchema}, {ask, testAlignmentSchema}, {summary, nil}} {
+		if _, err := recorder.Complete(ctx, call.msgs, call.schema); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatalf("NewReplayClient: %v", err)
+	}
+	if replay.Synthetic() {
+		t.Fatal("recorded cassette must not be marked synthetic")
+	}
+
+	// 同一请求录制两次：按顺序返回，用完后重复最后一次
+	for _, want := range []string{`{"n":1}`, `{"n":2}`, `{"n":2}`} {
+		got, err := replay.Complete(ctx, ask, testAlignmentSchema)
+		if err != nil || got != want {
+			t.Fatalf("replay: got %q err=%v, want %q", got, err, want)
+		}
+	}
+	if unused := replay.Unused(); len(unused) != 1 {
+		t.Fatalf("expected summary interaction unused, got %v", unused)
+	}
+	if got, _ := replay.Complete(ctx, summary, nil); got != "总结" {
+		t.Fatalf("unexpected summary replay: %q", got)
+	}
+	if unused := replay.Unused(); len(unused) != 0 {
+		t.Fatalf("expected all interactions used, got %v", unused)
+	}
+}
+
+func TestCassette_ReplayMissFailsLoudly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.json")
+	recorder := NewRecordingClient(&scriptedClient{outputs: []string{"ok"}}, path)
+	if _, err := recorder.Complete(context.Background(), []Message{{Role: "user", Content: "a"}}, nil); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatalf("NewReplayClient: %v", err)
+	}
+	_, err = replay.Complete(context.Background(), []Message{{Role: "user", Content: "b"}}, testAlignmentSchema)
+	if !errors.Is(err, ErrCassetteMiss) {
+		t.Fatalf("expected ErrCassetteMiss, got %v", err)
+	}
+	var miss *CassetteMissError
+	if !errors.As(err, &miss) || miss.Schema != "alignment_score" || miss.LastMessage != "b" {
+		t.Fatalf("unexpected miss detail: %+v", miss)
+	}
+
+	if _, err := NewReplayClient(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("expected error for missing cassette")
+	}
+}
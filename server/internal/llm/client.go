@@ -34,6 +34,52 @@ type JSONSchema struct {
 
 // NewClient 创建 LLM 客户端
 func NewClient(cfg *config.Config) (Client, error) {
+	client, err := NewUncachedClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// 缓存放在校验外层：只缓存校验通过的结果，命中时也不必再校验。
+	if cache := cfg.LLM.Cache; cache.Enabled {
+		client = NewCachingClient(client, CacheOptions{
+			MaxEntries: cache.MaxEntries,
+			Dir:        cache.Dir,
+			Namespace:  cfg.LLM.Provider + "-" + providerModel(cfg),
+			TTLs:       cache.TTLs,
+		}, DefaultCacheMetrics)
+	}
+	return client, nil
+}
+
+// NewUncachedClient 同 NewClient，但不套响应缓存：用于直接面向学习者的自由文本
+// （文本网关的角色发言、历史摘要），相同提示词在不同会话里也必须各自生成。
+func NewUncachedClient(cfg *config.Config) (Client, error) {
+	base, err := newProviderClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// 所有 provider 统一套一层结构化输出校验：去围栏、按 schema 校验、失败时做一次修复回合。
+	return NewValidatingClient(base, cfg.LLM.Provider, DefaultSchemaMetrics), nil
+}
+
+// providerModel 返回当前 provider 配置的模型名
+func providerModel(cfg *config.Config) string {
+	switch cfg.LLM.Provider {
+	case "openai":
+		return cfg.LLM.OpenAI.Model
+	case "anthropic":
+		return cfg.LLM.Anthropic.Model
+	case "talopenai":
+		return cfg.LLM.TalOpenAI.Model
+	case "openai_compatible":
+		return cfg.LLM.OpenAICompatible.Model
+	default:
+		return ""
+	}
+}
+
+// newProviderClient 按配置创建具体 provider 的客户端（不含装饰器）。
+func newProviderClient(cfg *config.Config) (Client, error) {
 	switch cfg.LLM.Provider {
 	case "openai":
 		return NewOpenAIClient(cfg.LLM.OpenAI), nil
@@ -41,6 +87,11 @@ func NewClient(cfg *config.Config) (Client, error) {
 		return NewAnthropicClient(cfg.LLM.Anthropic), nil
 	case "talopenai":
 		return NewTalOpenAIClient(cfg.LLM.TalOpenAI), nil
+	case "openai_compatible":
+		if cfg.LLM.OpenAICompatible.APIURL == "" {
+			return nil, fmt.Errorf("openai_compatible provider requires api_url")
+		}
+		return NewOpenAICompatibleClient(cfg.LLM.OpenAICompatible), nil
 	default:
 		return nil, fmt.Errorf("unsupported LLM provider: %s", cfg.LLM.Provider)
 	}
@@ -64,41 +115,12 @@ func NewOpenAIClient(cfg config.LLMProviderConfig) *OpenAIClient {
 
 // Complete 完成文本生成（OpenAI）
 func (c *OpenAIClient) Complete(ctx context.Context, messages []Message, schema *JSONSchema) (string, error) {
-	reqBody := map[string]any{
-		"model":                 c.config.Model,
-		"messages":              messages,
-		"temperature":           c.config.Temperature,
-		"max_completion_tokens": c.config.MaxTokens,
-	}
-
-	// gpt-5 系列在 ChatCompletions 下可能会把 token 预算主要消耗在 reasoning，
-	// 导致 message.content 为空且 finish_reason=length（只产出 reasoning tokens）。
-	// 这里默认将 reasoning effort 降到 low，确保能稳定产出可解析的输出内容。
-	if isOpenAIReasoningModel(c.config.Model) {
-		reqBody["reasoning_effort"] = "low"
-	}
-
-	// 如果提供了 schema，使用 JSON mode
-	if schema != nil {
-		reqBody["response_format"] = map[string]any{
-			"type":        "json_schema",
-			"json_schema": schema,
-		}
-	}
-
-	body, err := json.Marshal(reqBody)
+	req, err := c.newRequest(ctx, messages, schema, false)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return "", err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIURL+"/chat/completions", bytes.NewReader(body))
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
-
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("execute request: %w", err)
@@ -120,11 +142,13 @@ func (c *OpenAIClient) Complete(ctx context.Context, messages []Message, schema
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage openAIUsage `json:"usage"`
 	}
 
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		return "", fmt.Errorf("unmarshal response: %w", err)
 	}
+	ReportUsage(ctx, result.Usage.toUsage("openai", c.config.Model, schema, time.Since(start)))
 
 	if len(result.Choices) == 0 {
 		return "", fmt.Errorf("no choices in response")
@@ -138,6 +162,50 @@ func (c *OpenAIClient) Complete(ctx context.Context, messages []Message, schema
 	return content, nil
 }
 
+// newRequest 构造 chat/completions 请求；stream 时要求在最后一个 chunk 附带 usage。
+func (c *OpenAIClient) newRequest(ctx context.Context, messages []Message, schema *JSONSchema, stream bool) (*http.Request, error) {
+	reqBody := map[string]any{
+		"model":                 c.config.Model,
+		"messages":              messages,
+		"temperature":           c.config.Temperature,
+		"max_completion_tokens": c.config.MaxTokens,
+	}
+
+	// gpt-5 系列在 ChatCompletions 下可能会把 token 预算主要消耗在 reasoning，
+	// 导致 message.content 为空且 finish_reason=length（只产出 reasoning tokens）。
+	// 这里默认将 reasoning effort 降到 low，确保能稳定产出可解析的输出内容。
+	if isOpenAIReasoningModel(c.config.Model) {
+		reqBody["reasoning_effort"] = "low"
+	}
+
+	// 如果提供了 schema，使用 JSON mode
+	if schema != nil {
+		reqBody["response_format"] = map[string]any{
+			"type":        "json_schema",
+			"json_schema": schema,
+		}
+	}
+
+	if stream {
+		reqBody["stream"] = true
+		reqBody["stream_options"] = map[string]any{"include_usage": true}
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	return req, nil
+}
+
 func isOpenAIReasoningModel(model string) bool {
 	// 经验规则：gpt-5 / o1 等会产出 reasoning tokens。
 	// 这里用最保守的匹配，避免影响 gpt-4o 等常规模型。
@@ -162,6 +230,49 @@ func NewAnthropicClient(cfg config.LLMProviderConfig) *AnthropicClient {
 
 // Complete 完成文本生成（Anthropic）
 func (c *AnthropicClient) Complete(ctx context.Context, messages []Message, schema *JSONSchema) (string, error) {
+	req, err := c.newRequest(ctx, messages, false)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Content []struct {
+			Text string `json:"text"`
+			Type string `json:"type"`
+		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
+	}
+
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("unmarshal response: %w", err)
+	}
+	ReportUsage(ctx, result.Usage.toUsage(c.config.Model, schema, time.Since(start)))
+
+	if len(result.Content) == 0 {
+		return "", fmt.Errorf("no content in response")
+	}
+
+	return result.Content[0].Text, nil
+}
+
+// newRequest 构造 messages 请求（Anthropic 需要把 system 消息单独拿出来）。
+func (c *AnthropicClient) newRequest(ctx context.Context, messages []Message, stream bool) (*http.Request, error) {
 	// Anthropic 需要分离 system message
 	var systemMsg string
 	var userMessages []map[string]string
@@ -187,52 +298,24 @@ func (c *AnthropicClient) Complete(ctx context.Context, messages []Message, sche
 	if systemMsg != "" {
 		reqBody["system"] = systemMsg
 	}
+	if stream {
+		reqBody["stream"] = true
+	}
 
 	body, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIURL+"/messages", bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", c.config.APIKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
-	}
-
-	var result struct {
-		Content []struct {
-			Text string `json:"text"`
-			Type string `json:"type"`
-		} `json:"content"`
-	}
-
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("unmarshal response: %w", err)
-	}
-
-	if len(result.Content) == 0 {
-		return "", fmt.Errorf("no content in response")
-	}
-
-	return result.Content[0].Text, nil
+	return req, nil
 }
 
 // TalOpenAIClient 兼容 OpenAI 的 Tal 内部 openai-compatible 服务
@@ -253,35 +336,12 @@ func NewTalOpenAIClient(cfg config.LLMProviderConfig) *TalOpenAIClient {
 
 // Complete 完成文本生成（Tal OpenAI-compatible）
 func (c *TalOpenAIClient) Complete(ctx context.Context, messages []Message, schema *JSONSchema) (string, error) {
-	// 构造与 OpenAI chat/completions 类似的请求体
-	reqBody := map[string]any{
-		"model":    c.config.Model,
-		"messages": messages,
-		"stream":   false,
-	}
-
-	if schema != nil {
-		reqBody["response_format"] = map[string]any{
-			"type":        "json_schema",
-			"json_schema": schema,
-		}
-	}
-
-	body, err := json.Marshal(reqBody)
+	req, err := c.newRequest(ctx, messages, schema, false)
 	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+		return "", err
 	}
 
-	// Endpoint provided in the user's example uses path /openai-compatible/v1/chat/completions
-	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIURL+"/openai-compatible/v1/chat/completions", bytes.NewReader(body))
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	// Tal uses Bearer in Authorization header in the user's curl example
-	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
-
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("execute request: %w", err)
@@ -304,62 +364,22 @@ func (c *TalOpenAIClient) Complete(ctx context.Context, messages []Message, sche
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
 	}
 
-	if err := json.Unmarshal(respBody, &oa); err == nil && len(oa.Choices) > 0 {
+	oaErr := json.Unmarshal(respBody, &oa)
+	if oaErr == nil && oa.Usage != nil {
+		ReportUsage(ctx, oa.Usage.toUsage("talopenai", c.config.Model, schema, time.Since(start)))
+	}
+	if oaErr == nil && len(oa.Choices) > 0 {
 		content := oa.Choices[0].Message.Content
 		if content != "" {
 			// Normalize content: it might be wrapped in markdown fences, be an escaped JSON string，
-			// 或包含前后文本。尝试提取有效的 JSON 值并以紧凑的 JSON 格式返回，以便调用方如 director.decideLLM 可以 json.Unmarshal 。
-			trimmed := strings.TrimSpace(content)
-
-			// 如果内容是 markdown 围栏（例如 ```json\n{...}\n```），则去除围栏
-			if strings.HasPrefix(trimmed, "```") {
-				// 去除前导 ``` 和尾部 ```
-				end := strings.LastIndex(trimmed, "```")
-				if end > 3 {
-					inner := trimmed[3:end]
-					inner = strings.TrimSpace(inner)
-					// 如果第一行是类似 "json" 的语言提示，则删除它
-					if idx := strings.IndexAny(inner, "\n\r"); idx > 0 {
-						firstLine := inner[:idx]
-						if isAlphaString(firstLine) {
-							inner = strings.TrimSpace(inner[idx:])
-						}
-					}
-					trimmed = strings.TrimSpace(inner)
-				}
-			}
-
-			// 如果 trimmed 现在看起来像 JSON，尝试解组为通用类型并重新序列化为紧凑格式
-			if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[' || trimmed[0] == '"') {
-				var raw any
-				if err := json.Unmarshal([]byte(trimmed), &raw); err == nil {
-					b, _ := json.Marshal(raw)
-					return string(b), nil
-				}
-
-				// 可能是包含 JSON 对象（转义）的 JSON 字符串，尝试解引号+解组
-				var possible string
-				if err := json.Unmarshal([]byte(trimmed), &possible); err == nil {
-					possible = strings.TrimSpace(possible)
-					if len(possible) > 0 && (possible[0] == '{' || possible[0] == '[') {
-						var raw2 any
-						if err2 := json.Unmarshal([]byte(possible), &raw2); err2 == nil {
-							b, _ := json.Marshal(raw2)
-							return string(b), nil
-						}
-					}
-				}
-			}
-
-			// 作为最后的尝试，如果内容中某处包含 JSON 对象，尝试提取第一个 {
-			if idx := strings.Index(trimmed, "{"); idx >= 0 {
-				suffix := strings.TrimSpace(trimmed[idx:])
-				var raw any
-				if err := json.Unmarshal([]byte(suffix), &raw); err == nil {
-					b, _ := json.Marshal(raw)
-					return string(b), nil
+			// 或包含前后文本。结构化调用时尝试提取有效的 JSON 值并以紧凑的 JSON 格式返回，以便调用方如 director.decideLLM 可以 json.Unmarshal；
+			// 无 schema 的纯文本调用原样返回（正文恰好能解析成 JSON 时也不能改写）。
+			if schema != nil {
+				if normalized, ok := extractJSONContent(content); ok {
+					return normalized, nil
 				}
 			}
 
@@ -401,6 +421,93 @@ func (c *TalOpenAIClient) Complete(ctx context.Context, messages []Message, sche
 	return "", fmt.Errorf("empty response body")
 }
 
+// newRequest 构造 Tal chat/completions 请求
+func (c *TalOpenAIClient) newRequest(ctx context.Context, messages []Message, schema *JSONSchema, stream bool) (*http.Request, error) {
+	// 构造与 OpenAI chat/completions 类似的请求体
+	reqBody := map[string]any{
+		"model":    c.config.Model,
+		"messages": messages,
+		"stream":   stream,
+	}
+	if stream {
+		reqBody["stream_options"] = map[string]any{"include_usage": true}
+	}
+
+	if schema != nil {
+		reqBody["response_format"] = map[string]any{
+			"type":        "json_schema",
+			"json_schema": schema,
+		}
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	// Endpoint provided in the user's example uses path /openai-compatible/v1/chat/completions
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.APIURL+"/openai-compatible/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	// Tal uses Bearer in Authorization header in the user's curl example
+	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	return req, nil
+}
+
+// extractJSONContent 从模型输出中提取 JSON 值，并以紧凑格式返回。
+// 兼容三种常见"脏输出"：markdown 围栏、被转义成字符串的 JSON、JSON 前后夹带说明文字。
+// 第二个返回值表示是否成功提取到合法 JSON。
+func extractJSONContent(content string) (string, bool) {
+	// 如果内容是 markdown 围栏（例如 ```json\n{...}\n```），则去除围栏
+	trimmed := StripCodeFences(content)
+
+	// 如果 trimmed 现在看起来像 JSON，尝试解组为通用类型并重新序列化为紧凑格式
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[' || trimmed[0] == '"') {
+		var raw any
+		if err := json.Unmarshal([]byte(trimmed), &raw); err == nil {
+			if _, isString := raw.(string); !isString {
+				b, _ := json.Marshal(raw)
+				return string(b), true
+			}
+		}
+
+		// 可能是包含 JSON 对象（转义）的 JSON 字符串，尝试解引号+解组
+		var possible string
+		if err := json.Unmarshal([]byte(trimmed), &possible); err == nil {
+			possible = strings.TrimSpace(possible)
+			if len(possible) > 0 && (possible[0] == '{' || possible[0] == '[') {
+				var raw2 any
+				if err2 := json.Unmarshal([]byte(possible), &raw2); err2 == nil {
+					b, _ := json.Marshal(raw2)
+					return string(b), true
+				}
+			}
+		}
+	}
+
+	// 作为最后的尝试，如果内容中某处包含 JSON 对象，尝试提取第一个 {
+	if idx := strings.Index(trimmed, "{"); idx >= 0 {
+		suffix := strings.TrimSpace(trimmed[idx:])
+		var raw any
+		if err := json.Unmarshal([]byte(suffix), &raw); err == nil {
+			b, _ := json.Marshal(raw)
+			return string(b), true
+		}
+		// JSON 后面还夹带了说明文字：截到最后一个 } 再试一次
+		if last := strings.LastIndex(suffix, "}"); last > 0 {
+			if err := json.Unmarshal([]byte(suffix[:last+1]), &raw); err == nil {
+				b, _ := json.Marshal(raw)
+				return string(b), true
+			}
+		}
+	}
+
+	return "", false
+}
+
 // helper: check if a string is alphabetic (used to detect language hints like "json")
 func isAlphaString(s string) bool {
 	s = strings.TrimSpace(s)
@@ -0,0 +1,188 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"bubble-talk/server/internal/config"
+)
+
+// defaultOpenAICompatibleTimeout 本地模型（vLLM/llama.cpp/Ollama）首 token 往往较慢，默认超时放宽。
+const defaultOpenAICompatibleTimeout = 120 * time.Second
+
+// OpenAICompatibleClient 通用 OpenAI-compatible 客户端（vLLM、llama.cpp server、Ollama 等自部署模型）。
+//
+// 与 OpenAIClient 的区别：
+//   - 不套用托管模型的参数规则（如 reasoning_effort / max_completion_tokens），只发最通用的字段。
+//   - response_format 是否下发由 SupportsJSONSchema 能力位决定；不支持时改为在 system 中描述 schema，
+//     并从返回内容里提取 JSON（兼容围栏、前后夹带说明文字等情况）。
+//   - base URL 与额外请求头完全可配，APIKey 可为空（本地服务通常不鉴权）。
+type OpenAICompatibleClient struct {
+	config     config.LLMProviderConfig
+	httpClient *http.Client
+}
+
+// NewOpenAICompatibleClient 创建 OpenAI-compatible 客户端
+func NewOpenAICompatibleClient(cfg config.LLMProviderConfig) *OpenAICompatibleClient {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultOpenAICompatibleTimeout
+	}
+	return &OpenAICompatibleClient{
+		config: cfg,
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// Complete 完成文本生成（OpenAI-compatible）
+func (c *OpenAICompatibleClient) Complete(ctx context.Context, messages []Message, schema *JSONSchema) (string, error) {
+	req, err := c.newRequest(ctx, messages, schema, false)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("unmarshal response: %w", err)
+	}
+	ReportUsage(ctx, result.Usage.toUsage("openai_compatible", c.config.Model, schema, time.Since(start)))
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+
+	content := result.Choices[0].Message.Content
+	if content == "" {
+		return "", fmt.Errorf("empty content in response: %s", string(respBody))
+	}
+	return c.normalize(content, schema)
+}
+
+// newRequest 构造 chat/completions 请求；stream 时要求在最后一个 chunk 附带 usage。
+func (c *OpenAICompatibleClient) newRequest(ctx context.Context, messages []Message, schema *JSONSchema, stream bool) (*http.Request, error) {
+	reqMessages := messages
+	if schema != nil && !c.config.SupportsJSONSchema {
+		reqMessages = withSchemaInstruction(messages, schema)
+	}
+
+	reqBody := map[string]any{
+		"model":    c.config.Model,
+		"messages": reqMessages,
+		"stream":   stream,
+	}
+	if stream {
+		reqBody["stream_options"] = map[string]any{"include_usage": true}
+	}
+	if c.config.Temperature > 0 {
+		reqBody["temperature"] = c.config.Temperature
+	}
+	if c.config.MaxTokens > 0 {
+		reqBody["max_tokens"] = c.config.MaxTokens
+	}
+	if schema != nil && c.config.SupportsJSONSchema {
+		reqBody["response_format"] = map[string]any{
+			"type":        "json_schema",
+			"json_schema": schema,
+		}
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	c.setHeaders(req)
+	return req, nil
+}
+
+// normalize 结构化调用时从输出中提取 JSON：即便服务端声明支持 json_schema，
+// 本地模型也常在 JSON 外包一层围栏，这里统一做一次提取。
+func (c *OpenAICompatibleClient) normalize(content string, schema *JSONSchema) (string, error) {
+	if content == "" {
+		return "", fmt.Errorf("empty content in response")
+	}
+	if schema == nil {
+		return content, nil
+	}
+
+	normalized, ok := extractJSONContent(content)
+	if !ok {
+		return "", fmt.Errorf("no JSON value in response for schema %s: %.200s", schema.Name, content)
+	}
+	return normalized, nil
+}
+
+// endpoint 拼接 chat/completions 地址；兼容 base URL 末尾带不带 "/" 的写法。
+func (c *OpenAICompatibleClient) endpoint() string {
+	return strings.TrimRight(c.config.APIURL, "/") + "/chat/completions"
+}
+
+// setHeaders 设置默认请求头与配置的额外请求头（后者可覆盖前者）。
+func (c *OpenAICompatibleClient) setHeaders(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+	for k, v := range c.config.Headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// withSchemaInstruction 在不支持 response_format 的服务上，用 system 消息描述期望的 JSON Schema。
+// 返回新切片，不修改调用方的 messages。
+func withSchemaInstruction(messages []Message, schema *JSONSchema) []Message {
+	schemaJSON, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return messages
+	}
+
+	instruction := fmt.Sprintf(
+		"只输出一个符合以下 JSON Schema（%s）的 JSON 对象，不要输出 markdown 围栏或任何解释文字。\nJSON Schema:\n%s",
+		schema.Name,
+		string(schemaJSON),
+	)
+
+	out := make([]Message, 0, len(messages)+1)
+	out = append(out, messages...)
+	for i := range out {
+		if out[i].Role == "system" {
+			out[i].Content = out[i].Content + "\n\n" + instruction
+			return out
+		}
+	}
+	return append([]Message{{Role: "system", Content: instruction}}, out...)
+}
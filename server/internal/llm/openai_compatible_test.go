@@ -0,0 +1,223 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/config"
+)
+
+// compatRequest 记录 httptest 服务收到的请求，便于断言请求体与请求头。
+type compatRequest struct {
+	Path    string
+	Header  http.Header
+	Payload map[string]any
+}
+
+func newCompatServer(t *testing.T, content string, got *compatRequest) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.Path = r.URL.Path
+		got.Header = r.Header.Clone()
+		_ = json.Unmarshal(body, &got.Payload)
+
+		resp := map[string]any{
+			"choices": []any{
+				map[string]any{"message": map[string]any{"role": "assistant", "content": content}},
+			},
+			"usage": map[string]any{
+				"prompt_tokens":         120,
+				"completion_tokens":     30,
+				"prompt_tokens_details": map[string]any{"cached_tokens": 64},
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+var testAlignmentSchema = &JSONSchema{
+	Name: "alignment_score",
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"score":  map[string]any{"type": "number"},
+			"reason": map[string]any{"type": "string"},
+		},
+		"required": []string{"score", "reason"},
+	},
+	Strict: true,
+}
+
+// TestOpenAICompatible_NoSchemaSupportExtractsJSON 验证服务端不支持 json_schema 时：
+// 不下发 response_format、在 system 中注入 schema 描述，并从夹带说明文字的输出里提取 JSON。
+func TestOpenAICompatible_NoSchemaSupportExtractsJSON(t *testing.T) {
+	var got compatRequest
+	content := "好的，下面是结果：\n```json\n{\"score\": 0.8, \"reason\": \"贴近剧本\"}\n```\n希望有帮助。"
+	ts := newCompatServer(t, content, &got)
+	defer ts.Close()
+
+	client := NewOpenAICompatibleClient(config.LLMProviderConfig{
+		APIURL:  ts.URL + "/v1/",
+		Model:   "qwen2.5",
+		Headers: map[string]string{"X-Tenant": "bubble"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messages := []Message{
+		{Role: "system", Content: "你是评估专家"},
+		{Role: "user", Content: "评估对齐度"},
+	}
+	res, err := client.Complete(ctx, messages, testAlignmentSchema)
+	if err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+
+	var parsed struct {
+		Score  float64 `json:"score"`
+		Reason string  `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(res), &parsed); err != nil {
+		t.Fatalf("expected extracted JSON, got %q: %v", res, err)
+	}
+	if parsed.Score != 0.8 || parsed.Reason != "贴近剧本" {
+		t.Fatalf("unexpected parsed result: %+v", parsed)
+	}
+
+	if got.Path != "/v1/chat/completions" {
+		t.Errorf("expected path /v1/chat/completions, got %s", got.Path)
+	}
+	if _, ok := got.Payload["response_format"]; ok {
+		t.Errorf("response_format should not be sent when supports_json_schema=false")
+	}
+	if _, ok := got.Payload["reasoning_effort"]; ok {
+		t.Errorf("reasoning_effort must not be sent to compatible servers")
+	}
+	if got.Header.Get("Authorization") != "" {
+		t.Errorf("expected no Authorization header without api key, got %q", got.Header.Get("Authorization"))
+	}
+	if got.Header.Get("X-Tenant") != "bubble" {
+		t.Errorf("expected custom header X-Tenant=bubble, got %q", got.Header.Get("X-Tenant"))
+	}
+
+	sent, _ := got.Payload["messages"].([]any)
+	if len(sent) != 2 {
+		t.Fatalf("expected schema hint merged into existing system message, got %d messages", len(sent))
+	}
+	system, _ := sent[0].(map[string]any)["content"].(string)
+	if !strings.Contains(system, "alignment_score") {
+		t.Errorf("expected schema instruction in system message, got %q", system)
+	}
+	if messages[0].Content != "你是评估专家" {
+		t.Errorf("caller messages must not be mutated, got %q", messages[0].Content)
+	}
+}
+
+// TestOpenAICompatible_SchemaSupportSendsResponseFormat 验证能力位打开时下发 response_format 与鉴权头。
+func TestOpenAICompatible_SchemaSupportSendsResponseFormat(t *testing.T) {
+	var got compatRequest
+	ts := newCompatServer(t, `{"score":0.3,"reason":"偏离"}`, &got)
+	defer ts.Close()
+
+	client := NewOpenAICompatibleClient(config.LLMProviderConfig{
+		APIURL:             ts.URL + "/v1",
+		APIKey:             "local-key",
+		Model:              "llama3",
+		MaxTokens:          512,
+		SupportsJSONSchema: true,
+	})
+
+	res, err := client.Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, testAlignmentSchema)
+	if err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+	if !strings.Contains(res, `"score":0.3`) {
+		t.Fatalf("unexpected response: %s", res)
+	}
+
+	format, ok := got.Payload["response_format"].(map[string]any)
+	if !ok || format["type"] != "json_schema" {
+		t.Fatalf("expected response_format json_schema, got %+v", got.Payload["response_format"])
+	}
+	if got.Payload["max_tokens"] != float64(512) {
+		t.Errorf("expected max_tokens 512, got %v", got.Payload["max_tokens"])
+	}
+	if got.Header.Get("Authorization") != "Bearer local-key" {
+		t.Errorf("unexpected Authorization header: %q", got.Header.Get("Authorization"))
+	}
+}
+
+// TestOpenAICompatible_SchemaWithoutJSONFails 验证要求结构化输出但模型完全没给 JSON 时返回错误，而不是把原文当结果。
+func TestOpenAICompatible_SchemaWithoutJSONFails(t *testing.T) {
+	var got compatRequest
+	ts := newCompatServer(t, "抱歉，我无法回答。", &got)
+	defer ts.Close()
+
+	client := NewOpenAICompatibleClient(config.LLMProviderConfig{APIURL: ts.URL, Model: "m"})
+
+	if _, err := client.Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, testAlignmentSchema); err == nil {
+		t.Fatal("expected error when no JSON can be extracted")
+	}
+
+	// 无 schema 时原样返回文本
+	res, err := client.Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil)
+	if err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+	if res != "抱歉，我无法回答。" {
+		t.Fatalf("unexpected plain text response: %q", res)
+	}
+}
+
+// TestNewClient_OpenAICompatible 验证 provider 路由与必填配置校验。
+func TestNewClient_OpenAICompatible(t *testing.T) {
+	cfg := &config.Config{LLM: config.LLMConfig{Provider: "openai_compatible"}}
+	if _, err := NewClient(cfg); err == nil {
+		t.Fatal("expected error when api_url is missing")
+	}
+
+	cfg.LLM.OpenAICompatible.APIURL = "http://localhost:8000/v1"
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	validating, ok := client.(*ValidatingClient)
+	if !ok {
+		t.Fatalf("expected *ValidatingClient, got %T", client)
+	}
+	if _, ok := validating.Unwrap().(*OpenAICompatibleClient); !ok {
+		t.Fatalf("expected *OpenAICompatibleClient, got %T", validating.Unwrap())
+	}
+}
+
+// TestNewUncachedClient_SkipsCache 验证开启缓存时 NewClient 套缓存层，而 NewUncachedClient 不套。
+func TestNewUncachedClient_SkipsCache(t *testing.T) {
+	cfg := &config.Config{LLM: config.LLMConfig{Provider: "openai_compatible"}}
+	cfg.LLM.OpenAICompatible.APIURL = "http://localhost:8000/v1"
+	cfg.LLM.Cache.Enabled = true
+
+	cached, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	if _, ok := cached.(*CachingClient); !ok {
+		t.Fatalf("expected *CachingClient, got %T", cached)
+	}
+
+	uncached, err := NewUncachedClient(cfg)
+	if err != nil {
+		t.Fatalf("NewUncachedClient error: %v", err)
+	}
+	if _, ok := uncached.(*ValidatingClient); !ok {
+		t.Fatalf("expected *ValidatingClient, got %T", uncached)
+	}
+}
@@ -0,0 +1,255 @@
+package llm
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// PartialJSON 增量解析流式输出中的 JSON 对象，只关心顶层字符串字段。
+//
+// 用法：每到一段增量就 Write，然后用 StringField 查看某个字段“目前为止”的值。
+// 输出前面的 markdown 围栏/说明文字会被跳过（从第一个 '{' 开始解析）。
+// 每次查询都从头扫描，适用于导演决策这种几 KB 以内的输出。
+type PartialJSON struct {
+	buf strings.Builder
+}
+
+// Write 追加一段增量
+func (p *PartialJSON) Write(delta string) {
+	p.buf.WriteString(delta)
+}
+
+// String 返回目前累计的原始文本
+func (p *PartialJSON) String() string {
+	return p.buf.String()
+}
+
+// StringField 返回顶层字符串字段 name 目前已到达的值。
+// found=false 表示字段还没出现（或不是字符串）；complete=true 表示收尾引号已到达。
+// 未完成的转义序列不会出现在返回值中。
+func (p *PartialJSON) StringField(name string) (value string, complete bool, found bool) {
+	sc, ok := p.seek(name)
+	if !ok || sc.peek() != '"' {
+		return "", false, false
+	}
+	value, complete = sc.readString()
+	return value, complete, true
+}
+
+// RawField 返回顶层字段 name 完整到达后的原始 JSON（数组/对象/数字等，可直接 json.Unmarshal）；
+// 字段还没出现或尚未收尾时 complete=false。
+func (p *PartialJSON) RawField(name string) (raw string, complete bool) {
+	sc, ok := p.seek(name)
+	if !ok {
+		return "", false
+	}
+	start := sc.pos
+	scalar := !strings.ContainsRune(`"{[`, rune(sc.peek()))
+	if !sc.skipValue() {
+		return "", false
+	}
+	// 数字等标量读到分隔符才算完；扫到末尾说明后面可能还有字符没到
+	if scalar && sc.done() {
+		return "", false
+	}
+	return sc.s[start:sc.pos], true
+}
+
+// seek 定位到顶层字段 name 的值起始处；字段还没出现时 ok=false
+func (p *PartialJSON) seek(name string) (*partialScanner, bool) {
+	s := p.buf.String()
+	start := strings.IndexByte(s, '{')
+	if start < 0 {
+		return nil, false
+	}
+
+	sc := &partialScanner{s: s, pos: start + 1}
+	for {
+		sc.skipSpaceAndCommas()
+		if sc.done() || sc.peek() == '}' {
+			return nil, false
+		}
+		if sc.peek() != '"' {
+			return nil, false
+		}
+
+		key, keyDone := sc.readString()
+		if !keyDone {
+			return nil, false
+		}
+
+		sc.skipSpace()
+		if sc.done() || sc.peek() != ':' {
+			return nil, false
+		}
+		sc.pos++
+		sc.skipSpace()
+		if sc.done() {
+			return nil, false
+		}
+
+		if key == name {
+			return sc, true
+		}
+		if !sc.skipValue() {
+			return nil, false
+		}
+	}
+}
+
+// partialScanner 容忍截断输入的最小 JSON 扫描器
+type partialScanner struct {
+	s   string
+	pos int
+}
+
+func (sc *partialScanner) done() bool { return sc.pos >= len(sc.s) }
+
+func (sc *partialScanner) peek() byte { return sc.s[sc.pos] }
+
+func (sc *partialScanner) skipSpace() {
+	for !sc.done() {
+		switch sc.peek() {
+		case ' ', '\t', '\n', '\r':
+			sc.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (sc *partialScanner) skipSpaceAndCommas() {
+	for !sc.done() {
+		switch sc.peek() {
+		case ' ', '\t', '\n', '\r', ',':
+			sc.pos++
+		default:
+			return
+		}
+	}
+}
+
+// readString 读取一个字符串（当前位置是起始引号），返回已解码部分与是否读到收尾引号。
+func (sc *partialScanner) readString() (string, bool) {
+	sc.pos++ // 起始引号
+	var sb strings.Builder
+	for !sc.done() {
+		c := sc.peek()
+		switch {
+		case c == '"':
+			sc.pos++
+			return sb.String(), true
+		case c == '\\':
+			r, n, ok := decodeEscape(sc.s[sc.pos:])
+			if !ok {
+				// 转义序列被截断：停在这里，等下一段增量
+				sc.pos = len(sc.s)
+				return sb.String(), false
+			}
+			sb.WriteRune(r)
+			sc.pos += n
+		default:
+			r, n := utf8.DecodeRuneInString(sc.s[sc.pos:])
+			if r == utf8.RuneError && n <= 1 && !utf8.FullRuneInString(sc.s[sc.pos:]) {
+				// 多字节字符被截断（增量按字节切分时可能发生）
+				sc.pos = len(sc.s)
+				return sb.String(), false
+			}
+			sb.WriteRune(r)
+			sc.pos += n
+		}
+	}
+	return sb.String(), false
+}
+
+// skipValue 跳过一个任意 JSON 值；输入被截断时返回 false。
+func (sc *partialScanner) skipValue() bool {
+	if sc.done() {
+		return false
+	}
+	switch sc.peek() {
+	case '"':
+		_, ok := sc.readString()
+		return ok
+	case '{', '[':
+		depth := 0
+		for !sc.done() {
+			switch sc.peek() {
+			case '"':
+				if _, ok := sc.readString(); !ok {
+					return false
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					sc.pos++
+					return true
+				}
+			}
+			sc.pos++
+		}
+		return false
+	default:
+		// 数字 / true / false / null：读到分隔符为止
+		for !sc.done() {
+			switch sc.peek() {
+			case ',', '}', ' ', '\t', '\n', '\r':
+				return true
+			}
+			sc.pos++
+		}
+		return false
+	}
+}
+
+// decodeEscape 解码 s 开头的转义序列，返回字符、消耗的字节数；序列不完整时 ok=false。
+func decodeEscape(s string) (r rune, n int, ok bool) {
+	if len(s) < 2 {
+		return 0, 0, false
+	}
+	switch s[1] {
+	case '"', '\\', '/':
+		return rune(s[1]), 2, true
+	case 'b':
+		return '\b', 2, true
+	case 'f':
+		return '\f', 2, true
+	case 'n':
+		return '\n', 2, true
+	case 'r':
+		return '\r', 2, true
+	case 't':
+		return '\t', 2, true
+	case 'u':
+		if len(s) < 6 {
+			return 0, 0, false
+		}
+		v, err := strconv.ParseUint(s[2:6], 16, 32)
+		if err != nil {
+			return utf8.RuneError, 6, true
+		}
+		r = rune(v)
+		if !utf16.IsSurrogate(r) {
+			return r, 6, true
+		}
+		// 代理对：需要紧跟着的第二个 \uXXXX
+		if len(s) < 12 {
+			return 0, 0, false
+		}
+		if s[6] != '\\' || s[7] != 'u' {
+			return utf8.RuneError, 6, true
+		}
+		v2, err := strconv.ParseUint(s[8:12], 16, 32)
+		if err != nil {
+			return utf8.RuneError, 6, true
+		}
+		return utf16.DecodeRune(r, rune(v2)), 12, true
+	default:
+		return rune(s[1]), 2, true
+	}
+}
@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// StripCodeFences 去掉模型输出外层的 markdown 围栏（```json ... ```）。
+// 不是围栏包裹的内容原样返回（仅去掉首尾空白）。
+func StripCodeFences(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if !strings.HasPrefix(trimmed, "```") {
+		return trimmed
+	}
+
+	end := strings.LastIndex(trimmed, "```")
+	if end <= 3 {
+		return trimmed
+	}
+
+	inner := strings.TrimSpace(trimmed[3:end])
+	// 第一行若是 "json" 之类的语言提示，则删除
+	if idx := strings.IndexAny(inner, "\n\r"); idx > 0 && isAlphaString(inner[:idx]) {
+		inner = strings.TrimSpace(inner[idx:])
+	}
+	return inner
+}
+
+// ValidateJSON 按 JSONSchema 校验一段 JSON 文本，返回全部违规项（为空表示通过）。
+//
+// 只实现导演侧实际用到的 JSON Schema 子集：
+// type / properties / required / additionalProperties(false) / enum / items / minimum / maximum。
+// 不认识的关键字直接忽略，保证“宽进”，避免因为 schema 写法差异误判。
+func ValidateJSON(data string, schema *JSONSchema) ([]string, error) {
+	var value any
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+	if schema == nil || schema.Schema == nil {
+		return nil, nil
+	}
+
+	var violations []string
+	validateValue("$", value, schema.Schema, &violations)
+	return violations, nil
+}
+
+func validateValue(path string, value any, schema map[string]any, violations *[]string) {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		if !matchesAnyType(value, types) {
+			*violations = append(*violations, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, "|"), jsonTypeOf(value)))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"]; ok {
+		if !enumContains(enum, value) {
+			*violations = append(*violations, fmt.Sprintf("%s: value %v not in enum %v", path, value, enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		validateObject(path, v, schema, violations)
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validateValue(fmt.Sprintf("%s[%d]", path, i), item, items, violations)
+			}
+		}
+	case float64:
+		if min, ok := toFloat(schema["minimum"]); ok && v < min {
+			*violations = append(*violations, fmt.Sprintf("%s: %v is less than minimum %v", path, v, min))
+		}
+		if max, ok := toFloat(schema["maximum"]); ok && v > max {
+			*violations = append(*violations, fmt.Sprintf("%s: %v is greater than maximum %v", path, v, max))
+		}
+	}
+}
+
+func validateObject(path string, obj map[string]any, schema map[string]any, violations *[]string) {
+	properties, _ := schema["properties"].(map[string]any)
+
+	for _, name := range toStringSlice(schema["required"]) {
+		if _, ok := obj[name]; !ok {
+			*violations = append(*violations, fmt.Sprintf("%s: missing required field %q", path, name))
+		}
+	}
+
+	// 按字段名排序，保证违规信息稳定（便于测试与修复提示）
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propSchema, known := properties[name].(map[string]any)
+		if !known {
+			if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				*violations = append(*violations, fmt.Sprintf("%s: unexpected field %q", path, name))
+			}
+			continue
+		}
+		validateValue(path+"."+name, obj[name], propSchema, violations)
+	}
+}
+
+func schemaTypes(raw any) []string {
+	switch t := raw.(type) {
+	case string:
+		return []string{t}
+	default:
+		return toStringSlice(raw)
+	}
+}
+
+func matchesAnyType(value any, types []string) bool {
+	for _, t := range types {
+		if matchesType(value, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(value any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		// 未知类型不做约束
+		return true
+	}
+}
+
+func jsonTypeOf(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func enumContains(enum any, value any) bool {
+	var options []any
+	switch e := enum.(type) {
+	case []any:
+		options = e
+	case []string:
+		for _, s := range e {
+			options = append(options, s)
+		}
+	default:
+		return true
+	}
+	for _, opt := range options {
+		if fmt.Sprint(opt) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// toStringSlice 兼容 Go 侧直接写 []string 与 JSON 反序列化得到的 []any 两种形态。
+func toStringSlice(raw any) []string {
+	switch v := raw.(type) {
+	case []string:
+		return v
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func toFloat(raw any) (float64, bool) {
+	switch v := raw.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripCodeFences(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", `  {"a":1}  `, `{"a":1}`},
+		{"json fence", "```json\n{\"a\":1}\n```", `{"a":1}`},
+		{"bare fence", "```\n{\"a\":1}\n```", `{"a":1}`},
+		{"unterminated", "```json", "```json"},
+	}
+	for _, tc := range cases {
+		if got := StripCodeFences(tc.in); got != tc.want {
+			t.Errorf("%s: StripCodeFences(%q) = %q, want %q", tc.name, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	schema := &JSONSchema{
+		Name: "segment_plan",
+		Schema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"action": map[string]any{"type": "string", "enum": []string{"continue", "wrap"}},
+				"score":  map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+				"roles":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			"required":             []string{"action", "score"},
+			"additionalProperties": false,
+		},
+	}
+
+	violations, err := ValidateJSON(`{"action":"continue","score":0.5,"roles":["host"]}`, schema)
+	if err != nil || len(violations) != 0 {
+		t.Fatalf("expected valid, got violations=%v err=%v", violations, err)
+	}
+
+	violations, err = ValidateJSON(`{"action":"jump","score":1.5,"roles":[1],"extra":true}`, schema)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	want := []string{"not in enum", `unexpected field "extra"`, "greater than maximum", "$.roles[0]"}
+	joined := strings.Join(violations, "\n")
+	for _, w := range want {
+		if !strings.Contains(joined, w) {
+			t.Errorf("expected violation containing %q, got:\n%s", w, joined)
+		}
+	}
+
+	violations, _ = ValidateJSON(`{"action":"wrap"}`, schema)
+	if len(violations) != 1 || !strings.Contains(violations[0], `"score"`) {
+		t.Errorf("expected missing score violation, got %v", violations)
+	}
+
+	if _, err := ValidateJSON(`not json`, schema); err == nil {
+		t.Error("expected parse error for invalid JSON")
+	}
+}
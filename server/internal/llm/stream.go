@@ -0,0 +1,338 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StreamHandler 接收流式输出的增量文本。回调在 Stream 所在 goroutine 同步执行，应尽量轻量。
+type StreamHandler func(delta string)
+
+// StreamingClient 是可选能力：支持流式输出的客户端。
+//
+// 契约：
+// - 增量文本按到达顺序交给 onDelta；返回值是完整输出，与 Complete 的返回值等价（含 JSON 归一化）。
+// - 增量只用于“提前看”，最终以返回值为准：装饰器（如校验修复）可能让返回值与增量拼接结果不同。
+type StreamingClient interface {
+	Stream(ctx context.Context, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error)
+}
+
+// CompleteStream 优先走 Stream，不支持流式的客户端退回 Complete，并把完整结果作为唯一一段增量回调。
+func CompleteStream(ctx context.Context, c Client, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error) {
+	if sc, ok := c.(StreamingClient); ok {
+		return sc.Stream(ctx, messages, schema, onDelta)
+	}
+	response, err := c.Complete(ctx, messages, schema)
+	if err != nil {
+		return "", err
+	}
+	if onDelta != nil {
+		onDelta(response)
+	}
+	return response, nil
+}
+
+// maxSSELineSize 单行 SSE 数据上限（结构化输出偶尔会把整段 JSON 放在一个 chunk 里）
+const maxSSELineSize = 1 << 20
+
+// sseEvent 一个 Server-Sent Event
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readSSE 按 SSE 规范逐个解析事件：空行分隔事件，多行 data 以 \n 拼接，冒号开头为注释。
+// fn 返回 errStopStream 时正常结束读取。
+func readSSE(r io.Reader, fn func(sseEvent) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineSize)
+
+	var evt sseEvent
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			evt = sseEvent{}
+			return nil
+		}
+		evt.Data = strings.Join(data, "\n")
+		err := fn(evt)
+		evt, data = sseEvent{}, nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			if err := dispatch(); err != nil {
+				return stopOrErr(err)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			evt.Event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	// 流在最后一个事件后没有空行就结束了，也要把它交出去
+	return stopOrErr(dispatch())
+}
+
+// errStopStream 由事件回调返回，表示流已正常结束（如 OpenAI 的 [DONE]）。
+var errStopStream = errors.New("llm: stream done")
+
+func stopOrErr(err error) error {
+	if errors.Is(err, errStopStream) {
+		return nil
+	}
+	return err
+}
+
+// streamError 流中途返回的错误事件
+type streamError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// readOpenAIStream 解析 chat/completions 的流式响应（talopenai / openai_compatible 同构）。
+// usage 只有在请求里带了 stream_options.include_usage 时才会出现在最后一个 chunk。
+func readOpenAIStream(r io.Reader, onDelta StreamHandler) (string, *openAIUsage, error) {
+	var content strings.Builder
+	var usage *openAIUsage
+
+	err := readSSE(r, func(evt sseEvent) error {
+		if strings.TrimSpace(evt.Data) == "[DONE]" {
+			return errStopStream
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+			Error *streamError `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(evt.Data), &chunk); err != nil {
+			return fmt.Errorf("unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("stream error: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				onDelta(choice.Delta.Content)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return content.String(), usage, nil
+}
+
+// readAnthropicStream 解析 Anthropic messages 接口的流式响应。
+// 用量分两段给出：message_start 带输入 token，message_delta 带累计输出 token。
+func readAnthropicStream(r io.Reader, onDelta StreamHandler) (string, anthropicUsage, error) {
+	var content strings.Builder
+	var usage anthropicUsage
+
+	err := readSSE(r, func(evt sseEvent) error {
+		var payload struct {
+			Type    string `json:"type"`
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Usage *struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error *streamError `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(evt.Data), &payload); err != nil {
+			return fmt.Errorf("unmarshal stream event: %w", err)
+		}
+
+		switch payload.Type {
+		case "message_start":
+			usage = payload.Message.Usage
+		case "content_block_delta":
+			if payload.Delta.Type == "text_delta" && payload.Delta.Text != "" {
+				content.WriteString(payload.Delta.Text)
+				if onDelta != nil {
+					onDelta(payload.Delta.Text)
+				}
+			}
+		case "message_delta":
+			if payload.Usage != nil {
+				usage.OutputTokens = payload.Usage.OutputTokens
+			}
+		case "message_stop":
+			return errStopStream
+		case "error":
+			if payload.Error != nil {
+				return fmt.Errorf("stream error (%s): %s", payload.Error.Type, payload.Error.Message)
+			}
+			return fmt.Errorf("stream error: %s", evt.Data)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", anthropicUsage{}, err
+	}
+	return content.String(), usage, nil
+}
+
+// doStream 发出流式请求并校验状态码；非 200 时读出错误体返回。调用方负责关闭 Body。
+func doStream(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+// Stream 流式文本生成（OpenAI）
+func (c *OpenAIClient) Stream(ctx context.Context, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error) {
+	req, err := c.newRequest(ctx, messages, schema, true)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	resp, err := doStream(c.httpClient, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	content, usage, err := readOpenAIStream(resp.Body, onDelta)
+	if err != nil {
+		return "", err
+	}
+	if usage != nil {
+		ReportUsage(ctx, usage.toUsage("openai", c.config.Model, schema, time.Since(start)))
+	}
+	if content == "" {
+		return "", fmt.Errorf("empty content in stream")
+	}
+	return content, nil
+}
+
+// Stream 流式文本生成（Anthropic）
+func (c *AnthropicClient) Stream(ctx context.Context, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error) {
+	req, err := c.newRequest(ctx, messages, true)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	resp, err := doStream(c.httpClient, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	content, usage, err := readAnthropicStream(resp.Body, onDelta)
+	if err != nil {
+		return "", err
+	}
+	ReportUsage(ctx, usage.toUsage(c.config.Model, schema, time.Since(start)))
+	if content == "" {
+		return "", fmt.Errorf("no content in stream")
+	}
+	return content, nil
+}
+
+// Stream 流式文本生成（Tal OpenAI-compatible）
+func (c *TalOpenAIClient) Stream(ctx context.Context, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error) {
+	req, err := c.newRequest(ctx, messages, schema, true)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	resp, err := doStream(c.httpClient, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	content, usage, err := readOpenAIStream(resp.Body, onDelta)
+	if err != nil {
+		return "", err
+	}
+	if usage != nil {
+		ReportUsage(ctx, usage.toUsage("talopenai", c.config.Model, schema, time.Since(start)))
+	}
+	if content == "" {
+		return "", fmt.Errorf("empty content in stream")
+	}
+	// 与 Complete 一致：结构化调用尽量归一化成紧凑 JSON，失败或无 schema 时返回原文
+	if schema != nil {
+		if normalized, ok := extractJSONContent(content); ok {
+			return normalized, nil
+		}
+	}
+	return content, nil
+}
+
+// Stream 流式文本生成（OpenAI-compatible）
+func (c *OpenAICompatibleClient) Stream(ctx context.Context, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error) {
+	req, err := c.newRequest(ctx, messages, schema, true)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	resp, err := doStream(c.httpClient, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	content, usage, err := readOpenAIStream(resp.Body, onDelta)
+	if err != nil {
+		return "", err
+	}
+	if usage != nil {
+		ReportUsage(ctx, usage.toUsage("openai_compatible", c.config.Model, schema, time.Since(start)))
+	}
+	return c.normalize(content, schema)
+}
@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"bubble-talk/server/internal/config"
+)
+
+const wantStreamContent = "{\"role_id\":\"host,economist\",\"scene_direction\":\"主持人先接住用户的猜测\\n再抛出反例\"}"
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// TestReadOpenAIStream_Fixture 验证 OpenAI 流：跳过注释与空 delta、[DONE] 结束、最后一个 chunk 带 usage。
+func TestReadOpenAIStream_Fixture(t *testing.T) {
+	var deltas []string
+	content, usage, err := readOpenAIStream(openFixture(t, "openai_stream.sse"), func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatalf("readOpenAIStream error: %v", err)
+	}
+	if content != wantStreamContent {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if len(deltas) != 3 {
+		t.Fatalf("expected 3 deltas, got %d: %q", len(deltas), deltas)
+	}
+	if usage == nil || usage.PromptTokens != 812 || usage.CompletionTokens != 46 || usage.PromptTokensDetails.CachedTokens != 512 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+// TestReadAnthropicStream_Fixture 验证 Anthropic 流：按事件类型取文本增量，用量分两段合并。
+func TestReadAnthropicStream_Fixture(t *testing.T) {
+	var deltas []string
+	content, usage, err := readAnthropicStream(openFixture(t, "anthropic_stream.sse"), func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatalf("readAnthropicStream error: %v", err)
+	}
+	if content != wantStreamContent {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if len(deltas) != 3 {
+		t.Fatalf("expected 3 deltas, got %d", len(deltas))
+	}
+	u := usage.toUsage("claude", nil, 0)
+	if u.PromptTokens != 800 || u.CachedTokens != 100 || u.CompletionTokens != 46 {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+}
+
+func TestReadAnthropicStream_ErrorEvent(t *testing.T) {
+	_, _, err := readAnthropicStream(openFixture(t, "anthropic_stream_error.sse"), nil)
+	if err == nil || !strings.Contains(err.Error(), "overloaded_error") {
+		t.Fatalf("expected overloaded error, got %v", err)
+	}
+}
+
+func TestReadSSE_MultilineDataAndMissingTrailingBlank(t *testing.T) {
+	var events []sseEvent
+	err := readSSE(strings.NewReader("event: a\ndata: line1\ndata: line2\n\r\ndata:tail"), func(e sseEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readSSE error: %v", err)
+	}
+	if len(events) != 2 || events[0].Event != "a" || events[0].Data != "line1\nline2" || events[1].Data != "tail" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+// TestOpenAICompatible_Stream 端到端验证：请求带 stream 参数，增量按序回调，返回值与 Complete 一致地归一化，并上报用量。
+func TestOpenAICompatible_Stream(t *testing.T) {
+	var payload map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &payload)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fixture, _ := os.ReadFile("testdata/openai_stream.sse")
+		_, _ = w.Write(fixture)
+	}))
+	defer ts.Close()
+
+	client := NewOpenAICompatibleClient(config.LLMProviderConfig{APIURL: ts.URL, Model: "qwen2.5", SupportsJSONSchema: true})
+
+	var usages []Usage
+	ctx := WithUsageObserver(context.Background(), func(u Usage) { usages = append(usages, u) })
+
+	var streamed strings.Builder
+	schema := &JSONSchema{Name: "segment_plan"}
+	got, err := client.Stream(ctx, []Message{{Role: "user", Content: "plan"}}, schema, func(d string) { streamed.WriteString(d) })
+	if err != nil {
+		t.Fatalf("Stream error: %v", err)
+	}
+	if payload["stream"] != true {
+		t.Fatalf("expected stream=true in request, got %v", payload["stream"])
+	}
+	if streamed.String() != wantStreamContent {
+		t.Fatalf("unexpected streamed content: %q", streamed.String())
+	}
+	var plan map[string]string
+	if err := json.Unmarshal([]byte(got), &plan); err != nil || plan["role_id"] != "host,economist" {
+		t.Fatalf("expected normalized JSON result, got %q (err=%v)", got, err)
+	}
+	if len(usages) != 1 || usages[0].Schema != "segment_plan" || usages[0].PromptTokens != 812 {
+		t.Fatalf("unexpected usage: %+v", usages)
+	}
+}
+
+// TestCompleteStream_FallsBackToComplete 验证不支持流式的客户端：完整结果作为唯一一段增量。
+func TestCompleteStream_FallsBackToComplete(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{"hello"}}
+	var deltas []string
+	got, err := CompleteStream(context.Background(), inner, nil, nil, func(d string) { deltas = append(deltas, d) })
+	if err != nil || got != "hello" || len(deltas) != 1 || deltas[0] != "hello" {
+		t.Fatalf("unexpected fallback result: got=%q deltas=%q err=%v", got, deltas, err)
+	}
+
+	failing := &scriptedClient{}
+	deltas = nil
+	if _, err := CompleteStream(context.Background(), failing, nil, nil, func(d string) { deltas = append(deltas, d) }); err == nil || len(deltas) != 0 {
+		t.Fatalf("expected error without deltas, got err=%v deltas=%q", err, deltas)
+	}
+}
+
+// TestValidatingClient_StreamRepairs 验证流式首次输出不合法时仍会做修复回合，返回修复后的结果。
+func TestValidatingClient_StreamRepairs(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{`{"score":"high"}`, `{"score":0.4,"reason":"fixed"}`}}
+	client := NewValidatingClient(inner, "test", NewSchemaMetrics())
+
+	var deltas []string
+	got, err := client.Stream(context.Background(), []Message{{Role: "user", Content: "hi"}}, testAlignmentSchema, func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatalf("Stream error: %v", err)
+	}
+	if got != `{"score":0.4,"reason":"fixed"}` {
+		t.Fatalf("expected repaired output, got %q", got)
+	}
+	if len(deltas) != 1 || deltas[0] != `{"score":"high"}` {
+		t.Fatalf("expected only first attempt to be streamed, got %q", deltas)
+	}
+}
+
+func TestPartialJSON_StringField(t *testing.T) {
+	var p PartialJSON
+	chunks := []string{"```json\n{\"max_duration_sec\": 30, \"notes\": {\"a\": [1, \"}\"]}, \"role", "_id\": \"host\"", ", \"scene_direction\": \"先\\", "n讲", "故事\\u4e2", "d\\ud83d", "\\ude00\"}"}
+
+	type step struct {
+		role, scene           string
+		roleDone, sceneDone   bool
+		roleFound, sceneFound bool
+	}
+	want := []step{
+		{},
+		{role: "host", roleDone: true, roleFound: true},
+		{role: "host", roleDone: true, roleFound: true, scene: "先", sceneFound: true},
+		{role: "host", roleDone: true, roleFound: true, scene: "先\n讲", sceneFound: true},
+		{role: "host", roleDone: true, roleFound: true, scene: "先\n讲故事", sceneFound: true},
+		{role: "host", roleDone: true, roleFound: true, scene: "先\n讲故事中", sceneFound: true},
+		{role: "host", roleDone: true, roleFound: true, scene: "先\n讲故事中😀", sceneDone: true, sceneFound: true},
+	}
+
+	for i, chunk := range chunks {
+		p.Write(chunk)
+		w := want[i]
+		role, roleDone, roleFound := p.StringField("role_id")
+		scene, sceneDone, sceneFound := p.StringField("scene_direction")
+		got := step{role, scene, roleDone, sceneDone, roleFound, sceneFound}
+		if got != w {
+			t.Fatalf("after chunk %d (%q): got %+v, want %+v", i, chunk, got, w)
+		}
+	}
+
+	if _, _, found := p.StringField("max_duration_sec"); found {
+		t.Fatalf("non-string field should not be reported as found")
+	}
+}
+
+func TestPartialJSON_RawField(t *testing.T) {
+	var p PartialJSON
+	p.Write(`{"max_duration_sec": 3`)
+	if _, done := p.RawField("max_duration_sec"); done {
+		t.Fatal("number may still be growing")
+	}
+	p.Write(`0, "beats": [{"role_id": "host", "direction": "先]讲"}, {"role_id"`)
+	if raw, done := p.RawField("max_duration_sec"); !done || raw != "30" {
+		t.Fatalf("max_duration_sec = %q done=%v", raw, done)
+	}
+	if _, done := p.RawField("beats"); done {
+		t.Fatal("beats array is not closed yet")
+	}
+	p.Write(`: "economist", "direction": "接着"}], "scene_direction": "`)
+	raw, done := p.RawField("beats")
+	if !done || !strings.HasPrefix(raw, "[{") || !strings.HasSuffix(raw, "}]") {
+		t.Fatalf("beats = %q done=%v", raw, done)
+	}
+	if _, done := p.RawField("director_notes"); done {
+		t.Fatal("missing field should not be complete")
+	}
+}
+
+func TestPartialJSON_SplitMultibyteRune(t *testing.T) {
+	var p PartialJSON
+	full := "{\"scene_direction\":\"讲\"}"
+	cut := strings.Index(full, "讲") + 1
+	p.Write(full[:cut])
+	if v, done, _ := p.StringField("scene_direction"); v != "" || done {
+		t.Fatalf("expected truncated rune to be withheld, got %q done=%v", v, done)
+	}
+	p.Write(full[cut:])
+	if v, done, _ := p.StringField("scene_direction"); v != "讲" || !done {
+		t.Fatalf("expected full rune, got %q done=%v", v, done)
+	}
+}
@@ -124,7 +124,7 @@ func TestRealLLMTalOpenAI_OpenAIContentWithJSON(t *testing.T) {
 
 	messages := []Message{{Role: "user", Content: "test"}}
 
-	res, err := client.Complete(ctx, messages, nil)
+	res, err := client.Complete(ctx, messages, &JSONSchema{Name: "director_plan"})
 	if err != nil {
 		t.Fatalf("Complete error: %v", err)
 	}
@@ -144,6 +144,31 @@ func TestRealLLMTalOpenAI_OpenAIContentWithJSON(t *testing.T) {
 	}
 }
 
+func TestRealLLMTalOpenAI_SchemaLessTextNotRewritten(t *testing.T) {
+	// 无 schema 的纯文本调用：内容恰好是（带代码块的）JSON 也原样返回，不做归一化
+	content := "```json\n{\"a\": 1}\n```"
+	respBody := `{"choices":[{"message":{"content":` + string(jsonEscape(content)) + `}}]}`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(respBody))
+	}))
+	defer ts.Close()
+
+	client := NewTalOpenAIClient(config.LLMProviderConfig{APIURL: ts.URL, APIKey: "dummy", Model: "gpt-test"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.Complete(ctx, []Message{{Role: "user", Content: "test"}}, nil)
+	if err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+	if res != content {
+		t.Fatalf("schema-less content rewritten: %q", res)
+	}
+}
+
 // jsonEscape returns a JSON-quoted string of s (i.e., suitable to embed inside JSON)
 func jsonEscape(s string) []byte {
 	b, _ := json.Marshal(s)
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"time"
+)
+
+// Usage 一次 LLM 调用的用量与耗时。
+type Usage struct {
+	Provider string
+	Model    string
+	// Schema 结构化输出的 schema 名；纯文本调用为 "text"
+	Schema           string
+	PromptTokens     int
+	CompletionTokens int
+	// CachedTokens 命中 prompt cache 的输入 token（已包含在 PromptTokens 中）
+	CachedTokens int
+	Latency      time.Duration
+}
+
+// UsageObserver 接收用量回调。回调在 Complete 所在 goroutine 同步执行，应尽量轻量。
+type UsageObserver func(Usage)
+
+type usageObserverKey struct{}
+
+// WithUsageObserver 在 ctx 上挂一个用量观察者。
+// 通过 ctx 传递而不是扩展 Client 接口，避免所有调用方（导演的多次 LLM 调用）都要改签名；
+// 已有观察者时会串联，两者都会收到回调。
+func WithUsageObserver(ctx context.Context, fn UsageObserver) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	if parent, ok := ctx.Value(usageObserverKey{}).(UsageObserver); ok {
+		inner := fn
+		fn = func(u Usage) {
+			parent(u)
+			inner(u)
+		}
+	}
+	return context.WithValue(ctx, usageObserverKey{}, fn)
+}
+
+// ReportUsage 把用量交给 ctx 上的观察者（没有观察者时什么也不做）。
+// provider 实现与包外的 Client 装饰器/测试桩都应通过它上报。
+func ReportUsage(ctx context.Context, u Usage) {
+	if ctx == nil {
+		return
+	}
+	if fn, ok := ctx.Value(usageObserverKey{}).(UsageObserver); ok {
+		fn(u)
+	}
+}
+
+// schemaName 用量统计使用的 schema 名。
+func schemaName(schema *JSONSchema) string {
+	if schema == nil {
+		return "text"
+	}
+	return schema.Name
+}
+
+// openAIUsage OpenAI chat/completions 风格的 usage 字段（talopenai / openai_compatible 同构）。
+type openAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+func (u openAIUsage) toUsage(provider, model string, schema *JSONSchema, latency time.Duration) Usage {
+	return Usage{
+		Provider:         provider,
+		Model:            model,
+		Schema:           schemaName(schema),
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		CachedTokens:     u.PromptTokensDetails.CachedTokens,
+		Latency:          latency,
+	}
+}
+
+// anthropicUsage Anthropic messages 接口的 usage 字段。
+// 注意 Anthropic 的 input_tokens 不含缓存部分，这里折算成与 OpenAI 一致的口径。
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+func (u anthropicUsage) toUsage(model string, schema *JSONSchema, latency time.Duration) Usage {
+	return Usage{
+		Provider:         "anthropic",
+		Model:            model,
+		Schema:           schemaName(schema),
+		PromptTokens:     u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens,
+		CompletionTokens: u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+		Latency:          latency,
+	}
+}
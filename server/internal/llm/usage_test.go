@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"bubble-talk/server/internal/config"
+)
+
+// TestUsageObserver_ReceivesProviderUsage 验证 provider 解析 usage 并通过 ctx 上的观察者上报。
+func TestUsageObserver_ReceivesProviderUsage(t *testing.T) {
+	var got compatRequest
+	ts := newCompatServer(t, `{"score":0.5,"reason":"ok"}`, &got)
+	defer ts.Close()
+
+	client := NewOpenAICompatibleClient(config.LLMProviderConfig{APIURL: ts.URL, Model: "qwen2.5"})
+
+	var usages []Usage
+	ctx := WithUsageObserver(context.Background(), func(u Usage) { usages = append(usages, u) })
+
+	if _, err := client.Complete(ctx, []Message{{Role: "user", Content: "hi"}}, testAlignmentSchema); err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+	if _, err := client.Complete(ctx, []Message{{Role: "user", Content: "hi"}}, nil); err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+
+	if len(usages) != 2 {
+		t.Fatalf("expected 2 usage reports, got %d", len(usages))
+	}
+	u := usages[0]
+	if u.Provider != "openai_compatible" || u.Model != "qwen2.5" || u.Schema != "alignment_score" {
+		t.Errorf("unexpected usage identity: %+v", u)
+	}
+	if u.PromptTokens != 120 || u.CompletionTokens != 30 || u.CachedTokens != 64 {
+		t.Errorf("unexpected token counts: %+v", u)
+	}
+	if usages[1].Schema != "text" {
+		t.Errorf("expected schema text for plain completion, got %q", usages[1].Schema)
+	}
+}
+
+// TestWithUsageObserver_Chains 验证嵌套挂载的观察者都能收到回调。
+func TestWithUsageObserver_Chains(t *testing.T) {
+	var outer, inner int
+	ctx := WithUsageObserver(context.Background(), func(Usage) { outer++ })
+	ctx = WithUsageObserver(ctx, func(Usage) { inner++ })
+
+	ReportUsage(ctx, Usage{PromptTokens: 1})
+	ReportUsage(context.Background(), Usage{PromptTokens: 1})
+
+	if outer != 1 || inner != 1 {
+		t.Fatalf("expected both observers called once, got outer=%d inner=%d", outer, inner)
+	}
+}
@@ -0,0 +1,226 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrSchemaValidation 结构化输出未通过 JSON Schema 校验（含修复后仍失败）。
+// 调用方可用 errors.Is 判断，或 errors.As 取 *SchemaValidationError 拿到细节。
+var ErrSchemaValidation = errors.New("llm: structured output failed schema validation")
+
+// SchemaValidationError 结构化输出校验失败的详细信息。
+type SchemaValidationError struct {
+	Provider string
+	Schema   string
+	// Violations 最后一次校验的违规项；输出根本不是 JSON 时为空，原因见 ParseErr
+	Violations []string
+	ParseErr   error
+	// Raw 最后一次收到的原始输出（已去围栏）
+	Raw string
+	// Repaired 是否已经尝试过修复回合
+	Repaired bool
+}
+
+func (e *SchemaValidationError) Error() string {
+	detail := strings.Join(e.Violations, "; ")
+	if e.ParseErr != nil {
+		detail = e.ParseErr.Error()
+	}
+	return fmt.Sprintf("llm: %s output for schema %s failed validation (repaired=%v): %s",
+		e.Provider, e.Schema, e.Repaired, detail)
+}
+
+func (e *SchemaValidationError) Unwrap() error {
+	return ErrSchemaValidation
+}
+
+// SchemaStats 单个 provider + schema 的校验计数。
+type SchemaStats struct {
+	Provider string `json:"provider"`
+	Schema   string `json:"schema"`
+	// Calls 带 schema 的调用次数
+	Calls int64 `json:"calls"`
+	// Valid 首次输出即通过校验
+	Valid int64 `json:"valid"`
+	// Repaired 首次失败、修复回合后通过
+	Repaired int64 `json:"repaired"`
+	// Failed 修复后仍失败（或修复请求本身出错）
+	Failed int64 `json:"failed"`
+}
+
+// SchemaMetrics 记录每个 provider/schema 的校验结果，用于观察“哪个 schema 在哪个模型上最容易崩”。
+type SchemaMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*SchemaStats
+}
+
+// NewSchemaMetrics 创建校验计数器
+func NewSchemaMetrics() *SchemaMetrics {
+	return &SchemaMetrics{stats: make(map[string]*SchemaStats)}
+}
+
+// DefaultSchemaMetrics 进程级默认计数器，NewClient 创建的客户端都记到这里。
+var DefaultSchemaMetrics = NewSchemaMetrics()
+
+func (m *SchemaMetrics) record(provider, schema string, update func(s *SchemaStats)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := provider + "/" + schema
+	s, ok := m.stats[key]
+	if !ok {
+		s = &SchemaStats{Provider: provider, Schema: schema}
+		m.stats[key] = s
+	}
+	update(s)
+}
+
+// Snapshot 返回当前计数的副本（按 provider、schema 排序）。
+func (m *SchemaMetrics) Snapshot() []SchemaStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]SchemaStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		return out[i].Schema < out[j].Schema
+	})
+	return out
+}
+
+// ValidatingClient 结构化输出校验装饰器。
+//
+// 契约：
+// - schema 为 nil 时直接透传，不做任何处理。
+// - schema 非 nil 时：去围栏 → 校验 → 不通过则带着校验错误做一次修复回合 → 仍不通过返回 *SchemaValidationError。
+// - 成功时返回的是去围栏后的 JSON 文本，调用方可直接 json.Unmarshal。
+type ValidatingClient struct {
+	inner    Client
+	provider string
+	metrics  *SchemaMetrics
+}
+
+// NewValidatingClient 创建校验装饰器；metrics 为 nil 时使用 DefaultSchemaMetrics。
+func NewValidatingClient(inner Client, provider string, metrics *SchemaMetrics) *ValidatingClient {
+	if metrics == nil {
+		metrics = DefaultSchemaMetrics
+	}
+	return &ValidatingClient{
+		inner:    inner,
+		provider: provider,
+		metrics:  metrics,
+	}
+}
+
+// Unwrap 返回被装饰的客户端
+func (c *ValidatingClient) Unwrap() Client {
+	return c.inner
+}
+
+// Complete 实现 Client 接口
+func (c *ValidatingClient) Complete(ctx context.Context, messages []Message, schema *JSONSchema) (string, error) {
+	return c.complete(ctx, messages, schema, nil)
+}
+
+// Stream 实现 StreamingClient 接口。
+// 首次输出的增量原样透传；修复回合走非流式调用，调用方应以返回值为准。
+func (c *ValidatingClient) Stream(ctx context.Context, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error) {
+	if onDelta == nil {
+		onDelta = func(string) {}
+	}
+	return c.complete(ctx, messages, schema, onDelta)
+}
+
+// complete onDelta 非 nil 时首次调用走流式。
+func (c *ValidatingClient) complete(ctx context.Context, messages []Message, schema *JSONSchema, onDelta StreamHandler) (string, error) {
+	first := func(schema *JSONSchema) (string, error) {
+		if onDelta != nil {
+			return CompleteStream(ctx, c.inner, messages, schema, onDelta)
+		}
+		return c.inner.Complete(ctx, messages, schema)
+	}
+
+	if schema == nil {
+		return first(nil)
+	}
+
+	c.metrics.record(c.provider, schema.Name, func(s *SchemaStats) { s.Calls++ })
+
+	raw, err := first(schema)
+	if err != nil {
+		// 传输层错误不计入 schema 失败，由调用方按原有逻辑降级
+		return "", err
+	}
+
+	content := StripCodeFences(raw)
+	problem := checkSchema(content, schema)
+	if problem == nil {
+		c.metrics.record(c.provider, schema.Name, func(s *SchemaStats) { s.Valid++ })
+		return content, nil
+	}
+
+	// 修复回合：把上一次输出与校验错误一并交回模型，只要求修正后的 JSON。
+	repairMessages := make([]Message, 0, len(messages)+2)
+	repairMessages = append(repairMessages, messages...)
+	repairMessages = append(repairMessages,
+		Message{Role: "assistant", Content: raw},
+		Message{Role: "user", Content: buildRepairPrompt(schema, problem)},
+	)
+
+	repairedRaw, err := c.inner.Complete(ctx, repairMessages, schema)
+	if err != nil {
+		c.metrics.record(c.provider, schema.Name, func(s *SchemaStats) { s.Failed++ })
+		problem.Repaired = true
+		problem.Provider = c.provider
+		return "", fmt.Errorf("repair request: %w", errors.Join(problem, err))
+	}
+
+	repaired := StripCodeFences(repairedRaw)
+	if second := checkSchema(repaired, schema); second != nil {
+		c.metrics.record(c.provider, schema.Name, func(s *SchemaStats) { s.Failed++ })
+		second.Repaired = true
+		second.Provider = c.provider
+		return "", second
+	}
+
+	c.metrics.record(c.provider, schema.Name, func(s *SchemaStats) { s.Repaired++ })
+	return repaired, nil
+}
+
+// checkSchema 校验输出；通过返回 nil。
+func checkSchema(content string, schema *JSONSchema) *SchemaValidationError {
+	violations, err := ValidateJSON(content, schema)
+	if err == nil && len(violations) == 0 {
+		return nil
+	}
+	return &SchemaValidationError{
+		Schema:     schema.Name,
+		Violations: violations,
+		ParseErr:   err,
+		Raw:        content,
+	}
+}
+
+// buildRepairPrompt 生成修复提示：明确指出错在哪里，只要 JSON。
+func buildRepairPrompt(schema *JSONSchema, problem *SchemaValidationError) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("你上一次的输出没有通过 JSON Schema（%s）校验：\n", schema.Name))
+	if problem.ParseErr != nil {
+		sb.WriteString("- 输出不是合法的 JSON：" + problem.ParseErr.Error() + "\n")
+	}
+	for _, v := range problem.Violations {
+		sb.WriteString("- " + v + "\n")
+	}
+	sb.WriteString("请只输出修正后的 JSON 对象，不要输出 markdown 围栏或任何解释文字。")
+	return sb.String()
+}
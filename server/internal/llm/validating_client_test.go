@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scriptedClient 按顺序返回预设输出，并记录每次收到的消息。
+type scriptedClient struct {
+	outputs []string
+	calls   [][]Message
+}
+
+func (c *scriptedClient) Complete(ctx context.Context, messages []Message, schema *JSONSchema) (string, error) {
+	c.calls = append(c.calls, messages)
+	if len(c.outputs) == 0 {
+		return "", errors.New("no scripted output")
+	}
+	out := c.outputs[0]
+	c.outputs = c.outputs[1:]
+	return out, nil
+}
+
+func TestValidatingClient_ValidFirstTry(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{"```json\n{\"score\":0.9,\"reason\":\"ok\"}\n```"}}
+	metrics := NewSchemaMetrics()
+	client := NewValidatingClient(inner, "openai", metrics)
+
+	res, err := client.Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, testAlignmentSchema)
+	if err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+	if res != `{"score":0.9,"reason":"ok"}` {
+		t.Fatalf("expected fences stripped, got %q", res)
+	}
+	if len(inner.calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(inner.calls))
+	}
+
+	stats := metrics.Snapshot()
+	if len(stats) != 1 || stats[0].Calls != 1 || stats[0].Valid != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestValidatingClient_RepairRoundTrip(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{
+		`{"score":"high"}`,
+		`{"score":0.7,"reason":"修正"}`,
+	}}
+	metrics := NewSchemaMetrics()
+	client := NewValidatingClient(inner, "anthropic", metrics)
+
+	res, err := client.Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, testAlignmentSchema)
+	if err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+	if !strings.Contains(res, `"reason":"修正"`) {
+		t.Fatalf("expected repaired output, got %q", res)
+	}
+	if len(inner.calls) != 2 {
+		t.Fatalf("expected repair round-trip, got %d calls", len(inner.calls))
+	}
+
+	repair := inner.calls[1]
+	if len(repair) != 3 || repair[1].Role != "assistant" || repair[2].Role != "user" {
+		t.Fatalf("unexpected repair messages: %+v", repair)
+	}
+	if !strings.Contains(repair[2].Content, `"reason"`) {
+		t.Errorf("repair prompt should list violations, got %q", repair[2].Content)
+	}
+
+	stats := metrics.Snapshot()
+	if stats[0].Repaired != 1 || stats[0].Valid != 0 || stats[0].Failed != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestValidatingClient_FailsAfterRepair(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{"不是 JSON", `{"score":1}`}}
+	metrics := NewSchemaMetrics()
+	client := NewValidatingClient(inner, "talopenai", metrics)
+
+	_, err := client.Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, testAlignmentSchema)
+	if !errors.Is(err, ErrSchemaValidation) {
+		t.Fatalf("expected ErrSchemaValidation, got %v", err)
+	}
+	var verr *SchemaValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *SchemaValidationError, got %T", err)
+	}
+	if verr.Provider != "talopenai" || verr.Schema != "alignment_score" || !verr.Repaired {
+		t.Errorf("unexpected error detail: %+v", verr)
+	}
+
+	stats := metrics.Snapshot()
+	if stats[0].Failed != 1 || stats[0].Calls != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestValidatingClient_RepairRequestError(t *testing.T) {
+	// 修复回合本身失败（这里是没有第二个预设输出）：错误里仍能拿到 schema 校验详情与 provider
+	inner := &scriptedClient{outputs: []string{"不是 JSON"}}
+	metrics := NewSchemaMetrics()
+	client := NewValidatingClient(inner, "anthropic", metrics)
+
+	_, err := client.Complete(context.Background(), []Message{{Role: "user", Content: "hi"}}, testAlignmentSchema)
+	var verr *SchemaValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *SchemaValidationError, got %v", err)
+	}
+	if verr.Provider != "anthropic" || !verr.Repaired {
+		t.Errorf("unexpected error detail: %+v", verr)
+	}
+	if stats := metrics.Snapshot(); stats[0].Failed != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestValidatingClient_NilSchemaPassthrough(t *testing.T) {
+	inner := &scriptedClient{outputs: []string{"```纯文本```"}}
+	metrics := NewSchemaMetrics()
+	client := NewValidatingClient(inner, "openai", metrics)
+
+	res, err := client.Complete(context.Background(), nil, nil)
+	if err != nil || res != "```纯文本```" {
+		t.Fatalf("expected passthrough, got %q err=%v", res, err)
+	}
+	if len(metrics.Snapshot()) != 0 {
+		t.Fatal("nil schema calls must not be counted")
+	}
+}
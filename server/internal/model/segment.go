@@ -73,11 +73,23 @@ type SegmentPlan struct {
 	// 自治预算（允许这个角色说多久）
 	MaxDurationSec int `json:"max_duration_sec"`
 
+	// 多角色顺序出场时每个角色的一拍（与 RoleID 的顺序一致），单角色时为空
+	Beats []SegmentBeat `json:"beats,omitempty"`
+
+	// 发言优先级：low | normal | urgent（紧急插话，如质疑者当场打断）
+	Priority string `json:"priority,omitempty"`
+
 	// === 元信息 ===
 	// 导演的决策说明（调试用）
 	DirectorNotes string `json:"director_notes,omitempty"`
 }
 
+// SegmentBeat 多角色片段中某个角色的一拍
+type SegmentBeat struct {
+	RoleID    string `json:"role_id"`
+	Direction string `json:"direction"`
+}
+
 // SegmentSnapshot 片段执行快照
 type SegmentSnapshot struct {
 	SegmentID  string    `json:"segment_id"`
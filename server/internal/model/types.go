@@ -86,6 +86,14 @@ type SessionState struct {
 	// 对话的历史轮次。
 	Turns []Turn `json:"turns"`
 
+	// BudgetExceeded 会话用量已超出预算，导演应尽快收束（Wrap/ExitTicket）。
+	BudgetExceeded bool `json:"budget_exceeded,omitempty"`
+
+	// Lineage 由导入/分叉创建的会话记录来源，普通会话为空。
+	Lineage *SessionLineage `json:"lineage,omitempty"`
+	// Overrides 会话级引擎覆盖（分叉时换导演类型/Prompt 版本/LLM），为空使用服务默认配置。
+	Overrides *SessionOverrides `json:"overrides,omitempty"`
+
 	// 新增字段
 	LastUserUtterance string    `json:"last_user_utterance,omitempty"`
 	CreatedAt         time.Time `json:"created_at"`
@@ -114,6 +122,8 @@ type Event struct {
 
 	// Type 表示事件类型（asr_final/user_message/quiz_answer/assistant_text/...）。
 	Type string `json:"type"`
+	// Role 输出类事件（assistant_text）的发言角色。
+	Role string `json:"role,omitempty"`
 	// Text 是语音最终转写或用户文本输入。
 	Text string `json:"text,omitempty"`
 	// QuestionID/Answer 承载测评/工具类事件。
@@ -124,6 +134,88 @@ type Event struct {
 	ServerTS time.Time `json:"server_ts,omitempty"`
 	// DirectorPlan 作为结构化事实事件，便于验收与回放。
 	DirectorPlan *DirectorPlan `json:"director_plan,omitempty"`
+	// Usage 承载 usage 事件（一次 LLM/Realtime 调用的用量与费用）。
+	Usage *UsageRecord `json:"usage,omitempty"`
+	// SpeechDrop 承载 speech_dropped 事件（排队的角色发言未开播即被丢弃）。
+	SpeechDrop *SpeechDrop `json:"speech_drop,omitempty"`
+	// Caption 承载 caption 事件（一句最终字幕及其在会话音频时间轴上的位置）。
+	Caption *Caption `json:"caption,omitempty"`
+}
+
+// SessionLineage 会话谱系：从哪个会话的哪个 seq 导入/分叉而来。
+type SessionLineage struct {
+	// Source import（从导出的 Timeline 导入）| fork（从本服务的会话分叉）
+	Source          string `json:"source"`
+	ParentSessionID string `json:"parent_session_id,omitempty"`
+	// ForkSeq 回放到源 Timeline 的该 seq 为止（含），0 表示全部
+	ForkSeq int64 `json:"fork_seq"`
+	// ReplayedEvents 复制到新会话的事件数
+	ReplayedEvents int       `json:"replayed_events"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SessionOverrides 会话级引擎覆盖，空字段沿用服务配置。
+type SessionOverrides struct {
+	// DirectorType beats | segment
+	DirectorType string `json:"director_type,omitempty"`
+	// PromptVersion Actor Prompt 版本，对应 <paths.prompts>/versions/<version>
+	PromptVersion string `json:"prompt_version,omitempty"`
+	// LLMProvider/LLMModel 导演使用的 LLM
+	LLMProvider string `json:"llm_provider,omitempty"`
+	LLMModel    string `json:"llm_model,omitempty"`
+}
+
+// Caption 一句最终字幕，用于带字幕回放。
+type Caption struct {
+	// CaptionID 用户为转写 item_id，角色为 response_id
+	CaptionID string `json:"caption_id"`
+	// Speaker user | role
+	Speaker string `json:"speaker"`
+	Role    string `json:"role,omitempty"`
+	Avatar  string `json:"avatar,omitempty"`
+	// StreamID 角色发言对应的下行音频流
+	StreamID uint32 `json:"stream_id,omitempty"`
+	// StartMS/EndMS 相对所属录音 take（未录音时为网关启动）的毫秒数
+	StartMS int64 `json:"start_ms"`
+	EndMS   int64 `json:"end_ms"`
+	// Cancelled 角色发言被打断，Text 只包含实际播出的部分
+	Cancelled bool `json:"cancelled,omitempty"`
+	// Take 时间轴所属的录音 take（未录音时为 0）；OffsetMS 时间轴零点相对会话开始的毫秒数。
+	// 每个网关一条时间轴（重连、语音/文本切换都会重新从 0 开始），StartMS+OffsetMS 为会话时间。
+	Take     int   `json:"take,omitempty"`
+	OffsetMS int64 `json:"offset_ms,omitempty"`
+}
+
+// SpeechDrop 一次被丢弃的角色发言。
+type SpeechDrop struct {
+	Role     string `json:"role"`
+	PlanID   string `json:"plan_id,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	// Reason 丢弃原因：expired | superseded | client_barge_in | server_vad_speech_started | ...
+	Reason string `json:"reason"`
+}
+
+// UsageRecord 一次模型调用的用量事实。
+type UsageRecord struct {
+	// Source 用量来源：llm（导演等文本调用）| realtime（角色语音连接）
+	Source   string `json:"source"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Schema 文本调用的 schema 名（纯文本为 text）
+	Schema string `json:"schema,omitempty"`
+	// Role Realtime 用量所属角色
+	Role string `json:"role,omitempty"`
+
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	CachedTokens     int `json:"cached_tokens,omitempty"`
+	// AudioPromptTokens/AudioCompletionTokens 为 Realtime 音频部分（已包含在上面的总数中）
+	AudioPromptTokens     int `json:"audio_prompt_tokens,omitempty"`
+	AudioCompletionTokens int `json:"audio_completion_tokens,omitempty"`
+
+	LatencyMS int64 `json:"latency_ms,omitempty"`
+	// CostUSD 按配置价目折算的费用，未配置价目时为 0
+	CostUSD float64 `json:"cost_usd"`
 }
 
 // DirectorPlan 是导演对演员的最小指令协议。
@@ -132,10 +224,27 @@ type DirectorPlan struct {
 	NextRole string `json:"next_role"`
 	// 导演指令文本（给演员的执行指示）
 	Instruction string `json:"instruction"`
+	// Scene 多角色场景：按顺序出场的各拍，每拍有自己的角色与指令。
+	// 为空时按 NextRole（逗号分隔）让每个角色执行同一条 Instruction。
+	Scene []SceneBeat `json:"scene,omitempty"`
+	// Beat 拍点导演选定的拍点（其他导演为空）
+	Beat string `json:"beat,omitempty"`
+	// SegmentID 片段导演选定的片段（其他导演为空）
+	SegmentID string `json:"segment_id,omitempty"`
+	// PlanID 由编排器分配，随发言请求下发给网关；同一轮次的新计划会替换旧计划尚未开播的发言
+	PlanID string `json:"plan_id,omitempty"`
+	// Priority 发言优先级：low | normal（默认）| urgent（紧急插话，会抢占正在播的发言）
+	Priority string `json:"priority,omitempty"`
 	// 调试信息
 	Debug *DirectorDebug `json:"debug,omitempty"`
 }
 
+// SceneBeat 场景中的一拍：一个角色按自己的指令说一段。
+type SceneBeat struct {
+	Role        string `json:"role"`
+	Instruction string `json:"instruction"`
+}
+
 // DirectorDebug 导演决策的调试信息
 type DirectorDebug struct {
 	// 候选拍点列表
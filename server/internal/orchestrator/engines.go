@@ -0,0 +1,138 @@
+package orchestrator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"bubble-talk/server/internal/actor"
+	"bubble-talk/server/internal/config"
+	"bubble-talk/server/internal/director"
+	"bubble-talk/server/internal/llm"
+	"bubble-talk/server/internal/model"
+)
+
+// EngineFactory 按会话级覆盖构建导演与 Actor 引擎（分叉会话换导演类型/Prompt 版本/LLM 时使用）。
+// 返回的 actorEngine 为 nil 表示沿用默认 Actor 引擎。
+type EngineFactory func(overrides model.SessionOverrides) (director.Director, *actor.ActorEngine, error)
+
+// sessionEngines 一组覆盖对应的引擎；构建失败时只记下 err，之后沿用默认引擎，不再逐轮重试
+type sessionEngines struct {
+	director director.Director
+	actor    *actor.ActorEngine
+	err      error
+}
+
+// SetEngineFactory 设置会话级引擎工厂；NewWithConfig 已按服务配置设置好，测试可替换。
+func (o *Orchestrator) SetEngineFactory(factory EngineFactory) {
+	o.enginesMu.Lock()
+	defer o.enginesMu.Unlock()
+	o.engineFactory = factory
+	o.engines = make(map[model.SessionOverrides]*sessionEngines)
+}
+
+// PrepareEngines 按覆盖构建（并缓存）引擎，返回构建错误；分叉/导入会话前调用，拒绝无效的覆盖。
+func (o *Orchestrator) PrepareEngines(overrides *model.SessionOverrides) error {
+	if overrides == nil || *overrides == (model.SessionOverrides{}) {
+		return nil
+	}
+	o.enginesMu.Lock()
+	defer o.enginesMu.Unlock()
+	if o.engineFactory == nil {
+		return nil
+	}
+	return o.buildEnginesLocked(*overrides).err
+}
+
+// enginesFor 返回会话使用的导演与 Actor 引擎：无覆盖用默认引擎；同一组覆盖只构建一次，构建失败时退回默认。
+func (o *Orchestrator) enginesFor(state *model.SessionState) (director.Director, *actor.ActorEngine) {
+	if state == nil || state.Overrides == nil || *state.Overrides == (model.SessionOverrides{}) {
+		return o.directorEngine, o.actorEngine
+	}
+
+	o.enginesMu.Lock()
+	defer o.enginesMu.Unlock()
+	if o.engineFactory == nil {
+		return o.directorEngine, o.actorEngine
+	}
+
+	engines := o.buildEnginesLocked(*state.Overrides)
+	dir, act := engines.director, engines.actor
+	if dir == nil {
+		dir = o.directorEngine
+	}
+	if act == nil {
+		act = o.actorEngine
+	}
+	return dir, act
+}
+
+// buildEnginesLocked 取缓存的引擎，没有时构建一次（成功与失败都缓存）；调用方持有 enginesMu
+func (o *Orchestrator) buildEnginesLocked(key model.SessionOverrides) *sessionEngines {
+	if engines, ok := o.engines[key]; ok {
+		return engines
+	}
+	dir, act, err := o.engineFactory(key)
+	if err != nil {
+		o.logger.Printf("[Orchestrator] ⚠️  Failed to build engines for overrides %+v: %v, using defaults", key, err)
+		dir, act = nil, nil
+	} else {
+		o.logger.Printf("[Orchestrator] ✅ Engines built for overrides %+v", key)
+	}
+	engines := &sessionEngines{director: dir, actor: act, err: err}
+	o.engines[key] = engines
+	return engines
+}
+
+// ConfigEngineFactory 基于服务配置的引擎工厂：在配置副本上应用覆盖后按正常流程创建导演与 Actor 引擎。
+func ConfigEngineFactory(cfg *config.Config) EngineFactory {
+	return func(overrides model.SessionOverrides) (director.Director, *actor.ActorEngine, error) {
+		c := *cfg
+		if overrides.DirectorType != "" {
+			c.Director.Type = overrides.DirectorType
+		}
+		if overrides.LLMProvider != "" {
+			c.LLM.Provider = overrides.LLMProvider
+			if c.LLM.ActiveProvider() == nil {
+				return nil, nil, fmt.Errorf("unknown llm provider %q", c.LLM.Provider)
+			}
+		}
+		if overrides.LLMModel != "" {
+			provider := c.LLM.ActiveProvider()
+			if provider == nil {
+				return nil, nil, fmt.Errorf("unknown llm provider %q", c.LLM.Provider)
+			}
+			provider.Model = overrides.LLMModel
+		}
+
+		var llmClient llm.Client
+		if c.Director.EnableLLM {
+			client, err := llm.NewClient(&c)
+			if err != nil {
+				return nil, nil, fmt.Errorf("create llm client: %w", err)
+			}
+			llmClient = client
+		}
+		dir := director.NewDirector(&c, llmClient)
+
+		var act *actor.ActorEngine
+		if overrides.PromptVersion != "" {
+			dirPath, err := promptVersionDir(c.Paths.Prompts, overrides.PromptVersion)
+			if err != nil {
+				return nil, nil, err
+			}
+			if act, err = actor.NewActorEngine(dirPath); err != nil {
+				return nil, nil, fmt.Errorf("load prompt version %s: %w", overrides.PromptVersion, err)
+			}
+		}
+		return dir, act, nil
+	}
+}
+
+// promptVersionDir Prompt 版本目录：<prompts>/versions/<version>，版本名不能包含路径
+func promptVersionDir(promptsDir, version string) (string, error) {
+	if version == "." || version == ".." || strings.ContainsAny(version, `/\`) {
+		return "", fmt.Errorf("invalid prompt version %q", version)
+	}
+	return filepath.Join(promptsDir, "versions", version), nil
+}
@@ -0,0 +1,98 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"bubble-talk/server/internal/model"
+)
+
+// replayReducible 回放时需要归约进 SessionState 的事件类型（与线上 Handle*/OnEvent 的归约路径一致）。
+// caption/director_plan/usage 等只是 Timeline 事实，线上不归约，回放也不能归约（caption 带 Text 会被当成用户发言）。
+func replayReducible(eventType string) bool {
+	switch eventType {
+	case "user_utterance", "user_message", "asr_final", "assistant_text", "quiz_answer":
+		return true
+	}
+	return false
+}
+
+// ReplayEvents 把 seq <= atSeq 的事件（atSeq <= 0 为全部）按 seq 顺序归约进 state，返回参与回放的事件。
+// 导入的事件不保证有序，先按 seq 排序（seq 相同的保持原顺序）；state 应是刚创建的初始快照，
+// 导演运行中改写的 Beat/Segment 等不在 Timeline 里，会从初始值继续。
+func ReplayEvents(state *model.SessionState, events []model.Event, atSeq int64) []model.Event {
+	// 输出时钟只按回放事件自身的时间计算，不能拿创建快照的当前时间去减历史时间
+	state.LastOutputAt = time.Time{}
+	state.OutputClockSec = 0
+
+	sorted := make([]model.Event, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Seq < sorted[j].Seq })
+
+	var replayed []model.Event
+	for _, evt := range sorted {
+		if atSeq > 0 && evt.Seq > atSeq {
+			break
+		}
+		replayed = append(replayed, evt)
+		ReplayEvent(state, evt)
+	}
+	return replayed
+}
+
+// ReplayEvent 按线上路径把单个事件归约进 state（不需要归约的事件类型直接忽略），时间取事件自身的 ServerTS。
+func ReplayEvent(state *model.SessionState, evt model.Event) {
+	if !replayReducible(evt.Type) {
+		return
+	}
+	Reduce(state, evt, evt.ServerTS)
+	if evt.Type != "assistant_text" && evt.Text != "" {
+		state.LastUserUtterance = evt.Text
+	}
+}
+
+// ForkSession 用源 Timeline 创建新会话：state 为新会话的初始快照（已填好 SessionID、Lineage、Overrides），
+// 源事件按 seq 回放到 atSeq 为止，复制进新会话的 Timeline（seq 重新分配，EventID 保留），
+// 最后写一条 session_forked 事件标记分叉点并保存快照。之后的对话照常走 HandleUserUtterance。
+func (o *Orchestrator) ForkSession(ctx context.Context, state *model.SessionState, events []model.Event, atSeq int64) error {
+	replayed := ReplayEvents(state, events, atSeq)
+
+	for i := range replayed {
+		evt := replayed[i]
+		evt.Seq = 0
+		evt.SessionID = state.SessionID
+		if _, err := o.timeline.Append(ctx, state.SessionID, &evt); err != nil {
+			return fmt.Errorf("append replayed event: %w", err)
+		}
+	}
+
+	// 分叉会话从现在接着计时，保留回放得到的 OutputClock
+	now := o.now()
+	state.LastOutputAt = now.Add(-time.Duration(state.OutputClockSec) * time.Second)
+	if state.Lineage != nil {
+		state.Lineage.ReplayedEvents = len(replayed)
+		state.Lineage.CreatedAt = now
+	}
+	state.UpdatedAt = now
+
+	marker := &model.Event{
+		EventID:   fmt.Sprintf("evt_%d", now.UnixNano()),
+		SessionID: state.SessionID,
+		Type:      "session_forked",
+		ServerTS:  now,
+	}
+	if state.Lineage != nil {
+		marker.Text = fmt.Sprintf("%s from %s at seq %d", state.Lineage.Source, state.Lineage.ParentSessionID, state.Lineage.ForkSeq)
+	}
+	if _, err := o.timeline.Append(ctx, state.SessionID, marker); err != nil {
+		return fmt.Errorf("append fork marker: %w", err)
+	}
+
+	if err := o.store.Save(ctx, state); err != nil {
+		return fmt.Errorf("save session: %w", err)
+	}
+	o.logger.Printf("[Orchestrator] 🍴 Session %s forked: %d events replayed, %d turns", state.SessionID, len(replayed), len(state.Turns))
+	return nil
+}
@@ -0,0 +1,185 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/actor"
+	"bubble-talk/server/internal/config"
+	"bubble-talk/server/internal/director"
+	"bubble-talk/server/internal/model"
+	"bubble-talk/server/internal/session"
+	"bubble-talk/server/internal/timeline"
+)
+
+// namedDirector 测试桩：记录被调用次数，计划里带上自己的名字
+type namedDirector struct {
+	name  string
+	calls int
+}
+
+func (d *namedDirector) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
+	d.calls++
+	return model.DirectorPlan{NextRole: "host", Instruction: d.name}
+}
+
+// TestForkSessionReplaysUpToSeqAndSwitchesDirector 验证分叉：回放到指定 seq 重建快照、事件复制进新会话并记录谱系，
+// 之后的决策走覆盖对应的导演。
+func TestForkSessionReplaysUpToSeqAndSwitchesDirector(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewInMemoryStore()
+	timelineStore := timeline.NewInMemoryStore()
+	ts := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	base := &namedDirector{name: "base"}
+	alt := &namedDirector{name: "alt"}
+	orch := NewWithEngines(store, timelineStore, base, nil, log.Default())
+	var built []model.SessionOverrides
+	orch.SetEngineFactory(func(o model.SessionOverrides) (director.Director, *actor.ActorEngine, error) {
+		built = append(built, o)
+		return alt, nil, nil
+	})
+
+	source := []model.Event{
+		{Seq: 1, EventID: "e1", Type: "user_utterance", Text: "什么是通胀？", ServerTS: ts},
+		{Seq: 2, EventID: "e2", Type: "director_plan", DirectorPlan: &model.DirectorPlan{NextRole: "host"}, ServerTS: ts},
+		{Seq: 3, EventID: "e3", Type: "assistant_text", Role: "host", Text: "想想菜价。", ServerTS: ts.Add(time.Second)},
+		{Seq: 4, EventID: "e4", Type: "caption", Text: "想想菜价。", Caption: &model.Caption{Speaker: "role", Role: "host"}},
+		{Seq: 5, EventID: "e5", Type: "user_utterance", Text: "那工资呢？", ServerTS: ts.Add(31 * time.Second)},
+		{Seq: 6, EventID: "e6", Type: "assistant_text", Role: "economist", Text: "工资也会涨。", ServerTS: ts.Add(32 * time.Second)},
+	}
+
+	state := &model.SessionState{
+		SessionID: "fork1",
+		EntryID:   "entry",
+		Overrides: &model.SessionOverrides{DirectorType: "beats"},
+		Lineage:   &model.SessionLineage{Source: "import", ParentSessionID: "prod1", ForkSeq: 5},
+	}
+	if err := orch.ForkSession(ctx, state, source, 5); err != nil {
+		t.Fatalf("fork: %v", err)
+	}
+
+	saved, err := store.Get(ctx, "fork1")
+	if err != nil {
+		t.Fatalf("get fork: %v", err)
+	}
+	// caption 带 Text 但不归约；seq 6 在分叉点之后
+	if len(saved.Turns) != 3 || saved.Turns[0].Role != "user" || saved.Turns[1].Text != "想想菜价。" || saved.Turns[2].Text != "那工资呢？" {
+		t.Fatalf("turns = %+v", saved.Turns)
+	}
+	// 输出时钟按回放事件的时间算（上次输出后 30 秒），分叉后从现在接着计时
+	if saved.LastUserUtterance != "那工资呢？" || saved.OutputClockSec != 30 {
+		t.Fatalf("last utterance = %q, output clock = %d", saved.LastUserUtterance, saved.OutputClockSec)
+	}
+	if got := time.Since(saved.LastOutputAt); got < 29*time.Second || got > 31*time.Second {
+		t.Fatalf("last output at = %v", saved.LastOutputAt)
+	}
+	if saved.Lineage == nil || saved.Lineage.ReplayedEvents != 5 || saved.Lineage.ParentSessionID != "prod1" {
+		t.Fatalf("lineage = %+v", saved.Lineage)
+	}
+
+	events, _ := timelineStore.List(ctx, "fork1")
+	if len(events) != 6 || events[3].EventID != "e4" || events[3].SessionID != "fork1" || events[5].Type != "session_forked" {
+		t.Fatalf("fork timeline = %+v", events)
+	}
+
+	// 分叉会话之后的决策走覆盖导演，源会话仍走默认导演；同一组覆盖只构建一次
+	if err := orch.HandleUserUtterance(ctx, "fork1", "那工资呢？", nil); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if err := orch.HandleUserUtterance(ctx, "fork1", "再说说", nil); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if err := store.Save(ctx, &model.SessionState{SessionID: "plain"}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := orch.HandleUserUtterance(ctx, "plain", "你好", nil); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if alt.calls != 2 || base.calls != 1 || len(built) != 1 || built[0].DirectorType != "beats" {
+		t.Fatalf("alt calls = %d, base calls = %d, built = %+v", alt.calls, base.calls, built)
+	}
+}
+
+// TestReplayEventsSortsBySeq 验证导入的事件乱序时按 seq 回放，分叉点之后的事件不会截断前面的事件
+func TestReplayEventsSortsBySeq(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	events := []model.Event{
+		{Seq: 3, EventID: "e3", Type: "user_utterance", Text: "那工资呢？", ServerTS: ts.Add(2 * time.Second)},
+		{Seq: 5, EventID: "e5", Type: "assistant_text", Role: "host", Text: "分叉点之后", ServerTS: ts.Add(4 * time.Second)},
+		{Seq: 1, EventID: "e1", Type: "user_utterance", Text: "什么是通胀？", ServerTS: ts},
+		{Seq: 2, EventID: "e2", Type: "assistant_text", Role: "host", Text: "想想菜价。", ServerTS: ts.Add(time.Second)},
+	}
+
+	state := &model.SessionState{SessionID: "fork1"}
+	replayed := ReplayEvents(state, events, 3)
+
+	var ids []string
+	for _, evt := range replayed {
+		ids = append(ids, evt.EventID)
+	}
+	if fmt.Sprint(ids) != "[e1 e2 e3]" {
+		t.Fatalf("replayed = %v, want [e1 e2 e3]", ids)
+	}
+	if len(state.Turns) != 3 || state.Turns[0].Text != "什么是通胀？" || state.LastUserUtterance != "那工资呢？" {
+		t.Fatalf("turns = %+v, last utterance = %q", state.Turns, state.LastUserUtterance)
+	}
+	if events[0].EventID != "e3" {
+		t.Errorf("input events reordered in place")
+	}
+}
+
+// TestPrepareEnginesCachesFailures 验证无效覆盖在分叉前就报错，且构建失败也会缓存：之后每轮直接用默认导演，不再重试。
+func TestPrepareEnginesCachesFailures(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewInMemoryStore()
+	base := &namedDirector{name: "base"}
+	orch := NewWithEngines(store, timeline.NewInMemoryStore(), base, nil, log.Default())
+	attempts := 0
+	orch.SetEngineFactory(func(o model.SessionOverrides) (director.Director, *actor.ActorEngine, error) {
+		attempts++
+		return nil, nil, fmt.Errorf("unknown llm provider %q", o.LLMProvider)
+	})
+
+	bad := &model.SessionOverrides{LLMProvider: "nope"}
+	if err := orch.PrepareEngines(bad); err == nil {
+		t.Fatalf("expected error for bad overrides")
+	}
+	if err := orch.PrepareEngines(nil); err != nil {
+		t.Fatalf("nil overrides: %v", err)
+	}
+
+	if err := store.Save(ctx, &model.SessionState{SessionID: "s1", Overrides: bad}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	for _, text := range []string{"你好", "再说说"} {
+		if err := orch.HandleUserUtterance(ctx, "s1", text, nil); err != nil {
+			t.Fatalf("handle: %v", err)
+		}
+	}
+	if attempts != 1 || base.calls != 2 {
+		t.Fatalf("factory attempts = %d, base calls = %d", attempts, base.calls)
+	}
+}
+
+// TestConfigEngineFactoryRejectsBadOverrides 验证基于配置的工厂拒绝未知 provider 与不存在的 Prompt 版本。
+func TestConfigEngineFactoryRejectsBadOverrides(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.LLM.Provider = "openai"
+	cfg.Paths.Prompts = "../../configs/prompts"
+	factory := ConfigEngineFactory(cfg)
+
+	for _, o := range []model.SessionOverrides{
+		{LLMProvider: "nope"},
+		{LLMProvider: "nope", LLMModel: "m"},
+		{PromptVersion: "does-not-exist"},
+		{PromptVersion: "../etc"},
+	} {
+		if _, _, err := factory(o); err == nil {
+			t.Errorf("overrides %+v: expected error", o)
+		}
+	}
+}
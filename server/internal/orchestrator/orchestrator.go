@@ -2,9 +2,11 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"bubble-talk/server/internal/actor"
@@ -15,6 +17,7 @@ import (
 	"bubble-talk/server/internal/model"
 	"bubble-talk/server/internal/session"
 	"bubble-talk/server/internal/timeline"
+	"bubble-talk/server/internal/usage"
 )
 
 // Orchestrator 负责处理会话事件的编排逻辑。
@@ -28,8 +31,26 @@ type Orchestrator struct {
 	timeline       timeline.Store
 	directorEngine director.Director
 	actorEngine    *actor.ActorEngine
+	usage          *usage.Tracker
 	now            func() time.Time
 	logger         *log.Logger
+
+	// 会话级引擎覆盖（分叉会话）：engineFactory 按覆盖构建，engines 缓存已构建的引擎
+	enginesMu     sync.Mutex
+	engineFactory EngineFactory
+	engines       map[model.SessionOverrides]*sessionEngines
+
+	// 会话级锁：同一会话的 Get→修改→Save 串行执行。网关的 EventQueue 只串行化自己的事件，
+	// HTTP 事件接口、SSE 输入与换网关期间的新旧队列仍可能并发修改同一个 SessionState。
+	// 按引用计数管理，最后一个持有者解锁时删除，会话结束后不残留。
+	sessionLocksMu sync.Mutex
+	sessionLocks   map[string]*sessionLock
+}
+
+// sessionLock 一个会话的锁；refs 为持有或等待它的调用数，由 sessionLocksMu 保护
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int
 }
 
 // New 创建Orchestrator（兼容旧版本API）
@@ -62,6 +83,7 @@ func New(store session.Store, timeline timeline.Store, now func() time.Time) *Or
 		timeline:       timeline,
 		directorEngine: directorEngine,
 		actorEngine:    actorEngine,
+		usage:          usage.NewTracker(cfg.Usage),
 		now:            now,
 		logger:         log.Default(),
 	}
@@ -101,8 +123,11 @@ func NewWithConfig(
 		timeline:       timeline,
 		directorEngine: directorEngine,
 		actorEngine:    actorEngine,
+		usage:          usage.NewTracker(cfg.Usage),
 		now:            now,
 		logger:         log.Default(),
+		engineFactory:  ConfigEngineFactory(cfg),
+		engines:        make(map[model.SessionOverrides]*sessionEngines),
 	}, nil
 }
 
@@ -123,20 +148,35 @@ func NewWithEngines(
 		timeline:       timeline,
 		directorEngine: directorEngine,
 		actorEngine:    actorEngine,
+		usage:          usage.NewTracker(config.UsageConfig{}),
 		now:            time.Now,
 		logger:         logger,
 	}
 }
 
+// SetUsageTracker 替换用量跟踪器（用于注入预算/价目配置或在多个 Orchestrator 间共享）。
+func (o *Orchestrator) SetUsageTracker(tracker *usage.Tracker) {
+	if tracker != nil {
+		o.usage = tracker
+	}
+}
+
+// UsageTracker 返回用量跟踪器（API 查询用量时使用）。
+func (o *Orchestrator) UsageTracker() *usage.Tracker {
+	return o.usage
+}
+
 // GetInitialInstructions 生成会话初始的 System Instructions。
-func (o *Orchestrator) GetInitialInstructions(_ context.Context, state *model.SessionState) (string, error) {
+func (o *Orchestrator) GetInitialInstructions(ctx context.Context, state *model.SessionState) (string, error) {
+	_, actorEngine := o.enginesFor(state)
+
 	// 如果actorEngine未初始化，返回简单的默认指令
-	if o.actorEngine == nil {
+	if actorEngine == nil {
 		return "你是 BubbleTalk 的语音教学助手。默认用中文、口语化、短句输出。", nil
 	}
 
 	// 创建一个初始的DirectorPlan
-	plan := o.directorEngine.Decide(state, "")
+	plan := o.decide(ctx, state, "")
 
 	// 通过Actor Engine构建Prompt
 	req := actor.ActorRequest{
@@ -151,46 +191,130 @@ func (o *Orchestrator) GetInitialInstructions(_ context.Context, state *model.Se
 		Metaphor:      "",
 	}
 
-	prompt, err := o.actorEngine.BuildPrompt(req)
+	prompt, err := actorEngine.BuildPrompt(req)
 	if err != nil {
 		o.logger.Printf("Failed to build initial prompt: %v", err)
 		// 使用兜底Prompt
-		prompt = o.actorEngine.BuildFallbackPrompt(req)
+		prompt = actorEngine.BuildFallbackPrompt(req)
 	}
 
 	return prompt.Instructions, nil
 }
 
-// HandleUserUtterance 处理用户语音转写输入
-func (o *Orchestrator) HandleUserUtterance(ctx context.Context, sessionID string, text string, gw interface{}) error {
-	o.logger.Printf("[Orchestrator] handling user utterance for session %s: %s", sessionID, text)
+// lockSession 锁住一个会话的状态修改，返回解锁函数。
+// 只在 Get→归约→Save 期间持锁，不要跨 LLM 调用持有；持锁期间也不要再调用会加同一把锁的方法。
+func (o *Orchestrator) lockSession(sessionID string) func() {
+	o.sessionLocksMu.Lock()
+	if o.sessionLocks == nil {
+		o.sessionLocks = make(map[string]*sessionLock)
+	}
+	l, ok := o.sessionLocks[sessionID]
+	if !ok {
+		l = &sessionLock{}
+		o.sessionLocks[sessionID] = l
+	}
+	l.refs++
+	o.sessionLocksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		o.sessionLocksMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(o.sessionLocks, sessionID)
+		}
+		o.sessionLocksMu.Unlock()
+	}
+}
+
+// decisionState 复制一份供导演决策使用的快照：决策在锁外进行，会改写 Script/CurrentSegment/BudgetExceeded，
+// 不能直接改存储里的对象（内存存储的 Get 返回共享指针）。
+func decisionState(state *model.SessionState) *model.SessionState {
+	snapshot := *state
+	snapshot.AvailableRoles = append([]string(nil), state.AvailableRoles...)
+	snapshot.MisconceptionTags = append([]string(nil), state.MisconceptionTags...)
+	snapshot.QuestionStack = append([]model.BranchQuestion(nil), state.QuestionStack...)
+	snapshot.Turns = append([]model.Turn(nil), state.Turns...)
+	if state.Script != nil {
+		script := *state.Script
+		script.Revisions = append([]model.ScriptRevision(nil), state.Script.Revisions...)
+		snapshot.Script = &script
+	}
+	if state.CurrentSegment != nil {
+		segment := *state.CurrentSegment
+		snapshot.CurrentSegment = &segment
+	}
+	return &snapshot
+}
+
+// decisionSnapshot 持锁读取会话状态，返回供导演决策的快照
+func (o *Orchestrator) decisionSnapshot(ctx context.Context, sessionID string) (*model.SessionState, error) {
+	unlock := o.lockSession(sessionID)
+	defer unlock()
 
-	// 1. 获取当前会话状态
 	state, err := o.store.Get(ctx, sessionID)
 	if err != nil {
-		return fmt.Errorf("get session: %w", err)
+		return nil, fmt.Errorf("get session: %w", err)
 	}
+	return decisionState(state), nil
+}
 
-	// 2. 记录用户输入到Timeline
-	event := &model.Event{
-		EventID:   fmt.Sprintf("evt_%d", o.now().UnixNano()),
-		SessionID: sessionID,
-		Type:      "user_utterance",
-		Text:      text,
-		ClientTS:  o.now(),
-		ServerTS:  o.now(),
+// applyDecision 把导演决策对快照的修改写回最新的会话状态（决策期间其他事件可能已经保存过新快照）
+func (o *Orchestrator) applyDecision(ctx context.Context, sessionID string, decided *model.SessionState) error {
+	unlock := o.lockSession(sessionID)
+	defer unlock()
+
+	state, err := o.store.Get(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("get session: %w", err)
 	}
-	if _, err := o.timeline.Append(ctx, sessionID, event); err != nil {
-		o.logger.Printf("Failed to append timeline event: %v", err)
+	state.Script = decided.Script
+	state.CurrentSegment = decided.CurrentSegment
+	if decided.BudgetExceeded {
+		state.BudgetExceeded = true
+	}
+	state.UpdatedAt = o.now()
+	if err := o.store.Save(ctx, state); err != nil {
+		return fmt.Errorf("save session: %w", err)
 	}
+	return nil
+}
 
-	// 2.1 关键：ASR 直通路径此前只写 Timeline，不归约 SessionState，
-	// 会导致 Turns 不增长，从而导演的“轮流选角色”永远停在第一个角色（通常是 host）。
-	Reduce(state, *event, o.now())
-	state.LastUserUtterance = text
+// HandleUserUtterance 处理用户语音转写输入
+func (o *Orchestrator) HandleUserUtterance(ctx context.Context, sessionID string, text string, gw interface{}) error {
+	o.logger.Printf("[Orchestrator] handling user utterance for session %s: %s", sessionID, text)
+
+	// 1~2 持锁归约并保存用户发言；导演决策（LLM 调用）在锁外对快照进行，期间到达的助手文本与用量照常归约
+	state, turnID, err := o.reduceUserUtterance(ctx, sessionID, text)
+	if err != nil {
+		return err
+	}
 
 	// 3. 调用Director生成计划
-	plan := o.directorEngine.Decide(state, text)
+	// 流式决策时，角色与分镜开头一到就先让第一个角色开口，后面的完整计划会跳过它。
+	// 提前开口与完整计划同属一次决策，共用 plan_id，网关不会把前者当成旧计划替换掉。
+	planID := o.newPlanID()
+	earlyRole := ""
+	decideCtx := ctx
+	if gw != nil {
+		decideCtx = director.WithEarlyStart(ctx, func(early model.DirectorPlan) {
+			early.PlanID = planID
+			earlyRoles := splitRoles(early.NextRole)
+			role := earlyRoles[0]
+			if err := o.sendRoleInstruction(ctx, gw, state, early, role, 0, len(earlyRoles), turnID, text); err != nil {
+				o.logger.Printf("[Orchestrator] ❌ Failed to early-start %s: %v", role, err)
+				return
+			}
+			earlyRole = role
+			o.logger.Printf("[Orchestrator] ⚡ Early-started %s before director plan completed", role)
+		})
+	}
+	plan := o.decide(decideCtx, state, text)
+	plan.PlanID = planID
+	if err := o.applyDecision(ctx, sessionID, state); err != nil {
+		o.logger.Printf("Failed to update session: %v", err)
+	}
 
 	o.logger.Printf("[Orchestrator] 🎬 Director Plan:")
 	o.logger.Printf("  - NextRole: %s", plan.NextRole)
@@ -201,76 +325,69 @@ func (o *Orchestrator) HandleUserUtterance(ctx context.Context, sessionID string
 		o.logger.Printf("Failed to append plan event: %v", err)
 	}
 
-	// 5. 调用Actor生成Prompt
+	// 5. 为场景的每一拍生成 Actor Prompt 并下发（多角色按顺序出场，交接由网关的发言队列负责）
+	if gw != nil {
+		beats := planScene(plan)
+		if len(beats) > 1 {
+			o.logger.Printf("[Orchestrator] 🎭 Multi-role scene: %d beats", len(beats))
+		}
 
-	// 支持多角色顺序触发（逗号分隔）
-	roles := strings.Split(plan.NextRole, ",")
-	for i := range roles {
-		roles[i] = strings.TrimSpace(roles[i])
-	}
+		skip := 0
+		if earlyRole != "" && len(beats) > 0 {
+			if beats[0].Role == earlyRole {
+				o.logger.Printf("[Orchestrator] ⏭️  %s already started early, skipping", earlyRole)
+				skip = 1
+			} else {
+				// 修复回合等原因导致最终选角与提前开口的角色不一致：撤回提前开口的发言，以最终计划为准下发
+				o.logger.Printf("[Orchestrator] ⚠️  Final plan starts with %s, but %s was early-started; cancelling it", beats[0].Role, earlyRole)
+				if canceller, ok := gw.(speechCanceller); ok {
+					canceller.CancelSpeech(planID, earlyRole)
+				}
+			}
+		}
 
-	// 如果包含无效角色，记录警告
-	if len(roles) > 1 {
-		o.logger.Printf("[Orchestrator] 🎭 Multi-role sequence detected: %v", roles)
+		if err := o.sendScene(ctx, gw, state, plan, beats, skip, turnID, text); err != nil {
+			o.logger.Printf("[Orchestrator] ❌ Failed to send scene: %v", err)
+		}
 	}
 
-	// 6. 为每个角色生成并发送指令
-	if gw != nil {
-		for idx, role := range roles {
-			if role == "" {
-				continue
-			}
-
-			// 为当前角色构建prompt
-			rolePrompt := o.buildActorPrompt(state, model.DirectorPlan{
-				NextRole:    role,
-				Instruction: plan.Instruction,
-			}, event.EventID, text)
-
-			o.logger.Printf("[Orchestrator] 📝 Actor Prompt for role=%s:", role)
-			o.logger.Printf("  Length: %d characters", len(rolePrompt.Instructions))
-			o.logger.Printf("  Content (first 500 chars):\n%.500s\n---", rolePrompt.Instructions)
-
-			metadata := map[string]interface{}{
-				"role":     role,
-				"sequence": fmt.Sprintf("%d", idx),        // 🔧 FIX: 必须是字符串
-				"total":    fmt.Sprintf("%d", len(roles)), // 🔧 FIX: 必须是字符串
-			}
+	return nil
+}
 
-			// 类型断言，支持两种 Gateway
-			if mvg, ok := gw.(*gateway.MultiVoiceGateway); ok {
-				if err := mvg.SendInstructions(ctx, rolePrompt.Instructions, metadata); err != nil {
-					o.logger.Printf("[Orchestrator] ❌ Failed to send instructions to %s: %v", role, err)
-					continue
-				}
-			} else if g, ok := gw.(*gateway.Gateway); ok {
-				if err := g.SendInstructions(ctx, rolePrompt.Instructions, metadata); err != nil {
-					o.logger.Printf("[Orchestrator] ❌ Failed to send instructions to %s: %v", role, err)
-					continue
-				}
-			} else {
-				o.logger.Printf("[Orchestrator] ⚠️  Unknown gateway type, skipping SendInstructions")
-				break
-			}
+// reduceUserUtterance 持锁记录用户发言并归约保存，返回供导演决策的快照与本轮的 turn_id
+func (o *Orchestrator) reduceUserUtterance(ctx context.Context, sessionID string, text string) (*model.SessionState, string, error) {
+	unlock := o.lockSession(sessionID)
+	defer unlock()
 
-			o.logger.Printf("[Orchestrator] ✅ Instructions sent to %s (sequence %d/%d)", role, idx+1, len(roles))
+	state, err := o.store.Get(ctx, sessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("get session: %w", err)
+	}
 
-			// 如果是多角色，在角色之间添加延迟，避免同时说话
-			if len(roles) > 1 && idx < len(roles)-1 {
-				time.Sleep(300 * time.Millisecond)
-			}
-		}
+	// 记录用户输入到Timeline
+	event := &model.Event{
+		EventID:   fmt.Sprintf("evt_%d", o.now().UnixNano()),
+		SessionID: sessionID,
+		Type:      "user_utterance",
+		Text:      text,
+		ClientTS:  o.now(),
+		ServerTS:  o.now(),
+	}
+	if _, err := o.timeline.Append(ctx, sessionID, event); err != nil {
+		o.logger.Printf("Failed to append timeline event: %v", err)
 	}
 
-	// 7. 更新会话状态
+	// 关键：ASR 直通路径此前只写 Timeline，不归约 SessionState，
+	// 会导致 Turns 不增长，从而导演的“轮流选角色”永远停在第一个角色（通常是 host）。
+	Reduce(state, *event, o.now())
 	state.LastUserUtterance = text
 	state.UpdatedAt = o.now()
-
 	if err := o.store.Save(ctx, state); err != nil {
 		o.logger.Printf("Failed to update session: %v", err)
 	}
 
-	return nil
+	// 角色还没接话时的连续几句属于同一轮，后一句的计划会替换前一句尚未开播的发言
+	return decisionState(state), userTurnID(state), nil
 }
 
 // HandleAssistantText 处理一次助手输出完成后的文本（用于 Timeline/SessionState 归约）。
@@ -283,6 +400,9 @@ func (o *Orchestrator) HandleAssistantText(ctx context.Context, sessionID string
 		return nil
 	}
 
+	unlock := o.lockSession(sessionID)
+	defer unlock()
+
 	state, err := o.store.Get(ctx, sessionID)
 	if err != nil {
 		return fmt.Errorf("get session: %w", err)
@@ -292,6 +412,7 @@ func (o *Orchestrator) HandleAssistantText(ctx context.Context, sessionID string
 		EventID:   fmt.Sprintf("evt_%d", o.now().UnixNano()),
 		SessionID: sessionID,
 		Type:      "assistant_text",
+		Role:      fromRole,
 		Text:      text,
 		ServerTS:  o.now(),
 	}
@@ -302,9 +423,6 @@ func (o *Orchestrator) HandleAssistantText(ctx context.Context, sessionID string
 	Reduce(state, *event, o.now())
 	state.UpdatedAt = o.now()
 
-	// 预留：未来可将 fromRole 写入更结构化的字段，便于审计/回放。
-	_ = fromRole
-
 	if err := o.store.Save(ctx, state); err != nil {
 		return fmt.Errorf("save session: %w", err)
 	}
@@ -361,9 +479,10 @@ func (o *Orchestrator) HandleBargeIn(ctx context.Context, sessionID string) erro
 func (o *Orchestrator) HandleWorldEntered(ctx context.Context, sessionID string, gw interface{}) error {
 	o.logger.Printf("[Orchestrator] world entered: session=%s", sessionID)
 
-	state, err := o.store.Get(ctx, sessionID)
+	// 导演在快照上决策，不持锁跨 LLM 调用；决策的修改由 applyDecision 写回
+	state, err := o.decisionSnapshot(ctx, sessionID)
 	if err != nil {
-		return fmt.Errorf("get session: %w", err)
+		return err
 	}
 
 	eventID := fmt.Sprintf("evt_%d", o.now().UnixNano())
@@ -378,7 +497,11 @@ func (o *Orchestrator) HandleWorldEntered(ctx context.Context, sessionID string,
 		o.logger.Printf("Failed to append world_entered event: %v", err)
 	}
 
-	plan := o.directorEngine.Decide(state, "")
+	plan := o.decide(ctx, state, "")
+	plan.PlanID = o.newPlanID()
+	if err := o.applyDecision(ctx, sessionID, state); err != nil {
+		o.logger.Printf("Failed to update session: %v", err)
+	}
 
 	o.logger.Printf("[Orchestrator] 🎬 Opening Director Plan:")
 	o.logger.Printf("  - NextRole: %s", plan.NextRole)
@@ -388,70 +511,271 @@ func (o *Orchestrator) HandleWorldEntered(ctx context.Context, sessionID string,
 		o.logger.Printf("Failed to append plan event: %v", err)
 	}
 
-	// 支持多角色顺序触发
-	roles := strings.Split(plan.NextRole, ",")
+	// 通过 Gateway 下发开场场景（支持多角色顺序出场）
+	if gw != nil {
+		beats := planScene(plan)
+		if len(beats) > 1 {
+			o.logger.Printf("[Orchestrator] 🎭 Multi-role opening scene: %d beats", len(beats))
+		}
+		if err := o.sendScene(ctx, gw, state, plan, beats, 0, userTurnID(state), ""); err != nil {
+			o.logger.Printf("[Orchestrator] ❌ Failed to send opening: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// instructionSender 能下发角色指令的网关（Gateway 与 MultiVoiceGateway 都实现了它）。
+type instructionSender interface {
+	SendInstructions(ctx context.Context, instructions string, metadata map[string]interface{}) error
+}
+
+var (
+	_ instructionSender = (*gateway.Gateway)(nil)
+	_ instructionSender = (*gateway.MultiVoiceGateway)(nil)
+	_ instructionSender = (*gateway.TextGateway)(nil)
+)
+
+// sceneSender 能整段下发多角色场景的网关（MultiVoiceGateway、TextGateway）：各拍的交接由网关的发言队列负责。
+type sceneSender interface {
+	SendScene(ctx context.Context, scene gateway.Scene) error
+}
+
+var (
+	_ sceneSender = (*gateway.MultiVoiceGateway)(nil)
+	_ sceneSender = (*gateway.TextGateway)(nil)
+)
+
+// speechCanceller 能撤回已下发发言的网关（MultiVoiceGateway、TextGateway）。
+type speechCanceller interface {
+	CancelSpeech(planID string, role string)
+}
+
+var (
+	_ speechCanceller = (*gateway.MultiVoiceGateway)(nil)
+	_ speechCanceller = (*gateway.TextGateway)(nil)
+)
+
+// errUnsupportedGateway gw 不支持下发指令
+var errUnsupportedGateway = errors.New("gateway does not support SendInstructions")
+
+// userTurnID 当前用户轮次的标识（随发言请求下发给网关，用于替换同一轮次的旧计划）。
+// 连续的用户发言（中间没有角色接话，如 ASR 把一句话切成两段）算同一轮；开场时为 turn_0。
+func userTurnID(state *model.SessionState) string {
+	n := 0
+	prevUser := false
+	for _, turn := range state.Turns {
+		isUser := turn.Role == "user"
+		if isUser && !prevUser {
+			n++
+		}
+		prevUser = isUser
+	}
+	return fmt.Sprintf("turn_%d", n)
+}
+
+// splitRoles 拆分逗号分隔的角色序列；至少返回一个元素（可能为空串）。
+func splitRoles(nextRole string) []string {
+	roles := strings.Split(nextRole, ",")
 	for i := range roles {
 		roles[i] = strings.TrimSpace(roles[i])
 	}
+	return roles
+}
 
-	if len(roles) > 1 {
-		o.logger.Printf("[Orchestrator] 🎭 Multi-role opening sequence: %v", roles)
+// planScene 返回计划的场景各拍；导演没有给出 Scene 时按 NextRole 拆分，每个角色执行同一条指令。
+func planScene(plan model.DirectorPlan) []model.SceneBeat {
+	if len(plan.Scene) > 0 {
+		return plan.Scene
 	}
+	var beats []model.SceneBeat
+	for _, role := range splitRoles(plan.NextRole) {
+		if role == "" {
+			continue
+		}
+		beats = append(beats, model.SceneBeat{Role: role, Instruction: plan.Instruction})
+	}
+	return beats
+}
 
-	// 通过 Gateway 发送指令
-	if gw != nil {
-		for idx, role := range roles {
-			if role == "" {
-				continue
-			}
+// sendScene 为场景中第 skip 拍之后的每一拍构建 Actor Prompt 并下发到网关。
+// 支持 SendScene 的网关整段入队；否则逐拍 SendInstructions（网关按入队顺序串行播出，不需要在这里等待）。
+func (o *Orchestrator) sendScene(
+	ctx context.Context,
+	gw interface{},
+	state *model.SessionState,
+	plan model.DirectorPlan,
+	beats []model.SceneBeat,
+	skip int,
+	turnID string,
+	lastUserText string,
+) error {
+	if skip >= len(beats) {
+		return nil
+	}
 
+	if sender, ok := gw.(sceneSender); ok {
+		scene := gateway.Scene{
+			Metadata: map[string]interface{}{
+				"turn_id": turnID,
+				"plan_id": plan.PlanID,
+			},
+		}
+		if plan.Priority != "" {
+			scene.Metadata["priority"] = plan.Priority
+		}
+		for idx := skip; idx < len(beats); idx++ {
+			beat := beats[idx]
 			rolePrompt := o.buildActorPrompt(state, model.DirectorPlan{
-				NextRole:    role,
-				Instruction: plan.Instruction,
-			}, eventID, "")
-
-			o.logger.Printf("[Orchestrator] 📝 Opening Actor Prompt for role=%s:", role)
-			o.logger.Printf("  Length: %d characters", len(rolePrompt.Instructions))
-			o.logger.Printf("  Content (first 500 chars):\n%.500s\n---", rolePrompt.Instructions)
-
-			metadata := map[string]interface{}{
-				"role":     role,
-				"sequence": fmt.Sprintf("%d", idx),        // 🔧 FIX: 必须是字符串
-				"total":    fmt.Sprintf("%d", len(roles)), // 🔧 FIX: 必须是字符串
-			}
+				NextRole:    beat.Role,
+				Instruction: beat.Instruction,
+			}, turnID, lastUserText)
+			scene.Beats = append(scene.Beats, gateway.SceneBeat{
+				Role:         beat.Role,
+				Instructions: rolePrompt.Instructions,
+				Metadata: map[string]interface{}{
+					"sequence": fmt.Sprintf("%d", idx),
+					"total":    fmt.Sprintf("%d", len(beats)),
+				},
+			})
+		}
+		if err := sender.SendScene(ctx, scene); err != nil {
+			return err
+		}
+		o.logger.Printf("[Orchestrator] ✅ Scene sent (%d beats, plan=%s)", len(scene.Beats), plan.PlanID)
+		return nil
+	}
 
-			// 类型断言，支持两种 Gateway
-			if mvg, ok := gw.(*gateway.MultiVoiceGateway); ok {
-				if err := mvg.SendInstructions(ctx, rolePrompt.Instructions, metadata); err != nil {
-					o.logger.Printf("[Orchestrator] ❌ Failed to send opening to %s: %v", role, err)
-					continue
-				}
-			} else if g, ok := gw.(*gateway.Gateway); ok {
-				if err := g.SendInstructions(ctx, rolePrompt.Instructions, metadata); err != nil {
-					o.logger.Printf("[Orchestrator] ❌ Failed to send opening to %s: %v", role, err)
-					continue
-				}
-			} else {
-				o.logger.Printf("[Orchestrator] ⚠️  Unknown gateway type, skipping SendInstructions")
-				break
-			}
+	for idx := skip; idx < len(beats); idx++ {
+		beat := beats[idx]
+		beatPlan := plan
+		beatPlan.Instruction = beat.Instruction
+		err := o.sendRoleInstruction(ctx, gw, state, beatPlan, beat.Role, idx, len(beats), turnID, lastUserText)
+		if errors.Is(err, errUnsupportedGateway) {
+			o.logger.Printf("[Orchestrator] ⚠️  Unknown gateway type, skipping SendInstructions")
+			return nil
+		}
+		if err != nil {
+			o.logger.Printf("[Orchestrator] ❌ Failed to send instructions to %s: %v", beat.Role, err)
+			continue
+		}
+		o.logger.Printf("[Orchestrator] ✅ Instructions sent to %s (sequence %d/%d)", beat.Role, idx+1, len(beats))
+	}
+	return nil
+}
 
-			o.logger.Printf("[Orchestrator] ✅ Opening sent to %s (sequence %d/%d)", role, idx+1, len(roles))
+// sendRoleInstruction 为序列中的一个角色构建 Actor Prompt 并下发到网关。
+func (o *Orchestrator) sendRoleInstruction(
+	ctx context.Context,
+	gw interface{},
+	state *model.SessionState,
+	plan model.DirectorPlan,
+	role string,
+	idx, total int,
+	turnID string,
+	lastUserText string,
+) error {
+	sender, ok := gw.(instructionSender)
+	if !ok {
+		return errUnsupportedGateway
+	}
 
-			if len(roles) > 1 && idx < len(roles)-1 {
-				time.Sleep(300 * time.Millisecond)
-			}
-		}
+	rolePrompt := o.buildActorPrompt(state, model.DirectorPlan{
+		NextRole:    role,
+		Instruction: plan.Instruction,
+	}, turnID, lastUserText)
+
+	o.logger.Printf("[Orchestrator] 📝 Actor Prompt for role=%s:", role)
+	o.logger.Printf("  Length: %d characters", len(rolePrompt.Instructions))
+	o.logger.Printf("  Content (first 500 chars):\n%.500s\n---", rolePrompt.Instructions)
+
+	metadata := map[string]interface{}{
+		"role":     role,
+		"sequence": fmt.Sprintf("%d", idx),   // 🔧 FIX: 必须是字符串
+		"total":    fmt.Sprintf("%d", total), // 🔧 FIX: 必须是字符串
+		"turn_id":  turnID,
+		"plan_id":  plan.PlanID,
+	}
+	if plan.Priority != "" {
+		metadata["priority"] = plan.Priority
+	}
+	return sender.SendInstructions(ctx, rolePrompt.Instructions, metadata)
+}
+
+// decide 调用导演并记录本次决策产生的 LLM 用量。
+// 决策前先同步预算状态，超出预算时导演会收束到 Wrap/ExitTicket。
+func (o *Orchestrator) decide(ctx context.Context, state *model.SessionState, userInput string) model.DirectorPlan {
+	if o.usage.Exceeded(state.SessionID) {
+		state.BudgetExceeded = true
+	}
+
+	var usages []llm.Usage
+	ctx = llm.WithUsageObserver(ctx, func(u llm.Usage) {
+		usages = append(usages, u)
+	})
+
+	directorEngine, _ := o.enginesFor(state)
+	plan := director.DecideWithContext(ctx, directorEngine, state, userInput)
+
+	for _, u := range usages {
+		o.recordUsage(ctx, state, usage.FromLLM(u))
+	}
+	return plan
+}
+
+// HandleRealtimeUsage 记录一次 Realtime response 的用量（由网关在 response.done 时回灌）。
+func (o *Orchestrator) HandleRealtimeUsage(ctx context.Context, sessionID string, rec *model.UsageRecord) error {
+	if rec == nil {
+		return nil
+	}
+
+	unlock := o.lockSession(sessionID)
+	defer unlock()
+
+	state, err := o.store.Get(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("get session: %w", err)
+	}
+
+	wasExceeded := state.BudgetExceeded
+	o.recordUsage(ctx, state, rec)
+	if state.BudgetExceeded == wasExceeded {
+		return nil
 	}
 
 	state.UpdatedAt = o.now()
 	if err := o.store.Save(ctx, state); err != nil {
-		o.logger.Printf("Failed to update session: %v", err)
+		return fmt.Errorf("save session: %w", err)
 	}
-
 	return nil
 }
 
+// recordUsage 累计用量、写入 usage 事件，并在首次超出预算时打标。
+func (o *Orchestrator) recordUsage(ctx context.Context, state *model.SessionState, rec *model.UsageRecord) {
+	exceeded := o.usage.Record(state.SessionID, state.EntryID, rec)
+
+	event := &model.Event{
+		EventID:   fmt.Sprintf("evt_%d", o.now().UnixNano()),
+		SessionID: state.SessionID,
+		Type:      "usage",
+		ServerTS:  o.now(),
+		Usage:     rec,
+	}
+	if _, err := o.timeline.Append(ctx, state.SessionID, event); err != nil {
+		o.logger.Printf("Failed to append usage event: %v", err)
+	}
+
+	if exceeded && !state.BudgetExceeded {
+		state.BudgetExceeded = true
+		o.logger.Printf("[Orchestrator] 💰 Session %s exceeded usage budget, director will wrap up", state.SessionID)
+	}
+}
+
+// newPlanID 为一次导演决策分配 ID（网关据此判断同一轮次的新旧计划）
+func (o *Orchestrator) newPlanID() string {
+	return fmt.Sprintf("plan_%d", o.now().UnixNano())
+}
+
 func (o *Orchestrator) appendDirectorPlan(ctx context.Context, sessionID string, plan model.DirectorPlan) error {
 	planEvent := &model.Event{
 		EventID:      fmt.Sprintf("evt_%d", o.now().UnixNano()),
@@ -482,14 +806,15 @@ func (o *Orchestrator) buildActorPrompt(
 		Metaphor:      "", // TODO: 从ConceptPack获取
 	}
 
-	prompt, err := o.actorEngine.BuildPrompt(req)
+	_, actorEngine := o.enginesFor(state)
+	prompt, err := actorEngine.BuildPrompt(req)
 	if err != nil {
 		o.logger.Printf("Failed to build prompt: %v", err)
-		prompt = o.actorEngine.BuildFallbackPrompt(req)
+		prompt = actorEngine.BuildFallbackPrompt(req)
 	}
-	if err := o.actorEngine.Validate(prompt); err != nil {
+	if err := actorEngine.Validate(prompt); err != nil {
 		o.logger.Printf("Prompt validation failed: %v, using fallback", err)
-		prompt = o.actorEngine.BuildFallbackPrompt(req)
+		prompt = actorEngine.BuildFallbackPrompt(req)
 	}
 	return prompt
 }
@@ -501,6 +826,9 @@ func (o *Orchestrator) buildActorPrompt(
 // - 归约并更新 Session 快照（便于后续增量处理）。
 // - 写入 director_plan 与 assistant_text，作为可审计的输出事实。
 func (o *Orchestrator) OnEvent(ctx context.Context, sessionID string, evt model.Event) (*model.EventResponse, error) {
+	unlock := o.lockSession(sessionID)
+	defer unlock()
+
 	state, err := o.store.Get(ctx, sessionID)
 	if err != nil {
 		return nil, err
@@ -3,17 +3,23 @@ package orchestrator
 import (
 	"bubble-talk/server/internal/llm"
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"bubble-talk/server/internal/actor"
 	"bubble-talk/server/internal/config"
 	"bubble-talk/server/internal/director"
+	"bubble-talk/server/internal/gateway"
 	"bubble-talk/server/internal/model"
 	"bubble-talk/server/internal/session"
 	"bubble-talk/server/internal/timeline"
+	"bubble-talk/server/internal/usage"
 )
 
 // TestOrchestratorOnEventAppendsTimelineAndUpdatesSnapshot 验证 Orchestrator.OnEvent 的核心功能。
@@ -151,3 +157,384 @@ func TestHandleUserUtteranceIntegration(t *testing.T) {
 		t.Fatalf("expected UpdatedAt to be refreshed")
 	}
 }
+
+// usageDirector 测试桩：每次决策上报一次 LLM 用量，并记录决策时看到的预算状态。
+type usageDirector struct {
+	mu          sync.Mutex
+	tokens      int
+	sawExceeded []bool
+}
+
+func (d *usageDirector) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
+	return d.DecideContext(context.Background(), state, userInput)
+}
+
+func (d *usageDirector) DecideContext(ctx context.Context, state *model.SessionState, userInput string) model.DirectorPlan {
+	d.mu.Lock()
+	d.sawExceeded = append(d.sawExceeded, state.BudgetExceeded)
+	d.mu.Unlock()
+	llm.ReportUsage(ctx, llm.Usage{Provider: "openai", Model: "gpt-4o-mini", Schema: "segment_plan", PromptTokens: d.tokens})
+	return model.DirectorPlan{NextRole: "host", Instruction: "test"}
+}
+
+// copyingStore 每次 Get 返回快照副本（与 Redis/DB 类存储一致），并发的读-改-写会互相覆盖；
+// Save 带一点延迟模拟远端存储，放大读与写之间的窗口
+type copyingStore struct {
+	mu   sync.Mutex
+	data map[string]model.SessionState
+}
+
+func (s *copyingStore) Get(_ context.Context, id string) (*model.SessionState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.data[id]
+	if !ok {
+		return nil, session.ErrNotFound
+	}
+	state.Turns = append([]model.Turn(nil), state.Turns...)
+	return &state, nil
+}
+
+func (s *copyingStore) Save(_ context.Context, state *model.SessionState) error {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[state.SessionID] = *state
+	return nil
+}
+
+// TestSessionUpdatesAreSerialized 验证同一会话并发到达的用户发言、助手文本与 Realtime 用量不会互相覆盖快照。
+func TestSessionUpdatesAreSerialized(t *testing.T) {
+	ctx := context.Background()
+	store := &copyingStore{data: map[string]model.SessionState{"s1": {SessionID: "s1", EntryID: "entry"}}}
+	orch := NewWithEngines(store, timeline.NewInMemoryStore(), &usageDirector{}, nil, log.New(io.Discard, "", 0))
+	orch.SetUsageTracker(usage.NewTracker(config.UsageConfig{
+		Budget: config.UsageBudgetConfig{MaxSessionTokens: 100},
+	}))
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			_ = orch.HandleUserUtterance(ctx, "s1", fmt.Sprintf("问题%d", i), nil)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_ = orch.HandleAssistantText(ctx, "s1", fmt.Sprintf("回答%d", i), "host")
+		}(i)
+		go func() {
+			defer wg.Done()
+			_ = orch.HandleRealtimeUsage(ctx, "s1", &model.UsageRecord{Source: usage.SourceRealtime, Role: "host", PromptTokens: 10})
+		}()
+	}
+	wg.Wait()
+
+	state, _ := store.Get(ctx, "s1")
+	if len(state.Turns) != 2*n {
+		t.Fatalf("expected %d turns, got %d (concurrent updates overwrote each other)", 2*n, len(state.Turns))
+	}
+	if !state.BudgetExceeded {
+		t.Fatal("expected budget exceeded flag to survive concurrent saves")
+	}
+}
+
+// blockingDirector 决策时阻塞到 release 关闭，模拟慢的导演 LLM 调用
+type blockingDirector struct {
+	deciding chan struct{}
+	release  chan struct{}
+}
+
+func (d *blockingDirector) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
+	close(d.deciding)
+	<-d.release
+	state.Script = &model.ScriptState{StoryProgress: "用户问了通胀"}
+	return model.DirectorPlan{NextRole: "host", Instruction: "test"}
+}
+
+// TestDirectorDecisionDoesNotHoldSessionLock 验证导演决策期间不持会话锁：助手文本照常归约，
+// 决策对状态的修改写回时不覆盖期间保存的轮次，结束后会话锁被清理。
+func TestDirectorDecisionDoesNotHoldSessionLock(t *testing.T) {
+	ctx := context.Background()
+	store := &copyingStore{data: map[string]model.SessionState{"s1": {SessionID: "s1", EntryID: "entry"}}}
+	dir := &blockingDirector{deciding: make(chan struct{}), release: make(chan struct{})}
+	orch := NewWithEngines(store, timeline.NewInMemoryStore(), dir, nil, log.New(io.Discard, "", 0))
+
+	done := make(chan error, 1)
+	go func() { done <- orch.HandleUserUtterance(ctx, "s1", "什么是通胀？", nil) }()
+	<-dir.deciding
+
+	assistantDone := make(chan error, 1)
+	go func() { assistantDone <- orch.HandleAssistantText(ctx, "s1", "上一轮的回答", "host") }()
+	select {
+	case err := <-assistantDone:
+		if err != nil {
+			t.Fatalf("handle assistant text: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("assistant text blocked by director decision")
+	}
+
+	close(dir.release)
+	if err := <-done; err != nil {
+		t.Fatalf("handle user utterance: %v", err)
+	}
+
+	state, _ := store.Get(ctx, "s1")
+	if len(state.Turns) != 2 {
+		t.Errorf("turns = %+v, want user + assistant", state.Turns)
+	}
+	if state.Script == nil || state.Script.StoryProgress != "用户问了通胀" {
+		t.Errorf("director changes not saved: %+v", state.Script)
+	}
+	orch.sessionLocksMu.Lock()
+	defer orch.sessionLocksMu.Unlock()
+	if len(orch.sessionLocks) != 0 {
+		t.Errorf("session locks not pruned: %d left", len(orch.sessionLocks))
+	}
+}
+
+// TestUsageBudgetPushesDirectorToWrapUp 验证用量落 Timeline，且超出预算后导演在下一次决策时看到收束标记。
+func TestUsageBudgetPushesDirectorToWrapUp(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewInMemoryStore()
+	timelineStore := timeline.NewInMemoryStore()
+
+	dir := &usageDirector{tokens: 60}
+	orch := NewWithEngines(store, timelineStore, dir, nil, log.Default())
+	orch.SetUsageTracker(usage.NewTracker(config.UsageConfig{
+		Budget: config.UsageBudgetConfig{MaxSessionTokens: 100},
+	}))
+
+	if err := store.Save(ctx, &model.SessionState{SessionID: "s1", EntryID: "entry"}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+
+	if err := orch.HandleUserUtterance(ctx, "s1", "第一句", nil); err != nil {
+		t.Fatalf("handle user utterance: %v", err)
+	}
+	if err := orch.HandleRealtimeUsage(ctx, "s1", &model.UsageRecord{
+		Source: usage.SourceRealtime, Role: "host", PromptTokens: 30, CompletionTokens: 20,
+	}); err != nil {
+		t.Fatalf("handle realtime usage: %v", err)
+	}
+
+	state, _ := store.Get(ctx, "s1")
+	if !state.BudgetExceeded {
+		t.Fatal("expected budget exceeded flag to be saved after realtime usage")
+	}
+
+	if err := orch.HandleUserUtterance(ctx, "s1", "第二句", nil); err != nil {
+		t.Fatalf("handle user utterance: %v", err)
+	}
+	if len(dir.sawExceeded) != 2 || dir.sawExceeded[0] || !dir.sawExceeded[1] {
+		t.Fatalf("expected director to see budget exceeded only on second decision, got %v", dir.sawExceeded)
+	}
+
+	events, _ := timelineStore.List(ctx, "s1")
+	var usageEvents int
+	for _, evt := range events {
+		if evt.Type == "usage" {
+			usageEvents++
+			if evt.Usage == nil {
+				t.Fatal("usage event must carry usage record")
+			}
+		}
+	}
+	if usageEvents != 3 {
+		t.Fatalf("expected 3 usage events (2 llm + 1 realtime), got %d", usageEvents)
+	}
+
+	summary, ok := orch.UsageTracker().Session("s1")
+	if !ok || summary.TotalTokens != 170 || summary.ByRole["host"].TotalTokens != 50 {
+		t.Fatalf("unexpected usage summary: %+v", summary)
+	}
+}
+
+// earlyStartDirector 测试桩：决策中途触发提前开口，再返回完整的多角色计划。
+type earlyStartDirector struct{}
+
+func (d *earlyStartDirector) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
+	return d.DecideContext(context.Background(), state, userInput)
+}
+
+func (d *earlyStartDirector) DecideContext(ctx context.Context, state *model.SessionState, userInput string) model.DirectorPlan {
+	if early := director.EarlyStartFromContext(ctx); early != nil {
+		early(model.DirectorPlan{NextRole: "host,economist", Instruction: "Scene Direction: 先接住"})
+	}
+	return model.DirectorPlan{NextRole: "host,economist", Instruction: "Scene Direction: 先接住用户的猜测，再请经济学家解释"}
+}
+
+// recordingSender 记录下发的角色指令
+type recordingSender struct {
+	roles []string
+}
+
+func (s *recordingSender) SendInstructions(ctx context.Context, instructions string, metadata map[string]interface{}) error {
+	s.roles = append(s.roles, fmt.Sprintf("%s@%s/%s", metadata["role"], metadata["sequence"], metadata["total"]))
+	return nil
+}
+
+// TestHandleUserUtterance_EarlyStartSkipsStartedRole 验证提前开口的角色不会在完整计划到达后重复下发。
+func TestHandleUserUtterance_EarlyStartSkipsStartedRole(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewInMemoryStore()
+	actorEngine, err := actor.NewActorEngine("../../configs/prompts")
+	if err != nil {
+		t.Fatalf("new actor engine: %v", err)
+	}
+	orch := NewWithEngines(store, timeline.NewInMemoryStore(), &earlyStartDirector{}, actorEngine, log.Default())
+
+	if err := store.Save(ctx, &model.SessionState{SessionID: "s1", EntryID: "entry", AvailableRoles: []string{"host", "economist"}}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+
+	sender := &recordingSender{}
+	if err := orch.HandleUserUtterance(ctx, "s1", "价格为什么涨了", sender); err != nil {
+		t.Fatalf("handle user utterance: %v", err)
+	}
+
+	want := []string{"host@0/2", "economist@1/2"}
+	if fmt.Sprint(sender.roles) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, sender.roles)
+	}
+}
+
+// repairedDirector 测试桩：提前开口的是 economist，修复后的最终计划改由 host 开场。
+type repairedDirector struct{}
+
+func (d *repairedDirector) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
+	return d.DecideContext(context.Background(), state, userInput)
+}
+
+func (d *repairedDirector) DecideContext(ctx context.Context, state *model.SessionState, userInput string) model.DirectorPlan {
+	if early := director.EarlyStartFromContext(ctx); early != nil {
+		early(model.DirectorPlan{NextRole: "economist", Instruction: "Scene Direction: 直接解释"})
+	}
+	return model.DirectorPlan{NextRole: "host,economist", Instruction: "Scene Direction: 接力回应"}
+}
+
+// cancellingSender 记录下发的指令与撤回的发言
+type cancellingSender struct {
+	recordingSender
+	planIDs   []string
+	cancelled []string
+}
+
+func (s *cancellingSender) SendInstructions(ctx context.Context, instructions string, metadata map[string]interface{}) error {
+	s.planIDs = append(s.planIDs, fmt.Sprint(metadata["plan_id"]))
+	return s.recordingSender.SendInstructions(ctx, instructions, metadata)
+}
+
+func (s *cancellingSender) CancelSpeech(planID string, role string) {
+	s.cancelled = append(s.cancelled, role+"@"+planID)
+}
+
+// TestHandleUserUtterance_CancelsMismatchedEarlyStart 验证最终计划换了开场角色时，提前开口的发言被撤回，
+// 完整场景照最终计划全部下发。
+func TestHandleUserUtterance_CancelsMismatchedEarlyStart(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewInMemoryStore()
+	actorEngine, err := actor.NewActorEngine("../../configs/prompts")
+	if err != nil {
+		t.Fatalf("new actor engine: %v", err)
+	}
+	orch := NewWithEngines(store, timeline.NewInMemoryStore(), &repairedDirector{}, actorEngine, log.Default())
+	if err := store.Save(ctx, &model.SessionState{SessionID: "s1", EntryID: "entry", AvailableRoles: []string{"host", "economist"}}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+
+	sender := &cancellingSender{}
+	if err := orch.HandleUserUtterance(ctx, "s1", "价格为什么涨了", sender); err != nil {
+		t.Fatalf("handle user utterance: %v", err)
+	}
+
+	want := []string{"economist@0/1", "host@0/2", "economist@1/2"}
+	if fmt.Sprint(sender.roles) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, sender.roles)
+	}
+	if len(sender.cancelled) != 1 || sender.cancelled[0] != "economist@"+sender.planIDs[0] {
+		t.Fatalf("cancelled = %v, plans = %v", sender.cancelled, sender.planIDs)
+	}
+}
+
+// TestUserTurnID 验证连续的用户发言共用一个轮次，角色接话后才进入下一轮，
+// 这样同一轮的新计划才能在网关替换旧计划尚未开播的发言。
+func TestUserTurnID(t *testing.T) {
+	state := &model.SessionState{}
+	if id := userTurnID(state); id != "turn_0" {
+		t.Fatalf("opening turn = %s", id)
+	}
+	state.Turns = append(state.Turns, model.Turn{Role: "assistant"}, model.Turn{Role: "user"})
+	first := userTurnID(state)
+	state.Turns = append(state.Turns, model.Turn{Role: "user"})
+	if again := userTurnID(state); again != first {
+		t.Fatalf("consecutive utterances: %s != %s", again, first)
+	}
+	state.Turns = append(state.Turns, model.Turn{Role: "assistant"}, model.Turn{Role: "user"})
+	if next := userTurnID(state); next == first {
+		t.Fatalf("turn after assistant reply should change, got %s", next)
+	}
+}
+
+// sceneDirector 测试桩：返回两拍各自有分镜的多角色场景。
+type sceneDirector struct{}
+
+func (d *sceneDirector) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
+	return model.DirectorPlan{
+		NextRole:    "host,economist",
+		Instruction: "Scene Direction: 接力回应",
+		Scene: []model.SceneBeat{
+			{Role: "host", Instruction: "Your Beat (1/2): 主持人复述猜测"},
+			{Role: "economist", Instruction: "Your Beat (2/2): 经济学家解释机会成本"},
+		},
+	}
+}
+
+// sceneSenderStub 记录整段下发的场景
+type sceneSenderStub struct {
+	recordingSender
+	scenes []gateway.Scene
+}
+
+func (s *sceneSenderStub) SendScene(ctx context.Context, scene gateway.Scene) error {
+	s.scenes = append(s.scenes, scene)
+	return nil
+}
+
+// TestHandleUserUtterance_SendsSceneBeats 验证多角色计划整段交给网关，每拍带自己的分镜与轮次/计划标识。
+func TestHandleUserUtterance_SendsSceneBeats(t *testing.T) {
+	ctx := context.Background()
+	store := session.NewInMemoryStore()
+	actorEngine, err := actor.NewActorEngine("../../configs/prompts")
+	if err != nil {
+		t.Fatalf("new actor engine: %v", err)
+	}
+	orch := NewWithEngines(store, timeline.NewInMemoryStore(), &sceneDirector{}, actorEngine, log.Default())
+	if err := store.Save(ctx, &model.SessionState{SessionID: "s1", EntryID: "entry", AvailableRoles: []string{"host", "economist"}}); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+
+	sender := &sceneSenderStub{}
+	if err := orch.HandleUserUtterance(ctx, "s1", "加班赚了吧", sender); err != nil {
+		t.Fatalf("handle user utterance: %v", err)
+	}
+
+	if len(sender.roles) != 0 || len(sender.scenes) != 1 {
+		t.Fatalf("expected one scene and no single instructions, got scenes=%d roles=%v", len(sender.scenes), sender.roles)
+	}
+	scene := sender.scenes[0]
+	if len(scene.Beats) != 2 || scene.Beats[0].Role != "host" || scene.Beats[1].Role != "economist" {
+		t.Fatalf("beats = %+v", scene.Beats)
+	}
+	if !strings.Contains(scene.Beats[0].Instructions, "主持人复述猜测") || strings.Contains(scene.Beats[0].Instructions, "经济学家解释") {
+		t.Errorf("host beat should carry only its own direction")
+	}
+	if scene.Metadata["turn_id"] == "" || scene.Metadata["plan_id"] == "" {
+		t.Errorf("scene metadata = %+v", scene.Metadata)
+	}
+	if scene.Beats[1].Metadata["sequence"] != "1" || scene.Beats[1].Metadata["total"] != "2" {
+		t.Errorf("economist beat metadata = %+v", scene.Beats[1].Metadata)
+	}
+}
@@ -0,0 +1,159 @@
+package recording
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// mixChunkSamples 混音时每次从各轨道读取的采样数
+const mixChunkSamples = 4096
+
+// ExportMix 把会话所有 take 混成一条单声道 WAV 写入 w：take 内各轨道按时间轴叠加（饱和截断），
+// take 之间首尾相接。
+func (m *Manager) ExportMix(w io.Writer, sessionID string) error {
+	manifests, err := m.Takes(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// 先打开所有轨道拿到长度，才能写出正确的 WAV 头
+	takes := make([][]*wavData, 0, len(manifests))
+	defer func() {
+		for _, tracks := range takes {
+			for _, t := range tracks {
+				_ = t.close()
+			}
+		}
+	}()
+	var total int64
+	for _, manifest := range manifests {
+		dir := filepath.Join(m.sessionDir(sessionID), takeDirName(manifest.Take))
+		var tracks []*wavData
+		var longest int64
+		for _, info := range manifest.Tracks {
+			wd, err := openWAV(filepath.Join(dir, info.File))
+			if err != nil {
+				return err
+			}
+			tracks = append(tracks, wd)
+			if wd.samples() > longest {
+				longest = wd.samples()
+			}
+		}
+		takes = append(takes, tracks)
+		total += longest
+	}
+
+	if _, err := w.Write(encodeWAVHeader(total*bytesPerSample, SampleRate)); err != nil {
+		return err
+	}
+	for _, tracks := range takes {
+		if err := mixTracks(w, tracks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mixTracks 逐块读取各轨道并叠加，直到最长的轨道读完
+func mixTracks(w io.Writer, tracks []*wavData) error {
+	sum := make([]int32, mixChunkSamples)
+	buf := make([]byte, mixChunkSamples*bytesPerSample)
+	out := make([]byte, mixChunkSamples*bytesPerSample)
+	for {
+		for i := range sum {
+			sum[i] = 0
+		}
+		longest := 0
+		for _, t := range tracks {
+			n, err := io.ReadFull(t.data, buf)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			samples := n / bytesPerSample
+			for i := 0; i < samples; i++ {
+				sum[i] += int32(int16(binary.LittleEndian.Uint16(buf[i*bytesPerSample:])))
+			}
+			if samples > longest {
+				longest = samples
+			}
+		}
+		if longest == 0 {
+			return nil
+		}
+		for i := 0; i < longest; i++ {
+			binary.LittleEndian.PutUint16(out[i*bytesPerSample:], uint16(clampInt16(sum[i])))
+		}
+		if _, err := w.Write(out[:longest*bytesPerSample]); err != nil {
+			return err
+		}
+	}
+}
+
+func clampInt16(v int32) int16 {
+	switch {
+	case v > 32767:
+		return 32767
+	case v < -32768:
+		return -32768
+	default:
+		return int16(v)
+	}
+}
+
+// ExportArchive 把会话所有 take 的原始轨道与清单打成 zip 写入 w：
+// take-NNN/manifest.json、take-NNN/<track>.wav
+func (m *Manager) ExportArchive(w io.Writer, sessionID string) error {
+	manifests, err := m.Takes(sessionID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	for _, manifest := range manifests {
+		takeDir := takeDirName(manifest.Take)
+		dir := filepath.Join(m.sessionDir(sessionID), takeDir)
+
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal manifest: %w", err)
+		}
+		fw, err := zw.Create(takeDir + "/" + manifestFile)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+
+		for _, info := range manifest.Tracks {
+			if err := copyTrack(zw, takeDir+"/"+info.File, filepath.Join(dir, info.File)); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// copyTrack 复制一条轨道；头部按读到的 data 长度重写，录制中的文件也能得到一致的 WAV
+func copyTrack(zw *zip.Writer, name, path string) error {
+	wd, err := openWAV(path)
+	if err != nil {
+		return err
+	}
+	defer wd.close()
+
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(encodeWAVHeader(wd.dataBytes, wd.sampleRate)); err != nil {
+		return err
+	}
+	_, err = io.CopyN(fw, wd.data, wd.dataBytes)
+	return err
+}
@@ -0,0 +1,280 @@
+package recording
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bubble-talk/server/internal/model"
+	"bubble-talk/server/internal/timeline"
+)
+
+// ErrNotFound 会话没有录音
+var ErrNotFound = errors.New("recording: not found")
+
+// Config 录音配置
+type Config struct {
+	// Dir 录音根目录：<Dir>/<session_id>-<hash>/take-NNN/{manifest.json, mic.wav, role_<role>.wav}
+	// （session_id 清洗成安全文件名，hash 取原始会话 ID 的短哈希，避免清洗后撞名）
+	Dir string
+	// MaxAge 超过该时长未更新的会话录音会被清理，0 表示不按时间清理
+	MaxAge time.Duration
+	// MaxSessions 最多保留多少个会话的录音（按最近更新时间），0 表示不限制
+	MaxSessions int
+	// MaxTakeDuration 单个 take 每条轨道的最长时长，0 表示不限制
+	MaxTakeDuration time.Duration
+}
+
+// Manager 管理各会话的录音：开始/结束录制、Timeline 对齐标记、保留策略与导出
+type Manager struct {
+	cfg    Config
+	now    func() time.Time
+	logger *log.Logger
+
+	mu     sync.Mutex
+	active map[string]*Recorder
+}
+
+// NewManager 创建录音管理器，并按保留策略清理一次旧录音
+func NewManager(cfg Config) (*Manager, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("recording dir is required")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create recording dir: %w", err)
+	}
+	m := &Manager{
+		cfg:    cfg,
+		now:    time.Now,
+		logger: log.Default(),
+		active: make(map[string]*Recorder),
+	}
+	if err := m.Prune(); err != nil {
+		m.logger.Printf("[Recorder] ⚠️  Prune recordings failed: %v", err)
+	}
+	return m, nil
+}
+
+// Start 为会话开始一个新的 take。会话已有进行中的录制时先结束它（新连接替换旧网关的场景）。
+func (m *Manager) Start(sessionID string) (*Recorder, error) {
+	if err := m.Prune(); err != nil {
+		m.logger.Printf("[Recorder] ⚠️  Prune recordings failed: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if old := m.active[sessionID]; old != nil {
+		_ = old.Close()
+		delete(m.active, sessionID)
+	}
+
+	sessionDir := m.sessionDir(sessionID)
+	takes, err := listTakes(sessionDir)
+	if err != nil {
+		return nil, err
+	}
+	take := 1
+	if len(takes) > 0 {
+		take = takes[len(takes)-1] + 1
+	}
+
+	rec, err := newRecorder(filepath.Join(sessionDir, takeDirName(take)), sessionID, take, m.cfg.MaxTakeDuration, m.now)
+	if err != nil {
+		return nil, err
+	}
+	m.active[sessionID] = rec
+	m.logger.Printf("[Recorder] ✅ Recording started: session=%s take=%d dir=%s", sessionID, take, rec.Dir())
+	return rec, nil
+}
+
+// Finish 结束录制；rec 已被新 take 替换时只关闭 rec 本身
+func (m *Manager) Finish(sessionID string, rec *Recorder) {
+	m.mu.Lock()
+	if m.active[sessionID] == rec {
+		delete(m.active, sessionID)
+	}
+	m.mu.Unlock()
+
+	if err := rec.Close(); err != nil {
+		m.logger.Printf("[Recorder] ⚠️  Close recording failed: session=%s: %v", sessionID, err)
+	}
+}
+
+// Mark 把 Timeline 事件对齐到会话当前的录制上（没有进行中的录制时忽略）
+func (m *Manager) Mark(sessionID string, seq int64, eventType string) {
+	m.mu.Lock()
+	rec := m.active[sessionID]
+	m.mu.Unlock()
+	if rec != nil {
+		rec.Mark(seq, eventType)
+	}
+}
+
+// Takes 返回会话所有 take 的清单（按 take 递增）；进行中的录制会先 flush
+func (m *Manager) Takes(sessionID string) ([]Manifest, error) {
+	m.mu.Lock()
+	rec := m.active[sessionID]
+	m.mu.Unlock()
+	if rec != nil {
+		if err := rec.Flush(); err != nil {
+			return nil, fmt.Errorf("flush active recording: %w", err)
+		}
+	}
+
+	sessionDir := m.sessionDir(sessionID)
+	takes, err := listTakes(sessionDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(takes) == 0 {
+		return nil, ErrNotFound
+	}
+	out := make([]Manifest, 0, len(takes))
+	for _, take := range takes {
+		manifest, err := readManifest(filepath.Join(sessionDir, takeDirName(take)))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, manifest)
+	}
+	return out, nil
+}
+
+// Prune 按保留策略删除旧录音；进行中的会话不会被删除
+func (m *Manager) Prune() error {
+	entries, err := os.ReadDir(m.cfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	type sessionEntry struct {
+		id      string
+		modTime time.Time
+	}
+	m.mu.Lock()
+	// 进行中的会话按 manifest 里的原始会话 ID 比对（清洗后的目录名可能撞名）
+	var sessions []sessionEntry
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if sessionID := dirSessionID(filepath.Join(m.cfg.Dir, entry.Name())); sessionID != "" && m.active[sessionID] != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, sessionEntry{id: entry.Name(), modTime: info.ModTime()})
+	}
+	activeCount := len(m.active)
+	m.mu.Unlock()
+
+	// 最新的在前
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].modTime.After(sessions[j].modTime) })
+
+	now := m.now()
+	var firstErr error
+	for i, s := range sessions {
+		expired := m.cfg.MaxAge > 0 && now.Sub(s.modTime) > m.cfg.MaxAge
+		overflow := m.cfg.MaxSessions > 0 && activeCount+i >= m.cfg.MaxSessions
+		if !expired && !overflow {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(m.cfg.Dir, s.id)); err != nil && firstErr == nil {
+			firstErr = err
+			continue
+		}
+		m.logger.Printf("[Recorder] 🗑️  Pruned recording: session=%s expired=%v overflow=%v", s.id, expired, overflow)
+	}
+	return firstErr
+}
+
+func (m *Manager) sessionDir(sessionID string) string {
+	return filepath.Join(m.cfg.Dir, sessionDirName(sessionID))
+}
+
+// sessionDirName 会话录音目录名：清洗后的会话 ID 加原始 ID 的短哈希
+func sessionDirName(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return sanitizeName(sessionID) + "-" + hex.EncodeToString(sum[:4])
+}
+
+// dirSessionID 从会话录音目录里任一 take 的清单读出原始会话 ID；读不到时返回空串
+func dirSessionID(sessionDir string) string {
+	takes, err := listTakes(sessionDir)
+	if err != nil {
+		return ""
+	}
+	for _, take := range takes {
+		if manifest, err := readManifest(filepath.Join(sessionDir, takeDirName(take))); err == nil && manifest.SessionID != "" {
+			return manifest.SessionID
+		}
+	}
+	return ""
+}
+
+func takeDirName(take int) string {
+	return fmt.Sprintf("take-%03d", take)
+}
+
+// listTakes 返回会话目录下已有的 take 编号（递增）；目录不存在返回空
+func listTakes(sessionDir string) ([]int, error) {
+	entries, err := os.ReadDir(sessionDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var takes []int
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "take-") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "take-"))
+		if err != nil {
+			continue
+		}
+		takes = append(takes, n)
+	}
+	sort.Ints(takes)
+	return takes, nil
+}
+
+// TimelineStore 在写入 Timeline 的同时把事件 seq 对齐到录音上（装饰 timeline.Store）
+type TimelineStore struct {
+	timeline.Store
+	recordings *Manager
+}
+
+// NewTimelineStore 包装一个 timeline.Store
+func NewTimelineStore(inner timeline.Store, recordings *Manager) *TimelineStore {
+	return &TimelineStore{Store: inner, recordings: recordings}
+}
+
+// Query 透传给 inner，保留其分页查询能力
+func (s *TimelineStore) Query(ctx context.Context, sessionID string, q timeline.Query) (timeline.Page, error) {
+	return timeline.QueryEvents(ctx, s.Store, sessionID, q)
+}
+
+// Append 写入 Timeline 后打录音标记
+func (s *TimelineStore) Append(ctx context.Context, sessionID string, evt *model.Event) (int64, error) {
+	seq, err := s.Store.Append(ctx, sessionID, evt)
+	if err != nil {
+		return seq, err
+	}
+	s.recordings.Mark(sessionID, seq, evt.Type)
+	return seq, nil
+}
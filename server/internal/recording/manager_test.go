@@ -0,0 +1,216 @@
+package recording
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/model"
+	"bubble-talk/server/internal/timeline"
+)
+
+func newTestManager(t *testing.T, cfg Config, clock *fakeClock) *Manager {
+	t.Helper()
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	m, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	m.now = clock.Now
+	return m
+}
+
+func TestManager_ExportMixSumsTracksAndConcatenatesTakes(t *testing.T) {
+	clock := newFakeClock()
+	m := newTestManager(t, Config{}, clock)
+
+	take1, err := m.Start("s1")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	take1.RecordInput(pcmOf(100, 1000))
+	take1.RecordOutput("host", pcmOf(50, 32000)) // 叠加后饱和
+	m.Finish("s1", take1)
+
+	take2, err := m.Start("s1")
+	if err != nil {
+		t.Fatalf("start take 2: %v", err)
+	}
+	take2.RecordOutput("economist", pcmOf(30, -7))
+
+	var buf bytes.Buffer
+	if err := m.ExportMix(&buf, "s1"); err != nil {
+		t.Fatalf("export mix: %v", err)
+	}
+	wd, err := parseWAV(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse mix: %v", err)
+	}
+	if wd.samples() != 130 || int64(buf.Len()) != wavHeaderSize+wd.dataBytes {
+		t.Fatalf("mix samples = %d (len %d), want 130", wd.samples(), buf.Len())
+	}
+	data, _ := io.ReadAll(wd.data)
+	sample := func(i int) int16 { return int16(binary.LittleEndian.Uint16(data[i*bytesPerSample:])) }
+	if sample(0) != 32767 || sample(50) != 1000 || sample(100) != -7 || sample(129) != -7 {
+		t.Errorf("mix samples: [0]=%d [50]=%d [100]=%d [129]=%d", sample(0), sample(50), sample(100), sample(129))
+	}
+}
+
+func TestManager_ExportArchiveContainsTracksAndMarkers(t *testing.T) {
+	clock := newFakeClock()
+	m := newTestManager(t, Config{}, clock)
+
+	rec, err := m.Start("s1")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	store := NewTimelineStore(timeline.NewInMemoryStore(), m)
+	clock.Advance(500 * time.Millisecond)
+	if _, err := store.Append(context.Background(), "s1", &model.Event{EventID: "e1", Type: "user_utterance"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	// 幂等重试不重复打点
+	_, _ = store.Append(context.Background(), "s1", &model.Event{EventID: "e1", Type: "user_utterance"})
+	rec.RecordInput(pcmOf(10, 1))
+	rec.RecordOutput("host", pcmOf(10, 1))
+
+	// 录制进行中也能导出
+	var buf bytes.Buffer
+	if err := m.ExportArchive(&buf, "s1"); err != nil {
+		t.Fatalf("export archive: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	want := []string{"take-001/manifest.json", "take-001/mic.wav", "take-001/role_host.wav"}
+	if len(names) != len(want) {
+		t.Fatalf("archive entries = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("archive entries = %v, want %v", names, want)
+		}
+	}
+
+	manifests, err := m.Takes("s1")
+	if err != nil {
+		t.Fatalf("takes: %v", err)
+	}
+	markers := manifests[0].Markers
+	if len(markers) != 1 || markers[0] != (Marker{Seq: 1, Type: "user_utterance", OffsetMS: 500}) {
+		t.Errorf("markers = %+v", markers)
+	}
+}
+
+func TestManager_NotFound(t *testing.T) {
+	m := newTestManager(t, Config{}, newFakeClock())
+	if err := m.ExportMix(io.Discard, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManager_PruneByAgeAndCount(t *testing.T) {
+	clock := newFakeClock()
+	dir := t.TempDir()
+	// 预置三个旧会话：old 已过期，a/b 按修改时间排序
+	for i, id := range []string{"old", "a", "b"} {
+		path := filepath.Join(dir, id, "take-001")
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		mod := clock.Now().Add(-time.Duration(3-i) * time.Hour)
+		if id == "old" {
+			mod = clock.Now().Add(-48 * time.Hour)
+		}
+		if err := os.Chtimes(filepath.Join(dir, id), mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := newTestManager(t, Config{Dir: dir, MaxAge: 24 * time.Hour, MaxSessions: 2}, clock)
+	if err := m.Prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	assertSessions(t, dir, "a", "b")
+
+	// 进行中的会话占一个名额，最旧的 a 被清理
+	rec, err := m.Start("live")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer m.Finish("live", rec)
+	if err := m.Prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	assertSessions(t, dir, "b", sessionDirName("live"))
+}
+
+func TestManager_PruneKeepsActiveSanitizedSession(t *testing.T) {
+	clock := newFakeClock()
+	dir := t.TempDir()
+	m := newTestManager(t, Config{Dir: dir, MaxAge: time.Hour}, clock)
+
+	// live.1 与 live_1 清洗后同名，目录靠原始 ID 的哈希区分
+	done, err := m.Start("live_1")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	m.Finish("live_1", done)
+	rec, err := m.Start("live.1")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer m.Finish("live.1", rec)
+	if rec.Take() != 1 || sessionDirName("live.1") == sessionDirName("live_1") {
+		t.Fatalf("sanitized session ids collide: take=%d dir=%s", rec.Take(), rec.Dir())
+	}
+
+	// 两个都已过期：按原始 ID 比对，只保留录制中的 live.1
+	old := clock.Now().Add(-2 * time.Hour)
+	for _, id := range []string{"live.1", "live_1"} {
+		if err := os.Chtimes(filepath.Join(dir, sessionDirName(id)), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	assertSessions(t, dir, sessionDirName("live.1"))
+}
+
+func assertSessions(t *testing.T, dir string, want ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	sort.Strings(got)
+	if len(got) != len(want) {
+		t.Fatalf("sessions = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sessions = %v, want %v", got, want)
+		}
+	}
+}
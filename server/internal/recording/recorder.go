@@ -0,0 +1,306 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MicTrack 学习者麦克风轨道名；角色轨道名见 RoleTrack
+const MicTrack = "mic"
+
+const manifestFile = "manifest.json"
+
+// RoleTrack 返回角色 TTS 轨道名
+func RoleTrack(role string) string {
+	return "role_" + sanitizeName(role)
+}
+
+// Marker Timeline 事件在录音中的位置：把 timeline seq 对齐到各轨道共享的时间轴上
+type Marker struct {
+	Seq      int64  `json:"seq"`
+	Type     string `json:"type"`
+	OffsetMS int64  `json:"offset_ms"`
+}
+
+// TrackInfo 轨道描述
+type TrackInfo struct {
+	Name    string `json:"name"`
+	File    string `json:"file"`
+	Role    string `json:"role,omitempty"`
+	Samples int64  `json:"samples"`
+}
+
+// Manifest 一次录制（take）的清单，和轨道 WAV 一起落在 take 目录下。
+// 一个会话每次新建网关开始一个新 take；断线续传接回的网关沿用同一个 take。
+type Manifest struct {
+	SessionID  string      `json:"session_id"`
+	Take       int         `json:"take"`
+	StartedAt  time.Time   `json:"started_at"`
+	EndedAt    *time.Time  `json:"ended_at,omitempty"`
+	SampleRate int         `json:"sample_rate"`
+	Tracks     []TrackInfo `json:"tracks"`
+	Markers    []Marker    `json:"markers"`
+}
+
+// Recorder 把一次录制的各轨道 PCM16 写成 WAV。
+//
+// 对齐方式：所有轨道以 take 开始时刻为零点。写入时如果轨道落后于当前时刻，先补静音再追加；
+// TTS 音频通常比实时更快地成批到达，此时直接接在轨道末尾，不会被截断或重叠。
+type Recorder struct {
+	mu          sync.Mutex
+	dir         string
+	manifest    Manifest
+	tracks      map[string]*track
+	maxSamples  int64
+	now         func() time.Time
+	closed      bool
+	logger      *log.Logger
+	onDiskBytes int64
+}
+
+type track struct {
+	w       *wavWriter
+	info    *TrackInfo
+	cursor  int64 // 已写入的采样数
+	stopped bool  // 写入失败或超过单轨时长上限
+}
+
+func newRecorder(dir, sessionID string, take int, maxDuration time.Duration, now func() time.Time) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create recording dir: %w", err)
+	}
+	r := &Recorder{
+		dir: dir,
+		manifest: Manifest{
+			SessionID:  sessionID,
+			Take:       take,
+			StartedAt:  now(),
+			SampleRate: SampleRate,
+			Tracks:     []TrackInfo{},
+			Markers:    []Marker{},
+		},
+		tracks: make(map[string]*track),
+		now:    now,
+		logger: log.Default(),
+	}
+	if maxDuration > 0 {
+		r.maxSamples = int64(maxDuration.Seconds() * SampleRate)
+	}
+	if err := r.writeManifestLocked(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Take 返回本次录制的 take 编号
+func (r *Recorder) Take() int {
+	return r.manifest.Take
+}
+
+// StartedAt 返回本次录制的开始时刻（各轨道的零点）
+func (r *Recorder) StartedAt() time.Time {
+	return r.manifest.StartedAt
+}
+
+// Dir 返回本次录制的目录
+func (r *Recorder) Dir() string {
+	return r.dir
+}
+
+// RecordInput 写入学习者麦克风音频（PCM16）
+func (r *Recorder) RecordInput(pcm []byte) {
+	r.write(MicTrack, "", pcm)
+}
+
+// RecordOutput 写入角色 TTS 音频（PCM16）
+func (r *Recorder) RecordOutput(role string, pcm []byte) {
+	r.write(RoleTrack(role), role, pcm)
+}
+
+// Mark 记录一个 Timeline 事件在录音时间轴上的位置
+func (r *Recorder) Mark(seq int64, eventType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	// Timeline 的幂等重试会返回同一个 seq，不重复打点
+	if n := len(r.manifest.Markers); n > 0 && r.manifest.Markers[n-1].Seq >= seq {
+		return
+	}
+	r.manifest.Markers = append(r.manifest.Markers, Marker{
+		Seq:      seq,
+		Type:     eventType,
+		OffsetMS: r.now().Sub(r.manifest.StartedAt).Milliseconds(),
+	})
+}
+
+func (r *Recorder) write(name, role string, pcm []byte) {
+	// 只接受整采样；奇数字节的尾巴直接丢弃，不影响后续块的对齐
+	pcm = pcm[:len(pcm)-len(pcm)%bytesPerSample]
+	if len(pcm) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+
+	t, err := r.trackLocked(name, role)
+	if err != nil {
+		r.logger.Printf("[Recorder] ⚠️  Failed to open track %s for session %s: %v", name, r.manifest.SessionID, err)
+		return
+	}
+	if t.stopped {
+		return
+	}
+
+	if pos := r.now().Sub(r.manifest.StartedAt).Nanoseconds() * SampleRate / int64(time.Second); pos > t.cursor {
+		gap := pos - t.cursor
+		if r.maxSamples > 0 && t.cursor+gap > r.maxSamples {
+			gap = r.maxSamples - t.cursor
+		}
+		if err := t.w.writeSilence(gap); err != nil {
+			r.stopTrackLocked(t, err)
+			return
+		}
+		t.cursor += gap
+	}
+
+	samples := int64(len(pcm) / bytesPerSample)
+	if r.maxSamples > 0 && t.cursor+samples > r.maxSamples {
+		samples = r.maxSamples - t.cursor
+		pcm = pcm[:samples*bytesPerSample]
+	}
+	if samples > 0 {
+		if err := t.w.write(pcm); err != nil {
+			r.stopTrackLocked(t, err)
+			return
+		}
+		t.cursor += samples
+		r.onDiskBytes += int64(len(pcm))
+	}
+	t.info.Samples = t.cursor
+	if r.maxSamples > 0 && t.cursor >= r.maxSamples {
+		r.logger.Printf("[Recorder] ⏱️  Track %s reached max duration for session %s", name, r.manifest.SessionID)
+		t.stopped = true
+	}
+}
+
+func (r *Recorder) trackLocked(name, role string) (*track, error) {
+	if t, ok := r.tracks[name]; ok {
+		return t, nil
+	}
+	file := name + ".wav"
+	w, err := createWAV(filepath.Join(r.dir, file))
+	if err != nil {
+		return nil, err
+	}
+	r.manifest.Tracks = append(r.manifest.Tracks, TrackInfo{Name: name, File: file, Role: role})
+	sort.Slice(r.manifest.Tracks, func(i, j int) bool { return r.manifest.Tracks[i].Name < r.manifest.Tracks[j].Name })
+	t := &track{w: w}
+	r.tracks[name] = t
+	// Tracks 重新排序后指针会失效，统一重新绑定
+	for i := range r.manifest.Tracks {
+		r.tracks[r.manifest.Tracks[i].Name].info = &r.manifest.Tracks[i]
+	}
+	return t, nil
+}
+
+func (r *Recorder) stopTrackLocked(t *track, err error) {
+	r.logger.Printf("[Recorder] ⚠️  Stop recording track %s for session %s: %v", t.info.Name, r.manifest.SessionID, err)
+	t.stopped = true
+}
+
+// Flush 回填各轨道 WAV 头并写出清单，使录制中的文件也可以被导出
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	return r.flushLocked()
+}
+
+func (r *Recorder) flushLocked() error {
+	for name, t := range r.tracks {
+		if err := t.w.flush(); err != nil {
+			return fmt.Errorf("flush track %s: %w", name, err)
+		}
+	}
+	return r.writeManifestLocked()
+}
+
+// Close 结束录制（幂等）
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	ended := r.now()
+	r.manifest.EndedAt = &ended
+	var firstErr error
+	for name, t := range r.tracks {
+		if err := t.w.close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("close track %s: %w", name, err)
+		}
+	}
+	if err := r.writeManifestLocked(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	r.logger.Printf("[Recorder] ✅ Recording closed: session=%s take=%d tracks=%d bytes=%d",
+		r.manifest.SessionID, r.manifest.Take, len(r.tracks), r.onDiskBytes)
+	return firstErr
+}
+
+func (r *Recorder) writeManifestLocked() error {
+	data, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	path := filepath.Join(r.dir, manifestFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func readManifest(dir string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parse manifest %s: %w", dir, err)
+	}
+	return m, nil
+}
+
+// sanitizeName 把会话 ID / 角色名转换成安全的文件名
+func sanitizeName(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,163 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now().Truncate(time.Second)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func pcmOf(samples int, value int16) []byte {
+	buf := make([]byte, samples*bytesPerSample)
+	for i := 0; i < samples; i++ {
+		binary.LittleEndian.PutUint16(buf[i*bytesPerSample:], uint16(value))
+	}
+	return buf
+}
+
+func readTrack(t *testing.T, path string) []int16 {
+	t.Helper()
+	wd, err := openWAV(path)
+	if err != nil {
+		t.Fatalf("open wav: %v", err)
+	}
+	defer wd.close()
+	if wd.sampleRate != SampleRate {
+		t.Fatalf("sample rate = %d", wd.sampleRate)
+	}
+	data, err := io.ReadAll(wd.data)
+	if err != nil {
+		t.Fatalf("read wav: %v", err)
+	}
+	out := make([]int16, len(data)/bytesPerSample)
+	for i := range out {
+		out[i] = int16(binary.LittleEndian.Uint16(data[i*bytesPerSample:]))
+	}
+	return out
+}
+
+func TestRecorder_AlignsTracksToSharedClock(t *testing.T) {
+	clock := newFakeClock()
+	dir := t.TempDir()
+	rec, err := newRecorder(dir, "s1", 1, 0, clock.Now)
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+
+	// t=0：麦克风 100 个采样
+	rec.RecordInput(pcmOf(100, 1))
+	// t=10ms（240 个采样处）：角色音频成批到达，轨道从 240 开始补静音
+	clock.Advance(10 * time.Millisecond)
+	rec.RecordOutput("host", pcmOf(480, 2))
+	// 同一时刻再来一批：比实时快，直接接在末尾
+	rec.RecordOutput("host", pcmOf(480, 3))
+	rec.Mark(7, "assistant_text")
+	// 奇数字节的尾巴被丢弃
+	rec.RecordInput(append(pcmOf(10, 4), 0xff))
+
+	if err := rec.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	host := readTrack(t, filepath.Join(dir, RoleTrack("host")+".wav"))
+	if len(host) != 240+960 {
+		t.Fatalf("host samples = %d, want %d", len(host), 240+960)
+	}
+	if host[239] != 0 || host[240] != 2 || host[719] != 2 || host[720] != 3 {
+		t.Errorf("host track misaligned: [239]=%d [240]=%d [719]=%d [720]=%d", host[239], host[240], host[719], host[720])
+	}
+
+	mic := readTrack(t, filepath.Join(dir, MicTrack+".wav"))
+	if len(mic) != 250 || mic[99] != 1 || mic[100] != 0 || mic[240] != 4 {
+		t.Errorf("mic track = %d samples, [99]=%d [100]=%d [240]=%d", len(mic), mic[99], mic[100], mic[240])
+	}
+
+	manifest, err := readManifest(dir)
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	if manifest.EndedAt == nil || len(manifest.Tracks) != 2 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+	if manifest.Tracks[0].Name != MicTrack || manifest.Tracks[1].Role != "host" || manifest.Tracks[1].Samples != 1200 {
+		t.Errorf("tracks = %+v", manifest.Tracks)
+	}
+	if len(manifest.Markers) != 1 || manifest.Markers[0] != (Marker{Seq: 7, Type: "assistant_text", OffsetMS: 10}) {
+		t.Errorf("markers = %+v", manifest.Markers)
+	}
+}
+
+func TestRecorder_MaxTakeDurationCapsTracks(t *testing.T) {
+	clock := newFakeClock()
+	dir := t.TempDir()
+	rec, err := newRecorder(dir, "s1", 1, 10*time.Millisecond, clock.Now)
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+
+	rec.RecordOutput("host", pcmOf(200, 1))
+	rec.RecordOutput("host", pcmOf(200, 1))
+	rec.RecordOutput("host", pcmOf(200, 1))
+	_ = rec.Close()
+
+	if got := len(readTrack(t, filepath.Join(dir, RoleTrack("host")+".wav"))); got != 240 {
+		t.Errorf("host samples = %d, want 240 (10ms cap)", got)
+	}
+}
+
+func TestRecorder_FlushProducesValidWAVWhileRecording(t *testing.T) {
+	clock := newFakeClock()
+	dir := t.TempDir()
+	rec, err := newRecorder(dir, "s1", 1, 0, clock.Now)
+	if err != nil {
+		t.Fatalf("new recorder: %v", err)
+	}
+	defer rec.Close()
+
+	rec.RecordInput(pcmOf(64, 5))
+	if err := rec.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	// flush 之后继续写入的数据不应被读到（data 长度以头部为准）
+	rec.RecordInput(pcmOf(64, 6))
+
+	if got := readTrack(t, filepath.Join(dir, MicTrack+".wav")); len(got) != 64 {
+		t.Errorf("samples after flush = %d, want 64", len(got))
+	}
+}
+
+func TestParseWAV_RejectsNonPCM16Mono(t *testing.T) {
+	header := encodeWAVHeader(0, SampleRate)
+	binary.LittleEndian.PutUint16(header[22:24], 2) // stereo
+	if _, err := parseWAV(bytes.NewReader(header)); err == nil {
+		t.Fatal("expected error for stereo wav")
+	}
+	if _, err := parseWAV(bytes.NewReader([]byte("not a wav file at all"))); err == nil {
+		t.Fatal("expected error for garbage")
+	}
+}
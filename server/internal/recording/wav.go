@@ -0,0 +1,178 @@
+package recording
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// SampleRate Realtime pcm16 的采样率（24kHz 单声道 16-bit little-endian）
+	SampleRate = 24000
+
+	bytesPerSample = 2
+	wavHeaderSize  = 44
+)
+
+// ErrInvalidWAV 不是本包可以处理的 WAV（只支持 PCM 16-bit 单声道）
+var ErrInvalidWAV = errors.New("recording: invalid wav")
+
+// encodeWAVHeader 生成 44 字节的标准 PCM WAV 头
+func encodeWAVHeader(dataBytes int64, sampleRate int) []byte {
+	h := make([]byte, wavHeaderSize)
+	copy(h[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:8], uint32(36+dataBytes))
+	copy(h[8:12], "WAVE")
+	copy(h[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:20], 16)
+	binary.LittleEndian.PutUint16(h[20:22], 1) // PCM
+	binary.LittleEndian.PutUint16(h[22:24], 1) // mono
+	binary.LittleEndian.PutUint32(h[24:28], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(h[28:32], uint32(sampleRate*bytesPerSample))
+	binary.LittleEndian.PutUint16(h[32:34], bytesPerSample)
+	binary.LittleEndian.PutUint16(h[34:36], 16)
+	copy(h[36:40], "data")
+	binary.LittleEndian.PutUint32(h[40:44], uint32(dataBytes))
+	return h
+}
+
+// wavWriter 边录边写的 WAV 文件：数据直接追加，头部的长度字段在 flush/close 时回填
+type wavWriter struct {
+	f         *os.File
+	dataBytes int64
+}
+
+func createWAV(path string) (*wavWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(encodeWAVHeader(0, SampleRate)); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &wavWriter{f: f}, nil
+}
+
+func (w *wavWriter) write(pcm []byte) error {
+	n, err := w.f.Write(pcm)
+	w.dataBytes += int64(n)
+	return err
+}
+
+// writeSilence 追加 samples 个静音采样（用于轨道对齐）
+func (w *wavWriter) writeSilence(samples int64) error {
+	zeros := make([]byte, 4096)
+	remaining := samples * bytesPerSample
+	for remaining > 0 {
+		n := int64(len(zeros))
+		if remaining < n {
+			n = remaining
+		}
+		if err := w.write(zeros[:n]); err != nil {
+			return err
+		}
+		remaining -= n
+	}
+	return nil
+}
+
+// flush 回填头部长度，使文件在录制中途也是合法 WAV
+func (w *wavWriter) flush() error {
+	_, err := w.f.WriteAt(encodeWAVHeader(w.dataBytes, SampleRate), 0)
+	return err
+}
+
+func (w *wavWriter) close() error {
+	err := w.flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// wavData 一个已打开的 WAV 文件的 PCM 数据区
+type wavData struct {
+	f          *os.File
+	sampleRate int
+	dataBytes  int64
+	data       io.Reader
+}
+
+// openWAV 打开 WAV 并定位到 data 块；data 只读到头部声明的长度为止，
+// 因此可以安全地读取仍在录制中的文件（调用前先 flush）。
+func openWAV(path string) (*wavData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := parseWAV(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	wd.f = f
+	return wd, nil
+}
+
+func parseWAV(r io.Reader) (*wavData, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWAV, err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("%w: not a RIFF/WAVE file", ErrInvalidWAV)
+	}
+
+	wd := &wavData{}
+	sawFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("%w: missing data chunk", ErrInvalidWAV)
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("%w: short fmt chunk", ErrInvalidWAV)
+			}
+			fmtChunk := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, fmtChunk); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidWAV, err)
+			}
+			format := binary.LittleEndian.Uint16(fmtChunk[0:2])
+			channels := binary.LittleEndian.Uint16(fmtChunk[2:4])
+			bits := binary.LittleEndian.Uint16(fmtChunk[14:16])
+			if format != 1 || channels != 1 || bits != 16 {
+				return nil, fmt.Errorf("%w: format=%d channels=%d bits=%d", ErrInvalidWAV, format, channels, bits)
+			}
+			wd.sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:8]))
+			sawFormat = true
+		case "data":
+			if !sawFormat {
+				return nil, fmt.Errorf("%w: data before fmt", ErrInvalidWAV)
+			}
+			wd.dataBytes = size
+			wd.data = io.LimitReader(r, size)
+			return wd, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidWAV, err)
+			}
+		}
+	}
+}
+
+func (w *wavData) samples() int64 {
+	return w.dataBytes / bytesPerSample
+}
+
+func (w *wavData) close() error {
+	if w.f == nil {
+		return nil
+	}
+	return w.f.Close()
+}
@@ -0,0 +1,75 @@
+package replay
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// inputMaxRunes 差异里用户输入最多显示的字数
+const inputMaxRunes = 40
+
+// WriteDiff 渲染可读的逐轮差异：先是汇总行，再列出有变化的轮次（all 为 true 时列出全部轮次）。
+//
+//	#3 seq 12 「那工资呢？」
+//	  role:    host → economist
+//	  beat:    explain → check
+func WriteDiff(w io.Writer, r *Report, all bool) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "session %s", r.SessionID)
+	if r.Director != "" {
+		fmt.Fprintf(&b, " · director %s", r.Director)
+	}
+	fmt.Fprintf(&b, " · %d turns, %d changed (role %d / beat %d / segment %d)\n",
+		r.Turns, r.ChangedTurns, r.RoleChanges, r.BeatChanges, r.SegmentChanges)
+
+	for _, t := range r.Details {
+		if !all && !t.Changed() {
+			continue
+		}
+		mark := "="
+		if t.Changed() {
+			mark = "#"
+		}
+		fmt.Fprintf(&b, "\n%s%d seq %d", mark, t.Index, t.Seq)
+		if t.Input != "" {
+			fmt.Fprintf(&b, " 「%s」", truncateRunes(strings.Join(strings.Fields(t.Input), " "), inputMaxRunes))
+		} else {
+			b.WriteString(" (opening)")
+		}
+		b.WriteString("\n")
+
+		writeField(&b, "role", strings.Join(t.Recorded.Roles, ","), strings.Join(t.Replayed.Roles, ","), t.RoleChanged)
+		writeField(&b, "beat", t.Recorded.Beat, t.Replayed.Beat, t.BeatChanged)
+		writeField(&b, "segment", t.Recorded.SegmentID, t.Replayed.SegmentID, t.SegmentChanged)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeField 有变化时显示 旧 → 新；没变化且有值时只显示当前值，两边都为空时不输出
+func writeField(b *strings.Builder, name, recorded, replayed string, changed bool) {
+	switch {
+	case changed:
+		fmt.Fprintf(b, "  %-8s %s → %s\n", name+":", orNone(recorded), orNone(replayed))
+	case recorded != "":
+		fmt.Fprintf(b, "  %-8s %s\n", name+":", recorded)
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
@@ -0,0 +1,173 @@
+// Package replay 离线回放：把录制会话的用户轮次重新喂给导演，逐轮对比新计划与录制的 director_plan。
+package replay
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"bubble-talk/server/internal/director"
+	"bubble-talk/server/internal/model"
+	"bubble-talk/server/internal/orchestrator"
+)
+
+// Plan 对比用的计划摘要：只保留角色、拍点、片段三个维度
+type Plan struct {
+	Roles     []string `json:"roles"`
+	Beat      string   `json:"beat,omitempty"`
+	SegmentID string   `json:"segment_id,omitempty"`
+}
+
+// Turn 一轮导演决策的对比结果
+type Turn struct {
+	// Index 第几次导演决策（从 1 开始）
+	Index int `json:"index"`
+	// Seq 录制的 director_plan 事件的 seq
+	Seq int64 `json:"seq"`
+	// Input 触发本轮决策的用户输入（开场决策为空）
+	Input    string `json:"input"`
+	Recorded Plan   `json:"recorded"`
+	Replayed Plan   `json:"replayed"`
+
+	RoleChanged    bool `json:"role_changed"`
+	BeatChanged    bool `json:"beat_changed"`
+	SegmentChanged bool `json:"segment_changed"`
+}
+
+// Changed 任一维度有变化
+func (t Turn) Changed() bool {
+	return t.RoleChanged || t.BeatChanged || t.SegmentChanged
+}
+
+// Report 一个会话的回放结果（即 JSON 摘要）
+type Report struct {
+	SessionID string `json:"session_id"`
+	// Director 回放所用导演的说明（如 beats / segment），由调用方填写
+	Director string `json:"director,omitempty"`
+
+	Turns          int `json:"turns"`
+	ChangedTurns   int `json:"changed_turns"`
+	RoleChanges    int `json:"role_changes"`
+	BeatChanges    int `json:"beat_changes"`
+	SegmentChanges int `json:"segment_changes"`
+
+	Details []Turn `json:"details"`
+}
+
+// Run 按 Timeline 顺序回放：事件照线上路径归约进 state，每遇到一条录制的 director_plan，
+// 就在同一时刻的 state 上让 d 重新决策，并与录制的计划对比。
+//
+// state 应是会话的初始快照（通常来自导出的 SessionState 或新建会话），回放过程中会被导演与归约改写。
+// 导演自己维护的状态（拍点、片段进度等）沿用新导演的决策，而不是录制时的，与分叉后的会话行为一致。
+func Run(ctx context.Context, d director.Director, state *model.SessionState, events []model.Event) *Report {
+	report := &Report{SessionID: state.SessionID}
+	// 输出时钟只按回放事件自身的时间计算
+	state.LastOutputAt = time.Time{}
+	state.OutputClockSec = 0
+
+	input := ""
+	for _, evt := range events {
+		switch {
+		case evt.Type == "director_plan" && evt.DirectorPlan != nil:
+			plan := director.DecideWithContext(ctx, d, state, input)
+			report.add(evt.Seq, input, Summarize(*evt.DirectorPlan), Summarize(plan))
+			input = ""
+		case evt.Type == "world_entered":
+			// 开场决策没有用户输入
+			input = ""
+		case isUserTurn(evt.Type):
+			input = evt.Text
+		}
+		orchestrator.ReplayEvent(state, evt)
+	}
+	return report
+}
+
+// InitialState 由会话快照（通常是会话结束时导出的）得到回放用的初始快照：
+// 只保留泡泡与角色等身份信息，其余字段取新建会话时的初始值（与 api 创建会话一致）。
+func InitialState(snapshot *model.SessionState) *model.SessionState {
+	return &model.SessionState{
+		SessionID:       snapshot.SessionID,
+		EntryID:         snapshot.EntryID,
+		Domain:          snapshot.Domain,
+		AvailableRoles:  snapshot.AvailableRoles,
+		MainObjective:   snapshot.MainObjective,
+		Overrides:       snapshot.Overrides,
+		Act:             1,
+		Beat:            "ColdOpen",
+		PacingMode:      "NORMAL",
+		MasteryEstimate: 0.2,
+		TensionLevel:    2,
+		CognitiveLoad:   2,
+		CreatedAt:       snapshot.CreatedAt,
+	}
+}
+
+func (r *Report) add(seq int64, input string, recorded, replayed Plan) {
+	t := Turn{
+		Index:          len(r.Details) + 1,
+		Seq:            seq,
+		Input:          input,
+		Recorded:       recorded,
+		Replayed:       replayed,
+		RoleChanged:    strings.Join(recorded.Roles, ",") != strings.Join(replayed.Roles, ","),
+		BeatChanged:    recorded.Beat != replayed.Beat,
+		SegmentChanged: recorded.SegmentID != replayed.SegmentID,
+	}
+	r.Turns++
+	if t.RoleChanged {
+		r.RoleChanges++
+	}
+	if t.BeatChanged {
+		r.BeatChanges++
+	}
+	if t.SegmentChanged {
+		r.SegmentChanges++
+	}
+	if t.Changed() {
+		r.ChangedTurns++
+	}
+	r.Details = append(r.Details, t)
+}
+
+// isUserTurn 会触发导演决策的用户输入事件
+func isUserTurn(eventType string) bool {
+	switch eventType {
+	case "user_utterance", "user_message", "asr_final":
+		return true
+	}
+	return false
+}
+
+// Summarize 提取计划的角色序列、拍点与片段。
+// 早期录制的计划没有 Beat/SegmentID 字段，从指令里的 "Beat: " / "Segment: " 行取。
+func Summarize(plan model.DirectorPlan) Plan {
+	p := Plan{Beat: plan.Beat, SegmentID: plan.SegmentID}
+	if len(plan.Scene) > 0 {
+		for _, beat := range plan.Scene {
+			p.Roles = append(p.Roles, beat.Role)
+		}
+	} else {
+		for _, role := range strings.Split(plan.NextRole, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				p.Roles = append(p.Roles, role)
+			}
+		}
+	}
+	if p.Beat == "" {
+		p.Beat = instructionField(plan.Instruction, "Beat: ")
+	}
+	if p.SegmentID == "" {
+		p.SegmentID = instructionField(plan.Instruction, "Segment: ")
+	}
+	return p
+}
+
+func instructionField(instruction, prefix string) string {
+	for _, line := range strings.Split(instruction, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, prefix))
+		}
+	}
+	return ""
+}
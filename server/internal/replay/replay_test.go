@@ -0,0 +1,82 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/model"
+)
+
+// scriptedDirector 测试桩：按调用顺序返回预设计划，并记下每次决策时看到的输入与轮次数
+type scriptedDirector struct {
+	plans  []model.DirectorPlan
+	inputs []string
+	turns  []int
+}
+
+func (d *scriptedDirector) Decide(state *model.SessionState, userInput string) model.DirectorPlan {
+	d.inputs = append(d.inputs, userInput)
+	d.turns = append(d.turns, len(state.Turns))
+	plan := d.plans[0]
+	d.plans = d.plans[1:]
+	return plan
+}
+
+// TestRunComparesReplayedPlansTurnByTurn 验证回放：每条录制的 director_plan 都在同一时刻的状态上重新决策，
+// 角色/拍点/片段逐项对比；早期录制的计划从指令里解析拍点。
+func TestRunComparesReplayedPlansTurnByTurn(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	events := []model.Event{
+		{Seq: 1, Type: "world_entered", ServerTS: ts},
+		{Seq: 2, Type: "director_plan", DirectorPlan: &model.DirectorPlan{NextRole: "host", Instruction: "State: 好奇\nBeat: hook\n"}},
+		{Seq: 3, Type: "assistant_text", Role: "host", Text: "欢迎！", ServerTS: ts.Add(time.Second)},
+		{Seq: 4, Type: "user_utterance", Text: "什么是通胀？", ServerTS: ts.Add(5 * time.Second)},
+		{Seq: 5, Type: "director_plan", DirectorPlan: &model.DirectorPlan{NextRole: "host,economist", Beat: "explain"}},
+		{Seq: 6, Type: "user_message", Text: "那工资呢？", ServerTS: ts.Add(20 * time.Second)},
+		{Seq: 7, Type: "director_plan", DirectorPlan: &model.DirectorPlan{
+			Scene:     []model.SceneBeat{{Role: "economist"}},
+			SegmentID: "seg_1",
+		}},
+	}
+	d := &scriptedDirector{plans: []model.DirectorPlan{
+		{NextRole: "host", Beat: "hook"},
+		{NextRole: "economist", Beat: "check"},
+		{NextRole: "economist", SegmentID: "seg_2"},
+	}}
+
+	report := Run(context.Background(), d, &model.SessionState{SessionID: "s1"}, events)
+
+	if strings.Join(d.inputs, "|") != "|什么是通胀？|那工资呢？" {
+		t.Fatalf("inputs = %q", d.inputs)
+	}
+	// 决策时用户发言已归约，后续的角色发言还没有
+	if d.turns[0] != 0 || d.turns[1] != 2 || d.turns[2] != 3 {
+		t.Fatalf("turns seen by director = %v", d.turns)
+	}
+	if report.Turns != 3 || report.ChangedTurns != 2 || report.RoleChanges != 1 || report.BeatChanges != 1 || report.SegmentChanges != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if first := report.Details[0]; first.Changed() || first.Recorded.Beat != "hook" {
+		t.Fatalf("opening turn = %+v", first)
+	}
+	if second := report.Details[1]; !second.RoleChanged || !second.BeatChanged || second.SegmentChanged || second.Seq != 5 {
+		t.Fatalf("second turn = %+v", second)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, report, false); err != nil {
+		t.Fatalf("write diff: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"3 turns, 2 changed", "#2 seq 5 「什么是通胀？」", "role:    host,economist → economist", "segment: seg_1 → seg_2"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("diff missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "#1 ") || strings.Contains(out, "=1 ") {
+		t.Fatalf("unchanged turn should be omitted:\n%s", out)
+	}
+}
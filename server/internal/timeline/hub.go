@@ -0,0 +1,274 @@
+package timeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"bubble-talk/server/internal/model"
+)
+
+// ErrSlowConsumer 订阅者消费跟不上、积压超过上限时订阅被关闭，Err() 返回该错误；
+// 会话订阅可从最后收到的 seq 重新 Subscribe 补齐。
+var ErrSlowConsumer = errors.New("timeline: subscriber too slow")
+
+// DefaultSubscriptionBuffer 每个订阅者允许积压的事件数
+const DefaultSubscriptionBuffer = 1024
+
+// Watcher 是 Store 的可选能力：订阅新写入的事件，替代轮询 List。
+type Watcher interface {
+	// Subscribe 订阅某个 session：先补发 seq > fromSeq 的历史事件，再按 seq 顺序推送新事件。
+	Subscribe(ctx context.Context, sessionID string, fromSeq int64) (*Subscription, error)
+	// SubscribeAll 订阅所有 session 的新事件（firehose），不补发历史。
+	SubscribeAll(ctx context.Context) (*Subscription, error)
+}
+
+// BacklogFunc 读取某个 session 的历史事件，Hub 在订阅登记之后调用，用于补发 fromSeq 之后的事件。
+type BacklogFunc func(ctx context.Context, sessionID string) ([]model.Event, error)
+
+// Hub 把写入的事件扇出给订阅者。
+// 存储实现在 Append 成功后调用 Publish；Publish 不阻塞，每个订阅者有独立的积压队列和投递协程，
+// 某个订阅者卡住只会让它自己因 ErrSlowConsumer 被关闭。
+type Hub struct {
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	buffer  int
+	backlog BacklogFunc
+}
+
+// NewHub 创建 Hub；backlog 为 nil 时会话订阅不补发历史，buffer <= 0 时使用 DefaultSubscriptionBuffer。
+func NewHub(backlog BacklogFunc, buffer int) *Hub {
+	if buffer <= 0 {
+		buffer = DefaultSubscriptionBuffer
+	}
+	return &Hub{
+		subs:    make(map[*Subscription]struct{}),
+		buffer:  buffer,
+		backlog: backlog,
+	}
+}
+
+// Publish 把已分配 seq 的事件投递给所有匹配的订阅者。
+// 约定：同一 session 的事件按 seq 顺序 Publish（InMemoryStore 在写锁内调用，WatchStore 串行化 Append）。
+func (h *Hub) Publish(evt model.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if sub.sessionID != "" && sub.sessionID != evt.SessionID {
+			continue
+		}
+		if !sub.enqueue(evt) {
+			delete(h.subs, sub)
+		}
+	}
+}
+
+// Subscribe 订阅某个 session，补发 seq > fromSeq 的历史事件后推送新事件。
+func (h *Hub) Subscribe(ctx context.Context, sessionID string, fromSeq int64) (*Subscription, error) {
+	if sessionID == "" {
+		return nil, errors.New("timeline: session id required")
+	}
+	return h.subscribe(ctx, sessionID, fromSeq), nil
+}
+
+// SubscribeAll 订阅所有 session 的新事件。
+func (h *Hub) SubscribeAll(ctx context.Context) (*Subscription, error) {
+	return h.subscribe(ctx, "", 0), nil
+}
+
+// Subscribers 返回当前订阅者数量（用于调试与测试）。
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+func (h *Hub) subscribe(ctx context.Context, sessionID string, fromSeq int64) *Subscription {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &Subscription{
+		sessionID: sessionID,
+		limit:     h.buffer,
+		out:       make(chan model.Event),
+		notify:    make(chan struct{}, 1),
+		cancel:    cancel,
+	}
+
+	// 先登记再读历史：两者之间写入的事件会同时出现在历史与队列里，投递时按 seq 去重
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		delete(h.subs, sub)
+		h.mu.Unlock()
+	}()
+	go sub.run(ctx, h.backlog, fromSeq)
+	return sub
+}
+
+// Subscription 一个订阅。Events() 在订阅结束（ctx 取消、Close 或消费过慢）后被关闭，之后 Err() 给出原因。
+type Subscription struct {
+	sessionID string
+	limit     int
+	out       chan model.Event
+	notify    chan struct{}
+	cancel    context.CancelFunc
+
+	mu      sync.Mutex
+	pending []model.Event
+	err     error
+}
+
+// Events 返回事件通道
+func (s *Subscription) Events() <-chan model.Event {
+	return s.out
+}
+
+// Err 返回订阅结束的原因：消费过慢为 ErrSlowConsumer，否则为 ctx 的错误；订阅仍在进行时为 nil。
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.cancel()
+}
+
+// enqueue 由 Publish 调用（持有 Hub 锁），积压超过上限时关闭订阅并返回 false
+func (s *Subscription) enqueue(evt model.Event) bool {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return false
+	}
+	if len(s.pending) >= s.limit {
+		s.err = ErrSlowConsumer
+		s.mu.Unlock()
+		s.cancel()
+		return false
+	}
+	s.pending = append(s.pending, evt)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (s *Subscription) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+}
+
+// run 投递协程：先补发历史，再搬运积压队列
+func (s *Subscription) run(ctx context.Context, backlog BacklogFunc, fromSeq int64) {
+	defer close(s.out)
+	defer s.cancel()
+
+	lastSeq := fromSeq
+	send := func(evt model.Event) bool {
+		// 会话订阅按 seq 去重（历史与队列可能重叠）；firehose 不补发历史，无需去重
+		if s.sessionID != "" {
+			if evt.Seq <= lastSeq {
+				return true
+			}
+			lastSeq = evt.Seq
+		}
+		select {
+		case s.out <- evt:
+			return true
+		case <-ctx.Done():
+			s.fail(ctx.Err())
+			return false
+		}
+	}
+
+	if s.sessionID != "" && backlog != nil {
+		events, err := backlog(ctx, s.sessionID)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		for _, evt := range events {
+			if !send(evt) {
+				return
+			}
+		}
+	}
+
+	for {
+		s.mu.Lock()
+		batch := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+
+		for _, evt := range batch {
+			if !send(evt) {
+				return
+			}
+		}
+
+		select {
+		case <-s.notify:
+		case <-ctx.Done():
+			s.fail(ctx.Err())
+			return
+		}
+	}
+}
+
+// WatchStore 给任意 Store（包括持久化实现）加上订阅能力：Append 成功后把事件发布到 Hub。
+// Append 被串行化以保证同一 session 的事件按 seq 顺序发布；幂等的重复写入会再发布一次，会话订阅按 seq 去重。
+type WatchStore struct {
+	Store
+	hub *Hub
+	mu  sync.Mutex
+}
+
+// NewWatchStore 包装一个 Store，历史补发走 inner.List
+func NewWatchStore(inner Store) *WatchStore {
+	return &WatchStore{
+		Store: inner,
+		hub:   NewHub(inner.List, 0),
+	}
+}
+
+// Append 写入 inner 后发布事件
+func (s *WatchStore) Append(ctx context.Context, sessionID string, evt *model.Event) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq, err := s.Store.Append(ctx, sessionID, evt)
+	if err != nil {
+		return 0, err
+	}
+	published := *evt
+	published.Seq = seq
+	published.SessionID = sessionID
+	s.hub.Publish(published)
+	return seq, nil
+}
+
+// Subscribe 见 Watcher
+func (s *WatchStore) Subscribe(ctx context.Context, sessionID string, fromSeq int64) (*Subscription, error) {
+	return s.hub.Subscribe(ctx, sessionID, fromSeq)
+}
+
+// SubscribeAll 见 Watcher
+func (s *WatchStore) SubscribeAll(ctx context.Context) (*Subscription, error) {
+	return s.hub.SubscribeAll(ctx)
+}
+
+// Query 透传给 inner（见 QueryEvents）
+func (s *WatchStore) Query(ctx context.Context, sessionID string, q Query) (Page, error) {
+	return QueryEvents(ctx, s.Store, sessionID, q)
+}
@@ -0,0 +1,109 @@
+package timeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/model"
+)
+
+func recvEvent(t *testing.T, sub *Subscription) model.Event {
+	t.Helper()
+	select {
+	case evt, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("subscription closed: %v", sub.Err())
+		}
+		return evt
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	return model.Event{}
+}
+
+// TestInMemoryStoreSubscribeReplaysFromSeq 验证 Subscribe 先补发 fromSeq 之后的历史，再推送新事件，且只收本 session 的事件。
+func TestInMemoryStoreSubscribeReplaysFromSeq(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, text := range []string{"a", "b", "c"} {
+		if _, err := store.Append(ctx, "s1", &model.Event{Type: "user_message", Text: text}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	sub, err := store.Subscribe(ctx, "s1", 1)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if _, err := store.Append(ctx, "s2", &model.Event{Type: "user_message", Text: "other"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if _, err := store.Append(ctx, "s1", &model.Event{Type: "user_message", Text: "d"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		evt := recvEvent(t, sub)
+		if evt.SessionID != "s1" || evt.Seq != int64(i+2) {
+			t.Fatalf("event %d = seq %d session %s", i, evt.Seq, evt.SessionID)
+		}
+		got = append(got, evt.Text)
+	}
+	if want := "b,c,d"; strings.Join(got, ",") != want {
+		t.Fatalf("texts = %s, want %s", strings.Join(got, ","), want)
+	}
+
+	sub.Close()
+	for range sub.Events() {
+	}
+	if !errors.Is(sub.Err(), context.Canceled) {
+		t.Fatalf("err after close = %v", sub.Err())
+	}
+}
+
+// TestHubSubscribeAllAndSlowConsumer 验证 firehose 跨 session 收事件，积压超过上限的订阅者被 ErrSlowConsumer 关闭且不影响其他订阅者。
+func TestHubSubscribeAllAndSlowConsumer(t *testing.T) {
+	store := NewWatchStore(NewInMemoryStore())
+	store.hub.buffer = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fast, _ := store.SubscribeAll(ctx)
+	slow, _ := store.SubscribeAll(ctx)
+
+	for i, sid := range []string{"s1", "s2", "s1", "s2", "s1"} {
+		if _, err := store.Append(ctx, sid, &model.Event{Type: "user_message"}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		evt := recvEvent(t, fast)
+		if evt.SessionID != sid {
+			t.Fatalf("firehose event %d session = %s, want %s", i, evt.SessionID, sid)
+		}
+	}
+
+	// slow 从未读取：投递协程最多持有 1 条，队列积压 2 条后第 4 条触发关闭
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-slow.Events():
+			if ok {
+				continue
+			}
+		case <-deadline:
+			t.Fatal("slow consumer not closed")
+		}
+		break
+	}
+	if !errors.Is(slow.Err(), ErrSlowConsumer) {
+		t.Fatalf("slow err = %v", slow.Err())
+	}
+	if n := store.hub.Subscribers(); n != 1 {
+		t.Fatalf("subscribers = %d, want 1", n)
+	}
+}
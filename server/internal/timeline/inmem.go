@@ -2,25 +2,29 @@ package timeline
 
 import (
 	"context"
+	"sort"
 	"sync"
 
 	"bubble-talk/server/internal/model"
 )
 
-// InMemoryStore 是一个基于内存的 Timeline 存储实现。
+// InMemoryStore 是一个基于内存的 Timeline 存储实现，同时实现 Watcher。
 type InMemoryStore struct {
 	mu       sync.RWMutex
 	events   map[string][]model.Event
 	seq      map[string]int64
 	eventIDs map[string]map[string]int64
+	hub      *Hub
 }
 
 func NewInMemoryStore() *InMemoryStore {
-	return &InMemoryStore{
+	s := &InMemoryStore{
 		events:   make(map[string][]model.Event),
 		seq:      make(map[string]int64),
 		eventIDs: make(map[string]map[string]int64),
 	}
+	s.hub = NewHub(s.List, 0)
+	return s
 }
 
 // Append 追加事件到 timeline，并为该 session 分配单调递增 seq。
@@ -52,6 +56,9 @@ func (s *InMemoryStore) Append(_ context.Context, sessionID string, evt *model.E
 		s.eventIDs[sessionID][evt.EventID] = seq
 	}
 
+	// 在写锁内发布，保证同一 session 按 seq 顺序投递（Publish 不阻塞）
+	s.hub.Publish(eventCopy)
+
 	return seq, nil
 }
 
@@ -66,3 +73,43 @@ func (s *InMemoryStore) List(_ context.Context, sessionID string) ([]model.Event
 	copy(out, events)
 	return out, nil
 }
+
+// Subscribe 订阅某个 session 的事件，先补发 seq > fromSeq 的历史。
+func (s *InMemoryStore) Subscribe(ctx context.Context, sessionID string, fromSeq int64) (*Subscription, error) {
+	return s.hub.Subscribe(ctx, sessionID, fromSeq)
+}
+
+// SubscribeAll 订阅所有 session 的新事件。
+func (s *InMemoryStore) SubscribeAll(ctx context.Context) (*Subscription, error) {
+	return s.hub.SubscribeAll(ctx)
+}
+
+// Query 在读锁内按 seq 区间/游标先截取窗口（事件按 seq 升序存放），再做其余过滤与分页。
+func (s *InMemoryStore) Query(_ context.Context, sessionID string, q Query) (Page, error) {
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := s.events[sessionID]
+	lo, hi := q.FromSeq, q.ToSeq
+	if after > 0 {
+		if q.Reverse && (hi <= 0 || after-1 < hi) {
+			hi = after - 1
+		} else if !q.Reverse && after+1 > lo {
+			lo = after + 1
+		}
+	}
+	start := sort.Search(len(events), func(i int) bool { return events[i].Seq >= lo })
+	end := len(events)
+	if hi > 0 {
+		end = sort.Search(len(events), func(i int) bool { return events[i].Seq > hi })
+	}
+	if start >= end {
+		return Page{Events: []model.Event{}}, nil
+	}
+	return q.Apply(events[start:end])
+}
@@ -0,0 +1,130 @@
+package timeline
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"bubble-talk/server/internal/model"
+)
+
+// ErrInvalidCursor 游标无法解析
+var ErrInvalidCursor = errors.New("timeline: invalid cursor")
+
+// Query 描述一次分页/过滤查询，零值字段表示不限制。
+type Query struct {
+	// FromSeq/ToSeq seq 闭区间
+	FromSeq int64
+	ToSeq   int64
+	// Since/Until ServerTS 闭区间
+	Since time.Time
+	Until time.Time
+	// Types 只返回这些类型的事件
+	Types []string
+	// TurnID 只返回该轮次的事件
+	TurnID string
+	// Limit 每页最多条数，<= 0 表示不分页
+	Limit int
+	// Cursor 上一页返回的 NextCursor
+	Cursor string
+	// Reverse 按 seq 倒序（最新的在前）
+	Reverse bool
+}
+
+// Page 一页查询结果；NextCursor 为空表示没有更多。
+type Page struct {
+	Events     []model.Event `json:"events"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// Querier 是 Store 的可选能力：在存储侧完成过滤与分页。未实现时 QueryEvents 退化为 List + 内存过滤。
+type Querier interface {
+	Query(ctx context.Context, sessionID string, q Query) (Page, error)
+}
+
+// QueryEvents 按 q 查询某个 session 的事件
+func QueryEvents(ctx context.Context, store Store, sessionID string, q Query) (Page, error) {
+	if querier, ok := store.(Querier); ok {
+		return querier.Query(ctx, sessionID, q)
+	}
+	events, err := store.List(ctx, sessionID)
+	if err != nil {
+		return Page{}, err
+	}
+	return q.Apply(events)
+}
+
+// Apply 对按 seq 升序排列的事件执行过滤与分页，不修改入参。
+func (q Query) Apply(events []model.Event) (Page, error) {
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	types := make(map[string]bool, len(q.Types))
+	for _, t := range q.Types {
+		types[t] = true
+	}
+
+	page := Page{Events: []model.Event{}}
+	for i := range events {
+		idx := i
+		if q.Reverse {
+			idx = len(events) - 1 - i
+		}
+		evt := events[idx]
+
+		if after > 0 && ((!q.Reverse && evt.Seq <= after) || (q.Reverse && evt.Seq >= after)) {
+			continue
+		}
+		if !q.matches(evt, types) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Events) == q.Limit {
+			// 还有下一条匹配的事件才给游标
+			page.NextCursor = encodeCursor(page.Events[len(page.Events)-1].Seq)
+			break
+		}
+		page.Events = append(page.Events, evt)
+	}
+	return page, nil
+}
+
+func (q Query) matches(evt model.Event, types map[string]bool) bool {
+	if q.FromSeq > 0 && evt.Seq < q.FromSeq {
+		return false
+	}
+	if q.ToSeq > 0 && evt.Seq > q.ToSeq {
+		return false
+	}
+	if !q.Since.IsZero() && evt.ServerTS.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && evt.ServerTS.After(q.Until) {
+		return false
+	}
+	if len(types) > 0 && !types[evt.Type] {
+		return false
+	}
+	if q.TurnID != "" && evt.TurnID != q.TurnID {
+		return false
+	}
+	return true
+}
+
+// 游标是上一页最后一条事件的 seq；对调用方不透明，持久化实现可换成自己的格式
+func encodeCursor(seq int64) string {
+	return strconv.FormatInt(seq, 10)
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || seq <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return seq, nil
+}
@@ -0,0 +1,91 @@
+package timeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bubble-talk/server/internal/model"
+)
+
+func seqs(events []model.Event) []int64 {
+	out := make([]int64, 0, len(events))
+	for _, evt := range events {
+		out = append(out, evt.Seq)
+	}
+	return out
+}
+
+func equalSeqs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestQueryFiltersAndPaginates 验证 InMemoryStore.Query 与通用 Apply（List 回退）给出相同的过滤与分页结果。
+func TestQueryFiltersAndPaginates(t *testing.T) {
+	store := NewInMemoryStore()
+	ctx := context.Background()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// seq 1..10：奇数为 user_message，偶数为 assistant_text；turn 每两条换一个
+	for i := 1; i <= 10; i++ {
+		typ := "user_message"
+		if i%2 == 0 {
+			typ = "assistant_text"
+		}
+		evt := &model.Event{Type: typ, TurnID: []string{"t1", "t2", "t3", "t4", "t5"}[(i-1)/2], ServerTS: base.Add(time.Duration(i) * time.Minute)}
+		if _, err := store.Append(ctx, "s1", evt); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	cases := []struct {
+		name  string
+		query Query
+		pages [][]int64
+	}{
+		{"all", Query{}, [][]int64{{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}},
+		{"seq range paged", Query{FromSeq: 3, ToSeq: 8, Limit: 4}, [][]int64{{3, 4, 5, 6}, {7, 8}}},
+		{"type reverse paged", Query{Types: []string{"assistant_text"}, Limit: 2, Reverse: true}, [][]int64{{10, 8}, {6, 4}, {2}}},
+		{"time and turn", Query{Since: base.Add(3 * time.Minute), Until: base.Add(6 * time.Minute), TurnID: "t3"}, [][]int64{{5, 6}}},
+		{"exact page boundary", Query{ToSeq: 4, Limit: 2}, [][]int64{{1, 2}, {3, 4}}},
+	}
+
+	all, _ := store.List(ctx, "s1")
+	for _, c := range cases {
+		for _, name := range []string{"store", "fallback"} {
+			q := c.query
+			for i, want := range c.pages {
+				var page Page
+				var err error
+				if name == "store" {
+					page, err = store.Query(ctx, "s1", q)
+				} else {
+					page, err = q.Apply(all)
+				}
+				if err != nil {
+					t.Fatalf("%s/%s: %v", c.name, name, err)
+				}
+				if got := seqs(page.Events); !equalSeqs(got, want) {
+					t.Fatalf("%s/%s page %d = %v, want %v", c.name, name, i, got, want)
+				}
+				last := i == len(c.pages)-1
+				if last != (page.NextCursor == "") {
+					t.Fatalf("%s/%s page %d next cursor = %q", c.name, name, i, page.NextCursor)
+				}
+				q.Cursor = page.NextCursor
+			}
+		}
+	}
+
+	if _, err := store.Query(ctx, "s1", Query{Cursor: "bogus"}); err != ErrInvalidCursor {
+		t.Fatalf("bogus cursor err = %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package usage
+
+import (
+	"bubble-talk/server/internal/llm"
+	"bubble-talk/server/internal/model"
+)
+
+// 用量来源
+const (
+	SourceLLM      = "llm"
+	SourceRealtime = "realtime"
+)
+
+// FromLLM 把 llm.Usage 转成可落 Timeline 的用量记录。
+func FromLLM(u llm.Usage) *model.UsageRecord {
+	return &model.UsageRecord{
+		Source:           SourceLLM,
+		Provider:         u.Provider,
+		Model:            u.Model,
+		Schema:           u.Schema,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		CachedTokens:     u.CachedTokens,
+		LatencyMS:        u.Latency.Milliseconds(),
+	}
+}
@@ -0,0 +1,282 @@
+package usage
+
+import (
+	"strings"
+	"sync"
+
+	"bubble-talk/server/internal/config"
+	"bubble-talk/server/internal/model"
+)
+
+// Totals 用量累计值。
+type Totals struct {
+	Calls                 int     `json:"calls"`
+	PromptTokens          int     `json:"prompt_tokens"`
+	CompletionTokens      int     `json:"completion_tokens"`
+	CachedTokens          int     `json:"cached_tokens"`
+	AudioPromptTokens     int     `json:"audio_prompt_tokens"`
+	AudioCompletionTokens int     `json:"audio_completion_tokens"`
+	TotalTokens           int     `json:"total_tokens"`
+	LatencyMS             int64   `json:"latency_ms"`
+	CostUSD               float64 `json:"cost_usd"`
+}
+
+func (t *Totals) add(rec *model.UsageRecord) {
+	t.Calls++
+	t.PromptTokens += rec.PromptTokens
+	t.CompletionTokens += rec.CompletionTokens
+	t.CachedTokens += rec.CachedTokens
+	t.AudioPromptTokens += rec.AudioPromptTokens
+	t.AudioCompletionTokens += rec.AudioCompletionTokens
+	t.TotalTokens += rec.PromptTokens + rec.CompletionTokens
+	t.LatencyMS += rec.LatencyMS
+	t.CostUSD += rec.CostUSD
+}
+
+// Summary 一个会话或一个泡泡的用量汇总。
+type Summary struct {
+	Totals
+	// BySource llm / realtime
+	BySource map[string]Totals `json:"by_source"`
+	// ByRole 仅 Realtime 用量（每个角色一条连接）
+	ByRole map[string]Totals `json:"by_role,omitempty"`
+	// BySchema 仅 LLM 用量（导演每种调用各自的开销）
+	BySchema map[string]Totals `json:"by_schema,omitempty"`
+	// Sessions 仅泡泡汇总：统计到的会话数
+	Sessions int `json:"sessions,omitempty"`
+}
+
+func newSummary() *Summary {
+	return &Summary{
+		BySource: make(map[string]Totals),
+		ByRole:   make(map[string]Totals),
+		BySchema: make(map[string]Totals),
+	}
+}
+
+func (s *Summary) add(rec *model.UsageRecord) {
+	s.Totals.add(rec)
+	addTo(s.BySource, rec.Source, rec)
+	if rec.Role != "" {
+		addTo(s.ByRole, rec.Role, rec)
+	}
+	if rec.Schema != "" {
+		addTo(s.BySchema, rec.Schema, rec)
+	}
+}
+
+func (s *Summary) clone() Summary {
+	out := *s
+	out.BySource = cloneTotals(s.BySource)
+	out.ByRole = cloneTotals(s.ByRole)
+	out.BySchema = cloneTotals(s.BySchema)
+	return out
+}
+
+func addTo(m map[string]Totals, key string, rec *model.UsageRecord) {
+	t := m[key]
+	t.add(rec)
+	m[key] = t
+}
+
+func cloneTotals(m map[string]Totals) map[string]Totals {
+	out := make(map[string]Totals, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+type sessionUsage struct {
+	entryID  string
+	summary  *Summary
+	exceeded bool
+}
+
+// Tracker 按会话、按泡泡累计用量，并按配置折算费用、判断预算。
+//
+// 契约：
+// - 只做内存聚合；事实以 Timeline 的 usage 事件为准，重启后可用 Restore 重建。
+// - Record 会就地补齐 rec.CostUSD，调用方随后把 rec 写入 Timeline 即可。
+type Tracker struct {
+	mu       sync.Mutex
+	budget   config.UsageBudgetConfig
+	pricing  map[string]config.ModelPricing
+	sessions map[string]*sessionUsage
+	bubbles  map[string]*Summary
+}
+
+// NewTracker 创建用量跟踪器
+func NewTracker(cfg config.UsageConfig) *Tracker {
+	return &Tracker{
+		budget:   cfg.Budget,
+		pricing:  cfg.Pricing,
+		sessions: make(map[string]*sessionUsage),
+		bubbles:  make(map[string]*Summary),
+	}
+}
+
+// Record 记录一次用量，返回该会话是否已超出预算。
+func (t *Tracker) Record(sessionID, entryID string, rec *model.UsageRecord) bool {
+	if rec == nil {
+		return t.Exceeded(sessionID)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rec.CostUSD = t.cost(rec)
+	return t.apply(sessionID, entryID, rec)
+}
+
+// Restore 用 Timeline 中的 usage 事件重建某个会话的累计值（已重建过则忽略）。
+func (t *Tracker) Restore(sessionID, entryID string, events []model.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.sessions[sessionID]; ok {
+		return
+	}
+	t.session(sessionID, entryID)
+	for i := range events {
+		if events[i].Usage != nil {
+			t.apply(sessionID, entryID, events[i].Usage)
+		}
+	}
+}
+
+// Session 返回会话的用量汇总。
+func (t *Tracker) Session(sessionID string) (Summary, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	su, ok := t.sessions[sessionID]
+	if !ok {
+		return Summary{}, false
+	}
+	return su.summary.clone(), true
+}
+
+// Bubble 返回泡泡（entry_id）下所有会话的用量汇总。
+func (t *Tracker) Bubble(entryID string) Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.bubbles[entryID]
+	if !ok {
+		return newSummary().clone()
+	}
+	return s.clone()
+}
+
+// Exceeded 会话是否已超出预算。
+func (t *Tracker) Exceeded(sessionID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	su, ok := t.sessions[sessionID]
+	return ok && su.exceeded
+}
+
+// Budget 返回预算配置
+func (t *Tracker) Budget() config.UsageBudgetConfig {
+	return t.budget
+}
+
+func (t *Tracker) session(sessionID, entryID string) *sessionUsage {
+	su, ok := t.sessions[sessionID]
+	if !ok {
+		su = &sessionUsage{entryID: entryID, summary: newSummary()}
+		t.sessions[sessionID] = su
+		if entryID != "" {
+			t.bubble(entryID).Sessions++
+		}
+	}
+	return su
+}
+
+func (t *Tracker) bubble(entryID string) *Summary {
+	s, ok := t.bubbles[entryID]
+	if !ok {
+		s = newSummary()
+		t.bubbles[entryID] = s
+	}
+	return s
+}
+
+func (t *Tracker) apply(sessionID, entryID string, rec *model.UsageRecord) bool {
+	su := t.session(sessionID, entryID)
+	su.summary.add(rec)
+	if su.entryID != "" {
+		t.bubble(su.entryID).add(rec)
+	}
+
+	if !su.exceeded && t.overBudget(su.summary) {
+		su.exceeded = true
+	}
+	return su.exceeded
+}
+
+func (t *Tracker) overBudget(s *Summary) bool {
+	if t.budget.MaxSessionTokens > 0 && s.TotalTokens >= t.budget.MaxSessionTokens {
+		return true
+	}
+	if t.budget.MaxSessionCostUSD > 0 && s.CostUSD >= t.budget.MaxSessionCostUSD {
+		return true
+	}
+	return false
+}
+
+// cost 按价目折算费用。缓存与音频 token 已包含在总数中，这里拆开分别计价。
+func (t *Tracker) cost(rec *model.UsageRecord) float64 {
+	price, ok := t.lookupPricing(rec.Model)
+	if !ok {
+		return 0
+	}
+
+	audioInPrice := price.AudioInputPerMTok
+	if audioInPrice == 0 {
+		audioInPrice = price.InputPerMTok
+	}
+	audioOutPrice := price.AudioOutputPerMTok
+	if audioOutPrice == 0 {
+		audioOutPrice = price.OutputPerMTok
+	}
+	cachedPrice := price.CachedInputPerMTok
+	if cachedPrice == 0 {
+		cachedPrice = price.InputPerMTok
+	}
+
+	textIn := rec.PromptTokens - rec.CachedTokens - rec.AudioPromptTokens
+	if textIn < 0 {
+		textIn = 0
+	}
+	textOut := rec.CompletionTokens - rec.AudioCompletionTokens
+	if textOut < 0 {
+		textOut = 0
+	}
+
+	total := float64(textIn)*price.InputPerMTok +
+		float64(rec.CachedTokens)*cachedPrice +
+		float64(rec.AudioPromptTokens)*audioInPrice +
+		float64(textOut)*price.OutputPerMTok +
+		float64(rec.AudioCompletionTokens)*audioOutPrice
+	return total / 1e6
+}
+
+// lookupPricing 先精确匹配模型名，再按最长前缀匹配（gpt-realtime 覆盖 gpt-realtime-2025-08-28 等快照版本）。
+func (t *Tracker) lookupPricing(modelName string) (config.ModelPricing, bool) {
+	if p, ok := t.pricing[modelName]; ok {
+		return p, true
+	}
+	var (
+		best    config.ModelPricing
+		bestLen int
+	)
+	for name, p := range t.pricing {
+		if len(name) > bestLen && strings.HasPrefix(modelName, name) {
+			best, bestLen = p, len(name)
+		}
+	}
+	return best, bestLen > 0
+}
@@ -0,0 +1,130 @@
+package usage
+
+import (
+	"math"
+	"testing"
+
+	"bubble-talk/server/internal/config"
+	"bubble-talk/server/internal/model"
+)
+
+func newTestTracker(budget config.UsageBudgetConfig) *Tracker {
+	return NewTracker(config.UsageConfig{
+		Budget: budget,
+		Pricing: map[string]config.ModelPricing{
+			"gpt-realtime": {
+				InputPerMTok:       4,
+				CachedInputPerMTok: 0.4,
+				OutputPerMTok:      16,
+				AudioInputPerMTok:  32,
+				AudioOutputPerMTok: 64,
+			},
+			"gpt-4o-mini": {InputPerMTok: 0.15, OutputPerMTok: 0.6},
+		},
+	})
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// TestTracker_CostUsesPrefixPricingAndSplitsAudio 验证快照模型名按前缀命中价目，且缓存/音频 token 分开计价。
+func TestTracker_CostUsesPrefixPricingAndSplitsAudio(t *testing.T) {
+	tr := newTestTracker(config.UsageBudgetConfig{})
+
+	rec := &model.UsageRecord{
+		Source:                SourceRealtime,
+		Model:                 "gpt-realtime-2025-08-28",
+		Role:                  "host",
+		PromptTokens:          1000,
+		CachedTokens:          200,
+		AudioPromptTokens:     300,
+		CompletionTokens:      500,
+		AudioCompletionTokens: 400,
+	}
+	tr.Record("s1", "entry", rec)
+
+	// 文本输入 500*4 + 缓存 200*0.4 + 音频输入 300*32 + 文本输出 100*16 + 音频输出 400*64
+	want := (500*4 + 200*0.4 + 300*32 + 100*16 + 400*64) / 1e6
+	if !almostEqual(rec.CostUSD, want) {
+		t.Fatalf("expected cost %v, got %v", want, rec.CostUSD)
+	}
+
+	unknown := &model.UsageRecord{Source: SourceLLM, Model: "mystery", PromptTokens: 10}
+	tr.Record("s1", "entry", unknown)
+	if unknown.CostUSD != 0 {
+		t.Fatalf("expected zero cost for unpriced model, got %v", unknown.CostUSD)
+	}
+}
+
+// TestTracker_AggregatesPerSessionAndBubble 验证按会话、按泡泡、按来源/角色/schema 的聚合。
+func TestTracker_AggregatesPerSessionAndBubble(t *testing.T) {
+	tr := newTestTracker(config.UsageBudgetConfig{})
+
+	tr.Record("s1", "entry", &model.UsageRecord{Source: SourceLLM, Model: "gpt-4o-mini", Schema: "segment_plan", PromptTokens: 100, CompletionTokens: 20})
+	tr.Record("s1", "entry", &model.UsageRecord{Source: SourceRealtime, Model: "gpt-realtime", Role: "host", PromptTokens: 50, CompletionTokens: 50})
+	tr.Record("s2", "entry", &model.UsageRecord{Source: SourceLLM, Model: "gpt-4o-mini", Schema: "segment_plan", PromptTokens: 10, CompletionTokens: 10})
+
+	s1, ok := tr.Session("s1")
+	if !ok {
+		t.Fatal("expected session summary")
+	}
+	if s1.Calls != 2 || s1.TotalTokens != 220 {
+		t.Fatalf("unexpected session totals: %+v", s1.Totals)
+	}
+	if s1.BySource[SourceLLM].Calls != 1 || s1.ByRole["host"].TotalTokens != 100 || s1.BySchema["segment_plan"].PromptTokens != 100 {
+		t.Fatalf("unexpected breakdown: %+v", s1)
+	}
+
+	bubble := tr.Bubble("entry")
+	if bubble.Sessions != 2 || bubble.TotalTokens != 240 {
+		t.Fatalf("unexpected bubble summary: sessions=%d totals=%+v", bubble.Sessions, bubble.Totals)
+	}
+
+	// 返回的是副本，外部修改不影响内部累计
+	s1.BySource[SourceLLM] = Totals{}
+	again, _ := tr.Session("s1")
+	if again.BySource[SourceLLM].Calls != 1 {
+		t.Fatal("summary must be a copy")
+	}
+}
+
+// TestTracker_Budget 验证 token 与费用预算任一超出即判定超限。
+func TestTracker_Budget(t *testing.T) {
+	tr := newTestTracker(config.UsageBudgetConfig{MaxSessionTokens: 150})
+
+	if tr.Record("s1", "entry", &model.UsageRecord{Source: SourceLLM, PromptTokens: 100}) {
+		t.Fatal("should not exceed budget yet")
+	}
+	if !tr.Record("s1", "entry", &model.UsageRecord{Source: SourceLLM, PromptTokens: 60}) {
+		t.Fatal("expected budget exceeded")
+	}
+	if !tr.Exceeded("s1") || tr.Exceeded("s2") {
+		t.Fatal("budget flag should be per session")
+	}
+
+	costTracker := newTestTracker(config.UsageBudgetConfig{MaxSessionCostUSD: 0.001})
+	if !costTracker.Record("s1", "entry", &model.UsageRecord{Source: SourceRealtime, Model: "gpt-realtime", CompletionTokens: 100}) {
+		t.Fatal("expected cost budget exceeded")
+	}
+}
+
+// TestTracker_RestoreFromTimeline 验证可从 Timeline 的 usage 事件重建累计值。
+func TestTracker_RestoreFromTimeline(t *testing.T) {
+	tr := newTestTracker(config.UsageBudgetConfig{MaxSessionTokens: 100})
+
+	events := []model.Event{
+		{Type: "user_utterance", Text: "hi"},
+		{Type: "usage", Usage: &model.UsageRecord{Source: SourceLLM, PromptTokens: 80, CompletionTokens: 30, CostUSD: 0.5}},
+	}
+	tr.Restore("s1", "entry", events)
+	tr.Restore("s1", "entry", events) // 重复调用不应重复累计
+
+	s, ok := tr.Session("s1")
+	if !ok || s.Calls != 1 || s.TotalTokens != 110 || s.CostUSD != 0.5 {
+		t.Fatalf("unexpected restored summary: %+v", s)
+	}
+	if !tr.Exceeded("s1") {
+		t.Fatal("expected restored session to be over budget")
+	}
+}
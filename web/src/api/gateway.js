@@ -3,6 +3,41 @@
  * 适配新的后端 WebSocket 流式接口
  */
 
+// 协议 v2：二进制帧带 16 字节头（version, kind, codec, role_len, stream_id, seq）+ role + payload，
+// 布局与服务端 gateway/protocol.go 一致。
+const SUBPROTOCOL_V2 = 'bubbletalk.v2';
+const FRAME_HEADER_SIZE = 16;
+const CODEC_PCM16 = 1;
+
+function encodeAudioFrame(payload, { streamId = 0, seq = 0, codec = CODEC_PCM16 } = {}) {
+  const frame = new Uint8Array(FRAME_HEADER_SIZE + payload.byteLength);
+  const view = new DataView(frame.buffer);
+  view.setUint8(0, 2);
+  view.setUint8(1, 1);
+  view.setUint8(2, codec);
+  view.setUint8(3, 0);
+  view.setUint32(4, streamId);
+  view.setBigUint64(8, BigInt(seq));
+  frame.set(new Uint8Array(payload), FRAME_HEADER_SIZE);
+  return frame.buffer;
+}
+
+function decodeAudioFrame(buffer) {
+  const view = new DataView(buffer);
+  if (buffer.byteLength < FRAME_HEADER_SIZE || view.getUint8(0) !== 2 || view.getUint8(1) !== 1) {
+    return null;
+  }
+  const roleLen = view.getUint8(3);
+  const roleBytes = new Uint8Array(buffer, FRAME_HEADER_SIZE, roleLen);
+  return {
+    codec: view.getUint8(2),
+    streamId: view.getUint32(4),
+    seq: Number(view.getBigUint64(8)),
+    role: new TextDecoder().decode(roleBytes),
+    payload: buffer.slice(FRAME_HEADER_SIZE + roleLen),
+  };
+}
+
 export class BubbleTalkGateway {
   constructor(sessionId) {
     this.sessionId = sessionId;
@@ -26,37 +61,78 @@ export class BubbleTalkGateway {
     this.onDisconnected = null; // 断开连接
     this.onSpeechStarted = null; // VAD 说话开始
     this.onSpeechStopped = null; // VAD 说话结束
+    this.onReconnecting = null; // 断线，正在续传重连（attempt）
+    this.onReconnected = null;  // 续传成功（缺失消息已补发）
+    this.onResync = null;       // 缺口过大，服务端下发 Timeline 快照（replay 数组）
+
+    // 断线续传：服务端在 stream_ready 中下发 resume_token，重连时带上最后收到的 seq
+    this.resumeToken = null;
+    this.lastSeq = 0;
+    this.closedByUser = false;
+    this.reconnectAttempts = 0;
+    this.maxReconnectAttempts = 5;
+    this._reconnectTimer = null;
+
+    // 协议版本（stream_ready 下发协商结果）；v2 下按 stream_id 丢弃被打断的音频流
+    this.protocol = 1;
+    this.uplinkSeq = 0;
+    this.activeStreamId = 0;
+    this.droppedStreams = new Set();
   }
 
   /**
    * 连接到 WebSocket
    */
   async connect() {
+    this.closedByUser = false;
+    return this._open(false);
+  }
+
+  _streamUrl(resume) {
+    const base = `ws://localhost:8080/api/sessions/${this.sessionId}/stream`;
+    if (!resume || !this.resumeToken) return base;
+    const params = new URLSearchParams({
+      resume_token: this.resumeToken,
+      last_seq: String(this.lastSeq),
+    });
+    return `${base}?${params}`;
+  }
+
+  _open(resume) {
     return new Promise((resolve, reject) => {
-      const wsUrl = `ws://localhost:8080/api/sessions/${this.sessionId}/stream`;
+      const wsUrl = this._streamUrl(resume);
       console.log('[Gateway] Connecting to:', wsUrl);
 
-      this.ws = new WebSocket(wsUrl);
+      const ws = new WebSocket(wsUrl, [SUBPROTOCOL_V2]);
+      ws.binaryType = 'arraybuffer';
+      this.ws = ws;
 
-      this.ws.onopen = () => {
-        console.log('[Gateway] ✅ WebSocket connected');
-        if (this.onConnected) this.onConnected();
+      ws.onopen = () => {
+        this.protocol = ws.protocol === SUBPROTOCOL_V2 ? 2 : 1;
+        console.log('[Gateway] ✅ WebSocket connected, protocol v' + this.protocol);
+        // 续传连接以 stream_resumed 为准（onReconnected），不重复触发开场逻辑
+        if (!resume && this.onConnected) this.onConnected();
         resolve();
       };
 
-      this.ws.onerror = (error) => {
+      ws.onerror = (error) => {
         console.error('[Gateway] ❌ WebSocket error:', error);
-        if (this.onError) this.onError(error);
+        if (!resume && this.onError) this.onError(error);
         reject(error);
       };
 
-      this.ws.onclose = (event) => {
+      ws.onclose = (event) => {
         console.log('[Gateway] WebSocket closed:', event.code, event.reason);
+        if (this.ws !== ws) return;
+        if (!this.closedByUser && this.resumeToken && this.reconnectAttempts < this.maxReconnectAttempts) {
+          this._scheduleReconnect();
+          return;
+        }
         if (this.onDisconnected) this.onDisconnected(event);
       };
 
       this.ws.onmessage = (event) => {
-        if (event.data instanceof Blob) {
+        if (event.data instanceof ArrayBuffer) {
           // Binary frame - 音频数据
           this._handleAudioData(event.data);
         } else {
@@ -75,7 +151,27 @@ export class BubbleTalkGateway {
       const message = JSON.parse(data);
       console.log('[Gateway] Event received:', message.type);
 
+      // 续传补发可能与断线前收到的消息重叠，按 seq 去重
+      if (message.seq) {
+        if (message.seq <= this.lastSeq) return;
+        this.lastSeq = message.seq;
+      }
+
       switch (message.type) {
+        case 'stream_ready':
+          this.resumeToken = message.resume_token;
+          this.protocol = message.protocol || this.protocol;
+          break;
+        case 'stream_resumed':
+          this.resumeToken = message.resume_token || this.resumeToken;
+          this.reconnectAttempts = 0;
+          console.log('[Gateway] ✅ Stream resumed:', message.metadata);
+          if (this.onReconnected) this.onReconnected(message.metadata);
+          break;
+        case 'resync':
+          console.log('[Gateway] Resync from timeline:', (message.replay || []).length, 'messages');
+          if (this.onResync) this.onResync(message.replay || []);
+          break;
         case 'asr_partial':
           if (this.onASRPartial) this.onASRPartial(message.text);
           break;
@@ -83,12 +179,15 @@ export class BubbleTalkGateway {
           if (this.onASRFinal) this.onASRFinal(message.text);
           break;
         case 'tts_started':
+          this.activeStreamId = message.stream_id || 0;
           if (this.onTTSStarted) this.onTTSStarted(message.metadata);
           break;
         case 'tts_completed':
           if (this.onTTSCompleted) this.onTTSCompleted(message.metadata);
           break;
         case 'tts_interrupted':
+          // 被打断的流里仍在路上的音频帧直接丢弃
+          if (this.activeStreamId) this.droppedStreams.add(this.activeStreamId);
           if (this.onTTSInterrupted) this.onTTSInterrupted(message.metadata);
           break;
         case 'assistant_text':
@@ -119,14 +218,53 @@ export class BubbleTalkGateway {
     }
   }
 
+  /**
+   * 断线后按指数退避重连（带 resume_token 续传）
+   */
+  _scheduleReconnect() {
+    this.reconnectAttempts += 1;
+    const delay = Math.min(500 * 2 ** (this.reconnectAttempts - 1), 8000);
+    console.log(`[Gateway] Reconnecting in ${delay}ms (attempt ${this.reconnectAttempts})`);
+    if (this.onReconnecting) this.onReconnecting(this.reconnectAttempts);
+
+    clearTimeout(this._reconnectTimer);
+    this._reconnectTimer = setTimeout(() => {
+      if (this.closedByUser) return;
+      this._open(true).catch(() => {
+        // 失败由 onclose 继续调度
+      });
+    }, delay);
+  }
+
   /**
    * 处理音频数据
    */
-  async _handleAudioData(blob) {
-    console.log('[Gateway] Audio data received:', blob.size, 'bytes');
+  async _handleAudioData(buffer) {
+    let payload = buffer;
+    let frame = null;
+    if (this.protocol === 2) {
+      frame = decodeAudioFrame(buffer);
+      if (!frame) {
+        console.warn('[Gateway] Invalid audio frame dropped');
+        return;
+      }
+      if (this.droppedStreams.has(frame.streamId)) {
+        return;
+      }
+      payload = frame.payload;
+    }
+    console.log('[Gateway] Audio data received:', payload.byteLength, 'bytes');
     if (this.onAudioData) {
-      this.onAudioData(blob);
+      this.onAudioData(new Blob([payload]), frame);
+    }
+  }
+
+  _sendAudio(buffer) {
+    if (this.protocol === 2) {
+      this.ws.send(encodeAudioFrame(buffer, { seq: this.uplinkSeq++ }));
+      return;
     }
+    this.ws.send(buffer);
   }
 
   /**
@@ -250,7 +388,7 @@ export class BubbleTalkGateway {
       return;
     }
     if (!this.minChunkSamples) {
-      this.ws.send(pcm16.buffer);
+      this._sendAudio(pcm16.buffer);
       return;
     }
 
@@ -275,7 +413,7 @@ export class BubbleTalkGateway {
         }
       }
 
-      this.ws.send(chunk.buffer);
+      this._sendAudio(chunk.buffer);
       console.log('[Gateway] PCM16 audio sent:', chunk.length, 'samples');
     }
   }
@@ -365,6 +503,8 @@ export class BubbleTalkGateway {
   disconnect() {
     console.log('[Gateway] Disconnecting...');
 
+    this.closedByUser = true;
+    clearTimeout(this._reconnectTimer);
     this.stopRecording();
 
     if (this.ws) {